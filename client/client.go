@@ -0,0 +1,158 @@
+// Package client is a Go client of the HTTP API served by `wham serve --listen`,
+// through which other services trigger workflow runs and query the state of the
+// steps. The API is described by the OpenAPI specification of openapi.yaml, also
+// served by WHAM at /openapi.yaml.
+package client
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// OpenAPISpec is the OpenAPI specification of the API.
+//
+//go:embed openapi.yaml
+var OpenAPISpec []byte
+
+// defaultTimeout bounds the requests of a client created without an HTTP client.
+const defaultTimeout = 30 * time.Second
+
+// ErrNotFound is wrapped by the errors of the requests on a missing resource, e.g.
+// an unknown step.
+var ErrNotFound = errors.New("not found")
+
+// APIError is an error response of the API.
+type APIError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Message is the error reported by WHAM.
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("wham API error (%d): %s", e.StatusCode, e.Message)
+}
+
+// Unwrap returns ErrNotFound for a 404 response, so that errors.Is can test it.
+func (e *APIError) Unwrap() error {
+	if e.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Client calls the API of a WHAM scheduler.
+type Client struct {
+	baseURL string
+	http    *http.Client
+	token   string
+}
+
+// New returns a client of the API served at `baseURL` (e.g.,
+// "http://wham.internal:8080"). A nil `httpClient` is replaced by a client with
+// a 30 seconds timeout.
+func New(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: defaultTimeout}
+	}
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), http: httpClient}
+}
+
+// SetToken sets the bearer token sent with every request, required by a scheduler
+// started with --api-token.
+func (c *Client) SetToken(token string) {
+	c.token = token
+}
+
+// Status returns the status of the scheduler.
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	var status Status
+	if err := c.do(ctx, http.MethodGet, "/v1/status", &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// TriggerRun asks the scheduler to run the workflow as soon as possible, i.e.
+// right away or after the run in progress, and returns its status. It fails with
+// a 409 APIError if a triggered run is already pending.
+func (c *Client) TriggerRun(ctx context.Context) (*Status, error) {
+	var status Status
+	if err := c.do(ctx, http.MethodPost, "/v1/runs", &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// LastRun returns the last finished workflow run. It fails with an error wrapping
+// ErrNotFound if no run has finished yet.
+func (c *Client) LastRun(ctx context.Context) (*WorkflowRun, error) {
+	var run WorkflowRun
+	if err := c.do(ctx, http.MethodGet, "/v1/runs/last", &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// States returns the state of every step of the configuration, in configuration
+// order. A step that never ran has an empty RunAction.
+func (c *Client) States(ctx context.Context) ([]StepState, error) {
+	var states []StepState
+	if err := c.do(ctx, http.MethodGet, "/v1/states", &states); err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+// State returns the state of a step. It fails with an error wrapping ErrNotFound
+// if the step is not in the configuration.
+func (c *Client) State(ctx context.Context, step string) (*StepState, error) {
+	var state StepState
+	if err := c.do(ctx, http.MethodGet, "/v1/states/"+url.PathEscape(step), &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// do sends a request without body and decodes the JSON response into `out`. An
+// error response is returned as an *APIError.
+func (c *Client) do(ctx context.Context, method, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response of %s %s: %w", method, path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &apiErr) != nil || apiErr.Error == "" {
+			apiErr.Error = strings.TrimSpace(string(body))
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: apiErr.Error}
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse response of %s %s: %w", method, path, err)
+	}
+	return nil
+}
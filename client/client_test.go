@@ -0,0 +1,81 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+
+	"matiq.ai/wham/client"
+)
+
+// TestClient verifies that the client decodes the responses of the API, sends its
+// token, and reports its error responses as APIErrors.
+func TestClient(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/states/{step}", func(rw http.ResponseWriter, r *http.Request) {
+		if r.PathValue("step") != "load data" {
+			rw.WriteHeader(http.StatusNotFound)
+			rw.Write([]byte(`{"error":"step 'unknown' not found"}`))
+			return
+		}
+		rw.Write([]byte(`{"step_name":"load data","run_id":"abc","run_action":"run","elapsed":1500000000,"outputs":{"rows":"42"}}`))
+	})
+	mux.HandleFunc("POST /v1/runs", func(rw http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			rw.Write([]byte(`{"error":"missing or invalid bearer token"}`))
+			return
+		}
+		rw.WriteHeader(http.StatusAccepted)
+		rw.Write([]byte(`{"running":false,"trigger_pending":true,"runs":3}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	c := client.New(server.URL+"/", nil)
+
+	state, err := c.State(context.Background(), "load data")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "run", state.RunAction)
+		assert.Equal(t, "42", state.Outputs["rows"])
+		assert.Equal(t, "1.5s", state.Elapsed.String())
+	}
+
+	_, err = c.State(context.Background(), "unknown")
+	assert.ErrorIs(t, err, client.ErrNotFound)
+	var apiErr *client.APIError
+	if assert.True(t, errors.As(err, &apiErr)) {
+		assert.Equal(t, "step 'unknown' not found", apiErr.Message)
+	}
+
+	c.SetToken("s3cret")
+	status, err := c.TriggerRun(context.Background())
+	if assert.NoError(t, err) {
+		assert.True(t, status.TriggerPending)
+		assert.Equal(t, 3, status.Runs)
+	}
+}
+
+// TestOpenAPISpec verifies that the specification is valid YAML describing the
+// paths called by the client.
+func TestOpenAPISpec(t *testing.T) {
+	var spec struct {
+		OpenAPI string                    `yaml:"openapi"`
+		Paths   map[string]map[string]any `yaml:"paths"`
+	}
+	assert.NoError(t, yaml.Unmarshal(client.OpenAPISpec, &spec))
+	assert.NotEmpty(t, spec.OpenAPI)
+	for path, method := range map[string]string{
+		"/v1/status":        "get",
+		"/v1/runs":          "post",
+		"/v1/runs/last":     "get",
+		"/v1/states":        "get",
+		"/v1/states/{step}": "get",
+	} {
+		assert.Contains(t, spec.Paths[path], method, path)
+	}
+}
@@ -0,0 +1,76 @@
+package client
+
+import "time"
+
+// Status is the status of the scheduler of `wham serve`.
+type Status struct {
+	// Running is true while a workflow run is in progress.
+	Running bool `json:"running"`
+	// NextRunAt is when the next scheduled run is due. Zero while a run is in progress.
+	NextRunAt time.Time `json:"next_run_at"`
+	// TriggerPending is true if a run was triggered and has not started yet.
+	TriggerPending bool `json:"trigger_pending"`
+	// Runs is the number of runs executed since the scheduler started.
+	Runs int `json:"runs"`
+}
+
+// StepState is the WHAM state of a step: the outcome of its last execution.
+type StepState struct {
+	StepName string `json:"step_name"`
+	// RunID is the unique identifier of the execution state of the step.
+	RunID string `json:"run_id"`
+	// RunDate is when the state was recorded.
+	RunDate time.Time `json:"run_date"`
+	// RunIDDate is when the step's run_id last changed.
+	RunIDDate time.Time `json:"run_id_date"`
+	// RunAction is the outcome of the execution ("run", "skipped" or "failed"),
+	// or empty if the step has no state.
+	RunAction string `json:"run_action"`
+	// Reason explains why the step was not executed (e.g., "no_change") or why it
+	// failed (e.g., "timeout").
+	Reason string `json:"reason,omitempty"`
+	// FailureClass is the class of the failure, if it matched one of the step's
+	// failure_patterns.
+	FailureClass string `json:"failure_class,omitempty"`
+	// Elapsed is the duration of the step's execution.
+	Elapsed time.Duration `json:"elapsed"`
+	// Outputs are the custom key=value metrics reported by the step's script.
+	Outputs map[string]string `json:"outputs,omitempty"`
+	// Warnings describe the degradations of the execution that did not make it fail.
+	Warnings []string `json:"warnings,omitempty"`
+	// Watermark is the watermark of an incremental step.
+	Watermark string `json:"watermark,omitempty"`
+	// WorkflowRunID is the ID of the workflow run that recorded the state, if any.
+	WorkflowRunID string `json:"workflow_run_id,omitempty"`
+	// DryRun is true if the state was recorded by a staging run.
+	DryRun bool `json:"dry_run,omitempty"`
+	// WhamVersion is the version of the WHAM that recorded the state.
+	WhamVersion string `json:"wham_version,omitempty"`
+	// InputsHash is the hash of the step's inputs when it last succeeded.
+	InputsHash string `json:"inputs_hash,omitempty"`
+	// SchemaVersion is the version of the layout of the state, upgraded by WHAM to
+	// the one it writes.
+	SchemaVersion int `json:"schema_version"`
+}
+
+// WorkflowRun is the record of a `run all` invocation.
+type WorkflowRun struct {
+	// ID is the unique, time-sortable identifier of the workflow run.
+	ID string `json:"id"`
+	// Status is the outcome of the run ("succeeded" or "failed").
+	Status string `json:"status"`
+	// StartedAt is when the run started.
+	StartedAt time.Time `json:"started_at"`
+	// FinishedAt is when the run finished.
+	FinishedAt time.Time `json:"finished_at"`
+	// Elapsed is the total duration of the run.
+	Elapsed time.Duration `json:"elapsed"`
+	// ConfigFiles are the configuration files the run was started with.
+	ConfigFiles []string `json:"config_files"`
+	// ConfigDigest is a hash of the final, merged configuration used by the run.
+	ConfigDigest string `json:"config_digest"`
+	// RerunOf is the ID of the workflow run this run reproduces, if any.
+	RerunOf string `json:"rerun_of,omitempty"`
+	// Error is the error that halted the run, if any.
+	Error string `json:"error,omitempty"`
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+)
+
+// Cancel-related concrete command structs
+
+// CancelCmd handles the 'cancel' command.
+type CancelCmd struct {
+	Step    string        `arg:"" optional:"" help:"Name of a running step to cancel, instead of the whole run."`
+	PID     int           `help:"PID of the WHAM process to cancel, required if several are running." placeholder:"PID"`
+	Timeout time.Duration `help:"How long to wait for the cancelled run to finalize its state." default:"30s"`
+}
+
+// Cancel-related command implementations
+
+func (c *CancelCmd) Run(ctx *Context) error {
+	if c.PID < 0 {
+		return fmt.Errorf("--pid cannot be negative")
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("--timeout must be positive")
+	}
+	if c.Step != "" {
+		return ctx.WHAM.CancelStep(c.Step, c.PID)
+	}
+	return ctx.WHAM.CancelRun(c.PID, c.Timeout)
+}
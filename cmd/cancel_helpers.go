@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// cancelPollInterval is how often CancelRun checks whether the cancelled run is over.
+const cancelPollInterval = 100 * time.Millisecond
+
+// CancelRun cancels the run of a WHAM process running against the metadata
+// directory, as found through its inspection socket: the one with the given PID,
+// or the only one running if `pid` is 0.
+//
+// The process is sent SIGTERM, so that it aborts as if it had been interrupted:
+// its running steps are recorded as failed with the reason `interrupted`, and the
+// others as skipped with the reason `cancelled`. CancelRun then waits, up to
+// `timeout`, for the process to exit and for its workflow run record to be
+// finalized, and reports the status of the run.
+func (w *WHAM) CancelRun(pid int, timeout time.Duration) error {
+	running, err := w.queryRunningProcesses()
+	if err != nil {
+		return err
+	}
+	var target *RunProgress
+	for i := range running {
+		if pid == 0 || running[i].PID == pid {
+			if target != nil {
+				pids := make([]string, len(running))
+				for j, p := range running {
+					pids[j] = fmt.Sprint(p.PID)
+				}
+				return fmt.Errorf("several WHAM processes are running (PIDs %s): use --pid to choose one", strings.Join(pids, ", "))
+			}
+			target = &running[i]
+		}
+	}
+	if target == nil {
+		if pid != 0 {
+			return fmt.Errorf("no WHAM process with PID %d is running against '%s'", pid, w.config.WhamSettings.MetadataDir)
+		}
+		return fmt.Errorf("no WHAM process is running against '%s'", w.config.WhamSettings.MetadataDir)
+	}
+
+	fmt.Printf("🛑 Cancelling WHAM process %d (workflow run '%s')...\n", target.PID, orDash(target.WorkflowRunID))
+	w.logger.Info().Int("pid", target.PID).Str("workflow_run_id", target.WorkflowRunID).Msg("Sending SIGTERM to cancel the run.")
+	if err := syscall.Kill(target.PID, syscall.SIGTERM); err != nil {
+		return fmt.Errorf("failed to signal WHAM process %d: %w", target.PID, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		run, finalized := w.isRunFinalized(target)
+		if finalized {
+			if run == nil {
+				_, err := fmt.Printf("✅ WHAM process %d cancelled.\n", target.PID)
+				return err
+			}
+			_, err := fmt.Printf("✅ Workflow run '%s' cancelled, with status '%s': its state files are finalized.\n", run.ID, run.Status)
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("WHAM process %d did not finalize its state within %s", target.PID, timeout)
+		}
+		time.Sleep(cancelPollInterval)
+	}
+}
+
+// isRunFinalized reports whether a cancelled process has exited, and its workflow
+// run record, returned if any, is no longer "running".
+func (w *WHAM) isRunFinalized(target *RunProgress) (*WorkflowRun, bool) {
+	if isProcessRunning(target.PID) {
+		return nil, false
+	}
+	if target.WorkflowRunID == "" {
+		return nil, true // A single-step run has no workflow run record.
+	}
+	run, err := w.loadWorkflowRun(target.WorkflowRunID)
+	if err != nil {
+		// The process exited without finalizing the record (e.g., it was killed).
+		w.logger.Warn().Str("workflow_run_id", target.WorkflowRunID).Err(err).Msg("Could not load the record of the cancelled run.")
+		return nil, true
+	}
+	return run, run.Status != "running"
+}
+
+// CancelStep cancels the running script of a step in a WHAM process running
+// against the metadata directory, as found through its inspection socket: the one
+// with the given PID, or the only one running the step if `pid` is 0.
+//
+// Only the step is affected, not the run nor the process, which may be a daemon
+// (`wham serve`): its script is sent SIGTERM, then SIGKILL after the step's
+// `kill_grace_period` (10 seconds by default), and the attempt fails with the
+// reason `step_cancelled`. The step's failure policy then applies as for any
+// other failure: it is retried if it has retries left, and the run goes on if it
+// can fail.
+func (w *WHAM) CancelStep(step string, pid int) error {
+	running, err := w.queryRunningProcesses()
+	if err != nil {
+		return err
+	}
+	var candidates []RunProgress
+	for _, p := range running {
+		if (pid == 0 || p.PID == pid) && slices.Contains(p.CurrentSteps, step) {
+			candidates = append(candidates, p)
+		}
+	}
+	switch {
+	case len(candidates) == 0 && pid != 0:
+		return fmt.Errorf("step '%s' is not running in a WHAM process with PID %d against '%s'", step, pid, w.config.WhamSettings.MetadataDir)
+	case len(candidates) == 0:
+		return fmt.Errorf("step '%s' is not running in any WHAM process against '%s'", step, w.config.WhamSettings.MetadataDir)
+	case len(candidates) > 1:
+		pids := make([]string, len(candidates))
+		for i, p := range candidates {
+			pids[i] = fmt.Sprint(p.PID)
+		}
+		return fmt.Errorf("step '%s' is running in several WHAM processes (PIDs %s): use --pid to choose one", step, strings.Join(pids, ", "))
+	}
+	target := candidates[0]
+
+	w.logger.Info().Int("pid", target.PID).Str("step", step).Msg("Cancelling the step over the inspection socket.")
+	path := filepath.Join(w.getInspectionSocketsDir(), strconv.Itoa(target.PID)+".sock")
+	if err := cancelStepOverSocket(path, step); err != nil {
+		return fmt.Errorf("failed to cancel step '%s' in WHAM process %d: %w", step, target.PID, err)
+	}
+	_, err = fmt.Printf("🛑 Step '%s' cancelled in WHAM process %d (workflow run '%s'): its failure policy applies.\n", step, target.PID, orDash(target.WorkflowRunID))
+	return err
+}
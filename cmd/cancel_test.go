@@ -0,0 +1,89 @@
+package cmd_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCancel_RunningWorkflow verifies that `cancel` interrupts the workflow run in
+// progress, and returns once its state has been finalized.
+func TestCancel_RunningWorkflow(t *testing.T) {
+	const configPath = "../test/settings/settings_inspection.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "cancel")
+	assert.Error(t, err, "There should be nothing to cancel.")
+	assert.Contains(t, outputStr, "no WHAM process is running")
+
+	run := exec.Command(whamBinaryPath, "--config", configPath, "run", "all")
+	run.Env = append(os.Environ(), "NO_COLOR=true")
+	assert.NoError(t, run.Start())
+	t.Cleanup(func() { run.Process.Kill() })
+	socketPath := filepath.Join("../test/states/metadata/wham_sockets", strconv.Itoa(run.Process.Pid)+".sock")
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(socketPath)
+		return err == nil
+	}, 3*time.Second, 50*time.Millisecond, "The workflow should have started.")
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "cancel")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "cancelled, with status 'failed': its state files are finalized.")
+	assert.Error(t, run.Wait(), "The cancelled workflow should fail.")
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "status", "-o", "json")
+	assert.NoError(t, err)
+	var report TestStatusReport
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &report))
+	assert.Empty(t, report.Running)
+	if assert.NotNil(t, report.LastRun) {
+		assert.Equal(t, "failed", report.LastRun.Status)
+	}
+}
+
+// TestCancel_Step verifies that `cancel <step>` terminates only the named running
+// step, which fails according to its failure policy while the run goes on.
+func TestCancel_Step(t *testing.T) {
+	const configPath = "../test/settings/settings_cancel_step.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "cancel", "slow")
+	assert.Error(t, err, "There should be no step to cancel.")
+	assert.Contains(t, outputStr, "step 'slow' is not running in any WHAM process")
+
+	var runOutput bytes.Buffer
+	run := exec.Command(whamBinaryPath, "--config", configPath, "run", "all", "-o", "json")
+	run.Env = append(os.Environ(), "NO_COLOR=true")
+	run.Stdout, run.Stderr = &runOutput, &runOutput
+	assert.NoError(t, run.Start())
+	t.Cleanup(func() { run.Process.Kill() })
+	assert.Eventually(t, func() bool {
+		outputStr, err = runWhamCommand(t, "--config", configPath, "cancel", "slow")
+		return err == nil
+	}, 5*time.Second, 100*time.Millisecond, "The step should have been cancelled once running.")
+	assert.Contains(t, outputStr, "Step 'slow' cancelled in WHAM process")
+
+	assert.NoError(t, run.Wait(), "The step can fail, so the run should go on and succeed.")
+	assert.Contains(t, runOutput.String(), "cleaning up after cancellation", "The script should have been sent SIGTERM.")
+	// The logs before the summary contain brackets too.
+	_, summary, _ := strings.Cut(runOutput.String(), "Workflow execution finished.")
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, summary, &states)
+	statesMap := make(map[string]TestStepState)
+	for _, s := range states {
+		statesMap[s.StepName] = s
+	}
+	assert.Equal(t, "failed", statesMap["slow"].RunAction)
+	assert.Equal(t, "step_cancelled", statesMap["slow"].Reason)
+	assert.Equal(t, "run", statesMap["after_slow"].RunAction)
+}
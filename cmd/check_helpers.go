@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// CheckSpec defines the expectations of a data quality check step (`type: check`).
+//
+// A check step runs its command like any other step (e.g., a script or a SQL
+// client printing a single value) and the last non-empty line of its standard
+// output is taken as the observed value. The value is recorded as the `value`
+// output of the step and compared against the expectations below.
+type CheckSpec struct {
+	// NotNull requires the observed value to be present (not empty and not "null").
+	NotNull bool `yaml:"not_null,omitempty" json:"not_null,omitempty"`
+	// Min is the inclusive lower bound of the observed (numeric) value.
+	Min *float64 `yaml:"min,omitempty" json:"min,omitempty"`
+	// Max is the inclusive upper bound of the observed (numeric) value.
+	Max *float64 `yaml:"max,omitempty" json:"max,omitempty"`
+	// MaxChangePct is the maximum allowed change, in percent, of the observed value
+	// compared to the value recorded by the last successful run of the check (e.g.,
+	// 50 to flag a row count that halved or grew by more than half).
+	MaxChangePct *float64 `yaml:"max_change_pct,omitempty" json:"max_change_pct,omitempty"`
+	// Policy determines what happens when an expectation is not met: "fail" (default)
+	// treats the execution as failed, "warn" only prints a warning.
+	Policy string `yaml:"policy,omitempty" json:"policy,omitempty"`
+}
+
+// validate checks the expectations for semantic errors.
+func (c *CheckSpec) validate() error {
+	if c.Min != nil && c.Max != nil && *c.Min > *c.Max {
+		return fmt.Errorf("check min (%v) cannot be greater than max (%v)", *c.Min, *c.Max)
+	}
+	if c.MaxChangePct != nil && *c.MaxChangePct < 0 {
+		return fmt.Errorf("check max_change_pct cannot be negative")
+	}
+	switch c.Policy {
+	case "", "fail", "warn":
+	default:
+		return fmt.Errorf("check policy must be 'fail' or 'warn', got '%s'", c.Policy)
+	}
+	return nil
+}
+
+// evaluateCheck compares the value observed by a check step against its expectations.
+//
+// The observed value is extracted from the captured standard output and added to
+// the step's outputs as `value`, so that it is recorded in the state and can be
+// compared by the next runs. The previous value is taken from the last successful
+// run of the check (see checkBaseline).
+//
+// If an expectation is not met and the check's policy is "warn", a warning is
+// printed and recorded in the result, and nil is returned. Otherwise an error is returned so that the
+// execution is treated as failed.
+func (w *WHAM) evaluateCheck(step *Step, result *stepResult, prevState StepState) error {
+	if step.Type != StepTypeCheck || step.Check == nil {
+		return nil
+	}
+
+	value := lastNonEmptyLine(result.Stdout)
+	if result.Outputs == nil {
+		result.Outputs = make(map[string]string)
+	}
+	result.Outputs["value"] = value
+	w.logger.Debug().Str("step", step.Name).Str("value", value).Msg("Check observed value.")
+
+	var baseline *float64
+	if step.Check.MaxChangePct != nil {
+		baseline = w.checkBaseline(step.Name, prevState)
+	}
+	if err := step.Check.check(value, baseline); err != nil {
+		if step.Check.Policy == "warn" {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("check did not pass: %v", err))
+			fmt.Printf("⚠️ Check '%s' did not pass: %v\n", step.Name, err)
+			w.logger.Warn().Str("step", step.Name).Str("value", value).Err(err).Msg("Check failed, continuing as policy is 'warn'.")
+			return nil
+		}
+		return fmt.Errorf("check failed: %w", err)
+	}
+	return nil
+}
+
+// checkBaseline returns the value recorded by the last successful run of a check,
+// which `max_change_pct` compares against, or nil if it never succeeded. It is read
+// from the step's history, or from its current state `prevState` if it has no
+// history (e.g., `history_limit` is not set). Unlike the current state, the history
+// remembers it across failed runs, so that a check keeps failing on a value it
+// already rejected instead of taking it as the new baseline.
+func (w *WHAM) checkBaseline(stepName string, prevState StepState) *float64 {
+	history, err := w.loadStepHistory(stepName)
+	if err != nil {
+		w.logger.Warn().Str("step", stepName).Err(err).Msg("Could not read step history, comparing against the current state.")
+	}
+	if len(history) == 0 {
+		history = []StepState{prevState}
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].RunAction != "run" {
+			continue
+		}
+		if previous, err := strconv.ParseFloat(history[i].Outputs["value"], 64); err == nil {
+			return &previous
+		}
+	}
+	return nil
+}
+
+// check compares an observed value against the expectations, `baseline` being the
+// value of the last successful run for `max_change_pct`. It returns an error
+// describing the first expectation that is not met, or nil if all of them are.
+func (c *CheckSpec) check(value string, baseline *float64) error {
+	isNull := value == "" || strings.EqualFold(value, "null")
+	if isNull {
+		if c.NotNull {
+			return fmt.Errorf("value is null")
+		}
+		return nil // Nothing else can be compared against a null value.
+	}
+
+	if c.Min == nil && c.Max == nil && c.MaxChangePct == nil {
+		return nil // Only non-null expectations, which have been met.
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("value '%s' is not a number", value)
+	}
+	if c.Min != nil && number < *c.Min {
+		return fmt.Errorf("value %v is below the minimum of %v", number, *c.Min)
+	}
+	if c.Max != nil && number > *c.Max {
+		return fmt.Errorf("value %v is above the maximum of %v", number, *c.Max)
+	}
+
+	if c.MaxChangePct != nil && baseline != nil {
+		previous := *baseline
+		var changePct float64
+		switch {
+		case previous != 0:
+			changePct = math.Abs(number-previous) / math.Abs(previous) * 100
+		case number != 0:
+			changePct = math.Inf(1)
+		}
+		if changePct > *c.MaxChangePct {
+			return fmt.Errorf("value %v changed by %.1f%% from the last successful run's %v, more than the allowed %v%%", number, changePct, previous, *c.MaxChangePct)
+		}
+	}
+	return nil
+}
+
+// lastNonEmptyLine returns the last non-empty line of the given text, trimmed.
+func lastNonEmptyLine(text string) string {
+	lines := strings.Split(text, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if line := strings.TrimSpace(lines[i]); line != "" {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,16 @@
+package cmd
+
+// Clean-related concrete command structs
+
+// CleanCmd handles the 'clean' command.
+type CleanCmd struct {
+	DryRun     bool `help:"List the outputs past their retention without deleting them."`
+	NoTruncate bool `help:"Wrap long cells across lines instead of truncating them."`
+}
+
+// Clean-related command implementations
+
+func (c *CleanCmd) Run(ctx *Context) error {
+	ctx.WHAM.noTruncate = c.NoTruncate
+	return ctx.WHAM.ShowCleanOutputs(c.DryRun, ctx.OutputFormat)
+}
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CleanedOutput is an output file of a step past its `cleanup_outputs_after`
+// retention, as listed by `wham clean`.
+type CleanedOutput struct {
+	StepName string    `json:"step_name" yaml:"step_name"`
+	Path     string    `json:"path" yaml:"path"`
+	ModTime  time.Time `json:"mod_time" yaml:"mod_time"`
+	Size     int64     `json:"size" yaml:"size"`
+}
+
+// CleanOutputs deletes the output files of the steps with a `cleanup_outputs_after`
+// retention that were last modified before it, and returns them, in configuration
+// order then by path. With `dryRun`, the files are only returned.
+//
+// The outputs of a step are the files matching its `expected_outputs` and
+// `run_id_from_outputs`, relative to the config file's directory, so that their
+// retention is declared by the step that produces them rather than by external
+// cron scripts. Directories are left alone, as are the files of the metadata
+// directory, which hold the state of the workflow. A file that cannot be deleted
+// does not stop the cleanup: the errors are returned together at the end.
+func (w *WHAM) CleanOutputs(dryRun bool) ([]CleanedOutput, error) {
+	metadataDir := w.config.WhamSettings.MetadataDir
+	now := time.Now()
+	cleaned := []CleanedOutput{} // Render an empty list rather than null.
+	var problems []string
+	for i := range w.config.WhamSteps {
+		step := &w.config.WhamSteps[i]
+		if step.CleanupOutputsAfter == "" {
+			continue
+		}
+		retention, err := parseDurationOrDays(step.CleanupOutputsAfter)
+		if err != nil {
+			return cleaned, fmt.Errorf("invalid cleanup_outputs_after of step '%s': %w", step.Name, err)
+		}
+		cutoff := now.Add(-retention)
+
+		var expired []CleanedOutput
+		for _, path := range w.stepOutputFiles(step) {
+			if rel, err := filepath.Rel(metadataDir, path); err == nil && filepath.IsLocal(rel) {
+				w.logger.Warn().Str("step", step.Name).Str("path", path).Msg("Output in the metadata directory, not cleaned up.")
+				continue
+			}
+			info, err := os.Lstat(path)
+			if err != nil || !info.Mode().IsRegular() || !info.ModTime().Before(cutoff) {
+				continue
+			}
+			expired = append(expired, CleanedOutput{StepName: step.Name, Path: path, ModTime: info.ModTime(), Size: info.Size()})
+		}
+		sort.Slice(expired, func(a, b int) bool { return expired[a].Path < expired[b].Path })
+
+		for _, output := range expired {
+			if !dryRun {
+				if err := os.Remove(output.Path); err != nil && !os.IsNotExist(err) {
+					problems = append(problems, fmt.Sprintf("step '%s': %v", step.Name, err))
+					continue
+				}
+				w.logger.Info().Str("step", step.Name).Str("path", output.Path).Time("mod_time", output.ModTime).Msg("Output past its retention deleted.")
+			}
+			cleaned = append(cleaned, output)
+		}
+	}
+	if len(problems) > 0 {
+		return cleaned, fmt.Errorf("failed to delete outputs: %s", strings.Join(problems, "; "))
+	}
+	return cleaned, nil
+}
+
+// stepOutputFiles returns the resolved paths of the files matching the outputs
+// of a step, without duplicates. Invalid patterns are rejected by the validation
+// of the step, and match nothing here.
+func (w *WHAM) stepOutputFiles(step *Step) []string {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, pattern := range append(append([]string{}, step.ExpectedOutputs...), step.RunIDFromOutputs...) {
+		matches, _ := filepath.Glob(w.resolvePath(pattern))
+		for _, match := range matches {
+			if !seen[match] {
+				seen[match] = true
+				paths = append(paths, match)
+			}
+		}
+	}
+	return paths
+}
+
+// hasOutputRetention reports whether a step of the workflow has a
+// `cleanup_outputs_after` retention.
+func (w *WHAM) hasOutputRetention() bool {
+	for _, step := range w.config.WhamSteps {
+		if step.CleanupOutputsAfter != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// ShowCleanOutputs runs CleanOutputs and lists the files deleted, or that would be
+// with `dryRun`.
+func (w *WHAM) ShowCleanOutputs(dryRun bool, outputFormat string) error {
+	if !w.hasOutputRetention() {
+		fmt.Println("ℹ️ No step has a cleanup_outputs_after retention.")
+		return nil
+	}
+	cleaned, err := w.CleanOutputs(dryRun)
+	switch outputFormat {
+	case "json", "yaml":
+		if renderErr := RenderData(os.Stdout, cleaned, outputFormat); renderErr != nil {
+			return renderErr
+		}
+	case "table", "wide":
+		if renderErr := w.renderCleanedOutputs(cleaned, dryRun); renderErr != nil {
+			return renderErr
+		}
+	default:
+		return fmt.Errorf("unsupported output format: '%s'", outputFormat)
+	}
+	return err
+}
+
+// renderCleanedOutputs displays the files deleted by CleanOutputs, or a message if
+// there is none.
+func (w *WHAM) renderCleanedOutputs(cleaned []CleanedOutput, dryRun bool) error {
+	if len(cleaned) == 0 {
+		_, err := fmt.Println("✅ No output is past its retention.")
+		return err
+	}
+	verb := "Deleted"
+	if dryRun {
+		verb = "Would delete"
+	}
+	if _, err := fmt.Printf("🧹 %s %d output file(s) past their retention.\n", verb, len(cleaned)); err != nil {
+		return err
+	}
+	tr := NewTableRenderer(os.Stdout, "STEP", "MODIFIED", "SIZE", "PATH")
+	tr.SetWrap(w.noTruncate)
+	for _, output := range cleaned {
+		tr.AddRow(output.StepName, output.ModTime.Format(time.RFC3339), fmt.Sprintf("%d", output.Size), output.Path)
+	}
+	return tr.Render()
+}
+
+// cleanScheduledOutputs runs CleanOutputs after a run of the scheduler, if a step
+// has a retention. Its errors are logged, as they must not stop the scheduler.
+func (w *WHAM) cleanScheduledOutputs() {
+	if !w.hasOutputRetention() {
+		return
+	}
+	cleaned, err := w.CleanOutputs(false)
+	if len(cleaned) > 0 {
+		fmt.Printf("🧹 Deleted %d output file(s) past their retention.\n", len(cleaned))
+	}
+	if err != nil {
+		w.logger.Warn().Err(err).Msg("Cleanup of the outputs past their retention failed.")
+	}
+}
@@ -0,0 +1,64 @@
+package cmd_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestClean_OutputsPastRetention verifies that `clean` deletes the outputs of the
+// steps last modified before their cleanup_outputs_after retention, and only
+// those, and that --dry-run only lists them.
+func TestClean_OutputsPastRetention(t *testing.T) {
+	const configPath = "../test/settings/settings_cleanup_outputs.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.NoError(t, err, outputStr)
+
+	dataDir := "../test/states/data"
+	oldExport := filepath.Join(dataDir, "exports", "old.csv")
+	assert.NoError(t, os.WriteFile(oldExport, []byte("old"), 0644))
+	age := func(path string, by time.Duration) {
+		then := time.Now().Add(-by)
+		assert.NoError(t, os.Chtimes(path, then, then))
+	}
+	age(oldExport, 8*24*time.Hour)
+	age(filepath.Join(dataDir, "report.txt"), 48*time.Hour)
+	age(filepath.Join(dataDir, "archive.txt"), 30*24*time.Hour)
+	recentExports, err := filepath.Glob(filepath.Join(dataDir, "exports", "1*.csv"))
+	assert.NoError(t, err)
+	assert.Len(t, recentExports, 1)
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "clean", "--dry-run", "-o", "json")
+	assert.NoError(t, err, outputStr)
+	var cleaned []struct {
+		StepName string `json:"step_name"`
+		Path     string `json:"path"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &cleaned))
+	if assert.Len(t, cleaned, 2) {
+		assert.Equal(t, "export", cleaned[0].StepName)
+		assert.Equal(t, "old.csv", filepath.Base(cleaned[0].Path))
+		assert.Equal(t, "report", cleaned[1].StepName)
+		assert.Equal(t, "report.txt", filepath.Base(cleaned[1].Path))
+	}
+	assert.FileExists(t, oldExport, "--dry-run should not delete anything.")
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "clean")
+	assert.NoError(t, err, outputStr)
+	assert.Contains(t, outputStr, "Deleted 2 output file(s) past their retention.")
+	assert.NoFileExists(t, oldExport)
+	assert.NoFileExists(t, filepath.Join(dataDir, "report.txt"))
+	assert.FileExists(t, recentExports[0], "Outputs within their retention should be kept.")
+	assert.FileExists(t, filepath.Join(dataDir, "archive.txt"), "Outputs of steps without retention should be kept.")
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "clean")
+	assert.NoError(t, err, outputStr)
+	assert.Contains(t, outputStr, "No output is past its retention.")
+}
@@ -2,40 +2,70 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"reflect"
+	"slices"
+	"strings"
+	"sync"
 	"text/template"
 	"time"
 
 	"dario.cat/mergo"
 	"github.com/alecthomas/kong"
 	"github.com/rs/zerolog"
-	"gopkg.in/yaml.v3"
 )
 
 // CLI defines the command-line interface structure using kong.
 type CLI struct {
 	// Config is the path to one or more WHAM configuration files. Later files override earlier ones.
-	Config []string `help:"WHAM config file(s). Later files override earlier ones." default:"settings.yaml" short:"c"`
+	// If neither the flag nor WHAM_CONFIG is set, the file is discovered (see DiscoverConfig).
+	Config []string `help:"WHAM config file(s). Later files override earlier ones. Defaults to the first of ./wham.yaml, ./settings.yaml, $XDG_CONFIG_HOME/wham/config.yaml and /etc/wham/config.yaml that exists." short:"c" env:"WHAM_CONFIG"`
 	// Debug enables verbose debug logging.
 	Debug bool `help:"Enable debug logging" short:"d"`
+	// DataDir, if set, overrides the data_dir setting of the configuration.
+	DataDir string `help:"Data directory, overriding the data_dir setting." type:"path" env:"WHAM_DATA_DIR"`
+	// MetadataDir, if set, overrides the metadata_dir setting of the configuration.
+	MetadataDir string `help:"Metadata directory, overriding the metadata_dir setting." type:"path" env:"WHAM_METADATA_DIR"`
+	// Project, if set, selects the configuration files and the directories of a
+	// project of the projects registry (see LoadProjectRegistry).
+	Project string `help:"Project of the projects registry whose configuration files and directories to use, instead of --config." env:"WHAM_PROJECT"`
+	// ProjectsFile is the path of the projects registry.
+	ProjectsFile string `help:"Projects registry file. Defaults to the first of $XDG_CONFIG_HOME/wham/projects.yaml and /etc/wham/projects.yaml that exists." type:"path" env:"WHAM_PROJECTS_FILE"`
+	// ConfigCache reuses the configuration cached in the metadata directory while the files are unchanged.
+	ConfigCache bool `help:"Reuse the configuration and DAG cached in the metadata directory while the configuration files are unchanged." env:"WHAM_CONFIG_CACHE"`
+	// EphemeralState keeps all state in a temporary metadata directory, discarded at exit.
+	EphemeralState bool `help:"Use a temporary metadata directory, discarded at exit, instead of the configured one."`
+	// NonInteractive disables all prompts, which then take their safe default answer.
+	NonInteractive bool `help:"Never prompt for confirmation; act as if the safe default was answered (e.g. 'no' to deletions without --yes)." env:"WHAM_NON_INTERACTIVE"`
 	// Output format for commands that support it.
-	Output string `help:"Output format (table, json, yaml)." short:"o" default:"table"`
+	Output string `help:"Output format (table, wide, json, yaml)." short:"o" default:"table"`
 
 	// Canonical commands (object-verb)
-	Step      StepCmd   `cmd:"" help:"Manage and execute workflow steps."`
-	State     StateCmd  `cmd:"" help:"Manage the state of steps."`
-	DAG       DAGCmd    `cmd:"" help:"Interact with the workflow's DAG."`
-	ConfigCmd ConfigCmd `cmd:"" help:"Inspect the configuration." name:"config"`
+	Step       StepCmd    `cmd:"" help:"Manage and execute workflow steps."`
+	State      StateCmd   `cmd:"" help:"Manage the state of steps."`
+	DAG        DAGCmd     `cmd:"" help:"Interact with the workflow's DAG."`
+	ConfigCmd  ConfigCmd  `cmd:"" help:"Inspect the configuration." name:"config"`
+	DebugCmd   DebugCmd   `cmd:"" help:"Troubleshoot WHAM." name:"debug"`
+	ProjectCmd ProjectCmd `cmd:"" help:"Inspect the projects registry." name:"project"`
 
 	// Shortcuts for primary actions
-	Run      RunStepCmd      `cmd:"" help:"Run a step or all steps. Use --force to ignore state." name:"run"`
-	Validate ValidateStepCmd `cmd:"" help:"Validate a step or all steps (shortcut for 'step validate')." name:"validate"`
-	Get      GetStepCmd      `cmd:"" help:"Get a step's configuration (shortcut for 'step get')." name:"get"`
-	Describe DescribeStepCmd `cmd:"" help:"Describe a step's configuration and state (shortcut for 'step describe')." name:"describe"`
-	Version  VersionCmd      `cmd:"" help:"Show WHAM! version information."`
+	Run         RunStepCmd       `cmd:"" help:"Run a step or all steps. Use --force to ignore state." name:"run"`
+	Validate    ValidateStepCmd  `cmd:"" help:"Validate a step or all steps (shortcut for 'step validate')." name:"validate"`
+	Get         GetStepCmd       `cmd:"" help:"Get a step's configuration (shortcut for 'step get')." name:"get"`
+	Describe    DescribeStepCmd  `cmd:"" help:"Describe a step's configuration and state (shortcut for 'step describe')." name:"describe"`
+	Rerun       RerunWorkflowCmd `cmd:"" help:"Re-execute a historical workflow run with the same parameters." name:"rerun"`
+	Status      StatusCmd        `cmd:"" help:"Show an operational snapshot of the workflow."`
+	Serve       ServeCmd         `cmd:"" help:"Run the workflow on a cron schedule as a long-lived process."`
+	Operator    OperatorCmd      `cmd:"" help:"Run the Workflow resources of a Kubernetes cluster on their schedules."`
+	Fleet       FleetCmd         `cmd:"" help:"Show the status of several workflows, each with its own configuration."`
+	Cancel      CancelCmd        `cmd:"" help:"Cancel the run of a WHAM process in progress, or only one of its running steps."`
+	Clean       CleanCmd         `cmd:"" help:"Delete the outputs of the steps past their cleanup_outputs_after retention."`
+	Systemd     SystemdCmd       `cmd:"" help:"Install systemd units running the workflow on its schedule." name:"install-systemd"`
+	StateHelper StateHelperCmd   `cmd:"" help:"Report the state of a stateful step from within its script." name:"state-helper"`
+	Version     VersionCmd       `cmd:"" help:"Show WHAM! version information."`
 }
 
 // CLI Methods
@@ -67,24 +97,222 @@ type WhamSettings struct {
 	MetadataAddDepth bool `yaml:"metadata_add_depth" json:"metadata_add_depth"`
 	// MetadataDepthPadding is the number of digits for zero-padding the depth in filenames.
 	MetadataDepthPadding int `yaml:"metadata_depth_padding" json:"metadata_depth_padding"`
+	// StateBackend, if set, is where the WHAM states of the steps are kept instead
+	// of the metadata directory. See StateStore.
+	StateBackend *StateBackendSettings `yaml:"state_backend,omitempty" json:"state_backend,omitempty"`
+	// HistoryLimit, if positive, is the number of WHAM states kept in the history of
+	// each step, the current one included. See saveStepHistory.
+	HistoryLimit int `yaml:"history_limit,omitempty" json:"history_limit,omitempty"`
+	// MinVersion, if set, is the oldest WHAM release that may load the
+	// configuration. See checkMinVersion.
+	MinVersion string `yaml:"min_version,omitempty" json:"min_version,omitempty"`
+	// EnvFiles are dotenv files whose variables are set for every step, before the
+	// step's own env_files. Paths are relative to the config file's directory.
+	EnvFiles []string `yaml:"env_files,omitempty" json:"env_files,omitempty"`
 	// sharedArgs are command-line parameters to be passed to every step script.
 	SharedArgs []string `yaml:"shared_args" json:"shared_args"`
+	// Maintenance, if true, puts the workflow in maintenance mode: steps are skipped
+	// unless forced.
+	Maintenance bool `yaml:"maintenance,omitempty" json:"maintenance,omitempty"`
+	// Notifications, if set, enables the notifications sent when steps fail or recover.
+	Notifications *NotificationSettings `yaml:"notifications,omitempty" json:"notifications,omitempty"`
+	// FailurePatterns classify the failures of every step, after the step's own
+	// failure_patterns. See FailurePattern.
+	FailurePatterns []FailurePattern `yaml:"failure_patterns,omitempty" json:"failure_patterns,omitempty"`
+	// LocksDir, if set, is the directory holding the files of the steps' named locks.
+	// Defaults to a directory shared by all the WHAM processes of the host.
+	LocksDir string `yaml:"locks_dir,omitempty" json:"locks_dir,omitempty"`
+	// HostGuards, if set, holds steps back while the host is too busy. See
+	// waitForHostGuards.
+	HostGuards *HostGuardSettings `yaml:"host_guards,omitempty" json:"host_guards,omitempty"`
+	// DeleteBackupDir, if set, is the directory where `state delete` moves the
+	// states it deletes, as with --backup. See deleteBackupDir.
+	DeleteBackupDir string `yaml:"delete_backup_dir,omitempty" json:"delete_backup_dir,omitempty"`
+	// WorkflowTimeout, if set, is the maximum duration of a `run all` invocation.
+	// It can be overridden with the --timeout flag.
+	WorkflowTimeout time.Duration `yaml:"workflow_timeout,omitempty" json:"workflow_timeout,omitempty"`
+	// SummaryGroupBy, if set to "depth", groups the steps of the state tables (such as
+	// the execution summary) by DAG depth, under headers with subtotal durations.
+	SummaryGroupBy string `yaml:"summary_group_by,omitempty" json:"summary_group_by,omitempty"`
+	// Schedule, if set, is the schedule on which `wham serve` runs the workflow.
+	Schedule *ScheduleSettings `yaml:"schedule,omitempty" json:"schedule,omitempty"`
+	// OnSuccess, if set, is run at the end of every `run all` invocation that succeeds.
+	OnSuccess *WorkflowHandler `yaml:"on_success,omitempty" json:"on_success,omitempty"`
+	// OnFailure, if set, is run at the end of every `run all` invocation that fails.
+	OnFailure *WorkflowHandler `yaml:"on_failure,omitempty" json:"on_failure,omitempty"`
 }
 
+// StateBackendSettings configures the store of the WHAM states of the steps.
+type StateBackendSettings struct {
+	// Type is the kind of store: "file" (the default), the files of the metadata
+	// directory, "s3", the objects of an S3-compatible bucket, or "postgres", the
+	// rows of a PostgreSQL table.
+	Type string `yaml:"type" json:"type"`
+	// Bucket is the bucket holding the states of an "s3" store.
+	Bucket string `yaml:"bucket,omitempty" json:"bucket,omitempty"`
+	// Prefix is prepended to the names of the state files to form their object keys
+	// (e.g., "nightly/").
+	Prefix string `yaml:"prefix,omitempty" json:"prefix,omitempty"`
+	// Region is the region of the bucket. Defaults to the AWS_REGION or
+	// AWS_DEFAULT_REGION environment variable, or else "us-east-1".
+	Region string `yaml:"region,omitempty" json:"region,omitempty"`
+	// Endpoint, if set, is the URL of an S3-compatible service (e.g., MinIO), which
+	// is sent path-style requests. Defaults to AWS S3.
+	Endpoint string `yaml:"endpoint,omitempty" json:"endpoint,omitempty"`
+	// DSN is the connection URL of a "postgres" store (e.g.,
+	// "postgres://wham@db:5432/ops?sslmode=require"). It is a template, so that its
+	// password can be read from the environment with `require_env`.
+	DSN string `yaml:"dsn,omitempty" json:"dsn,omitempty"`
+	// Table is the table holding the states of a "postgres" store, created if it
+	// does not exist. Defaults to "wham_step_states".
+	Table string `yaml:"table,omitempty" json:"table,omitempty"`
+	// Workflow is the name under which a "postgres" store records the states of the
+	// steps, so that several workflows can share a table. Defaults to the name of
+	// the configuration file, without its extension.
+	Workflow string `yaml:"workflow,omitempty" json:"workflow,omitempty"`
+}
+
+// ScheduleSettings defines when `wham serve` runs the workflow.
+type ScheduleSettings struct {
+	// Cron is the cron expression of the schedule (e.g., "0 3 * * *"). See parseCronSchedule.
+	Cron string `yaml:"cron" json:"cron"`
+	// TimeZone is the IANA time zone in which Cron is evaluated (e.g., "Europe/Paris").
+	// Defaults to the local time zone.
+	TimeZone string `yaml:"time_zone,omitempty" json:"time_zone,omitempty"`
+}
+
+// WorkflowHandler defines a command run at the end of a `run all` invocation
+// depending on its outcome, e.g. to clean up or to send an alert. It receives the
+// outcome and the execution summary of the run. See runWorkflowHandler.
+type WorkflowHandler struct {
+	// Command is the executable and its arguments. A path is relative to the config
+	// file's directory; a bare name is looked up on the PATH.
+	Command []string `yaml:"command" json:"command"`
+	// EnvVars are environment variables set for the command. Values are templates,
+	// which can reference the workflow run as `.Workflow`.
+	EnvVars map[string]string `yaml:"env_vars,omitempty" json:"env_vars,omitempty"`
+	// Timeout, if set, is the maximum duration of the command.
+	Timeout time.Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+// NotificationSettings configures the notifications sent when steps fail or recover.
+// See notifyStepOutcome.
+type NotificationSettings struct {
+	// WebhookURL is the URL notifications are posted to as JSON. It is a template,
+	// so it can be read from the environment with `require_env`.
+	WebhookURL string `yaml:"webhook_url" json:"webhook_url"`
+	// MaxPerHour is the maximum number of notifications sent per step in any hour.
+	// Defaults to 0 (unlimited).
+	MaxPerHour int `yaml:"max_per_hour,omitempty" json:"max_per_hour,omitempty"`
+	// Secret, if set, is the shared secret with which the payloads are signed
+	// (HMAC-SHA256, in the X-Wham-Signature-256 header). It is a template, like WebhookURL.
+	Secret string `yaml:"secret,omitempty" json:"secret,omitempty"`
+	// Retries is the number of times the delivery of a notification is retried
+	// after a network error or a 429 or 5xx response. Defaults to 0 (no retries).
+	Retries int `yaml:"retries,omitempty" json:"retries,omitempty"`
+	// RetryDelay is the delay before the first retry, doubled for each next one.
+	// Defaults to 1s.
+	RetryDelay time.Duration `yaml:"retry_delay,omitempty" json:"retry_delay,omitempty"`
+}
+
+// Supported step types.
+const (
+	// StepTypeCommand is the default step type, which runs a command.
+	StepTypeCommand = "command"
+	// StepTypeCheck is a data quality check, which runs a command and compares the
+	// value it prints against the expectations of its `check` block.
+	StepTypeCheck = "check"
+	// StepTypeDbt invokes dbt as described by its `dbt` block and derives the
+	// step's run_id and outputs from dbt's run_results.json artifact.
+	StepTypeDbt = "dbt"
+	// StepTypeFreshness observes the watermark of an upstream source, as described
+	// by its `freshness` block, and uses it as the step's run_id.
+	StepTypeFreshness = "freshness"
+	// StepTypeWorkflow runs the DAG of another WHAM configuration, referenced by its
+	// `workflow` field, and aggregates the states of its steps.
+	StepTypeWorkflow = "workflow"
+)
+
 // Step defines a single executable unit in the workflow.
 type Step struct {
 	// Name is the unique identifier for the step.
 	Name string `yaml:"name" json:"name"`
+	// Extends, if set, is the name of the step template (see Config.StepTemplates)
+	// whose fields the step inherits, unless it sets them itself.
+	Extends string `yaml:"extends,omitempty" json:"extends,omitempty"`
+	// Type is the kind of step ("command", "check", "dbt" or "freshness"). Defaults to "command".
+	Type string `yaml:"type,omitempty" json:"type,omitempty"`
+	// Owner is the team or person responsible for the step (e.g., "team-data").
+	Owner string `yaml:"owner,omitempty" json:"owner,omitempty"`
+	// Tags are free-form labels of the step (e.g., "etl"). With Owner, they select
+	// steps in bulk (see StepSelector).
+	Tags []string `yaml:"tags,omitempty" json:"tags,omitempty"`
 	// Command is the path to the executable script for this step. Can be relative to the config file.
+	// For dbt steps, it is optional and defaults to the `dbt` executable found on the PATH.
 	Command []string `yaml:"command" json:"command"`
 	// Args are the command-line parameters specific to this step.
 	Args []string `yaml:"args" json:"args"`
 	// EnvVars is a list of environment variables to be set for the script's execution.
 	EnvVars map[string]string `yaml:"env_vars" json:"env_vars"`
+	// EnvFiles are dotenv files whose variables are set for the script's execution,
+	// after those of the settings' env_files and before the connection and EnvVars.
+	EnvFiles []string `yaml:"env_files,omitempty" json:"env_files,omitempty"`
+	// Connection is the name of an entry of the `connections` section whose environment
+	// variables are injected into the script's execution, before the step's own EnvVars.
+	Connection string `yaml:"connection,omitempty" json:"connection,omitempty"`
 	// Retries is the number of times to retry a failed script. Defaults to 0 (no retries).
 	Retries int `yaml:"retries" json:"retries"`
 	// RetryDelay is the duration to wait between retries (e.g., "5s", "1m").
 	RetryDelay time.Duration `yaml:"retry_delay" json:"retry_delay"`
+	// FailurePatterns classify the failures of the step from its standard error, and
+	// decide whether they are retried and notified. See FailurePattern.
+	FailurePatterns []FailurePattern `yaml:"failure_patterns,omitempty" json:"failure_patterns,omitempty"`
+	// Timeout, if set, is the maximum duration of each execution attempt (e.g., "30m").
+	// When it elapses, the script and all the processes it spawned are killed.
+	Timeout time.Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	// KillGracePeriod, if set, is how long a script that timed out or was cancelled
+	// is given to exit after SIGTERM, e.g. to flush its state file, before it is
+	// killed with SIGKILL. By default, a script that timed out is killed at once.
+	KillGracePeriod time.Duration `yaml:"kill_grace_period,omitempty" json:"kill_grace_period,omitempty"`
+	// SuccessExitCodes are the exit codes of the script that mean success. Defaults to [0].
+	SuccessExitCodes []int `yaml:"success_exit_codes,omitempty" json:"success_exit_codes,omitempty"`
+	// WarningExitCodes are the exit codes of the script that mean success with a warning.
+	WarningExitCodes []int `yaml:"warning_exit_codes,omitempty" json:"warning_exit_codes,omitempty"`
+	// TTY, if true, runs the script under a pseudo-terminal, for tools that behave
+	// differently without one. Its stdout and stderr are then merged.
+	TTY bool `yaml:"tty,omitempty" json:"tty,omitempty"`
+	// ScratchDir, if set, gives each attempt of the step a private temporary
+	// directory, removed after it. See createScratchDir.
+	ScratchDir *ScratchDirSpec `yaml:"scratch_dir,omitempty" json:"scratch_dir,omitempty"`
+	// IgnoreHostGuards, if true, starts the step without waiting for the host guards
+	// of the settings, e.g. for a light step. See waitForHostGuards.
+	IgnoreHostGuards bool `yaml:"ignore_host_guards,omitempty" json:"ignore_host_guards,omitempty"`
+	// RunAsUser, if set, is the user (name or numeric ID) the step's command and hooks
+	// run as, so that a privileged WHAM can drop privileges per step. See resolveRunAs.
+	RunAsUser string `yaml:"run_as_user,omitempty" json:"run_as_user,omitempty"`
+	// RunAsGroup, if set, is the group (name or numeric ID) the step's command and
+	// hooks run as. Defaults to the primary group of RunAsUser.
+	RunAsGroup string `yaml:"run_as_group,omitempty" json:"run_as_group,omitempty"`
+	// LogLevel is the verbosity of the step in the combined output: "debug", "info"
+	// (default) or "quiet". See the LogLevel* constants.
+	LogLevel string `yaml:"log_level,omitempty" json:"log_level,omitempty"`
+	// Before lists commands run before the step's command, in order, with the same
+	// environment and working directory. If one fails, the command is not run.
+	Before [][]string `yaml:"before,omitempty" json:"before,omitempty"`
+	// After lists commands run after the step's command, in order, even if it failed.
+	After [][]string `yaml:"after,omitempty" json:"after,omitempty"`
+	// BeforeRetry lists commands run before each retry of the step, i.e. between
+	// failed attempts, to repair what the failed attempt left behind (e.g., clear
+	// a partially loaded table). If one fails, the retry fails without running.
+	BeforeRetry [][]string `yaml:"before_retry,omitempty" json:"before_retry,omitempty"`
+	// Disabled, if true, causes the step to be skipped unless forced.
+	Disabled bool `yaml:"disabled,omitempty" json:"disabled,omitempty"`
+	// DryRun, if true, always runs the step with the dry-run marker, as `run --staging`
+	// does for every step (see dryRunMarked), e.g. while it is being rolled out.
+	DryRun bool `yaml:"dry_run,omitempty" json:"dry_run,omitempty"`
+	// When is a template that gates the execution of the step: it must render to a
+	// boolean, and the step is skipped unless forced if it renders to "false".
+	When string `yaml:"when,omitempty" json:"when,omitempty"`
 	// CanFail, if true, allows the workflow to continue even if this step fails.
 	CanFail bool `yaml:"can_fail" json:"can_fail"`
 	// IsStateful determines the step's behavior. A stateful step's state is determined
@@ -95,13 +323,90 @@ type Step struct {
 	StateFile string `yaml:"state_file" json:"state_file"`
 	// RunIdVar is the variable name inside the StateFile that holds the run ID.
 	RunIdVar string `yaml:"run_id_var" json:"run_id_var"`
+	// StateFiles lists the files of a stateful step that manages several logical datasets.
+	// It replaces StateFile and RunIdVar; the step's run_id is a hash of all of their run IDs.
+	StateFiles []StateFileSpec `yaml:"state_files,omitempty" json:"state_files,omitempty"`
+	// RunIDFromOutputs lists the files (or glob patterns) a stateful step produces,
+	// relative to the config file's directory. It replaces StateFile and RunIdVar:
+	// the step's run_id is a hash of their content. See outputsRunID.
+	RunIDFromOutputs []string `yaml:"run_id_from_outputs,omitempty" json:"run_id_from_outputs,omitempty"`
+	// Priority orders the steps of equal DAG depth: steps with a higher priority are
+	// started first, in serial and parallel runs alike. Defaults to 0.
+	Priority int `yaml:"priority,omitempty" json:"priority,omitempty"`
+	// ConcurrencyGroup, if set, names a resource shared with other steps (e.g., a
+	// database): steps of the same group never run simultaneously, even in parallel runs.
+	ConcurrencyGroup string `yaml:"concurrency_group,omitempty" json:"concurrency_group,omitempty"`
+	// Locks names the locks the step holds while it runs (e.g., "warehouse_write").
+	// Unlike concurrency groups, they are honored by all the WHAM processes of the
+	// host. See acquireStepLocks.
+	Locks []string `yaml:"locks,omitempty" json:"locks,omitempty"`
+	// Requires lists the binaries the step needs (e.g., "psql", "/usr/bin/aws" or
+	// "jq>=1.6"). They are checked by `validate` and before `run all` executes any
+	// step. See checkRequirements.
+	Requires []string `yaml:"requires,omitempty" json:"requires,omitempty"`
 	// PreviousSteps is a list of step names that must complete before this step can run.
 	PreviousSteps []string `yaml:"previous_steps" json:"previous_steps"`
+	// Inputs lists the files (or glob patterns) a stateless step reads, relative to
+	// the config file's directory. The step also runs when their content changed
+	// since its last successful execution, and only then if it has no predecessor
+	// to tell. See shouldRunStep.
+	Inputs []string `yaml:"inputs,omitempty" json:"inputs,omitempty"`
 	// WorkDir, if specified, sets the working directory for the script's execution.
 	// The path can be absolute or relative to the configuration file's directory.
 	WorkDir string `yaml:"work_dir,omitempty" json:"work_dir,omitempty"`
 	// Image specifies the container image to be used for this step in an orchestrated environment.
 	Image string `yaml:"image,omitempty" json:"image,omitempty"`
+	// SuccessCriteria is an expression over the step's outputs that must hold after a
+	// successful execution (e.g., "rows_processed > 0"). See parseSuccessCriteria.
+	SuccessCriteria string `yaml:"success_criteria,omitempty" json:"success_criteria,omitempty"`
+	// SuccessCriteriaPolicy determines what happens when the success criteria are not met:
+	// "fail" (default) treats the execution as failed, "warn" only prints a warning.
+	SuccessCriteriaPolicy string `yaml:"success_criteria_policy,omitempty" json:"success_criteria_policy,omitempty"`
+	// ExpectedOutputs are the files the step must produce, relative to the config
+	// file's directory. After a successful execution, each one must exist and have
+	// been written during the execution. See checkExpectedOutputs.
+	ExpectedOutputs []string `yaml:"expected_outputs,omitempty" json:"expected_outputs,omitempty"`
+	// ExpectedOutputsPolicy determines what happens when an expected output is missing
+	// or stale: "fail" (default) treats the execution as failed, "warn" only prints a warning.
+	ExpectedOutputsPolicy string `yaml:"expected_outputs_policy,omitempty" json:"expected_outputs_policy,omitempty"`
+	// CleanupOutputsAfter is the retention of the step's outputs, its
+	// `expected_outputs` and `run_id_from_outputs`, as a duration ("36h") or a
+	// number of days ("7d"). `wham clean` deletes the older ones. See CleanOutputs.
+	CleanupOutputsAfter string `yaml:"cleanup_outputs_after,omitempty" json:"cleanup_outputs_after,omitempty"`
+	// GeneratesSteps, if true, makes the step a generator: its standard output is a
+	// JSON list of step definitions, added to the DAG after a successful execution
+	// and run by `run all` right after it. See parseGeneratedSteps.
+	GeneratesSteps bool `yaml:"generates_steps,omitempty" json:"generates_steps,omitempty"`
+	// MustStartBy is the local time of day ("HH:MM") by which the step must have started.
+	// Starting it later puts its SLA at risk. See checkMustStartBy.
+	MustStartBy string `yaml:"must_start_by,omitempty" json:"must_start_by,omitempty"`
+	// MustStartByPolicy determines what happens when MustStartBy is missed: "warn"
+	// (default) only prints a warning, "fail" fails the step without executing it.
+	MustStartByPolicy string `yaml:"must_start_by_policy,omitempty" json:"must_start_by_policy,omitempty"`
+	// MaxFailureRate is the highest share of the step's executions that may fail over
+	// a sliding window, as "<rate> over <window>" (e.g., "0.2 over 7d"). Exceeding it
+	// raises an alert, even for a `can_fail` step. See checkFailureRate.
+	MaxFailureRate string `yaml:"max_failure_rate,omitempty" json:"max_failure_rate,omitempty"`
+	// WatermarkFromOutput is the name of an output of the step (e.g., "max_loaded_ts")
+	// recorded as its watermark, and exposed to its next executions as `.Watermark`.
+	WatermarkFromOutput string `yaml:"watermark_from_output,omitempty" json:"watermark_from_output,omitempty"`
+	// Check holds the expectations of a data quality check step (`type: check`).
+	Check *CheckSpec `yaml:"check,omitempty" json:"check,omitempty"`
+	// Dbt holds the invocation of a dbt step (`type: dbt`).
+	Dbt *DbtSpec `yaml:"dbt,omitempty" json:"dbt,omitempty"`
+	// Freshness holds the source observed by a freshness step (`type: freshness`).
+	Freshness *FreshnessSpec `yaml:"freshness,omitempty" json:"freshness,omitempty"`
+	// Workflow is the configuration file of the sub-workflow run by a workflow step
+	// (`type: workflow`), relative to the config file's directory.
+	Workflow string `yaml:"workflow,omitempty" json:"workflow,omitempty"`
+}
+
+// StateFileSpec defines one of the state files generated by a stateful step.
+type StateFileSpec struct {
+	// File is the name of the state file, located in MetadataDir.
+	File string `yaml:"file" json:"file"`
+	// RunIdVar is the variable name inside the File that holds its run ID.
+	RunIdVar string `yaml:"run_id_var" json:"run_id_var"`
 }
 
 // StepState represents the persisted state of a WHAM step execution.
@@ -110,19 +415,130 @@ type StepState struct {
 	RunID string `json:"run_id" yaml:"run_id"`
 	// RunDate is the timestamp of when the state was recorded.
 	RunDate time.Time `json:"run_date" yaml:"run_date"`
+	// RunIDDate is when the step's run_id last changed: it is carried over by the
+	// states recording the same run_id (see saveStepWhamState).
+	RunIDDate time.Time `json:"run_id_date" yaml:"run_id_date"`
 	// RunAction is the outcome of the execution ("run", "skipped", or "failed").
 	RunAction string `json:"run_action" yaml:"run_action"`
+	// Reason explains why the step was not executed (e.g., "no_change") or why it
+	// failed (e.g., "timeout"). See the Reason* constants.
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+	// FailureClass is the class of the failure, if it matched one of the step's
+	// failure_patterns.
+	FailureClass string `json:"failure_class,omitempty" yaml:"failure_class,omitempty"`
 	// Elapsed is the duration of the step's execution.
 	Elapsed time.Duration `json:"elapsed" yaml:"elapsed"`
+	// Outputs are the custom key=value metrics reported by the step's script
+	// (e.g., rows_processed) through the file named by VAR_OUTPUT_FILE.
+	Outputs map[string]string `json:"outputs,omitempty" yaml:"outputs,omitempty"`
+	// Warnings describe the degradations of the step's last execution that did not
+	// make it fail (e.g., a warning exit code or a missed must_start_by time).
+	Warnings []string `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+	// Watermark is the value of the output named by the step's watermark_from_output,
+	// as reported by its last successful execution that reported it. It is carried
+	// over by every other execution (see saveStepWhamState).
+	Watermark string `json:"watermark,omitempty" yaml:"watermark,omitempty"`
+	// WorkflowRunID is the ID of the workflow run that recorded the state, so that
+	// the states recorded by the same `run all` invocation can be correlated. It is
+	// empty for the states recorded outside of a workflow run (e.g., `run <step>`).
+	WorkflowRunID string `json:"workflow_run_id,omitempty" yaml:"workflow_run_id,omitempty"`
+	// DryRun is true if the state was recorded by an execution with the dry-run
+	// marker (see dryRunMarked), so that staging runs can be told apart from
+	// production ones.
+	DryRun bool `json:"dry_run,omitempty" yaml:"dry_run,omitempty"`
+	// WhamVersion is the version of the WHAM that recorded the state. An older
+	// release refuses to run the step (see checkStateVersions).
+	WhamVersion string `json:"wham_version,omitempty" yaml:"wham_version,omitempty"`
+	// InputsHash is the hash of the step's inputs when it last succeeded (see
+	// inputsHash). It is carried over by every other state (see saveStepWhamState).
+	InputsHash string `json:"inputs_hash,omitempty" yaml:"inputs_hash,omitempty"`
+	// SchemaVersion is the version of the layout of the state (see
+	// StateSchemaVersion). The states of an older layout are upgraded when read, and
+	// rewritten by `state migrate`; those of a newer one are refused.
+	SchemaVersion int `json:"schema_version" yaml:"schema_version"`
+}
+
+// Step log levels.
+const (
+	// LogLevelDebug shows the debug messages about the step, even without --debug.
+	LogLevelDebug = "debug"
+	// LogLevelInfo is the default verbosity.
+	LogLevelInfo = "info"
+	// LogLevelQuiet mutes the standard output of the step's script.
+	LogLevelQuiet = "quiet"
+)
+
+// Reasons recorded in StepState.Reason when a step is skipped or fails.
+const (
+	// ReasonNoChange means none of the step's predecessors and inputs changed since
+	// its last run.
+	ReasonNoChange = "no_change"
+	// ReasonPreconditionFailed means a predecessor was not in a valid state (e.g., never run).
+	ReasonPreconditionFailed = "precondition_failed"
+	// ReasonFilteredByFromTo means the step was left out of `run all` by --from/--to.
+	ReasonFilteredByFromTo = "filtered_by_from_to"
+	// ReasonNotInOnly means the step was left out of `run all` by --only.
+	ReasonNotInOnly = "not_in_only"
+	// ReasonExcludedBySkip means the step was excluded from `run all` by --skip.
+	ReasonExcludedBySkip = "excluded_by_skip"
+	// ReasonDisabled means the step, or one of its ancestors, is marked as `disabled`.
+	ReasonDisabled = "disabled"
+	// ReasonWhenFalse means the step's `when` condition evaluated to false.
+	ReasonWhenFalse = "when_false"
+	// ReasonMaintenance means the workflow is in maintenance mode.
+	ReasonMaintenance = "maintenance"
+	// ReasonCancelled means the workflow run was aborted (timed out or interrupted),
+	// or halted by a failing step, before the step could run.
+	ReasonCancelled = "cancelled"
+	// ReasonTimeout means the step failed because its execution exceeded its timeout.
+	ReasonTimeout = "timeout"
+	// ReasonWorkflowTimeout means the step was killed because the workflow run exceeded its timeout.
+	ReasonWorkflowTimeout = "workflow_timeout"
+	// ReasonInterrupted means the step was killed because WHAM received SIGINT or SIGTERM.
+	ReasonInterrupted = "interrupted"
+	// ReasonStepCancelled means the step was killed by `wham cancel <step>`.
+	ReasonStepCancelled = "step_cancelled"
+	// ReasonBeforeHookFailed means the step failed because one of its `before` hooks failed.
+	ReasonBeforeHookFailed = "before_hook_failed"
+	// ReasonBeforeRetryFailed means a retry of the step failed because one of its
+	// `before_retry` commands failed.
+	ReasonBeforeRetryFailed = "before_retry_failed"
+	// ReasonAfterHookFailed means the step failed because one of its `after` hooks failed.
+	ReasonAfterHookFailed = "after_hook_failed"
+	// ReasonStaleOutputs means the step succeeded without producing or updating one of
+	// its `expected_outputs`.
+	ReasonStaleOutputs = "stale_outputs"
+)
+
+// Connection defines a set of connection details (e.g., to a data warehouse) that
+// steps can reference by name instead of duplicating them in their env_vars.
+type Connection struct {
+	// EnvVars are the environment variables injected into the steps using the
+	// connection. Values are templates, so secrets can be referenced with
+	// `require_env` or `read_file` instead of being written in the config.
+	EnvVars map[string]string `yaml:"env_vars" json:"env_vars"`
 }
 
 // Config holds the entire application configuration, including settings and steps.
 type Config struct {
 	WhamSettings WhamSettings `yaml:"wham_settings" json:"wham_settings"`
 	WhamSteps    []Step       `yaml:"wham_steps" json:"wham_steps"`
+	// StepTemplates maps template names to partial step definitions, which steps
+	// inherit with `extends`. See applyStepTemplate.
+	StepTemplates map[string]Step `yaml:"step_templates,omitempty" json:"step_templates,omitempty"`
+	// Connections maps connection names to their details.
+	Connections map[string]Connection `yaml:"connections,omitempty" json:"connections,omitempty"`
 	// ConfigDir stores the absolute path of the directory containing the config file.
 	// This is resolved at load time and used as a base for all other relative paths.
 	ConfigDir string `json:"-"` // Exclude from JSON marshaling for tests
+	// ConfigFiles stores the paths of the configuration files, in load order.
+	ConfigFiles []string `json:"-" yaml:"-"`
+	// StepPositions stores where each step is defined in the configuration files,
+	// in load order, so that validation errors can point at the definition.
+	StepPositions map[string][]ConfigPosition `json:"-" yaml:"-"`
+	// cachedStepDepths stores the step depths of a configuration read from the
+	// config cache, which NewWHAM uses instead of computing them. See LoadCachedConfig.
+	cachedStepDepths map[string]int
 }
 
 // WHAM is the main engine for managing and executing workflow steps.
@@ -133,6 +549,39 @@ type WHAM struct {
 	stepsMap map[string]*Step
 	// stepDepths stores the calculated depth in the DAG for each step.
 	stepDepths map[string]int
+	// stateStore persists the WHAM states of the steps.
+	stateStore StateStore
+	// stepsMu guards stepsMap and stepDepths, which are replaced when steps are
+	// generated while other steps may be running (see addGeneratedSteps).
+	stepsMu sync.RWMutex
+	// generatedSteps are the steps generated by each generator step that `run all`
+	// has not scheduled yet (see takeGeneratedSteps).
+	generatedSteps map[string][]*Step
+	// generatedOrder are all the steps generated during the run, in generation order.
+	generatedOrder []*Step
+	// workflowChain holds the absolute paths of the configurations of the parent
+	// workflows of a sub-workflow, to detect the workflows including themselves.
+	workflowChain []string
+	// continueOnError is true while `run all --continue-on-error` runs, making every
+	// step behave as if it was marked with `can_fail: true` (see stepCanFail).
+	continueOnError bool
+	// staging is true while `run --staging` runs, exporting the dry-run marker to
+	// every step (see dryRunMarked).
+	staging bool
+	// noTruncate is true while a command runs with `--no-truncate`, wrapping the
+	// long cells of the validation, deletion and state tables instead of
+	// truncating them.
+	noTruncate bool
+	// activeRun is the workflow run in progress during `run all`, if any.
+	activeRun *WorkflowRun
+	// parentRunID is the ID of the workflow run of the parent workflow of a
+	// sub-workflow, whose steps belong to that run (see workflowRunID).
+	parentRunID string
+	// inspection serves the progress of the execution in flight, if any.
+	inspection *inspection
+	// runCtx is the context of the execution in progress, if any. It is cancelled
+	// when the execution is aborted. See startRunContext.
+	runCtx context.Context
 }
 
 // WHAM methods
@@ -145,6 +594,10 @@ type Context struct {
 	Logger zerolog.Logger
 	// OutputFormat holds the global output format for the current command execution.
 	OutputFormat string
+	// NonInteractive is true if commands must never prompt the user.
+	NonInteractive bool
+	// ProjectsFile is the projects registry given with --projects-file, if any.
+	ProjectsFile string
 }
 
 // NewWHAM creates and initializes a new WHAM instance.
@@ -155,13 +608,76 @@ func NewWHAM(config *Config, logger zerolog.Logger) (*WHAM, error) {
 	for i := range config.WhamSteps {
 		step := &config.WhamSteps[i]
 		if _, exists := stepsMap[step.Name]; exists {
-			return nil, fmt.Errorf("duplicate step name found in configuration: '%s'", step.Name)
+			return nil, fmt.Errorf("duplicate step name found in configuration: '%s'%s", step.Name, atPosition(config.stepPosition(step.Name)))
 		}
 		stepsMap[step.Name] = step
 
 		// Validate the semantic correctness of the step's definition.
 		if err := validateStepDefinition(step); err != nil {
-			return nil, fmt.Errorf("invalid configuration for step '%s': %w", step.Name, err)
+			return nil, fmt.Errorf("invalid configuration for step '%s'%s: %w", step.Name, atPosition(config.stepPosition(step.Name)), err)
+		}
+		if _, ok := config.Connections[step.Connection]; step.Connection != "" && !ok {
+			return nil, fmt.Errorf("invalid configuration for step '%s'%s: connection '%s' is not defined", step.Name, atPosition(config.stepPosition(step.Name)), step.Connection)
+		}
+	}
+
+	if config.WhamSettings.WorkflowTimeout < 0 {
+		return nil, fmt.Errorf("invalid settings: workflow_timeout cannot be negative")
+	}
+	if err := checkMinVersion(config.WhamSettings.MinVersion); err != nil {
+		return nil, err
+	}
+	if config.WhamSettings.HistoryLimit < 0 {
+		return nil, fmt.Errorf("invalid settings: history_limit cannot be negative")
+	}
+	switch config.WhamSettings.SummaryGroupBy {
+	case "", "none", "depth":
+	default:
+		return nil, fmt.Errorf("invalid settings: summary_group_by must be 'none' or 'depth', got '%s'", config.WhamSettings.SummaryGroupBy)
+	}
+	if sched := config.WhamSettings.Schedule; sched != nil {
+		if _, err := sched.location(); err != nil {
+			return nil, fmt.Errorf("invalid schedule settings: %w", err)
+		}
+		if sched.Cron != "" {
+			if _, err := sched.parse(sched.Cron); err != nil {
+				return nil, fmt.Errorf("invalid schedule settings: %w", err)
+			}
+		}
+	}
+	if slices.Contains(config.WhamSettings.EnvFiles, "") {
+		return nil, fmt.Errorf("invalid settings: env_files entries cannot be empty")
+	}
+	for i := range config.WhamSettings.FailurePatterns {
+		if err := config.WhamSettings.FailurePatterns[i].validate(); err != nil {
+			return nil, fmt.Errorf("invalid settings: %w", err)
+		}
+	}
+	for name, handler := range map[string]*WorkflowHandler{"on_success": config.WhamSettings.OnSuccess, "on_failure": config.WhamSettings.OnFailure} {
+		if handler == nil {
+			continue
+		}
+		if len(handler.Command) == 0 || handler.Command[0] == "" {
+			return nil, fmt.Errorf("invalid settings: %s command cannot be empty", name)
+		}
+		if handler.Timeout < 0 {
+			return nil, fmt.Errorf("invalid settings: %s timeout cannot be negative", name)
+		}
+	}
+	if g := config.WhamSettings.HostGuards; g != nil {
+		if err := g.validate(); err != nil {
+			return nil, fmt.Errorf("invalid host_guards settings: %w", err)
+		}
+	}
+	if n := config.WhamSettings.Notifications; n != nil {
+		if n.WebhookURL == "" {
+			return nil, fmt.Errorf("invalid notifications settings: 'webhook_url' cannot be empty")
+		}
+		if n.MaxPerHour < 0 {
+			return nil, fmt.Errorf("invalid notifications settings: max_per_hour cannot be negative")
+		}
+		if n.Retries < 0 || n.RetryDelay < 0 {
+			return nil, fmt.Errorf("invalid notifications settings: retries and retry_delay cannot be negative")
 		}
 	}
 
@@ -171,7 +687,16 @@ func NewWHAM(config *Config, logger zerolog.Logger) (*WHAM, error) {
 		stepsMap:   stepsMap,
 		stepDepths: make(map[string]int),
 	}
-	wham.calculateStepDepths() // Calculate depths on initialization
+	if config.cachedStepDepths != nil {
+		wham.stepDepths = config.cachedStepDepths
+	} else {
+		wham.calculateStepDepths() // Calculate depths on initialization
+	}
+	stateStore, err := wham.newStateStore()
+	if err != nil {
+		return nil, fmt.Errorf("invalid settings: %w", err)
+	}
+	wham.stateStore = stateStore
 	return wham, nil
 }
 
@@ -180,10 +705,40 @@ func validateStepDefinition(step *Step) error {
 	if step.Name == "" {
 		return fmt.Errorf("step name cannot be empty")
 	}
-	if len(step.Command) == 0 {
+	if len(step.Command) == 0 && step.Type != StepTypeDbt && step.Type != StepTypeFreshness && step.Type != StepTypeWorkflow {
 		return fmt.Errorf("command cannot be empty")
 	}
-	if step.IsStateful {
+	if len(step.StateFiles) > 0 {
+		if !step.IsStateful {
+			return fmt.Errorf("only stateful steps can have 'state_files' defined")
+		}
+		if step.StateFile != "" || step.RunIdVar != "" {
+			return fmt.Errorf("'state_files' cannot be combined with 'state_file' and 'run_id_var'")
+		}
+		if len(step.RunIDFromOutputs) > 0 {
+			return fmt.Errorf("'state_files' cannot be combined with 'run_id_from_outputs'")
+		}
+		for i, sf := range step.StateFiles {
+			if sf.File == "" || sf.RunIdVar == "" {
+				return fmt.Errorf("state_files entry #%d must have both 'file' and 'run_id_var' defined", i+1)
+			}
+		}
+	} else if len(step.RunIDFromOutputs) > 0 {
+		if !step.IsStateful {
+			return fmt.Errorf("only stateful steps can have 'run_id_from_outputs' defined")
+		}
+		if step.StateFile != "" || step.RunIdVar != "" {
+			return fmt.Errorf("'run_id_from_outputs' cannot be combined with 'state_file' and 'run_id_var'")
+		}
+		for _, pattern := range step.RunIDFromOutputs {
+			if pattern == "" {
+				return fmt.Errorf("run_id_from_outputs cannot contain an empty pattern")
+			}
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid run_id_from_outputs pattern '%s': %w", pattern, err)
+			}
+		}
+	} else if step.IsStateful {
 		if step.StateFile == "" {
 			return fmt.Errorf("stateful steps must have a 'state_file' defined")
 		}
@@ -197,6 +752,168 @@ func validateStepDefinition(step *Step) error {
 	if step.RetryDelay < 0 {
 		return fmt.Errorf("retry_delay cannot be negative")
 	}
+	if step.Timeout < 0 {
+		return fmt.Errorf("timeout cannot be negative")
+	}
+	if step.KillGracePeriod < 0 {
+		return fmt.Errorf("kill_grace_period cannot be negative")
+	}
+	if slices.Contains(step.EnvFiles, "") {
+		return fmt.Errorf("env_files entries cannot be empty")
+	}
+	for i := range step.FailurePatterns {
+		if err := step.FailurePatterns[i].validate(); err != nil {
+			return err
+		}
+	}
+	if step.ScratchDir != nil {
+		if err := step.ScratchDir.validate(); err != nil {
+			return fmt.Errorf("invalid scratch_dir: %w", err)
+		}
+	}
+	for _, hook := range slices.Concat(step.Before, step.After, step.BeforeRetry) {
+		if len(hook) == 0 || hook[0] == "" {
+			return fmt.Errorf("hook commands cannot be empty")
+		}
+	}
+	for _, code := range append(slices.Clone(step.SuccessExitCodes), step.WarningExitCodes...) {
+		if code < 0 || code > 255 {
+			return fmt.Errorf("exit codes must be between 0 and 255, got %d", code)
+		}
+	}
+	for _, code := range step.WarningExitCodes {
+		if slices.Contains(step.SuccessExitCodes, code) {
+			return fmt.Errorf("exit code %d cannot be in both success_exit_codes and warning_exit_codes", code)
+		}
+	}
+	if step.Check != nil && step.Type != StepTypeCheck {
+		return fmt.Errorf("a 'check' block is only allowed for steps of type '%s'", StepTypeCheck)
+	}
+	if step.Dbt != nil && step.Type != StepTypeDbt {
+		return fmt.Errorf("a 'dbt' block is only allowed for steps of type '%s'", StepTypeDbt)
+	}
+	if step.Freshness != nil && step.Type != StepTypeFreshness {
+		return fmt.Errorf("a 'freshness' block is only allowed for steps of type '%s'", StepTypeFreshness)
+	}
+	if step.Workflow != "" && step.Type != StepTypeWorkflow {
+		return fmt.Errorf("a 'workflow' is only allowed for steps of type '%s'", StepTypeWorkflow)
+	}
+	if step.GeneratesSteps && step.Type != "" && step.Type != StepTypeCommand {
+		return fmt.Errorf("only steps of type '%s' can generate steps", StepTypeCommand)
+	}
+	switch step.Type {
+	case "", StepTypeCommand:
+	case StepTypeCheck:
+		if step.Check == nil {
+			return fmt.Errorf("steps of type '%s' must have a 'check' block defined", StepTypeCheck)
+		}
+		if err := step.Check.validate(); err != nil {
+			return err
+		}
+	case StepTypeDbt:
+		if step.Dbt == nil {
+			return fmt.Errorf("steps of type '%s' must have a 'dbt' block defined", StepTypeDbt)
+		}
+		if step.IsStateful {
+			return fmt.Errorf("steps of type '%s' derive their run_id from dbt and cannot be stateful", StepTypeDbt)
+		}
+	case StepTypeFreshness:
+		if step.Freshness == nil {
+			return fmt.Errorf("steps of type '%s' must have a 'freshness' block defined", StepTypeFreshness)
+		}
+		if step.IsStateful {
+			return fmt.Errorf("steps of type '%s' derive their run_id from the watermark and cannot be stateful", StepTypeFreshness)
+		}
+		if err := step.Freshness.validate(step); err != nil {
+			return err
+		}
+	case StepTypeWorkflow:
+		if step.Workflow == "" {
+			return fmt.Errorf("steps of type '%s' must have a 'workflow' defined", StepTypeWorkflow)
+		}
+		if len(step.Command) > 0 || len(step.Before) > 0 || len(step.After) > 0 || len(step.BeforeRetry) > 0 {
+			return fmt.Errorf("steps of type '%s' run their sub-workflow and cannot have a command or hooks", StepTypeWorkflow)
+		}
+		if step.IsStateful {
+			return fmt.Errorf("steps of type '%s' derive their run_id from their sub-workflow and cannot be stateful", StepTypeWorkflow)
+		}
+	default:
+		return fmt.Errorf("unknown step type '%s'", step.Type)
+	}
+	if step.SuccessCriteria != "" {
+		if _, err := parseSuccessCriteria(step.SuccessCriteria); err != nil {
+			return err
+		}
+	}
+	switch step.SuccessCriteriaPolicy {
+	case "", "fail", "warn":
+	default:
+		return fmt.Errorf("success_criteria_policy must be 'fail' or 'warn', got '%s'", step.SuccessCriteriaPolicy)
+	}
+	if step.MustStartBy != "" {
+		if _, err := parseClockTime(step.MustStartBy); err != nil {
+			return fmt.Errorf("invalid must_start_by: %w", err)
+		}
+	}
+	if step.MaxFailureRate != "" {
+		if _, err := parseMaxFailureRate(step.MaxFailureRate); err != nil {
+			return err
+		}
+	}
+	for _, output := range step.ExpectedOutputs {
+		if strings.TrimSpace(output) == "" {
+			return fmt.Errorf("expected_outputs cannot contain an empty path")
+		}
+	}
+	if step.CleanupOutputsAfter != "" {
+		if len(step.ExpectedOutputs) == 0 && len(step.RunIDFromOutputs) == 0 {
+			return fmt.Errorf("cleanup_outputs_after requires the step to declare its outputs with expected_outputs or run_id_from_outputs")
+		}
+		if retention, err := parseDurationOrDays(step.CleanupOutputsAfter); err != nil || retention <= 0 {
+			return fmt.Errorf("invalid cleanup_outputs_after '%s': it must be a positive duration such as '36h' or '7d'", step.CleanupOutputsAfter)
+		}
+	}
+	if len(step.Inputs) > 0 && producesOwnRunID(step) {
+		return fmt.Errorf("only stateless steps can have 'inputs' defined")
+	}
+	for _, pattern := range step.Inputs {
+		if strings.TrimSpace(pattern) == "" {
+			return fmt.Errorf("inputs cannot contain an empty pattern")
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid inputs pattern '%s': %w", pattern, err)
+		}
+	}
+	for _, tag := range step.Tags {
+		if strings.TrimSpace(tag) == "" {
+			return fmt.Errorf("tags cannot contain an empty tag")
+		}
+	}
+	for _, lock := range step.Locks {
+		if !lockNamePattern.MatchString(lock) {
+			return fmt.Errorf("invalid lock name '%s': only letters, digits, '_', '-' and '.' are allowed", lock)
+		}
+	}
+	for _, entry := range step.Requires {
+		if _, err := parseRequirement(entry); err != nil {
+			return err
+		}
+	}
+	switch step.ExpectedOutputsPolicy {
+	case "", "fail", "warn":
+	default:
+		return fmt.Errorf("expected_outputs_policy must be 'fail' or 'warn', got '%s'", step.ExpectedOutputsPolicy)
+	}
+	switch step.MustStartByPolicy {
+	case "", "warn", "fail":
+	default:
+		return fmt.Errorf("must_start_by_policy must be 'warn' or 'fail', got '%s'", step.MustStartByPolicy)
+	}
+	switch step.LogLevel {
+	case "", LogLevelDebug, LogLevelInfo, LogLevelQuiet:
+	default:
+		return fmt.Errorf("log_level must be '%s', '%s' or '%s', got '%s'", LogLevelDebug, LogLevelInfo, LogLevelQuiet, step.LogLevel)
+	}
 	return nil
 }
 
@@ -205,6 +922,54 @@ func (w *WHAM) Config() *Config {
 	return w.config
 }
 
+// resolvePath makes a path absolute, using the configuration file's directory as
+// the base for relative paths.
+func (w *WHAM) resolvePath(path string) string {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(w.config.ConfigDir, path)
+	}
+	return filepath.Clean(path)
+}
+
+// configSearchPaths returns the paths where DiscoverConfig looks for a
+// configuration file, in order of precedence.
+func configSearchPaths() []string {
+	paths := []string{"wham.yaml", "settings.yaml"}
+	if dir := userConfigDir(); dir != "" {
+		paths = append(paths, filepath.Join(dir, "config.yaml"))
+	}
+	return append(paths, filepath.Join("/etc", "wham", "config.yaml"))
+}
+
+// userConfigDir returns the WHAM directory of the user's configuration files,
+// $XDG_CONFIG_HOME/wham (~/.config/wham if unset), or "" if there is none.
+func userConfigDir() string {
+	xdgConfigHome := os.Getenv("XDG_CONFIG_HOME")
+	if xdgConfigHome == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			xdgConfigHome = filepath.Join(home, ".config")
+		}
+	}
+	if xdgConfigHome == "" {
+		return ""
+	}
+	return filepath.Join(xdgConfigHome, "wham")
+}
+
+// DiscoverConfig returns the configuration file to use when none is given with
+// --config or WHAM_CONFIG: the first existing one of ./wham.yaml, ./settings.yaml
+// (the historical default), $XDG_CONFIG_HOME/wham/config.yaml (~/.config if unset)
+// and /etc/wham/config.yaml, so that a packaged binary works without flags.
+func DiscoverConfig() (string, error) {
+	paths := configSearchPaths()
+	for _, path := range paths {
+		if fileExists(path) {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no configuration file found in %s; use --config or WHAM_CONFIG", strings.Join(paths, ", "))
+}
+
 // LoadConfig reads, parses, and prepares the WHAM configuration from a YAML file.
 //
 // It performs three main actions:
@@ -227,7 +992,8 @@ func LoadConfig(configPaths ...string) (*Config, error) {
 		return nil, fmt.Errorf("failed to read base config file '%s': %w", configPaths[0], err)
 	}
 	var finalConfig Config
-	if err := yaml.Unmarshal(baseData, &finalConfig); err != nil {
+	positions := make(map[string][]ConfigPosition)
+	if err := decodeConfigFile(configPaths[0], baseData, &finalConfig, positions); err != nil {
 		return nil, fmt.Errorf("failed to parse YAML from base config '%s': %w", configPaths[0], err)
 	}
 
@@ -238,7 +1004,7 @@ func LoadConfig(configPaths ...string) (*Config, error) {
 			return nil, fmt.Errorf("failed to read override config file '%s': %w", path, err)
 		}
 		var overrideConfig Config
-		if err := yaml.Unmarshal(overrideData, &overrideConfig); err != nil {
+		if err := decodeConfigFile(path, overrideData, &overrideConfig, positions); err != nil {
 			return nil, fmt.Errorf("failed to parse YAML from override config '%s': %w", path, err)
 		}
 
@@ -259,6 +1025,13 @@ func LoadConfig(configPaths ...string) (*Config, error) {
 		return nil, fmt.Errorf("failed to get absolute directory of config file '%s': %w", configPaths[0], err)
 	}
 	config.ConfigDir = configDir
+	config.ConfigFiles = configPaths
+	config.StepPositions = positions
+
+	// Steps inherit the fields of the templates they extend, once all the files are merged.
+	if err := config.applyStepTemplates(); err != nil {
+		return nil, err
+	}
 
 	// IMPORTANT: Make the data_dir and metadata_dir paths absolute
 	// using ConfigDir as the base, which is the directory of the settings.yaml file.
@@ -323,12 +1096,66 @@ func (t stepSliceTransformer) Transformer(typ reflect.Type) func(dst, src reflec
 	return nil
 }
 
-// processTemplateString executes a Go template on a given string using runtime context.
+// templateListSeparator separates the items of a list rendered by a template (see
+// templateList), so that processTemplateArgs can expand it into several arguments.
+const templateListSeparator = "\x00"
+
+// templateList is a list returned by a template function (e.g., glob). It can be
+// iterated with `range` and measured with `len`; rendered as is, its items are
+// separated by templateListSeparator.
+type templateList []string
+
+// String renders the items of the list, separated by templateListSeparator.
+func (l templateList) String() string {
+	return strings.Join(l, templateListSeparator)
+}
+
+// processTemplateString executes a Go template on a given string using runtime
+// context. The items of a rendered list are separated by spaces.
 func (w *WHAM) processTemplateString(tplStr string, context TemplateContext) (string, error) {
+	rendered, err := w.executeTemplate(tplStr, context)
+	return strings.ReplaceAll(rendered, templateListSeparator, " "), err
+}
+
+// processTemplateArgs executes the Go template of a command-line argument, like
+// processTemplateString, and returns the resulting arguments: a rendered list, such
+// as `{{ glob "data/*.csv" }}`, expands into one argument per item, and an empty
+// result into no argument at all.
+func (w *WHAM) processTemplateArgs(tplStr string, context TemplateContext) ([]string, error) {
+	rendered, err := w.executeTemplate(tplStr, context)
+	if err != nil {
+		return nil, err
+	}
+	var args []string
+	for _, arg := range strings.Split(rendered, templateListSeparator) {
+		if arg != "" {
+			args = append(args, arg)
+		}
+	}
+	return args, nil
+}
+
+// executeTemplate executes a Go template on a given string using runtime context.
+func (w *WHAM) executeTemplate(tplStr string, context TemplateContext) (string, error) {
 	if tplStr == "" {
 		return "", nil
 	}
 
+	tmpl, err := w.parseTemplate(tplStr)
+	if err != nil {
+		return "", err
+	}
+
+	var processed bytes.Buffer
+	if err := tmpl.Execute(&processed, context); err != nil {
+		return "", fmt.Errorf("failed to execute parameter template: %w", err)
+	}
+	return processed.String(), nil
+}
+
+// parseTemplate parses a Go template with the functions available to the
+// templates of the configuration.
+func (w *WHAM) parseTemplate(tplStr string) (*template.Template, error) {
 	funcMap := template.FuncMap{
 		// getenv retrieves the value of the environment variable named by the key.
 		// It can optionally take a second argument as a default value.
@@ -357,16 +1184,37 @@ func (w *WHAM) processTemplateString(tplStr string, context TemplateContext) (st
 			}
 			return value, nil
 		},
+		// read_file returns the content of a file, without its trailing newline. It is
+		// meant for secrets mounted as files (e.g., Kubernetes or Docker secrets).
+		// Relative paths are resolved against the config file's directory.
+		// Usage: {{ read_file "/run/secrets/db_password" }}
+		"read_file": func(path string) (string, error) {
+			data, err := os.ReadFile(w.resolvePath(path))
+			if err != nil {
+				return "", fmt.Errorf("failed to read file '%s': %w", path, err)
+			}
+			return strings.TrimRight(string(data), "\r\n"), nil
+		},
+		// glob returns the absolute paths of the files matching a pattern, in lexical
+		// order. Relative patterns are resolved against the config file's directory.
+		// In `args`, the files expand into one argument each (see processTemplateArgs).
+		// Usage: {{ glob "data/incoming/*.csv" }}
+		"glob": func(pattern string) (templateList, error) {
+			matches, err := filepath.Glob(w.resolvePath(pattern))
+			if err != nil {
+				return nil, fmt.Errorf("invalid glob pattern '%s': %w", pattern, err)
+			}
+			return templateList(matches), nil
+		},
+		// lastSuccess returns the last successful execution of a step, from its
+		// history: it renders its date, and has the fields RunID and RunDate.
+		// Usage: {{ lastSuccess "extract" }} or {{ (lastSuccess "extract").RunID }}
+		"lastSuccess": w.lastSuccess,
 	}
 
 	tmpl, err := template.New("runtime_param").Funcs(funcMap).Parse(tplStr)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse parameter template: %w", err)
-	}
-
-	var processed bytes.Buffer
-	if err := tmpl.Execute(&processed, context); err != nil {
-		return "", fmt.Errorf("failed to execute parameter template: %w", err)
+		return nil, fmt.Errorf("failed to parse parameter template: %w", err)
 	}
-	return processed.String(), nil
+	return tmpl, nil
 }
@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// configCacheDir is the directory of the metadata directory holding the config
+// caches. It is not named after `metadata_prefix`, which is unknown until the
+// configuration is parsed.
+const configCacheDir = ".wham_config_cache"
+
+// metadataDirPattern finds the `metadata_dir` setting in the text of a
+// configuration file, without parsing it.
+var metadataDirPattern = regexp.MustCompile(`(?m)^[ \t]+metadata_dir:[ \t]*["']?([^"'#\r\n]*?)["']?[ \t]*(?:#.*)?$`)
+
+// configCacheEntry is the content of a config cache file.
+type configCacheEntry struct {
+	// Digest identifies the configuration files and the WHAM binary the entry was
+	// computed from (see configSourcesDigest).
+	Digest string `json:"digest"`
+	// Config is the configuration as returned by LoadConfig. Its fields excluded
+	// from JSON are stored apart, except ConfigFiles, set to the paths given.
+	Config        *Config                     `json:"config"`
+	ConfigDir     string                      `json:"config_dir"`
+	StepPositions map[string][]ConfigPosition `json:"step_positions"`
+	// StepDepths are the depths of the steps in the DAG.
+	StepDepths map[string]int `json:"step_depths"`
+}
+
+// LoadCachedConfig returns the configuration LoadConfig would return, reusing the
+// configuration and DAG cached in the metadata directory by a previous call while
+// the configuration files and the WHAM binary are unchanged, and caching them
+// otherwise. It reports whether the cache was used. `metadataDir`, if set,
+// overrides the `metadata_dir` of the configuration, as the --metadata-dir flag.
+//
+// Parsing a very large configuration dominates the startup of WHAM, e.g. for a
+// sensor run by cron every minute. The cache is a JSON file of
+// `<metadata_dir>/.wham_config_cache/`, named after the paths of the configuration
+// files, holding the digest of their content (see configSourcesDigest): any change
+// to one of them, or a new WHAM binary, invalidates it. As the metadata directory
+// is a setting of the configuration, the cache is looked up in the directory found
+// in the text of the files (see guessMetadataDir); a wrong guess only misses it.
+// A cache that cannot be read or written is ignored.
+func LoadCachedConfig(metadataDir string, configPaths ...string) (*Config, bool, error) {
+	digest, err := configSourcesDigest(configPaths)
+	if err != nil {
+		// The files cannot be read: LoadConfig reports it.
+		config, err := LoadConfig(configPaths...)
+		return config, false, err
+	}
+	name, err := configCacheFileName(configPaths)
+	if err != nil {
+		config, err := LoadConfig(configPaths...)
+		return config, false, err
+	}
+
+	lookupDir := metadataDir
+	if lookupDir == "" {
+		lookupDir = guessMetadataDir(configPaths)
+	}
+	if lookupDir != "" {
+		if config := readConfigCache(filepath.Join(lookupDir, configCacheDir, name), digest); config != nil {
+			config.ConfigFiles = configPaths
+			return config, true, nil
+		}
+	}
+
+	config, err := LoadConfig(configPaths...)
+	if err != nil {
+		return nil, false, err
+	}
+	if metadataDir == "" {
+		metadataDir = config.WhamSettings.MetadataDir
+	}
+	if depths := computeStepDepths(config); depths != nil {
+		writeConfigCache(filepath.Join(metadataDir, configCacheDir, name), configCacheEntry{
+			Digest: digest, Config: config, ConfigDir: config.ConfigDir, StepPositions: config.StepPositions, StepDepths: depths,
+		})
+	}
+	return config, false, nil
+}
+
+// computeStepDepths returns the step depths NewWHAM computes for a configuration,
+// or nil if its DAG has a cycle, which is then left for NewWHAM to report. The
+// configuration is not validated, as NewWHAM validates it on every invocation.
+func computeStepDepths(config *Config) map[string]int {
+	w := &WHAM{config: config, logger: zerolog.Nop(), stepsMap: make(map[string]*Step), stepDepths: make(map[string]int)}
+	for i := range config.WhamSteps {
+		w.stepsMap[config.WhamSteps[i].Name] = &config.WhamSteps[i]
+	}
+	if _, err := w.getTopologicalOrder(); err != nil {
+		return nil
+	}
+	w.calculateStepDepths()
+	return w.stepDepths
+}
+
+// readConfigCache returns the configuration of a cache file, or nil if the file
+// is missing, unreadable or was computed from other sources.
+func readConfigCache(path, digest string) *Config {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var entry configCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Digest != digest || entry.Config == nil {
+		return nil
+	}
+	config := entry.Config
+	config.ConfigDir, config.StepPositions = entry.ConfigDir, entry.StepPositions
+	config.cachedStepDepths = entry.StepDepths
+	return config
+}
+
+// writeConfigCache writes a cache file, atomically so that concurrent invocations
+// never read it half-written.
+func writeConfigCache(path string, entry configCacheEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	writeFileAtomically(path, data)
+}
+
+// configSourcesDigest returns the digest of everything a loaded configuration
+// depends on: the absolute paths and the content of the configuration files, and
+// the WHAM binary, identified by its version, path, size and modification time.
+func configSourcesDigest(configPaths []string) (string, error) {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "version=%s commit=%s\n", Version, Commit)
+	if executable, err := os.Executable(); err == nil {
+		if info, err := os.Stat(executable); err == nil {
+			fmt.Fprintf(hash, "binary=%s %d %d\n", executable, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	for _, path := range configPaths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return "", err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "file=%s %d\n", absPath, len(data))
+		hash.Write(data)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// configCacheFileName returns the name of the cache file of a set of configuration
+// files, so that each set has its own cache, replaced when the files change.
+func configCacheFileName(configPaths []string) (string, error) {
+	absPaths := make([]string, len(configPaths))
+	for i, path := range configPaths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return "", err
+		}
+		absPaths[i] = absPath
+	}
+	hash := sha256.Sum256([]byte(strings.Join(absPaths, "\n")))
+	return hex.EncodeToString(hash[:16]) + ".json", nil
+}
+
+// guessMetadataDir returns the `metadata_dir` set by the configuration files, the
+// last one setting it winning as with LoadConfig, found in their text without
+// parsing them, or "" if none sets it.
+func guessMetadataDir(configPaths []string) string {
+	dir := ""
+	for _, path := range configPaths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return ""
+		}
+		if matches := metadataDirPattern.FindAllSubmatch(data, -1); len(matches) > 0 {
+			dir = string(matches[len(matches)-1][1])
+		}
+	}
+	if dir == "" || len(configPaths) == 0 {
+		return ""
+	}
+	if !filepath.IsAbs(dir) {
+		configDir, err := filepath.Abs(filepath.Dir(configPaths[0]))
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(configDir, dir)
+	}
+	return filepath.Clean(dir)
+}
@@ -18,7 +18,7 @@ func (c *GetConfigCmd) Run(ctx *Context) error {
 	// format (which is the CLI default), we'll default to YAML as it's the
 	// source format and more human-readable for this kind of data.
 	outputFormat := ctx.OutputFormat
-	if outputFormat == "table" {
+	if outputFormat == "table" || outputFormat == "wide" {
 		outputFormat = "yaml"
 	}
 
@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigPosition locates a definition in a configuration file.
+type ConfigPosition struct {
+	File   string
+	Line   int
+	Column int
+}
+
+// String returns the position in the conventional `file:line:column` form.
+func (p ConfigPosition) String() string {
+	if p.Column == 0 {
+		return fmt.Sprintf("%s:%d", p.File, p.Line)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// ConfigError reports an error at a position of a configuration file, and the
+// step whose definition contains it, if any.
+type ConfigError struct {
+	Position ConfigPosition
+	Step     string
+	Msg      string
+}
+
+// Error implements the error interface.
+func (e *ConfigError) Error() string {
+	if e.Step != "" {
+		return fmt.Sprintf("%s: %s (in step '%s')", e.Position, e.Msg, e.Step)
+	}
+	return fmt.Sprintf("%s: %s", e.Position, e.Msg)
+}
+
+// yamlErrorLine matches the line prefix of the messages of YAML syntax and type
+// errors (e.g., "yaml: line 12: did not find expected key").
+var yamlErrorLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// stepNode is the YAML node of a step definition in a configuration file.
+type stepNode struct {
+	name string
+	node *yaml.Node
+}
+
+// decodeConfigFile parses the YAML content of a configuration file into `config`.
+//
+// Syntax and type errors are reported as ConfigErrors, at the position of the
+// offending value and with the name of the step containing it, rather than as
+// the generic errors of the YAML decoder. The positions of the step definitions
+// found in the file are added to `positions`, by step name.
+func decodeConfigFile(path string, data []byte, config *Config, positions map[string][]ConfigPosition) error {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return configErrorFromYAML(path, nil, nil, err)
+	}
+	if len(root.Content) == 0 {
+		return nil // An empty file defines nothing.
+	}
+
+	steps := findStepNodes(root.Content[0])
+	for _, s := range steps {
+		positions[s.name] = append(positions[s.name], ConfigPosition{File: path, Line: s.node.Line, Column: s.node.Column})
+	}
+	if err := root.Decode(config); err != nil {
+		return configErrorFromYAML(path, &root, steps, err)
+	}
+	return nil
+}
+
+// findStepNodes returns the step definitions of the `wham_steps` sequence of a
+// configuration document, in order.
+func findStepNodes(doc *yaml.Node) []stepNode {
+	if doc.Kind != yaml.MappingNode {
+		return nil
+	}
+	var steps []stepNode
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if doc.Content[i].Value != "wham_steps" || doc.Content[i+1].Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, item := range doc.Content[i+1].Content {
+			steps = append(steps, stepNode{name: mappingValue(item, "name"), node: item})
+		}
+	}
+	return steps
+}
+
+// mappingValue returns the scalar value of a key of a mapping node, or "".
+func mappingValue(node *yaml.Node, key string) string {
+	if node.Kind != yaml.MappingNode {
+		return ""
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key && node.Content[i+1].Kind == yaml.ScalarNode {
+			return node.Content[i+1].Value
+		}
+	}
+	return ""
+}
+
+// configErrorFromYAML converts an error of the YAML decoder into ConfigErrors.
+// Each message of a yaml.TypeError becomes its own ConfigError. When the document
+// tree is known, the column of the offending value and the enclosing step are
+// looked up from its line. Messages without a line are kept as they are.
+func configErrorFromYAML(path string, root *yaml.Node, steps []stepNode, err error) error {
+	messages := []string{err.Error()}
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	}
+
+	var errs []error
+	for _, msg := range messages {
+		match := yamlErrorLine.FindStringSubmatch(msg)
+		if match == nil {
+			errs = append(errs, errors.New(msg))
+			continue
+		}
+		line, _ := strconv.Atoi(match[1])
+		configErr := &ConfigError{Position: ConfigPosition{File: path, Line: line}, Msg: match[2]}
+		if root != nil {
+			configErr.Position.Column = columnOfLine(root, line)
+		}
+		for _, s := range steps {
+			if s.node.Line <= line && line <= lastLine(s.node) {
+				configErr.Step = s.name
+			}
+		}
+		errs = append(errs, configErr)
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return configErrors(errs)
+}
+
+// configErrors is a list of configuration errors reported together, e.g. all the
+// type errors of a configuration file. Unlike errors.Join, it keeps them on a single
+// line, as log messages do.
+type configErrors []error
+
+// Error implements the error interface.
+func (e configErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap returns the errors of the list, for errors.Is and errors.As.
+func (e configErrors) Unwrap() []error {
+	return e
+}
+
+// columnOfLine returns the column of the first node starting on the given line
+// of a document tree, or 0 if there is none.
+func columnOfLine(node *yaml.Node, line int) int {
+	if node.Kind != yaml.DocumentNode && node.Line == line {
+		return node.Column
+	}
+	for _, child := range node.Content {
+		if column := columnOfLine(child, line); column != 0 {
+			return column
+		}
+	}
+	return 0
+}
+
+// lastLine returns the last line spanned by a node and its children.
+func lastLine(node *yaml.Node) int {
+	line := node.Line
+	for _, child := range node.Content {
+		line = max(line, lastLine(child))
+	}
+	return line
+}
+
+// stepPosition returns the positions of a step's definitions in the configuration
+// files (e.g., "settings.yaml:12:5"), or "" if they are not known.
+func (c *Config) stepPosition(name string) string {
+	positions := c.StepPositions[name]
+	locations := make([]string, len(positions))
+	for i, p := range positions {
+		locations[i] = p.String()
+	}
+	return strings.Join(locations, ", ")
+}
+
+// atPosition formats the positions returned by stepPosition for an error message.
+func atPosition(position string) string {
+	if position == "" {
+		return ""
+	}
+	return " (at " + position + ")"
+}
@@ -2,10 +2,13 @@ package cmd_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"testing"
 	"text/template"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -42,3 +45,188 @@ func TestConfigGet_MergedOutput(t *testing.T) {
 	// Compare the command's JSON output with the processed golden file.
 	assert.JSONEq(t, processedGolden.String(), outputStr, "The output of 'config get' should match the golden file.")
 }
+
+// TestConfig_StepTemplates verifies that steps inherit the fields of the templates
+// they extend, transitively, with their own fields and env_vars keys taking
+// precedence, and that extending an undefined template is rejected.
+func TestConfig_StepTemplates(t *testing.T) {
+	configPath := "../test/settings/settings_step_templates.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "config", "get", "-o", "json")
+	assert.NoError(t, err)
+	var config struct {
+		WhamSteps []struct {
+			Name    string            `json:"name"`
+			Command []string          `json:"command"`
+			EnvVars map[string]string `json:"env_vars"`
+			Retries int               `json:"retries"`
+			Timeout time.Duration     `json:"timeout"`
+		} `json:"wham_steps"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &config))
+	if assert.Len(t, config.WhamSteps, 2) {
+		orders, customers := config.WhamSteps[0], config.WhamSteps[1]
+		assert.Equal(t, map[string]string{"TABLE": "orders", "TARGET": "warehouse"}, orders.EnvVars, "env_vars should be merged key by key.")
+		assert.Equal(t, 2, orders.Retries, "The template's fields should be inherited.")
+		assert.Equal(t, orders.Command, customers.Command, "The fields of a template's own template should be inherited.")
+		assert.Equal(t, 1, customers.Retries, "The step's own fields should take precedence.")
+		assert.Equal(t, 30*time.Second, customers.Timeout)
+	}
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "loading customers into staging")
+
+	outputStr, err = runWhamCommand(t, "--config", "../test/settings/settings_fail_unknown_step_template.yaml", "config", "get")
+	assert.Error(t, err)
+	assert.Contains(t, outputStr, "step template 'no_such_template' is not defined")
+}
+
+// TestConfig_Discovery verifies the precedence of the configuration sources when
+// --config is not given: WHAM_CONFIG, then ./wham.yaml, then the XDG config directory.
+func TestConfig_Discovery(t *testing.T) {
+	dir := t.TempDir()
+	workDir := filepath.Join(dir, "work")
+	xdgDir := filepath.Join(dir, "xdg")
+	writeConfig := func(path, stepName string) {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		content := "wham_settings:\n  data_dir: data\n  metadata_dir: metadata\nwham_steps:\n- name: " + stepName + "\n  command: [\"true\"]\n  previous_steps: []\n"
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	configGet := func(env ...string) (string, error) {
+		cmd := exec.Command(whamBinaryPath, "config", "get", "-o", "json")
+		cmd.Dir = workDir
+		cmd.Env = append(os.Environ(), append([]string{"NO_COLOR=true", "WHAM_CONFIG=", "XDG_CONFIG_HOME=" + xdgDir}, env...)...)
+		output, err := cmd.CombinedOutput()
+		return string(output), err
+	}
+	assert.NoError(t, os.MkdirAll(workDir, 0755))
+
+	outputStr, err := configGet()
+	assert.Error(t, err, "Without any configuration file, WHAM should fail.")
+	assert.Contains(t, outputStr, "no configuration file found")
+
+	writeConfig(filepath.Join(xdgDir, "wham", "config.yaml"), "from-xdg")
+	outputStr, err = configGet()
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "from-xdg")
+
+	writeConfig(filepath.Join(workDir, "wham.yaml"), "from-work-dir")
+	outputStr, err = configGet()
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "from-work-dir", "./wham.yaml should take precedence over the XDG config directory.")
+
+	envConfigPath := filepath.Join(dir, "env.yaml")
+	writeConfig(envConfigPath, "from-env")
+	outputStr, err = configGet("WHAM_CONFIG=" + envConfigPath)
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "from-env", "WHAM_CONFIG should take precedence over discovered files.")
+	assert.NotContains(t, outputStr, "from-work-dir")
+
+	flagConfigPath := filepath.Join(dir, "flag.yaml")
+	writeConfig(flagConfigPath, "from-flag")
+	cmd := exec.Command(whamBinaryPath, "--config", flagConfigPath, "config", "get", "-o", "json")
+	cmd.Dir = workDir
+	cmd.Env = append(os.Environ(), "NO_COLOR=true", "WHAM_CONFIG="+envConfigPath)
+	output, err := cmd.Output()
+	assert.NoError(t, err)
+	assert.Contains(t, string(output), "from-flag", "--config should take precedence over WHAM_CONFIG.")
+}
+
+// TestConfig_Project verifies that --project selects the configuration files and
+// the directories of a project of the projects registry, resolved against the
+// directory of the registry, and that it cannot be combined with --config.
+func TestConfig_Project(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"marketing", "finance"} {
+		content := "wham_settings:\n  data_dir: data\n  metadata_dir: metadata\n  metadata_suffix: .json\nwham_steps:\n- name: " + name + "-step\n  command: [\"/bin/true\"]\n  previous_steps: []\n"
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name+".yaml"), []byte(content), 0644))
+	}
+	registryPath := filepath.Join(dir, "projects.yaml")
+	registry := "projects:\n  marketing:\n    config: [marketing.yaml]\n    data_dir: marketing/data\n    metadata_dir: marketing/metadata\n  finance:\n    config: [finance.yaml]\n"
+	assert.NoError(t, os.WriteFile(registryPath, []byte(registry), 0644))
+	wham := func(args ...string) (string, error) {
+		cmd := exec.Command(whamBinaryPath, args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "NO_COLOR=true", "WHAM_CONFIG=", "WHAM_PROJECTS_FILE="+registryPath)
+		output, err := cmd.CombinedOutput()
+		return string(output), err
+	}
+
+	outputStr, err := wham("--project", "marketing", "run", "all")
+	assert.NoError(t, err, "Command failed: %s", outputStr)
+	assert.FileExists(t, filepath.Join(dir, "marketing", "metadata", "marketing-step.json"), "The project's metadata_dir should be used.")
+	assert.DirExists(t, filepath.Join(dir, "marketing", "data"))
+	assert.NoDirExists(t, filepath.Join(dir, "metadata"), "The metadata_dir of the configuration should be overridden.")
+
+	outputStr, err = wham("--project", "finance", "config", "get", "-o", "json")
+	assert.NoError(t, err, "Command failed: %s", outputStr)
+	assert.Contains(t, outputStr, "finance-step")
+	assert.NotContains(t, outputStr, "marketing-step")
+
+	outputStr, err = wham("--project", "sales", "config", "get")
+	assert.Error(t, err)
+	assert.Contains(t, outputStr, "project 'sales' not found")
+	assert.Contains(t, outputStr, "known projects: finance, marketing")
+
+	outputStr, err = wham("--project", "finance", "--config", filepath.Join(dir, "marketing.yaml"), "config", "get")
+	assert.Error(t, err)
+	assert.Contains(t, outputStr, "--project and --config cannot be combined")
+
+	outputStr, err = wham("project", "list", "-o", "json")
+	assert.NoError(t, err, "Command failed: %s", outputStr)
+	var projects []struct {
+		Name        string   `json:"name"`
+		Config      []string `json:"config"`
+		MetadataDir string   `json:"metadata_dir"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &projects))
+	if assert.Len(t, projects, 2) {
+		assert.Equal(t, "finance", projects[0].Name)
+		assert.Equal(t, []string{filepath.Join(dir, "finance.yaml")}, projects[0].Config)
+		assert.Empty(t, projects[0].MetadataDir)
+		assert.Equal(t, filepath.Join(dir, "marketing", "metadata"), projects[1].MetadataDir)
+	}
+}
+
+// TestConfig_Cache verifies that --config-cache caches the configuration in the
+// metadata directory, reuses it while the file is unchanged and parses the file
+// again once it changes.
+func TestConfig_Cache(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "wham.yaml")
+	writeConfig := func(stepName string) {
+		content := "wham_settings:\n  data_dir: data\n  metadata_dir: metadata\nwham_steps:\n- name: first\n  command: [\"true\"]\n  previous_steps: []\n- name: " + stepName + "\n  command: [\"true\"]\n  previous_steps: [first]\n"
+		assert.NoError(t, os.WriteFile(configPath, []byte(content), 0644))
+	}
+	dagGet := func() (string, string) {
+		cmd := exec.Command(whamBinaryPath, "--config", configPath, "--config-cache", "--debug", "dag", "get", "-o", "json")
+		cmd.Env = append(os.Environ(), "NO_COLOR=true")
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		assert.NoError(t, cmd.Run(), stderr.String())
+		return stdout.String(), stderr.String()
+	}
+
+	writeConfig("second")
+	outputStr, logs := dagGet()
+	assert.Contains(t, logs, "hit=false")
+	assert.Contains(t, outputStr, `"second"`)
+	cacheFiles, _ := filepath.Glob(filepath.Join(dir, "metadata", ".wham_config_cache", "*.json"))
+	assert.Len(t, cacheFiles, 1, "The configuration should be cached in the metadata directory.")
+
+	cachedOutputStr, logs := dagGet()
+	assert.Contains(t, logs, "hit=true", "An unchanged configuration should be read from the cache.")
+	assert.JSONEq(t, outputStr, cachedOutputStr, "The cached configuration and DAG should be those of the file.")
+
+	writeConfig("renamed")
+	outputStr, logs = dagGet()
+	assert.Contains(t, logs, "hit=false", "A changed configuration file should invalidate the cache.")
+	assert.Contains(t, outputStr, `"renamed"`)
+	assert.NotContains(t, outputStr, `"second"`)
+
+	_, logs = dagGet()
+	assert.Contains(t, logs, "hit=true")
+}
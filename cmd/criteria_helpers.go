@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// criterion is a single parsed comparison of a success criteria expression,
+// such as `rows_processed > 0`.
+type criterion struct {
+	Key      string
+	Operator string
+	Value    string
+}
+
+// criteriaOperators lists the supported comparison operators. Two-character
+// operators must come first so that `>=` is not mistaken for `>`.
+var criteriaOperators = []string{">=", "<=", "==", "!=", ">", "<"}
+
+// parseSuccessCriteria parses a success criteria expression into its comparisons.
+//
+// An expression is one or more comparisons joined by `&&`, all of which must hold.
+// Each comparison has the form `<output_key> <operator> <value>`, where the
+// operator is one of `==`, `!=`, `>`, `>=`, `<` or `<=`, and the value is a
+// number or a string, optionally quoted (e.g., `status == "complete"`).
+func parseSuccessCriteria(expr string) ([]criterion, error) {
+	var criteria []criterion
+	for _, clause := range strings.Split(expr, "&&") {
+		clause = strings.TrimSpace(clause)
+		if clause == "" {
+			return nil, fmt.Errorf("empty comparison in success criteria '%s'", expr)
+		}
+		var c *criterion
+		for _, op := range criteriaOperators {
+			if key, value, found := strings.Cut(clause, op); found {
+				c = &criterion{Key: strings.TrimSpace(key), Operator: op, Value: unquote(strings.TrimSpace(value))}
+				break
+			}
+		}
+		if c == nil || c.Key == "" {
+			return nil, fmt.Errorf("invalid comparison '%s' in success criteria: expected '<output> <operator> <value>'", clause)
+		}
+		criteria = append(criteria, *c)
+	}
+	return criteria, nil
+}
+
+// unquote removes matching single or double quotes around a value, if any.
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// evaluate checks the comparison against the given outputs. It returns an error
+// describing why the comparison does not hold, or nil if it does.
+//
+// If both sides are numbers, they are compared numerically. Otherwise only the
+// `==` and `!=` operators are supported and the values are compared as strings.
+func (c criterion) evaluate(outputs map[string]string) error {
+	actual, ok := outputs[c.Key]
+	if !ok {
+		return fmt.Errorf("output '%s' was not reported", c.Key)
+	}
+
+	actualNum, errA := strconv.ParseFloat(actual, 64)
+	expectedNum, errE := strconv.ParseFloat(c.Value, 64)
+	var holds bool
+	if errA == nil && errE == nil {
+		switch c.Operator {
+		case "==":
+			holds = actualNum == expectedNum
+		case "!=":
+			holds = actualNum != expectedNum
+		case ">":
+			holds = actualNum > expectedNum
+		case ">=":
+			holds = actualNum >= expectedNum
+		case "<":
+			holds = actualNum < expectedNum
+		case "<=":
+			holds = actualNum <= expectedNum
+		}
+	} else {
+		switch c.Operator {
+		case "==":
+			holds = actual == c.Value
+		case "!=":
+			holds = actual != c.Value
+		default:
+			return fmt.Errorf("cannot compare non-numeric output '%s' ('%s') with '%s'", c.Key, actual, c.Operator)
+		}
+	}
+
+	if !holds {
+		return fmt.Errorf("'%s %s %s' does not hold (%s is '%s')", c.Key, c.Operator, c.Value, c.Key, actual)
+	}
+	return nil
+}
+
+// checkSuccessCriteria evaluates a step's `success_criteria` against the outputs
+// it reported after a successful execution.
+//
+// If a criterion does not hold and the step's `success_criteria_policy` is "warn",
+// a warning is printed and recorded in the result, and nil is returned. Otherwise (policy "fail", the default),
+// an error is returned so that the execution is treated as failed.
+func (w *WHAM) checkSuccessCriteria(step *Step, result *stepResult) error {
+	if step.SuccessCriteria == "" {
+		return nil
+	}
+	criteria, err := parseSuccessCriteria(step.SuccessCriteria)
+	if err != nil {
+		return err // Already validated at load time; kept for robustness.
+	}
+	for _, c := range criteria {
+		if err := c.evaluate(result.Outputs); err != nil {
+			if step.SuccessCriteriaPolicy == "warn" {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("success criteria not met: %v", err))
+				fmt.Printf("⚠️ Step '%s' did not meet its success criteria: %v\n", step.Name, err)
+				w.logger.Warn().Str("step", step.Name).Str("success_criteria", step.SuccessCriteria).Err(err).Msg("Success criteria not met, continuing as policy is 'warn'.")
+				return nil
+			}
+			return fmt.Errorf("success criteria not met: %w", err)
+		}
+	}
+	w.logger.Debug().Str("step", step.Name).Str("success_criteria", step.SuccessCriteria).Msg("Success criteria met.")
+	return nil
+}
@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed cron expression. See parseCronSchedule.
+type cronSchedule struct {
+	// every, if set, is the fixed interval of an "@every" schedule, which ignores
+	// the fields below.
+	every time.Duration
+	// minute, hour, dom, month and dow are bitsets of the values matched by each
+	// field of the expression (bit N set if value N matches).
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny are true if the day-of-month or day-of-week field is "*".
+	// As in cron, when both are restricted, a day matching either one matches.
+	domAny, dowAny bool
+	// location is the time zone in which the expression is evaluated.
+	location *time.Location
+}
+
+// cronField describes the range and value names of a field of a cron expression.
+type cronField struct {
+	name     string
+	min, max int
+	names    []string // Names of the values from min, if any (e.g., "jan").
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	// Sunday is both 0 and 7, as in most cron implementations.
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// cronMacros are the shorthands accepted in place of a five-field expression.
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseCronSchedule parses a cron expression evaluated in the given time zone.
+//
+// The expression has the five standard fields (minute, hour, day of month, month
+// and day of week), each being "*" or a comma-separated list of values, ranges
+// ("1-5") and steps ("*/15", "0-30/10"). Months and days of the week can also be
+// named by their first three letters (e.g., "jan", "mon"). The macros "@yearly",
+// "@monthly", "@weekly", "@daily" and "@hourly", and "@every <duration>" (e.g.,
+// "@every 90m") are accepted as well.
+func parseCronSchedule(expr string, location *time.Location) (*cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if interval, ok := strings.CutPrefix(expr, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(interval))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule '%s': %w", expr, err)
+		}
+		if every < time.Second {
+			return nil, fmt.Errorf("invalid schedule '%s': the interval must be at least 1s", expr)
+		}
+		return &cronSchedule{every: every, location: location}, nil
+	}
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("invalid schedule '%s': expected %d fields, got %d", expr, len(cronFields), len(fields))
+	}
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		var err error
+		if bits[i], err = parseCronField(field, cronFields[i]); err != nil {
+			return nil, fmt.Errorf("invalid schedule '%s': %w", expr, err)
+		}
+	}
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1 // Sunday
+	}
+	s := &cronSchedule{
+		minute: bits[0], hour: bits[1], dom: bits[2], month: bits[3], dow: bits[4],
+		domAny: fields[2] == "*", dowAny: fields[4] == "*",
+		location: location,
+	}
+	if s.next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("invalid schedule '%s': it never matches", expr)
+	}
+	return s, nil
+}
+
+// parseCronField parses a field of a cron expression into the bitset of the
+// values it matches.
+func parseCronField(field string, spec cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step '%s' in %s field", stepPart, spec.name)
+			}
+		}
+		low, high := spec.min, spec.max
+		if rangePart != "*" {
+			lowPart, highPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = parseCronValue(lowPart, spec); err != nil {
+				return 0, err
+			}
+			high = low
+			if isRange {
+				if high, err = parseCronValue(highPart, spec); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				high = spec.max // "5/10" means from 5 to the maximum, every 10.
+			}
+			if low > high {
+				return 0, fmt.Errorf("invalid range '%s' in %s field", rangePart, spec.name)
+			}
+		}
+		for v := low; v <= high; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// parseCronValue parses a single value of a cron field, either as a number or as
+// one of the field's value names.
+func parseCronValue(value string, spec cronField) (int, error) {
+	for i, name := range spec.names {
+		if strings.EqualFold(value, name) {
+			return spec.min + i, nil
+		}
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < spec.min || n > spec.max {
+		return 0, fmt.Errorf("invalid value '%s' in %s field: expected %d-%d", value, spec.name, spec.min, spec.max)
+	}
+	return n, nil
+}
+
+// next returns the first time strictly after `after` matched by the schedule, or
+// the zero time if none is found within the next five years.
+func (s *cronSchedule) next(after time.Time) time.Time {
+	if s.every > 0 {
+		return after.Add(s.every)
+	}
+	t := after.In(s.location).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.location)
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.location)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.location)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// matchesDay reports whether the day of `t` is matched by the day-of-month and
+// day-of-week fields of the schedule.
+func (s *cronSchedule) matchesDay(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
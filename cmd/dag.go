@@ -2,7 +2,9 @@ package cmd
 
 // DAG-related concrete command structs (verbs)
 
-type GetDAGCmd struct{}
+type GetDAGCmd struct {
+	Status bool `help:"Show the current state of each step: its last action, the age of its run_id and whether it is stale."`
+}
 
 // DAG-related command groups (objects)
 
@@ -14,5 +16,5 @@ type DAGCmd struct {
 // DAG-related command implementations
 
 func (g *GetDAGCmd) Run(ctx *Context) error {
-	return ctx.WHAM.GetDAG(ctx.OutputFormat)
+	return ctx.WHAM.GetDAG(ctx.OutputFormat, g.Status)
 }
@@ -5,6 +5,7 @@ import (
 	"os"
 	"sort"
 	"strings"
+	"time"
 )
 
 // DAGStepInfo is a struct designed for structured output (JSON/YAML) of the DAG.
@@ -13,15 +14,46 @@ type DAGStepInfo struct {
 	Name          string   `json:"name" yaml:"name"`
 	Depth         int      `json:"depth" yaml:"depth"`
 	PreviousSteps []string `json:"previous_steps" yaml:"previous_steps"`
+	// Status is the current state of the step, only collected with `dag get --status`.
+	Status *DAGStepStatus `json:"status,omitempty" yaml:"status,omitempty"`
 }
 
+// DAGStepStatus is the current state of a step, as shown by `dag get --status`.
+type DAGStepStatus struct {
+	// Action and Reason are those of the step's last recorded state.
+	Action string `json:"action" yaml:"action"`
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+	RunID  string `json:"run_id" yaml:"run_id"`
+	// RunIDDate is when the step's run_id last changed.
+	RunIDDate *time.Time `json:"run_id_date,omitempty" yaml:"run_id_date,omitempty"`
+	// Staleness tells whether the step has caught up with its predecessors. See the
+	// Staleness* constants; it is empty for the steps that do not inherit their
+	// run_id from predecessors.
+	Staleness string `json:"staleness,omitempty" yaml:"staleness,omitempty"`
+	// Detail explains why a step is blocked.
+	Detail string `json:"detail,omitempty" yaml:"detail,omitempty"`
+}
+
+// Staleness of a step relative to its predecessors, as shown by `dag get --status`.
+const (
+	// StalenessUpToDate means the step holds the run_id of its predecessors.
+	StalenessUpToDate = "up_to_date"
+	// StalenessStale means the predecessors changed since the step last ran: the next
+	// `run all` would execute it.
+	StalenessStale = "stale"
+	// StalenessBlocked means the predecessors are not in a consistent state (e.g.,
+	// one of them never succeeded), so the step cannot run.
+	StalenessBlocked = "blocked"
+	// StalenessNeverRun means the step has no recorded state.
+	StalenessNeverRun = "never_run"
+)
+
 // GetDAG orchestrates the display of the workflow's Directed Acyclic Graph.
 // It fetches the DAG structure and renders it in the format specified by `outputFormat`.
-func (w *WHAM) GetDAG(outputFormat string) error {
-	// The core logic to render the DAG is now in a separate function.
-	// This function will handle the switch between different output formats.
-	// For now, we'll keep the existing table rendering logic.
-	return w.renderDAG(outputFormat)
+// With `withStatus`, the current state of every step is merged into the graph, so
+// that where the workflow is stuck can be seen at a glance.
+func (w *WHAM) GetDAG(outputFormat string, withStatus bool) error {
+	return w.renderDAG(outputFormat, withStatus)
 }
 
 // GetDAG displays the workflow's Directed Acyclic Graph to the console.
@@ -32,15 +64,20 @@ func (w *WHAM) GetDAG(outputFormat string) error {
 //
 // To improve readability, the output is aligned: step names are padded to the same
 // length, ensuring that the dependency arrows (`<--`) are vertically aligned.
-func (w *WHAM) renderDAG(outputFormat string) error {
+func (w *WHAM) renderDAG(outputFormat string, withStatus bool) error {
 	// 1. Collect DAG information into a structured format.
 	var dagInfo []DAGStepInfo
-	for _, step := range w.config.WhamSteps {
-		dagInfo = append(dagInfo, DAGStepInfo{
+	for i := range w.config.WhamSteps {
+		step := &w.config.WhamSteps[i]
+		info := DAGStepInfo{
 			Name:          step.Name,
 			Depth:         w.stepDepths[step.Name],
 			PreviousSteps: step.PreviousSteps,
-		})
+		}
+		if withStatus {
+			info.Status = w.dagStepStatus(step)
+		}
+		dagInfo = append(dagInfo, info)
 	}
 
 	// Sort the collected info once, so all renderers use the same order.
@@ -56,7 +93,10 @@ func (w *WHAM) renderDAG(outputFormat string) error {
 	switch outputFormat {
 	case "json", "yaml":
 		return RenderData(os.Stdout, dagInfo, outputFormat)
-	case "table":
+	case "table", "wide":
+		if withStatus {
+			return w.renderDAGStatusAsTable(dagInfo)
+		}
 		return w.renderDAGAsTable(dagInfo)
 	default:
 		return fmt.Errorf("unsupported output format: '%s'", outputFormat)
@@ -79,3 +119,92 @@ func (w *WHAM) renderDAGAsTable(dagInfo []DAGStepInfo) error {
 
 	return tr.Render()
 }
+
+// dagStepStatus collects the current state of a step and its staleness relative
+// to its predecessors.
+//
+// Only the steps inheriting their run_id from their predecessors can be stale or
+// blocked, as decided by checkPreviousStepsConsistency before they run: stateful
+// steps always run, and steps without predecessors have nothing to catch up with.
+func (w *WHAM) dagStepStatus(step *Step) *DAGStepStatus {
+	state := w.getCurrentStepWhamState(step.Name)
+	status := &DAGStepStatus{Action: state.RunAction, Reason: state.Reason, RunID: state.RunID}
+	if state.RunID != "" {
+		runIDDate := state.RunIDDate
+		status.RunIDDate = &runIDDate
+	}
+
+	var prevRunID string
+	inheritsRunID := !producesOwnRunID(step) && len(step.PreviousSteps) > 0
+	if inheritsRunID {
+		var err error
+		prevRunID, err = w.checkPreviousStepsConsistency(step.PreviousSteps)
+		if err != nil {
+			status.Staleness, status.Detail = StalenessBlocked, err.Error()
+			return status
+		}
+	}
+	switch {
+	case state.RunAction == "":
+		status.Staleness = StalenessNeverRun
+	case !inheritsRunID || prevRunID == "":
+		// Nothing to compare the run_id with.
+	case prevRunID != state.RunID:
+		status.Staleness = StalenessStale
+	default:
+		status.Staleness = StalenessUpToDate
+	}
+	return status
+}
+
+// renderDAGStatusAsTable displays the DAG merged with the current state of its
+// steps, one row per step. When the output is a terminal, failed steps are shown in
+// red, stale or blocked steps in yellow, and the other steps that ran in green.
+// The reasons why steps are blocked are listed below the table.
+func (w *WHAM) renderDAGStatusAsTable(dagInfo []DAGStepInfo) error {
+	colors := colorsEnabled(os.Stdout)
+	tr := NewTableRenderer(os.Stdout, "DEPTH", "NAME", "ACTION", "RUN ID", "AGE", "STALENESS", "PREDECESSORS")
+	var blocked []DAGStepInfo
+	for _, info := range dagInfo {
+		status := info.Status
+		action := orDash(status.Action)
+		if status.Reason != "" {
+			action += " (" + status.Reason + ")"
+		}
+		age := "-"
+		if status.RunIDDate != nil {
+			age = time.Since(*status.RunIDDate).Round(time.Second).String()
+		}
+		predecessorsStr := "<none>"
+		if len(info.PreviousSteps) > 0 {
+			predecessorsStr = strings.Join(info.PreviousSteps, ", ")
+		}
+
+		color := ""
+		switch {
+		case !colors:
+		case status.Action == "failed":
+			color = colorRed
+		case status.Staleness == StalenessStale || status.Staleness == StalenessBlocked:
+			color = colorYellow
+		case status.Action != "":
+			color = colorGreen
+		}
+		if status.Staleness == StalenessBlocked {
+			blocked = append(blocked, info)
+		}
+		tr.AddColoredRow(color, fmt.Sprintf("%d", info.Depth), info.Name, action, orDash(status.RunID), age, orDash(status.Staleness), predecessorsStr)
+	}
+	if err := tr.Render(); err != nil {
+		return err
+	}
+
+	ew := &errorWriter{w: os.Stdout}
+	if len(blocked) > 0 {
+		ew.Println()
+	}
+	for _, info := range blocked {
+		ew.Printf("🚧 Step '%s' is blocked: %s\n", info.Name, info.Status.Detail)
+	}
+	return ew.err
+}
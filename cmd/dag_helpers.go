@@ -1,6 +1,10 @@
 package cmd
 
-import "fmt"
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
 
 // getTopologicalOrder performs a topological sort of the workflow's Directed Acyclic Graph (DAG).
 //
@@ -68,6 +72,26 @@ func (w *WHAM) getTopologicalOrder() ([]*Step, error) {
 	return sortedSteps, nil
 }
 
+// getExecutionOrder returns the steps in the order in which `run all` executes
+// them: sorted by DAG depth and, at equal depth, by decreasing priority, so that
+// the steps declared with a higher `priority` (e.g., the most expensive ones) are
+// started first. Steps of equal depth and priority keep their topological order.
+// Since a step is always deeper than its predecessors, the order is topological.
+func (w *WHAM) getExecutionOrder() ([]*Step, error) {
+	sortedSteps, err := w.getTopologicalOrder()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(sortedSteps, func(i, j int) bool {
+		depthI, depthJ := w.stepDepths[sortedSteps[i].Name], w.stepDepths[sortedSteps[j].Name]
+		if depthI != depthJ {
+			return depthI < depthJ
+		}
+		return sortedSteps[i].Priority > sortedSteps[j].Priority
+	})
+	return sortedSteps, nil
+}
+
 func (w *WHAM) calculateStepDepths() {
 	// 1. Get the topological order. This also validates the DAG for cycles.
 	sortedSteps, err := w.getTopologicalOrder()
@@ -105,3 +129,64 @@ func (w *WHAM) calculateStepDepths() {
 		}
 	}
 }
+
+// getDescendants returns the names of all steps that directly or transitively
+// depend on the given step, in the order they are defined in the configuration.
+// The step itself is not included.
+func (w *WHAM) getDescendants(stepName string) []string {
+	// Build an adjacency list to easily find the successors of each node.
+	adjList := make(map[string][]string)
+	for _, step := range w.config.WhamSteps {
+		for _, prevStepName := range step.PreviousSteps {
+			adjList[prevStepName] = append(adjList[prevStepName], step.Name)
+		}
+	}
+
+	// Breadth-first traversal of the successors.
+	visited := map[string]bool{stepName: true}
+	queue := []string{stepName}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, successor := range adjList[current] {
+			if !visited[successor] {
+				visited[successor] = true
+				queue = append(queue, successor)
+			}
+		}
+	}
+
+	// Preserve the configuration order for a stable output.
+	var descendants []string
+	for _, step := range w.config.WhamSteps {
+		if step.Name != stepName && visited[step.Name] {
+			descendants = append(descendants, step.Name)
+		}
+	}
+	return descendants
+}
+
+// disabledAncestor returns the name of the nearest ancestor of a step marked as
+// `disabled`, or "" if there is none. The steps depending on a disabled step are
+// skipped along with it, rather than failing their precondition checks.
+func (w *WHAM) disabledAncestor(step *Step) string {
+	visited := make(map[string]bool)
+	queue := slices.Clone(step.PreviousSteps)
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if visited[current] {
+			continue
+		}
+		visited[current] = true
+		pred := w.findStep(current)
+		if pred == nil {
+			continue
+		}
+		if pred.Disabled {
+			return pred.Name
+		}
+		queue = append(queue, pred.PreviousSteps...)
+	}
+	return ""
+}
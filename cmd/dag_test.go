@@ -54,3 +54,58 @@ func TestDAGGet_JsonOutput(t *testing.T) {
 	assert.Equal(t, 3, finalStep.Depth, "The depth of the final step should be 3.")
 	assert.Contains(t, finalStep.PreviousSteps, "stateless_sh_maybe_fail", "The final step should depend on 'stateless_sh_maybe_fail'.")
 }
+
+// TestDAGGet_Status verifies that `dag get --status` merges the state of the steps
+// into the DAG: a step behind its predecessors is stale, a step after a failed one
+// is blocked, and the age of a run_id does not change while the run_id is kept.
+func TestDAGGet_Status(t *testing.T) {
+	const configPath = "../test/settings/settings_resume.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	getStatus := func() map[string]TestDAGStepInfo {
+		outputStr, err := runWhamCommand(t, "--config", configPath, "dag", "get", "--status", "-o", "json")
+		assert.NoError(t, err, "The command should execute successfully.")
+		var dagInfo []TestDAGStepInfo
+		assert.NoError(t, json.Unmarshal([]byte(outputStr), &dagInfo))
+		infoMap := make(map[string]TestDAGStepInfo)
+		for _, info := range dagInfo {
+			if assert.NotNil(t, info.Status, "Every step should have a status.") {
+				infoMap[info.Name] = info
+			}
+		}
+		return infoMap
+	}
+
+	infoMap := getStatus()
+	assert.Equal(t, "never_run", infoMap["extract"].Status.Staleness)
+
+	_, err := runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.Error(t, err, "The workflow should halt at the failing step.")
+	infoMap = getStatus()
+	extract := infoMap["extract"].Status
+	assert.Equal(t, "run", extract.Action)
+	assert.NotNil(t, extract.RunIDDate)
+	assert.Empty(t, extract.Staleness, "A stateful step is never stale.")
+	assert.Equal(t, "failed", infoMap["transform"].Status.Action)
+	assert.Equal(t, "stale", infoMap["transform"].Status.Staleness)
+	assert.Equal(t, "blocked", infoMap["load"].Status.Staleness)
+	assert.Contains(t, infoMap["load"].Status.Detail, "previous step 'transform' has no valid WHAM state")
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "dag", "get", "--status")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "STALENESS")
+	assert.Contains(t, outputStr, "Step 'load' is blocked")
+	assert.NotContains(t, outputStr, "\033[", "Colors should be disabled when the output is not a terminal.")
+
+	t.Setenv("TEST_EXIT_STATUS", "success")
+	_, err = runWhamCommand(t, "--config", configPath, "run", "all", "--resume")
+	assert.NoError(t, err)
+	infoMap = getStatus()
+	assert.Equal(t, "up_to_date", infoMap["transform"].Status.Staleness)
+	assert.Equal(t, "up_to_date", infoMap["load"].Status.Staleness)
+	if resumed := infoMap["extract"].Status; assert.NotNil(t, resumed.RunIDDate) && extract.RunIDDate != nil {
+		assert.Equal(t, extract.RunID, resumed.RunID)
+		assert.True(t, extract.RunIDDate.Equal(*resumed.RunIDDate), "The run_id date should be kept along with the run_id.")
+	}
+}
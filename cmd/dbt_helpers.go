@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DbtSpec defines the invocation of a dbt step (`type: dbt`).
+//
+// WHAM assembles the dbt command line from these fields, runs it, and then parses
+// the `target/run_results.json` file written by dbt: the `invocation_id` becomes
+// the step's run_id, and the per-model outcomes are recorded as step outputs.
+type DbtSpec struct {
+	// Command is the dbt sub-command to invoke (e.g., "run", "test", "build"). Defaults to "run".
+	Command string `yaml:"command,omitempty" json:"command,omitempty"`
+	// Select is a list of node selectors passed to `--select`.
+	Select []string `yaml:"select,omitempty" json:"select,omitempty"`
+	// Exclude is a list of node selectors passed to `--exclude`.
+	Exclude []string `yaml:"exclude,omitempty" json:"exclude,omitempty"`
+	// Selector is the name of a YAML selector passed to `--selector`.
+	Selector string `yaml:"selector,omitempty" json:"selector,omitempty"`
+	// Target is the profile target passed to `--target`.
+	Target string `yaml:"target,omitempty" json:"target,omitempty"`
+	// ProjectDir is the dbt project directory, relative to the config file's directory.
+	// If omitted, dbt runs in the step's working directory.
+	ProjectDir string `yaml:"project_dir,omitempty" json:"project_dir,omitempty"`
+	// ProfilesDir is the directory containing profiles.yml, relative to the config file's directory.
+	ProfilesDir string `yaml:"profiles_dir,omitempty" json:"profiles_dir,omitempty"`
+}
+
+// dbtRunResults mirrors the parts of dbt's run_results.json artifact used by WHAM.
+type dbtRunResults struct {
+	Metadata struct {
+		InvocationID string `json:"invocation_id"`
+	} `json:"metadata"`
+	Results []struct {
+		UniqueID string `json:"unique_id"`
+		Status   string `json:"status"`
+	} `json:"results"`
+}
+
+// dbtArgs assembles the dbt-specific command-line arguments of a dbt step.
+func (w *WHAM) dbtArgs(step *Step) []string {
+	spec := step.Dbt
+	command := spec.Command
+	if command == "" {
+		command = "run"
+	}
+	args := []string{command}
+	if len(spec.Select) > 0 {
+		args = append(args, "--select")
+		args = append(args, spec.Select...)
+	}
+	if len(spec.Exclude) > 0 {
+		args = append(args, "--exclude")
+		args = append(args, spec.Exclude...)
+	}
+	if spec.Selector != "" {
+		args = append(args, "--selector", spec.Selector)
+	}
+	if spec.Target != "" {
+		args = append(args, "--target", spec.Target)
+	}
+	if spec.ProjectDir != "" {
+		args = append(args, "--project-dir", w.resolvePath(spec.ProjectDir))
+	}
+	if spec.ProfilesDir != "" {
+		args = append(args, "--profiles-dir", w.resolvePath(spec.ProfilesDir))
+	}
+	return args
+}
+
+// collectDbtResults parses the run_results.json artifact of a dbt step and records
+// the invocation ID as the step's run_id and the per-model outcomes as outputs.
+//
+// `projectDir` is the directory dbt ran in, and `startedAt` the time the execution
+// started: an artifact older than that was left by a previous invocation (e.g., if
+// dbt failed before compiling the project) and is ignored.
+func (w *WHAM) collectDbtResults(step *Step, projectDir string, startedAt time.Time, result *stepResult) {
+	path := filepath.Join(projectDir, "target", "run_results.json")
+	stat, err := os.Stat(path)
+	if err != nil || stat.ModTime().Before(startedAt) {
+		w.logger.Warn().Str("step", step.Name).Str("path", path).Msg("No fresh dbt run_results.json found after execution.")
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		w.logger.Warn().Str("step", step.Name).Str("path", path).Err(err).Msg("Could not read dbt run_results.json.")
+		return
+	}
+	var runResults dbtRunResults
+	if err := json.Unmarshal(data, &runResults); err != nil {
+		w.logger.Warn().Str("step", step.Name).Str("path", path).Err(err).Msg("Could not parse dbt run_results.json.")
+		return
+	}
+
+	var failed []string
+	for _, res := range runResults.Results {
+		switch res.Status {
+		case "error", "fail", "runtime error":
+			failed = append(failed, res.UniqueID)
+		}
+	}
+	sort.Strings(failed)
+
+	result.RunID = runResults.Metadata.InvocationID
+	if result.Outputs == nil {
+		result.Outputs = make(map[string]string)
+	}
+	result.Outputs["dbt_invocation_id"] = runResults.Metadata.InvocationID
+	result.Outputs["models_total"] = strconv.Itoa(len(runResults.Results))
+	result.Outputs["models_failed"] = strconv.Itoa(len(failed))
+	if len(failed) > 0 {
+		result.Outputs["failed_models"] = strings.Join(failed, ",")
+		fmt.Printf("⚠️ dbt step '%s' reported %d failed node(s): %s\n", step.Name, len(failed), strings.Join(failed, ", "))
+	}
+	w.logger.Debug().Str("step", step.Name).Str("invocation_id", result.RunID).Int("results", len(runResults.Results)).Strs("failed", failed).Msg("Parsed dbt run results.")
+}
@@ -0,0 +1,26 @@
+package cmd
+
+import "fmt"
+
+// Debug-related concrete command structs (verbs)
+
+type BundleDebugCmd struct {
+	Out string `help:"Path of the archive to write." default:"wham_bundle.tgz"`
+}
+
+// Debug-related command groups (objects)
+
+// DebugCmd holds subcommands for troubleshooting WHAM.
+type DebugCmd struct {
+	Bundle BundleDebugCmd `cmd:"" help:"Bundle the redacted configuration, state and history into an archive for support."`
+}
+
+// Debug-related command implementations
+
+func (b *BundleDebugCmd) Run(ctx *Context) error {
+	if err := ctx.WHAM.WriteDebugBundle(b.Out); err != nil {
+		return err
+	}
+	_, err := fmt.Printf("📦 Debug bundle written to '%s'.\n", b.Out)
+	return err
+}
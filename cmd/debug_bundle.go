@@ -0,0 +1,298 @@
+package cmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// debugBundleRunsLimit is the number of most recent workflow runs included in a debug bundle.
+const debugBundleRunsLimit = 20
+
+// debugBundleLogsLimit is the number of most recent detached run logs included in
+// a debug bundle, and debugBundleLogSize the size kept of each, from its end.
+const (
+	debugBundleLogsLimit = 5
+	debugBundleLogSize   = 1 << 20
+)
+
+// redactedValue replaces sensitive values in the configuration of a debug bundle.
+const redactedValue = "<redacted>"
+
+// WriteDebugBundle writes a gzipped tar archive meant to be attached to a support
+// request or a bug report. It contains:
+//   - version.txt: the WHAM version information;
+//   - config.yaml: the final, merged configuration, with the values of all
+//     environment variables and the notifications webhook URL and secret redacted;
+//   - state/: the WHAM state file of every step, and the state files generated by
+//     stateful steps;
+//   - runs/: the records of the most recent workflow runs;
+//   - logs/: the logs of the most recent detached runs (see Detach), the only
+//     output of the steps WHAM captures to disk, each truncated to its last
+//     debugBundleLogSize bytes. The output of an attached run goes to the terminal
+//     or wherever it is redirected, out of reach of the bundle. The logs are not
+//     redacted: the steps may print secrets.
+//
+// Missing files (e.g., of steps that never ran) are skipped.
+func (w *WHAM) WriteDebugBundle(outPath string) error {
+	f, err := os.Create(outPath)
+	if err != nil {
+		return fmt.Errorf("failed to create debug bundle '%s': %w", outPath, err)
+	}
+	defer f.Close()
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+
+	version := fmt.Sprintf("Version: %s\nCommit: %s\nBuild Date: %s\nGo Version: %s\nPlatform: %s/%s\n",
+		Version, Commit, BuildDate, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	if err := addBundleEntry(tw, "version.txt", []byte(version)); err != nil {
+		return err
+	}
+
+	config, err := yaml.Marshal(w.redactedConfig())
+	if err != nil {
+		return fmt.Errorf("failed to marshal configuration for debug bundle: %w", err)
+	}
+	if err := addBundleEntry(tw, "config.yaml", config); err != nil {
+		return err
+	}
+
+	// Collect the WHAM state files from the state store, whatever its backend.
+	for _, step := range w.config.WhamSteps {
+		data, err := w.stateStore.Load(step.Name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read '%s' for debug bundle: %w", w.stateStore.Location(step.Name), err)
+		}
+		if err := addBundleEntry(tw, "state/"+w.getWhamStateFileName(step.Name), data); err != nil {
+			return err
+		}
+	}
+
+	// Collect the state files of the steps, without duplicates (steps may share a state file).
+	statePaths := make(map[string]bool)
+	for _, step := range w.config.WhamSteps {
+		if step.StateFile != "" {
+			statePaths[filepath.Join(w.config.WhamSettings.MetadataDir, step.StateFile)] = true
+		}
+		for _, sf := range step.StateFiles {
+			statePaths[filepath.Join(w.config.WhamSettings.MetadataDir, sf.File)] = true
+		}
+	}
+	sortedStatePaths := make([]string, 0, len(statePaths))
+	for path := range statePaths {
+		sortedStatePaths = append(sortedStatePaths, path)
+	}
+	sort.Strings(sortedStatePaths)
+	for _, path := range sortedStatePaths {
+		if err := addBundleFile(tw, "state", path); err != nil {
+			return err
+		}
+	}
+
+	runsDir := w.getWorkflowRunsDir()
+	entries, err := os.ReadDir(runsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read workflow runs directory '%s': %w", runsDir, err)
+	}
+	// Run IDs start with a timestamp, and os.ReadDir sorts entries by name.
+	if len(entries) > debugBundleRunsLimit {
+		entries = entries[len(entries)-debugBundleRunsLimit:]
+	}
+	for _, entry := range entries {
+		if err := addBundleFile(tw, "runs", filepath.Join(runsDir, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	logs, err := w.addDetachedRunLogs(tw)
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to finalize debug bundle '%s': %w", outPath, err)
+	}
+	if err := gw.Close(); err != nil {
+		return fmt.Errorf("failed to finalize debug bundle '%s': %w", outPath, err)
+	}
+	w.logger.Info().Str("path", outPath).Int("state_files", len(statePaths)).Int("workflow_runs", len(entries)).Int("logs", logs).Msg("Debug bundle written.")
+	return nil
+}
+
+// redactedConfig returns a copy of the configuration in which the values that may
+// hold secrets are replaced by a placeholder, keeping their keys: the values of
+// every `env_vars` map, wherever it is (see redactEnvVars), the DSN of the state
+// backend, and the webhook URL and secret of the notifications.
+func (w *WHAM) redactedConfig() Config {
+	config := redactEnvVars(reflect.ValueOf(*w.config)).Interface().(Config)
+	if b := config.WhamSettings.StateBackend; b != nil && b.DSN != "" {
+		backend := *b
+		backend.DSN = redactedValue
+		config.WhamSettings.StateBackend = &backend
+	}
+	if n := config.WhamSettings.Notifications; n != nil {
+		notifications := *n
+		notifications.WebhookURL = redactedValue
+		if notifications.Secret != "" {
+			notifications.Secret = redactedValue
+		}
+		config.WhamSettings.Notifications = &notifications
+	}
+	return config
+}
+
+// envVarsType is the type of the `env_vars` fields redacted by redactEnvVars.
+var envVarsType = reflect.TypeFor[map[string]string]()
+
+// redactEnvVars returns a copy of a configuration value in which the values of
+// every `env_vars` field, at any depth (e.g., of the steps, step templates,
+// connections and workflow handlers), are replaced by redactedValue. The
+// pointers, slices and maps leading to them are copied, so that the original is
+// left untouched, and a new section holding environment variables is redacted
+// without further ado.
+func redactEnvVars(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.New(v.Type().Elem())
+		copied.Elem().Set(redactEnvVars(v.Elem()))
+		return copied
+	case reflect.Struct:
+		copied := reflect.New(v.Type()).Elem()
+		copied.Set(v)
+		for i := range v.NumField() {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if name, _, _ := strings.Cut(field.Tag.Get("yaml"), ","); name == "env_vars" && field.Type == envVarsType {
+				copied.Field(i).Set(reflect.ValueOf(redactValues(v.Field(i).Interface().(map[string]string))))
+				continue
+			}
+			copied.Field(i).Set(redactEnvVars(v.Field(i)))
+		}
+		return copied
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := range v.Len() {
+			copied.Index(i).Set(redactEnvVars(v.Index(i)))
+		}
+		return copied
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			copied.SetMapIndex(iter.Key(), redactEnvVars(iter.Value()))
+		}
+		return copied
+	default:
+		return v
+	}
+}
+
+// redactValues returns a copy of environment variables with their values replaced
+// by redactedValue.
+func redactValues(envVars map[string]string) map[string]string {
+	if envVars == nil {
+		return nil
+	}
+	redacted := make(map[string]string, len(envVars))
+	for k := range envVars {
+		redacted[k] = redactedValue
+	}
+	return redacted
+}
+
+// addBundleFile adds a file to a debug bundle under the given directory.
+// A missing file is skipped.
+func addBundleFile(tw *tar.Writer, dir, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read '%s' for debug bundle: %w", path, err)
+	}
+	return addBundleEntry(tw, dir+"/"+filepath.Base(path), data)
+}
+
+// addDetachedRunLogs adds the logs of the most recent detached runs to a bundle,
+// truncated to their last debugBundleLogSize bytes, and returns how many.
+func (w *WHAM) addDetachedRunLogs(tw *tar.Writer) (int, error) {
+	dir := w.getDetachedRunsDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, fmt.Errorf("failed to read detached runs directory '%s': %w", dir, err)
+	}
+	var logs []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && strings.HasSuffix(entry.Name(), ".log") {
+			logs = append(logs, entry.Name())
+		}
+	}
+	// The logs are named after the start time of their run, and os.ReadDir sorts
+	// entries by name.
+	if len(logs) > debugBundleLogsLimit {
+		logs = logs[len(logs)-debugBundleLogsLimit:]
+	}
+	for _, name := range logs {
+		path := filepath.Join(dir, name)
+		data, err := readFileTail(path, debugBundleLogSize)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read '%s' for debug bundle: %w", path, err)
+		}
+		if err := addBundleEntry(tw, "logs/"+name, data); err != nil {
+			return 0, err
+		}
+	}
+	return len(logs), nil
+}
+
+// readFileTail returns the last `size` bytes of a file, or all of it if smaller.
+func readFileTail(path string, size int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := max(info.Size()-size, 0)
+	return io.ReadAll(io.NewSectionReader(f, offset, info.Size()-offset))
+}
+
+// addBundleEntry adds a regular file with the given content to a bundle.
+func addBundleEntry(tw *tar.Writer, name string, data []byte) error {
+	header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to add '%s' to bundle: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to add '%s' to bundle: %w", name, err)
+	}
+	return nil
+}
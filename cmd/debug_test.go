@@ -0,0 +1,151 @@
+package cmd_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestDebugBundle_CollectsRedactedConfigAndState verifies that `debug bundle` archives
+// the version, the configuration without secrets, the state files and the run history.
+func TestDebugBundle_CollectsRedactedConfigAndState(t *testing.T) {
+	const configPath = "../test/settings/settings_connections.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	_, err := runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.NoError(t, err)
+
+	bundlePath := filepath.Join(t.TempDir(), "bundle.tgz")
+	outputStr, err := runWhamCommand(t, "--config", configPath, "debug", "bundle", "--out", bundlePath)
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "Debug bundle written to")
+
+	entries := readDebugBundle(t, bundlePath)
+	var runs int
+	for name := range entries {
+		if filepath.Dir(name) == "runs" {
+			runs++
+		}
+	}
+
+	assert.Contains(t, entries["version.txt"], "Version:")
+	assert.Contains(t, entries["config.yaml"], "VAR1: <redacted>", "Environment variables should be redacted.")
+	assert.NotContains(t, entries["config.yaml"], "warehouse-host", "Connection details should not leak.")
+	assert.Contains(t, entries, "state/wham_uses_connection.state", "The WHAM state files should be included.")
+	assert.Contains(t, entries, "state/uses_connection.state", "The state files of stateful steps should be included.")
+	assert.Equal(t, 1, runs, "The workflow run record should be included.")
+}
+
+// TestDebugBundle_RedactsNotificationSecret verifies that the secret signing the
+// notifications is not written to the bundle.
+func TestDebugBundle_RedactsNotificationSecret(t *testing.T) {
+	const configPath = "../test/settings/settings_notifications_signed.yaml"
+	t.Setenv("WHAM_TEST_WEBHOOK_URL", "http://127.0.0.1:1/hook")
+	t.Setenv("WHAM_TEST_WEBHOOK_SECRET", "bundle-signing-secret")
+
+	bundlePath := filepath.Join(t.TempDir(), "bundle.tgz")
+	outputStr, err := runWhamCommand(t, "--config", configPath, "debug", "bundle", "--out", bundlePath)
+	assert.NoError(t, err, outputStr)
+
+	config := readDebugBundle(t, bundlePath)["config.yaml"]
+	assert.Contains(t, config, "secret: <redacted>")
+	assert.NotContains(t, config, "bundle-signing-secret", "The notifications secret should not leak.")
+}
+
+// TestDebugBundle_CollectsRecentLogs verifies that the bundle includes the logs of
+// the most recent detached runs, truncated to their end.
+func TestDebugBundle_CollectsRecentLogs(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "wham.yaml")
+	config := "wham_settings:\n  data_dir: data\n  metadata_dir: metadata\n  metadata_prefix: wham_\nwham_steps:\n- name: step\n  command: [\"/bin/true\"]\n  previous_steps: []\n"
+	assert.NoError(t, os.WriteFile(configPath, []byte(config), 0644))
+	logsDir := filepath.Join(dir, "metadata", "wham_detached")
+	assert.NoError(t, os.MkdirAll(logsDir, 0755))
+	for day := 1; day <= 6; day++ {
+		name := fmt.Sprintf("2026010%dT000000.000000000", day)
+		content := fmt.Sprintf("output of run %d\n", day)
+		if day == 6 {
+			content = strings.Repeat("x", 2<<20) + content
+		}
+		assert.NoError(t, os.WriteFile(filepath.Join(logsDir, name+".log"), []byte(content), 0644))
+		assert.NoError(t, os.WriteFile(filepath.Join(logsDir, name+".json"), []byte("{}"), 0644))
+	}
+
+	bundlePath := filepath.Join(dir, "bundle.tgz")
+	outputStr, err := runWhamCommand(t, "--config", configPath, "debug", "bundle", "--out", bundlePath)
+	assert.NoError(t, err, outputStr)
+
+	entries := readDebugBundle(t, bundlePath)
+	var logs []string
+	for name := range entries {
+		if filepath.Dir(name) == "logs" {
+			logs = append(logs, name)
+		}
+	}
+	assert.Len(t, logs, 5, "Only the most recent logs should be included.")
+	assert.NotContains(t, entries, "logs/20260101T000000.000000000.log")
+	assert.Equal(t, "output of run 2\n", entries["logs/20260102T000000.000000000.log"])
+	latest := entries["logs/20260106T000000.000000000.log"]
+	assert.Len(t, latest, 1<<20, "A large log should be truncated.")
+	assert.True(t, strings.HasSuffix(latest, "output of run 6\n"), "The end of a truncated log should be kept.")
+}
+
+// readDebugBundle returns the content of every entry of a debug bundle, by name.
+func readDebugBundle(t *testing.T, bundlePath string) map[string]string {
+	t.Helper()
+	f, err := os.Open(bundlePath)
+	assert.NoError(t, err)
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	assert.NoError(t, err)
+	tr := tar.NewReader(gr)
+	entries := make(map[string]string)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		assert.NoError(t, err)
+		entries[header.Name] = string(data)
+	}
+	return entries
+}
+
+// TestDebugBundle_RedactsHandlerEnvVars verifies that the environment variables of
+// the workflow handlers are redacted like those of the steps.
+func TestDebugBundle_RedactsHandlerEnvVars(t *testing.T) {
+	const configPath = "../test/settings/settings_handlers.yaml"
+
+	bundlePath := filepath.Join(t.TempDir(), "bundle.tgz")
+	outputStr, err := runWhamCommand(t, "--config", configPath, "debug", "bundle", "--out", bundlePath)
+	assert.NoError(t, err, outputStr)
+
+	config := readDebugBundle(t, bundlePath)["config.yaml"]
+	assert.Contains(t, config, "TEMPLATED: <redacted>")
+	assert.NotContains(t, config, "templated-", "The environment variables of the handlers should not leak.")
+}
+
+// TestDebugBundle_RedactsStepTemplateEnvVars verifies that the environment
+// variables of the step templates are redacted like those of the steps.
+func TestDebugBundle_RedactsStepTemplateEnvVars(t *testing.T) {
+	const configPath = "../test/settings/settings_step_templates.yaml"
+
+	bundlePath := filepath.Join(t.TempDir(), "bundle.tgz")
+	outputStr, err := runWhamCommand(t, "--config", configPath, "debug", "bundle", "--out", bundlePath)
+	assert.NoError(t, err, outputStr)
+
+	config := readDebugBundle(t, bundlePath)["config.yaml"]
+	assert.Contains(t, config, "step_templates:")
+	assert.Contains(t, config, "TARGET: <redacted>")
+	assert.NotContains(t, config, "warehouse", "The environment variables of the step templates should not leak.")
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+)
+
+// depthProgress tracks the steps of each DAG depth during a parallel run, so that
+// each depth is summarized once all of its steps have finished. Steps of a deeper
+// depth may finish first, as they only wait for their own predecessors: depths are
+// nevertheless reported in order, once every shallower depth has been reported.
+type depthProgress struct {
+	w *WHAM
+	// depths holds the depth of the tracked steps.
+	depths map[string]int
+	// remaining counts, for each depth, the tracked steps that have not finished.
+	remaining map[int]int
+	stats     map[int]*depthStats
+	// next is the shallowest depth not reported yet, and maxDepth the deepest one.
+	next, maxDepth int
+}
+
+// depthStats are the outcomes of the steps of a depth.
+type depthStats struct {
+	run, skipped, failed int
+	// started is when the first step of the depth started.
+	started time.Time
+	// longest is the step of the depth that took the longest, and longestElapsed its duration.
+	longest        string
+	longestElapsed time.Duration
+}
+
+// newDepthProgress returns the tracker of the steps of a parallel run.
+func (w *WHAM) newDepthProgress(steps []*Step) *depthProgress {
+	p := &depthProgress{w: w, depths: make(map[string]int), remaining: make(map[int]int), stats: make(map[int]*depthStats)}
+	for i, step := range steps {
+		depth := p.track(step)
+		if i == 0 || depth < p.next {
+			p.next = depth
+		}
+	}
+	return p
+}
+
+// add tracks a step added to the run, unless its depth has already been reported
+// (e.g., a step generated at the depth of a sibling of its generator).
+func (p *depthProgress) add(step *Step) {
+	if p.w.stepDepth(step.Name) >= p.next {
+		p.track(step)
+	}
+}
+
+// track counts a step in its depth, and returns the depth.
+func (p *depthProgress) track(step *Step) int {
+	depth := p.w.stepDepth(step.Name)
+	p.depths[step.Name] = depth
+	p.remaining[depth]++
+	p.maxDepth = max(p.maxDepth, depth)
+	if p.stats[depth] == nil {
+		p.stats[depth] = &depthStats{}
+	}
+	return depth
+}
+
+// start records that a step started.
+func (p *depthProgress) start(step *Step) {
+	depth, ok := p.depths[step.Name]
+	if ok && p.stats[depth].started.IsZero() {
+		p.stats[depth].started = time.Now()
+	}
+}
+
+// finish records the outcome of a step that took `elapsed`, then prints the
+// summary of the depths whose steps have all finished, in order.
+func (p *depthProgress) finish(step *Step, elapsed time.Duration) {
+	depth, ok := p.depths[step.Name]
+	if !ok {
+		return
+	}
+	stats := p.stats[depth]
+	switch p.w.getCurrentStepWhamState(step.Name).RunAction {
+	case "run":
+		stats.run++
+	case "skipped":
+		stats.skipped++
+	default:
+		stats.failed++
+	}
+	if elapsed > stats.longestElapsed {
+		stats.longest, stats.longestElapsed = step.Name, elapsed
+	}
+	p.remaining[depth]--
+
+	for p.next <= p.maxDepth && p.remaining[p.next] == 0 {
+		if stats := p.stats[p.next]; stats != nil {
+			fmt.Printf("📊 Depth %d finished: %d run, %d skipped, %d failed in %s (longest: '%s', %s).\n",
+				p.next, stats.run, stats.skipped, stats.failed,
+				time.Since(stats.started).Round(time.Millisecond), stats.longest, stats.longestElapsed.Round(time.Millisecond))
+		}
+		p.next++
+	}
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DetachedRun is the journal record of a workflow run started with `run all --detach`.
+type DetachedRun struct {
+	// PID is the process ID of the detached WHAM process.
+	PID int `json:"pid" yaml:"pid"`
+	// StartedAt is the time the process was started.
+	StartedAt time.Time `json:"started_at" yaml:"started_at"`
+	// Args are the command-line arguments of the process.
+	Args []string `json:"args" yaml:"args"`
+	// LogFile is the file receiving the output of the process.
+	LogFile string `json:"log_file" yaml:"log_file"`
+}
+
+// getDetachedRunsDir returns the directory where the journals of detached runs are
+// kept: a record and a log file per run, named after its start time.
+func (w *WHAM) getDetachedRunsDir() string {
+	return filepath.Join(w.config.WhamSettings.MetadataDir, w.config.WhamSettings.MetadataPrefix+"detached")
+}
+
+// detachedArgs returns the command-line arguments of the current process without
+// the --detach flag, i.e. those of the process it detaches.
+func detachedArgs(args []string) []string {
+	return slices.DeleteFunc(slices.Clone(args), func(arg string) bool {
+		return arg == "--detach" || strings.HasPrefix(arg, "--detach=")
+	})
+}
+
+// Detach starts the current command again, without --detach, as a background
+// process in its own session, so that it outlives the terminal it was started
+// from. Its output is written to a log file, and a record of the process is
+// written next to it, in the detached runs directory, for `wham status`.
+func (w *WHAM) Detach() (*DetachedRun, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate the WHAM executable: %w", err)
+	}
+	dir := w.getDetachedRunsDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create detached runs directory '%s': %w", dir, err)
+	}
+
+	run := &DetachedRun{StartedAt: time.Now(), Args: detachedArgs(os.Args[1:])}
+	name := run.StartedAt.Format("20060102T150405.000000000")
+	run.LogFile = filepath.Join(dir, name+".log")
+	logFile, err := os.OpenFile(run.LogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log file of the detached run: %w", err)
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(executable, run.Args...)
+	cmd.Stdout, cmd.Stderr = logFile, logFile // Stdin is /dev/null.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start the detached run: %w", err)
+	}
+	run.PID = cmd.Process.Pid
+	// The process is not waited for: once WHAM exits, it is adopted by init.
+	cmd.Process.Release()
+
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal detached run record: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".json"), data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write detached run record: %w", err)
+	}
+	w.logger.Info().Int("pid", run.PID).Str("log_file", run.LogFile).Msg("Workflow run detached.")
+	return run, nil
+}
+
+// listDetachedRuns returns the detached runs whose process is still running, in
+// order of start. The records of the runs whose process exited are removed, but
+// their log files are kept.
+func (w *WHAM) listDetachedRuns() ([]DetachedRun, error) {
+	dir := w.getDetachedRunsDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read detached runs directory '%s': %w", dir, err)
+	}
+
+	var runs []DetachedRun
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read detached run record '%s': %w", path, err)
+		}
+		var run DetachedRun
+		if err := json.Unmarshal(data, &run); err != nil {
+			w.logger.Warn().Str("path", path).Err(err).Msg("Ignoring invalid detached run record.")
+			continue
+		}
+		if !isProcessRunning(run.PID) {
+			w.logger.Debug().Str("path", path).Int("pid", run.PID).Msg("Removing the record of a finished detached run.")
+			os.Remove(path)
+			continue
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil // Sorted by start time, as the file names are.
+}
+
+// isProcessRunning reports whether a process with the given PID exists and has not
+// exited yet (zombie processes are considered exited).
+func isProcessRunning(pid int) bool {
+	if err := syscall.Kill(pid, 0); err != nil && !errors.Is(err, syscall.EPERM) {
+		return false
+	}
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	return err != nil || !strings.Contains(string(stat), ") Z ")
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// loadEnvFiles reads the dotenv files of the settings and of a step, in that
+// order, and returns their variables as "KEY=value" entries for the step's
+// environment. Values are templates, processed with `templateContext` like the
+// step's env_vars. Relative paths are resolved against the config file's directory.
+// A variable defined by several files takes the value of the last one.
+func (w *WHAM) loadEnvFiles(step *Step, templateContext TemplateContext) ([]string, error) {
+	paths := append(append([]string{}, w.config.WhamSettings.EnvFiles...), step.EnvFiles...)
+	var env []string
+	for _, path := range paths {
+		vars, err := parseEnvFile(w.resolvePath(path))
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range vars {
+			value, err := w.processTemplateString(v[1], templateContext)
+			if err != nil {
+				return nil, fmt.Errorf("failed to process template for variable '%s' of env file '%s': %w", v[0], path, err)
+			}
+			env = append(env, fmt.Sprintf("%s=%s", v[0], value))
+		}
+	}
+	return env, nil
+}
+
+// parseEnvFile parses a dotenv file into its key/value pairs, in order.
+//
+// Each non-empty line that is not a comment (`#`) has the form `KEY=value`,
+// optionally prefixed with `export`. A value can be enclosed in single quotes,
+// taken literally, or in double quotes, where `\n`, `\"` and `\\` are unescaped.
+// An unquoted value is trimmed and ends at a ` #` comment.
+func parseEnvFile(path string) ([][2]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open env file '%s': %w", path, err)
+	}
+	defer f.Close()
+
+	var vars [][2]string
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("invalid line %d in env file '%s': expected KEY=value", lineNum, path)
+		}
+		value, err := parseEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid line %d in env file '%s': %w", lineNum, path, err)
+		}
+		vars = append(vars, [2]string{key, value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read env file '%s': %w", path, err)
+	}
+	return vars, nil
+}
+
+// parseEnvValue unquotes the value of a dotenv line. See parseEnvFile.
+func parseEnvValue(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	switch quote := value[0]; quote {
+	case '\'', '"':
+		end := strings.LastIndexByte(value, quote)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated quoted value")
+		}
+		if quote == '\'' {
+			return value[1:end], nil
+		}
+		return strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`).Replace(value[1:end]), nil
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value, nil
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// errStaleOutputs is returned when a step succeeded without producing or updating
+// one of its `expected_outputs`.
+var errStaleOutputs = errors.New("expected outputs not produced")
+
+// outputSnapshot is the state of an expected output before the step's execution.
+type outputSnapshot struct {
+	exists  bool
+	modTime time.Time
+	size    int64
+}
+
+// snapshotExpectedOutputs records the state of the step's `expected_outputs`
+// before its execution, keyed by their resolved paths.
+func (w *WHAM) snapshotExpectedOutputs(step *Step) map[string]outputSnapshot {
+	if len(step.ExpectedOutputs) == 0 {
+		return nil
+	}
+	snapshots := make(map[string]outputSnapshot, len(step.ExpectedOutputs))
+	for _, output := range step.ExpectedOutputs {
+		path := w.resolvePath(output)
+		if stat, err := os.Stat(path); err == nil {
+			snapshots[path] = outputSnapshot{exists: true, modTime: stat.ModTime(), size: stat.Size()}
+		} else {
+			snapshots[path] = outputSnapshot{}
+		}
+	}
+	return snapshots
+}
+
+// checkExpectedOutputs verifies, after a successful execution started at `start`,
+// that every one of the step's `expected_outputs` exists and was written by it:
+// its modification time must not be older than `start`, or else its modification
+// time or size must differ from its snapshot (e.g., a file copied with its
+// original modification time). This flags scripts that exit 0 without producing
+// anything.
+//
+// If an output is missing or stale and the step's `expected_outputs_policy` is
+// "warn", a warning is printed and recorded in the result, and nil is returned.
+// Otherwise (policy "fail", the default), an error wrapping errStaleOutputs is
+// returned so that the execution is treated as failed.
+func (w *WHAM) checkExpectedOutputs(step *Step, snapshots map[string]outputSnapshot, start time.Time, result *stepResult) error {
+	var problems []string
+	for _, output := range step.ExpectedOutputs {
+		path := w.resolvePath(output)
+		stat, err := os.Stat(path)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("'%s' does not exist", output))
+			continue
+		}
+		before := snapshots[path]
+		updated := !before.exists || !stat.ModTime().Equal(before.modTime) || stat.Size() != before.size || !stat.ModTime().Before(start)
+		if !updated {
+			problems = append(problems, fmt.Sprintf("'%s' was not updated (last modified at %s)", output, stat.ModTime().Format(time.RFC3339)))
+		}
+	}
+	if len(problems) == 0 {
+		w.logger.Debug().Str("step", step.Name).Strs("expected_outputs", step.ExpectedOutputs).Msg("Expected outputs produced.")
+		return nil
+	}
+
+	detail := strings.Join(problems, ", ")
+	if step.ExpectedOutputsPolicy == "warn" {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("expected outputs not produced: %s", detail))
+		fmt.Printf("⚠️ Step '%s' succeeded without producing its expected outputs: %s\n", step.Name, detail)
+		w.logger.Warn().Str("step", step.Name).Str("outputs", detail).Msg("Expected outputs not produced, continuing as policy is 'warn'.")
+		return nil
+	}
+	return fmt.Errorf("%w: %s", errStaleOutputs, detail)
+}
@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"time"
+)
+
+// stderrTailLimit is the number of bytes of a script's standard error kept to
+// classify its failures.
+const stderrTailLimit = 64 << 10
+
+// stderrDrainDelay is how long the standard error of a script is still read after
+// it exited, since processes it left behind may keep it open.
+const stderrDrainDelay = time.Second
+
+// FailurePattern classifies the failures of a step whose standard error matches a
+// regular expression (e.g., "quota exceeded" from a vendor CLI), and determines how
+// they are retried and notified.
+type FailurePattern struct {
+	// Pattern is the regular expression (RE2 syntax) matched against the standard
+	// error of the failed execution, followed by the error WHAM reports for it.
+	Pattern string `yaml:"pattern" json:"pattern"`
+	// Class names the kind of failure (e.g., "quota_exceeded"). It is recorded in
+	// the step's state and in its failure notification.
+	Class string `yaml:"class" json:"class"`
+	// Action is what to do with a failure of this class: "retry" (default) retries
+	// the step up to its `retries`, "fatal" fails it without any further attempt.
+	Action string `yaml:"action,omitempty" json:"action,omitempty"`
+	// Notify, if false, suppresses the notification of failures of this class.
+	Notify *bool `yaml:"notify,omitempty" json:"notify,omitempty"`
+}
+
+// Failure pattern actions.
+const (
+	// FailureActionRetry retries a failure up to the step's `retries`.
+	FailureActionRetry = "retry"
+	// FailureActionFatal fails the step without retrying.
+	FailureActionFatal = "fatal"
+)
+
+// validate checks the failure pattern for semantic errors.
+func (p *FailurePattern) validate() error {
+	if p.Pattern == "" || p.Class == "" {
+		return fmt.Errorf("failure patterns must have both a 'pattern' and a 'class' defined")
+	}
+	if _, err := regexp.Compile(p.Pattern); err != nil {
+		return fmt.Errorf("invalid failure pattern '%s': %w", p.Pattern, err)
+	}
+	switch p.Action {
+	case "", FailureActionRetry, FailureActionFatal:
+	default:
+		return fmt.Errorf("failure pattern action must be '%s' or '%s', got '%s'", FailureActionRetry, FailureActionFatal, p.Action)
+	}
+	return nil
+}
+
+// classifiedFailure is the error of a failed execution matched by a failure pattern.
+type classifiedFailure struct {
+	pattern *FailurePattern
+	err     error
+}
+
+// Error implements the error interface.
+func (c *classifiedFailure) Error() string {
+	return fmt.Sprintf("%v (classified as '%s')", c.err, c.pattern.Class)
+}
+
+// Unwrap returns the error of the failed execution.
+func (c *classifiedFailure) Unwrap() error {
+	return c.err
+}
+
+// classifyFailure matches the standard error of a failed execution and its error
+// against the failure patterns of the step, then those of the settings, and returns
+// the error wrapped in a classifiedFailure for the first one that matches. The error
+// is returned unchanged if no pattern matches, or if the workflow run was aborted.
+func (w *WHAM) classifyFailure(step *Step, execErr error, result stepResult) error {
+	if w.runContext().Err() != nil {
+		return execErr
+	}
+	text := result.Stderr + "\n" + execErr.Error()
+	for _, patterns := range [][]FailurePattern{step.FailurePatterns, w.config.WhamSettings.FailurePatterns} {
+		for i := range patterns {
+			re, err := regexp.Compile(patterns[i].Pattern)
+			if err != nil {
+				continue // Rejected when the configuration is loaded.
+			}
+			if re.MatchString(text) {
+				w.logger.Info().Str("step", step.Name).Str("class", patterns[i].Class).Str("action", patterns[i].action()).Msg("Failure classified.")
+				return &classifiedFailure{pattern: &patterns[i], err: execErr}
+			}
+		}
+	}
+	return execErr
+}
+
+// action returns the action of the failure pattern, defaulting to "retry".
+func (p *FailurePattern) action() string {
+	if p.Action == "" {
+		return FailureActionRetry
+	}
+	return p.Action
+}
+
+// failureClass returns the class of a classified failure, or "".
+func failureClass(err error) string {
+	var classified *classifiedFailure
+	if errors.As(err, &classified) {
+		return classified.pattern.Class
+	}
+	return ""
+}
+
+// isFatalFailure reports whether a failure was classified as fatal, i.e. must not be retried.
+func isFatalFailure(err error) bool {
+	var classified *classifiedFailure
+	return errors.As(err, &classified) && classified.pattern.action() == FailureActionFatal
+}
+
+// isNotifiedFailure reports whether a failure must be notified, i.e. it was not
+// classified by a pattern with `notify: false`.
+func isNotifiedFailure(err error) bool {
+	var classified *classifiedFailure
+	return !errors.As(err, &classified) || classified.pattern.Notify == nil || *classified.pattern.Notify
+}
+
+// tailBuffer is an io.Writer that keeps the last `limit` bytes written to it.
+type tailBuffer struct {
+	limit int
+	data  []byte
+}
+
+// Write implements the io.Writer interface.
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.data = append(b.data, p...)
+	// Trim only once twice the limit is reached, so that data is not moved on every write.
+	if len(b.data) > 2*b.limit {
+		b.data = append(b.data[:0:0], b.data[len(b.data)-b.limit:]...)
+	}
+	return len(p), nil
+}
+
+// String returns the last `limit` bytes written to the buffer.
+func (b *tailBuffer) String() string {
+	return string(b.data[max(0, len(b.data)-b.limit):])
+}
+
+// stderrPipe copies the standard error of a command to a writer. Unlike a writer
+// set as cmd.Stderr, the pipe is not waited for by cmd.Wait, which returns as soon
+// as the script exits, even if processes it spawned still hold the pipe open.
+type stderrPipe struct {
+	r, w *os.File
+	done chan struct{}
+}
+
+// pipeStderr sets the standard error of the command to a new stderrPipe copied to `out`.
+func pipeStderr(cmd *exec.Cmd, out io.Writer) (*stderrPipe, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the standard error pipe: %w", err)
+	}
+	p := &stderrPipe{r: r, w: w, done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		io.Copy(out, r)
+	}()
+	cmd.Stderr = w
+	return p, nil
+}
+
+// close stops the copy once the command exited: whatever the script wrote is
+// copied, but the processes it left behind are waited for no longer than
+// stderrDrainDelay.
+func (p *stderrPipe) close() {
+	p.w.Close()
+	select {
+	case <-p.done:
+	case <-time.After(stderrDrainDelay):
+	}
+	p.r.Close()
+	<-p.done
+}
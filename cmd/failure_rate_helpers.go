@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxFailureRatePattern parses a `max_failure_rate`: the rate, followed by the
+// window it is computed over (e.g., "0.2 over 7d").
+var maxFailureRatePattern = regexp.MustCompile(`^(\d*\.?\d+)\s+over\s+(\S+)$`)
+
+// maxFailureRate is the parsed `max_failure_rate` of a step.
+type maxFailureRate struct {
+	// rate is the highest share of executions that may fail, between 0 and 1.
+	rate float64
+	// window is how far back the executions are taken into account, and windowText
+	// how it was written in the configuration.
+	window     time.Duration
+	windowText string
+}
+
+// FailureRateStats are the executions of a step over its `max_failure_rate` window.
+type FailureRateStats struct {
+	// Executions is the number of executions of the step in the window.
+	Executions int `json:"executions"`
+	// Failures is the number of those executions that failed.
+	Failures int `json:"failures"`
+	// Rate is the share of the executions that failed.
+	Rate float64 `json:"rate"`
+	// Max is the rate that may not be exceeded.
+	Max float64 `json:"max"`
+	// Window is the window of the executions, as configured (e.g., "7d").
+	Window string `json:"window"`
+}
+
+// failureRateState is the persisted execution history of a step with a
+// `max_failure_rate`, limited to its window.
+type failureRateState struct {
+	Executions []stepExecution `json:"executions,omitempty"`
+	// Alerting is true if the rate was reported as exceeded and has not fallen back
+	// below the maximum since.
+	Alerting bool `json:"alerting"`
+}
+
+// stepExecution is the outcome of an execution of a step.
+type stepExecution struct {
+	Time   time.Time `json:"time"`
+	Failed bool      `json:"failed"`
+}
+
+// parseMaxFailureRate parses a `max_failure_rate`. The window is a duration
+// ("36h") or a number of days ("7d").
+func parseMaxFailureRate(value string) (maxFailureRate, error) {
+	match := maxFailureRatePattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return maxFailureRate{}, fmt.Errorf("invalid max_failure_rate '%s': expected '<rate> over <window>', e.g. '0.2 over 7d'", value)
+	}
+	rate, err := strconv.ParseFloat(match[1], 64)
+	if err != nil || rate >= 1 {
+		return maxFailureRate{}, fmt.Errorf("invalid max_failure_rate '%s': the rate must be at least 0 and below 1", value)
+	}
+	window, err := parseDurationOrDays(match[2])
+	if err != nil || window <= 0 {
+		return maxFailureRate{}, fmt.Errorf("invalid max_failure_rate '%s': the window must be a positive duration such as '36h' or '7d'", value)
+	}
+	return maxFailureRate{rate: rate, window: window, windowText: match[2]}, nil
+}
+
+// parseDurationOrDays parses a duration ("36h") or a number of days ("7d").
+func parseDurationOrDays(value string) (time.Duration, error) {
+	days, ok := strings.CutSuffix(value, "d")
+	if !ok {
+		return time.ParseDuration(value)
+	}
+	n, err := strconv.Atoi(days)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number of days '%s'", value)
+	}
+	return time.Duration(n) * 24 * time.Hour, nil
+}
+
+// getFailureRateStateFilePath returns the path of the file holding a step's execution history.
+func (w *WHAM) getFailureRateStateFilePath(stepName string) string {
+	return filepath.Join(w.config.WhamSettings.MetadataDir, w.config.WhamSettings.MetadataPrefix+"failure_rates", stepName+".json")
+}
+
+// loadFailureRateState reads a step's execution history. A missing or unreadable
+// file results in an empty history.
+func (w *WHAM) loadFailureRateState(stepName string) failureRateState {
+	var state failureRateState
+	path := w.getFailureRateStateFilePath(stepName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			w.logger.Warn().Str("step", stepName).Str("path", path).Err(err).Msg("Could not read execution history, starting a new one.")
+		}
+		return state
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		w.logger.Warn().Str("step", stepName).Str("path", path).Err(err).Msg("Could not parse execution history, starting a new one.")
+		return failureRateState{}
+	}
+	return state
+}
+
+// saveFailureRateState writes a step's execution history.
+func (w *WHAM) saveFailureRateState(stepName string, state failureRateState) error {
+	path := w.getFailureRateStateFilePath(stepName)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create failure rates directory '%s': %w", filepath.Dir(path), err)
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal execution history for '%s': %w", stepName, err)
+	}
+	return writeFileAtomically(path, data)
+}
+
+// checkFailureRate records the outcome of a step's execution in its history, if
+// it has a `max_failure_rate`, and checks the rate of the failed executions over
+// its window, the one that just ended included. `execErr` is nil if the step
+// succeeded.
+//
+// Failures tolerated by `can_fail` count as well, so that a step slowly getting
+// less reliable is noticed even though the workflow keeps succeeding. While the
+// rate is above the maximum, a warning is printed and returned to be recorded in
+// the step's state. When notifications are configured, a "failure_rate"
+// notification is sent once, when the rate goes above the maximum; it is sent
+// again only after the rate has fallen back to the maximum or below.
+func (w *WHAM) checkFailureRate(step *Step, execErr error) string {
+	if step.MaxFailureRate == "" {
+		return ""
+	}
+	limit, err := parseMaxFailureRate(step.MaxFailureRate)
+	if err != nil {
+		return "" // Already validated at load time; kept for robustness.
+	}
+
+	now := time.Now()
+	state := w.loadFailureRateState(step.Name)
+	executions := []stepExecution{}
+	for _, execution := range state.Executions {
+		if now.Sub(execution.Time) < limit.window {
+			executions = append(executions, execution)
+		}
+	}
+	state.Executions = append(executions, stepExecution{Time: now, Failed: execErr != nil})
+
+	stats := FailureRateStats{Executions: len(state.Executions), Max: limit.rate, Window: limit.windowText}
+	for _, execution := range state.Executions {
+		if execution.Failed {
+			stats.Failures++
+		}
+	}
+	stats.Rate = float64(stats.Failures) / float64(stats.Executions)
+
+	warning := ""
+	switch {
+	case stats.Rate > limit.rate:
+		warning = fmt.Sprintf("failed %d of its %d executions over the last %s, above its max_failure_rate (%s)", stats.Failures, stats.Executions, limit.windowText, step.MaxFailureRate)
+		fmt.Printf("📉 Step '%s' %s.\n", step.Name, warning)
+		w.logger.Warn().Str("step", step.Name).Int("failures", stats.Failures).Int("executions", stats.Executions).Str("max_failure_rate", step.MaxFailureRate).Msg("Step exceeds its max_failure_rate.")
+		if !state.Alerting {
+			state.Alerting = w.notifyFailureRate(step, stats)
+		}
+	case state.Alerting:
+		state.Alerting = false
+		w.logger.Info().Str("step", step.Name).Str("max_failure_rate", step.MaxFailureRate).Msg("Step failure rate is back within its max_failure_rate.")
+	}
+
+	if err := w.saveFailureRateState(step.Name, state); err != nil {
+		w.logger.Warn().Str("step", step.Name).Err(err).Msg("Could not save execution history.")
+	}
+	return warning
+}
+
+// notifyFailureRate sends the "failure_rate" notification of a step, if
+// notifications are configured. It reports whether the alert is raised, i.e. it
+// does not need to be sent again: a notification that cannot be delivered is
+// attempted again after the next execution of the step.
+func (w *WHAM) notifyFailureRate(step *Step, stats FailureRateStats) bool {
+	if w.config.WhamSettings.Notifications == nil {
+		return true
+	}
+	notification := Notification{Event: NotificationFailureRate, Step: step.Name, FailureRate: &stats, Time: time.Now()}
+	if w.activeRun != nil {
+		notification.WorkflowRunID = w.activeRun.ID
+	}
+	if err := w.sendNotification(step, notification); err != nil {
+		w.logger.Warn().Str("step", step.Name).Str("event", notification.Event).Err(err).Msg("Could not send notification.")
+		return false
+	}
+	w.logger.Info().Str("step", step.Name).Str("event", notification.Event).Msg("Notification sent.")
+	return true
+}
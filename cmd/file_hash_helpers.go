@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// outputsRunID returns the run_id of a stateful step with `run_id_from_outputs`: a
+// hash of the files matching its patterns after its execution (see hashFiles), so
+// that the script need not write a state file.
+//
+// If no file matches any pattern, the step has no valid run_id, as with a missing
+// state file, and an empty string is returned.
+func (w *WHAM) outputsRunID(step *Step) (string, error) {
+	hash, files, err := w.hashFiles(step.RunIDFromOutputs)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash the outputs of step '%s': %w", step.Name, err)
+	}
+	if files == 0 {
+		w.logger.Warn().Str("step", step.Name).Strs("run_id_from_outputs", step.RunIDFromOutputs).Msg("No output matches run_id_from_outputs. Using empty string as run_id.")
+		return "", nil
+	}
+	w.logger.Debug().Str("step", step.Name).Int("files", files).Msg("Derived run_id from outputs.")
+	return hash[:16], nil
+}
+
+// inputsHash returns the hash of the files matching the `inputs` of a stateless
+// step (see hashFiles), or an empty string if it has none. A step whose inputs
+// match no file still gets a hash, so that files appearing later are noticed.
+func (w *WHAM) inputsHash(step *Step) (string, error) {
+	if len(step.Inputs) == 0 {
+		return "", nil
+	}
+	hash, files, err := w.hashFiles(step.Inputs)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash the inputs of step '%s': %w", step.Name, err)
+	}
+	w.logger.Debug().Str("step", step.Name).Int("files", files).Str("inputs_hash", hash).Msg("Hashed step inputs.")
+	return hash, nil
+}
+
+// hashFiles returns the hex SHA-256 hash of the files matching glob patterns,
+// relative to the config file's directory, and their number. Each file
+// contributes its path, relative to the config file's directory, and its content,
+// in lexical order of the paths, so the hash changes whenever a file is added,
+// removed, renamed or modified, and only then. Directories are ignored.
+func (w *WHAM) hashFiles(patterns []string) (string, int, error) {
+	seen := make(map[string]bool)
+	var files []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(w.resolvePath(pattern))
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+		for _, match := range matches {
+			if stat, err := os.Stat(match); err == nil && stat.Mode().IsRegular() && !seen[match] {
+				seen[match] = true
+				files = append(files, match)
+			}
+		}
+	}
+	sort.Strings(files)
+
+	hash := sha256.New()
+	for _, file := range files {
+		name, err := filepath.Rel(w.config.ConfigDir, file)
+		if err != nil {
+			name = file
+		}
+		fileHash, err := hashFile(file)
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to hash '%s': %w", name, err)
+		}
+		fmt.Fprintf(hash, "%s=%s\n", filepath.ToSlash(name), fileHash)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), len(files), nil
+}
+
+// hashFile returns the hex SHA-256 of a file's content.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,19 @@
+package cmd
+
+// Fleet-related concrete command structs
+
+// FleetCmd groups the commands working on several workflows at once.
+type FleetCmd struct {
+	Status FleetStatusCmd `cmd:"" help:"Show the last run outcome and the stale steps of several workflows."`
+}
+
+// FleetStatusCmd handles the 'fleet status' command.
+type FleetStatusCmd struct {
+	Configs []string `help:"Glob pattern of the configuration files of the workflows (repeatable)." required:"" placeholder:"GLOB"`
+}
+
+// Fleet-related command implementations
+
+func (f *FleetStatusCmd) Run(ctx *Context) error {
+	return ShowFleetStatus(f.Configs, ctx.OutputFormat, ctx.Logger)
+}
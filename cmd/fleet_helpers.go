@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// PipelineStatus is the summary of a workflow shown by `wham fleet status`.
+type PipelineStatus struct {
+	// Config is the path of the configuration file of the workflow.
+	Config string `json:"config" yaml:"config"`
+	// Error explains why the status of the workflow could not be collected, e.g.
+	// because its configuration is invalid.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+	// Running is the number of WHAM processes currently running the workflow.
+	Running int `json:"running" yaml:"running"`
+	// LastRun is the most recent finished workflow run, if any.
+	LastRun *WorkflowRun `json:"last_run,omitempty" yaml:"last_run,omitempty"`
+	// FailedSteps lists the steps whose last recorded action is "failed".
+	FailedSteps []string `json:"failed_steps" yaml:"failed_steps"`
+	// StaleSteps lists the steps whose predecessors changed since they last ran.
+	StaleSteps []string `json:"stale_steps" yaml:"stale_steps"`
+}
+
+// ShowFleetStatus loads the configuration files matching the glob patterns, each
+// one being a separate workflow, and reports the outcome of their last run and
+// their stale steps in a single view. A workflow whose status cannot be collected
+// is reported with its error, rather than hiding the others.
+func ShowFleetStatus(patterns []string, outputFormat string, logger zerolog.Logger) error {
+	configPaths, err := expandConfigPatterns(patterns)
+	if err != nil {
+		return err
+	}
+	pipelines := make([]PipelineStatus, 0, len(configPaths))
+	for _, path := range configPaths {
+		pipelines = append(pipelines, collectPipelineStatus(path, logger))
+	}
+
+	switch outputFormat {
+	case "json", "yaml":
+		return RenderData(os.Stdout, pipelines, outputFormat)
+	case "table", "wide":
+		return renderFleetStatus(pipelines)
+	default:
+		return fmt.Errorf("unsupported output format: '%s'", outputFormat)
+	}
+}
+
+// expandConfigPatterns returns the sorted and deduplicated files matching the
+// glob patterns. A pattern matching no file is an error, as it is most likely a typo.
+func expandConfigPatterns(patterns []string) ([]string, error) {
+	var paths []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no configuration file matches '%s'", pattern)
+		}
+		paths = append(paths, matches...)
+	}
+	slices.Sort(paths)
+	return slices.Compact(paths), nil
+}
+
+// collectPipelineStatus loads the workflow of a configuration file and collects its status.
+func collectPipelineStatus(configPath string, logger zerolog.Logger) PipelineStatus {
+	pipeline := PipelineStatus{Config: configPath, FailedSteps: []string{}, StaleSteps: []string{}}
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		pipeline.Error = err.Error()
+		return pipeline
+	}
+	w, err := NewWHAM(config, logger.With().Str("config", configPath).Logger())
+	if err != nil {
+		pipeline.Error = err.Error()
+		return pipeline
+	}
+	report, err := w.collectStatus()
+	if err != nil {
+		pipeline.Error = err.Error()
+		return pipeline
+	}
+	pipeline.Running = len(report.Running)
+	pipeline.LastRun = report.LastRun
+	pipeline.FailedSteps = report.FailedSteps
+	pipeline.StaleSteps = report.StaleSteps
+	return pipeline
+}
+
+// renderFleetStatus displays the status of the workflows, one row per workflow.
+// When the output is a terminal, the workflows whose status could not be collected, or whose
+// last run or steps failed are shown in red, those with stale steps in yellow,
+// and the others that ran in green. The errors are listed below the table.
+func renderFleetStatus(pipelines []PipelineStatus) error {
+	colors := colorsEnabled(os.Stdout)
+	tr := NewTableRenderer(os.Stdout, "CONFIG", "RUNNING", "LAST RUN", "STATUS", "FINISHED", "FAILED STEPS", "STALE STEPS")
+	var broken []PipelineStatus
+	for _, p := range pipelines {
+		running, runID, status, finished := fmt.Sprint(p.Running), "-", "-", "-"
+		switch {
+		case p.Error != "":
+			running, status = "-", "error"
+			broken = append(broken, p)
+		case p.LastRun == nil:
+			status = "never run"
+		default:
+			runID = p.LastRun.ID
+			status = p.LastRun.Status
+			finished = p.LastRun.FinishedAt.Format("2006-01-02 15:04:05")
+		}
+
+		color := ""
+		switch {
+		case !colors:
+		case p.Error != "" || status == "failed" || len(p.FailedSteps) > 0:
+			color = colorRed
+		case len(p.StaleSteps) > 0:
+			color = colorYellow
+		case p.LastRun != nil:
+			color = colorGreen
+		}
+		tr.AddColoredRow(color, p.Config, running, runID, status, finished,
+			orDash(strings.Join(p.FailedSteps, ", ")), orDash(strings.Join(p.StaleSteps, ", ")))
+	}
+	if err := tr.Render(); err != nil {
+		return err
+	}
+
+	ew := &errorWriter{w: os.Stdout}
+	if len(broken) > 0 {
+		ew.Println()
+	}
+	for _, p := range broken {
+		ew.Printf("❌ Workflow '%s': %s\n", p.Config, p.Error)
+	}
+	return ew.err
+}
@@ -0,0 +1,52 @@
+package cmd_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFleetStatus verifies that `fleet status` reports the last run and the stale
+// steps of every workflow matching the patterns, and the error of a workflow whose
+// configuration cannot be loaded, without failing.
+func TestFleetStatus(t *testing.T) {
+	const configPath = "../test/settings/settings_state_files.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	_, err := runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.NoError(t, err)
+	_, err = runWhamCommand(t, "--config", configPath, "state", "delete", "build_report", "-y")
+	assert.NoError(t, err)
+
+	outputStr, err := runWhamCommand(t, "fleet", "status", "--configs", configPath, "--configs", "../test/settings/settings_fail_yaml_*.yaml", "-o", "json")
+	assert.NoError(t, err, outputStr)
+	var pipelines []struct {
+		Config  string `json:"config"`
+		Error   string `json:"error"`
+		LastRun *struct {
+			Status string `json:"status"`
+		} `json:"last_run"`
+		FailedSteps []string `json:"failed_steps"`
+		StaleSteps  []string `json:"stale_steps"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &pipelines))
+	if !assert.Len(t, pipelines, 3) {
+		return
+	}
+	assert.Equal(t, "../test/settings/settings_fail_yaml_syntax.yaml", pipelines[0].Config)
+	assert.Contains(t, pipelines[0].Error, "failed to parse YAML")
+	assert.NotEmpty(t, pipelines[1].Error)
+
+	assert.Equal(t, configPath, pipelines[2].Config)
+	assert.Empty(t, pipelines[2].Error)
+	if assert.NotNil(t, pipelines[2].LastRun) {
+		assert.Equal(t, "succeeded", pipelines[2].LastRun.Status)
+	}
+	assert.Empty(t, pipelines[2].FailedSteps)
+	assert.Equal(t, []string{"build_report"}, pipelines[2].StaleSteps)
+
+	_, err = runWhamCommand(t, "fleet", "status", "--configs", "../test/settings/no_such_*.yaml")
+	assert.Error(t, err, "A pattern matching no file should be an error.")
+}
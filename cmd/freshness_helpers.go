@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FreshnessSpec defines how a source freshness step (`type: freshness`) observes
+// the watermark of an upstream source, i.e. the timestamp of its latest data.
+//
+// The watermark is either the modification time of `file`, or the value printed
+// on the last non-empty line of the step's command output (e.g., a SQL client
+// printing `max(updated_at)`, or an object store CLI printing a last-modified
+// date). It becomes the step's run_id, so that downstream stateless steps only
+// run when new data actually arrived.
+type FreshnessSpec struct {
+	// File is the path of a file whose modification time is the watermark, relative
+	// to the config file's directory. A step observing a file has no command.
+	File string `yaml:"file,omitempty" json:"file,omitempty"`
+	// MaxAge is the maximum age of the watermark (e.g., "26h"). An older watermark
+	// means the source is stale. If unset, the age is not checked.
+	MaxAge time.Duration `yaml:"max_age,omitempty" json:"max_age,omitempty"`
+	// Policy determines what happens when the source is stale: "fail" (default)
+	// treats the execution as failed, "warn" only prints a warning.
+	Policy string `yaml:"policy,omitempty" json:"policy,omitempty"`
+}
+
+// watermarkLayouts are the timestamp layouts accepted for a watermark printed by
+// a command, besides Unix timestamps. Layouts without a time zone are read as UTC.
+var watermarkLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z07",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+// validate checks the freshness definition for semantic errors.
+func (f *FreshnessSpec) validate(step *Step) error {
+	if f.File != "" && len(step.Command) > 0 {
+		return fmt.Errorf("freshness 'file' cannot be combined with a command")
+	}
+	if f.File == "" && len(step.Command) == 0 {
+		return fmt.Errorf("steps of type '%s' must have either a command or a freshness 'file' defined", StepTypeFreshness)
+	}
+	if f.MaxAge < 0 {
+		return fmt.Errorf("freshness max_age cannot be negative")
+	}
+	switch f.Policy {
+	case "", "fail", "warn":
+	default:
+		return fmt.Errorf("freshness policy must be 'fail' or 'warn', got '%s'", f.Policy)
+	}
+	return nil
+}
+
+// evaluateFreshness observes the watermark of a freshness step's source and
+// compares its age against the step's `max_age`.
+//
+// The watermark, normalized to RFC 3339 in UTC, is recorded as the step's run_id
+// and as the `watermark` output, together with its `age`. If the source is stale
+// and the policy is "warn", a warning is printed and recorded in the result, and
+// nil is returned. Otherwise an error is returned so that the execution is treated
+// as failed, as it is when no watermark can be observed.
+func (w *WHAM) evaluateFreshness(step *Step, result *stepResult) error {
+	if step.Type != StepTypeFreshness || step.Freshness == nil {
+		return nil
+	}
+
+	watermark, err := w.observeWatermark(step, result.Stdout)
+	if err != nil {
+		return err
+	}
+	age := time.Since(watermark).Round(time.Second)
+	result.RunID = watermark.UTC().Format(time.RFC3339Nano)
+	if result.Outputs == nil {
+		result.Outputs = make(map[string]string)
+	}
+	result.Outputs["watermark"] = result.RunID
+	result.Outputs["age"] = age.String()
+	w.logger.Debug().Str("step", step.Name).Str("watermark", result.RunID).Dur("age", age).Msg("Freshness observed watermark.")
+
+	spec := step.Freshness
+	if spec.MaxAge == 0 || age <= spec.MaxAge {
+		return nil
+	}
+	staleErr := fmt.Errorf("source is stale: watermark %s is %s old, more than the allowed %s", result.RunID, age, spec.MaxAge)
+	if spec.Policy == "warn" {
+		result.Warnings = append(result.Warnings, staleErr.Error())
+		fmt.Printf("⚠️ Freshness '%s' did not pass: %v\n", step.Name, staleErr)
+		w.logger.Warn().Str("step", step.Name).Err(staleErr).Msg("Source is stale, continuing as policy is 'warn'.")
+		return nil
+	}
+	return fmt.Errorf("freshness check failed: %w", staleErr)
+}
+
+// observeWatermark returns the watermark of a freshness step's source: the
+// modification time of its file, or the timestamp on the last non-empty line of
+// its command's standard output.
+func (w *WHAM) observeWatermark(step *Step, stdout string) (time.Time, error) {
+	if step.Freshness.File != "" {
+		path := w.resolvePath(step.Freshness.File)
+		stat, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to observe the watermark of '%s': %w", path, err)
+		}
+		return stat.ModTime(), nil
+	}
+	value := lastNonEmptyLine(stdout)
+	if value == "" || strings.EqualFold(value, "null") {
+		return time.Time{}, fmt.Errorf("no watermark observed: the command printed no value")
+	}
+	return parseWatermark(value)
+}
+
+// parseWatermark parses a watermark printed by a command: a timestamp in one of
+// the watermarkLayouts, or a Unix timestamp in seconds.
+func parseWatermark(value string) (time.Time, error) {
+	for _, layout := range watermarkLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("watermark '%s' is not a timestamp", value)
+}
@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// parseGeneratedSteps parses the step definitions that a generator step
+// (`generates_steps: true`) printed on its standard output, as a JSON list (YAML
+// is accepted too, so durations can be written as in the configuration, e.g.
+// "5s"), and checks that they can be added to the DAG (see prepareGeneratedSteps).
+// The steps are stored in the result, to be added to the DAG once the execution
+// is known to be successful.
+func (w *WHAM) parseGeneratedSteps(step *Step, result *stepResult) error {
+	if !step.GeneratesSteps {
+		return nil
+	}
+	var defs []Step
+	if err := yaml.Unmarshal([]byte(result.Stdout), &defs); err != nil {
+		return fmt.Errorf("failed to parse the steps generated on standard output: %w", err)
+	}
+	w.stepsMu.RLock()
+	generated, err := w.prepareGeneratedSteps(step, defs)
+	w.stepsMu.RUnlock()
+	if err != nil {
+		return err
+	}
+	result.GeneratedSteps = generated
+	return nil
+}
+
+// prepareGeneratedSteps validates the steps generated by `generator` and returns
+// them in a topological order. It must be called with stepsMu held.
+//
+// Each generated step depends on the generator, which is added to its
+// `previous_steps` if missing. Its other predecessors must be ancestors of the
+// generator, which have already finished, or other steps of the same batch, so that
+// the steps can be inserted right after the generator in the execution order.
+func (w *WHAM) prepareGeneratedSteps(generator *Step, defs []Step) ([]*Step, error) {
+	ancestors := make(map[string]bool)
+	queue := slices.Clone(generator.PreviousSteps)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if pred := w.stepsMap[name]; pred != nil && !ancestors[name] {
+			ancestors[name] = true
+			queue = append(queue, pred.PreviousSteps...)
+		}
+	}
+
+	batch := make(map[string]*Step, len(defs))
+	var steps []*Step
+	for i := range defs {
+		step := &defs[i]
+		if step.Name == "" {
+			return nil, fmt.Errorf("generated step #%d: step name cannot be empty", i+1)
+		}
+		if _, exists := w.stepsMap[step.Name]; exists || batch[step.Name] != nil {
+			return nil, fmt.Errorf("generated step '%s': a step with this name already exists", step.Name)
+		}
+		if err := w.config.applyStepTemplate(step); err != nil {
+			return nil, fmt.Errorf("invalid generated step '%s': %w", step.Name, err)
+		}
+		if !slices.Contains(step.PreviousSteps, generator.Name) {
+			step.PreviousSteps = append([]string{generator.Name}, step.PreviousSteps...)
+		}
+		if err := validateStepDefinition(step); err != nil {
+			return nil, fmt.Errorf("invalid generated step '%s': %w", step.Name, err)
+		}
+		if _, ok := w.config.Connections[step.Connection]; step.Connection != "" && !ok {
+			return nil, fmt.Errorf("invalid generated step '%s': connection '%s' is not defined", step.Name, step.Connection)
+		}
+		batch[step.Name] = step
+		steps = append(steps, step)
+	}
+	for _, step := range steps {
+		for _, pred := range step.PreviousSteps {
+			if pred != generator.Name && !ancestors[pred] && batch[pred] == nil {
+				return nil, fmt.Errorf("generated step '%s' depends on '%s', which is neither the generator, one of its ancestors nor a generated step", step.Name, pred)
+			}
+		}
+	}
+
+	// Order the batch topologically, so that each step comes after its predecessors.
+	var sorted []*Step
+	added := make(map[string]bool, len(steps))
+	for len(sorted) < len(steps) {
+		progress := false
+		for _, step := range steps {
+			if added[step.Name] {
+				continue
+			}
+			ready := true
+			for _, pred := range step.PreviousSteps {
+				if batch[pred] != nil && !added[pred] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				sorted = append(sorted, step)
+				added[step.Name] = true
+				progress = true
+			}
+		}
+		if !progress {
+			return nil, fmt.Errorf("circular dependency detected among the generated steps")
+		}
+	}
+	return sorted, nil
+}
+
+// addGeneratedSteps adds the steps generated by a successful execution of
+// `generator` to the DAG, for the remainder of the run: `run all` executes them
+// right after the generator (see takeGeneratedSteps).
+//
+// As other steps may be running, the steps map and depths are replaced rather
+// than modified, under stepsMu. The configuration itself is only updated once the
+// run is finished (see commitGeneratedSteps).
+func (w *WHAM) addGeneratedSteps(generator *Step, generated []*Step) error {
+	if len(generated) == 0 {
+		return nil
+	}
+	w.stepsMu.Lock()
+	defer w.stepsMu.Unlock()
+	// Check again, in case another generator added a step with the same name meanwhile.
+	defs := make([]Step, len(generated))
+	for i, step := range generated {
+		defs[i] = *step
+	}
+	generated, err := w.prepareGeneratedSteps(generator, defs)
+	if err != nil {
+		return err
+	}
+
+	stepsMap := make(map[string]*Step, len(w.stepsMap)+len(generated))
+	for name, step := range w.stepsMap {
+		stepsMap[name] = step
+	}
+	stepDepths := make(map[string]int, len(w.stepDepths)+len(generated))
+	for name, depth := range w.stepDepths {
+		stepDepths[name] = depth
+	}
+	names := make([]string, len(generated))
+	for i, step := range generated {
+		stepsMap[step.Name] = step
+		for _, pred := range step.PreviousSteps {
+			stepDepths[step.Name] = max(stepDepths[step.Name], stepDepths[pred]+1)
+		}
+		names[i] = step.Name
+	}
+	w.stepsMap, w.stepDepths = stepsMap, stepDepths
+	if w.generatedSteps == nil {
+		w.generatedSteps = make(map[string][]*Step)
+	}
+	w.generatedSteps[generator.Name] = generated
+	w.generatedOrder = append(w.generatedOrder, generated...)
+
+	fmt.Printf("🧬 Step '%s' generated %d step(s): %s.\n", generator.Name, len(generated), strings.Join(names, ", "))
+	w.logger.Info().Str("step", generator.Name).Strs("generated_steps", names).Msg("Steps generated.")
+	return nil
+}
+
+// takeGeneratedSteps returns the steps generated by the last execution of a step
+// that `run all` has not scheduled yet, in a topological order, and forgets them.
+func (w *WHAM) takeGeneratedSteps(generatorName string) []*Step {
+	w.stepsMu.Lock()
+	defer w.stepsMu.Unlock()
+	generated := w.generatedSteps[generatorName]
+	delete(w.generatedSteps, generatorName)
+	return generated
+}
+
+// commitGeneratedSteps appends the steps generated during a run to the
+// configuration, so that the execution summary and the commands run afterwards
+// in the same process (e.g., `serve`) see them. It must not be called while steps
+// are running.
+func (w *WHAM) commitGeneratedSteps() {
+	for _, step := range w.generatedOrder {
+		if !slices.ContainsFunc(w.config.WhamSteps, func(s Step) bool { return s.Name == step.Name }) {
+			w.config.WhamSteps = append(w.config.WhamSteps, *step)
+		}
+	}
+	w.rebuildStepsMap()
+}
+
+// resetGeneratedSteps removes the steps generated by a previous run from the DAG,
+// as their generator generates them again. It must not be called while steps are
+// running.
+func (w *WHAM) resetGeneratedSteps() {
+	if len(w.generatedOrder) == 0 {
+		return
+	}
+	generated := make(map[string]bool, len(w.generatedOrder))
+	for _, step := range w.generatedOrder {
+		generated[step.Name] = true
+	}
+	w.config.WhamSteps = slices.DeleteFunc(w.config.WhamSteps, func(s Step) bool { return generated[s.Name] })
+	w.generatedOrder, w.generatedSteps = nil, nil
+	w.rebuildStepsMap()
+}
+
+// rebuildStepsMap points the steps map at the steps of the configuration, and
+// recalculates their depths.
+func (w *WHAM) rebuildStepsMap() {
+	w.stepsMu.Lock()
+	defer w.stepsMu.Unlock()
+	w.stepsMap = make(map[string]*Step, len(w.config.WhamSteps))
+	for i := range w.config.WhamSteps {
+		w.stepsMap[w.config.WhamSteps[i].Name] = &w.config.WhamSteps[i]
+	}
+	w.stepDepths = make(map[string]int, len(w.config.WhamSteps))
+	w.calculateStepDepths()
+}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// getStepHistoryFilePath returns the path of the file holding a step's history.
+func (w *WHAM) getStepHistoryFilePath(stepName string) string {
+	return filepath.Join(w.config.WhamSettings.MetadataDir, w.config.WhamSettings.MetadataPrefix+"history", stepName+".json")
+}
+
+// loadStepHistory reads the history of a step: its latest WHAM states, oldest
+// first. A step without history has none.
+func (w *WHAM) loadStepHistory(stepName string) ([]StepState, error) {
+	history, _, err := w.readStepHistoryFile(w.getStepHistoryFilePath(stepName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return history, err
+}
+
+// readStepHistoryFile reads a history file, upgrading its states written with an
+// older schema (see decodeStepState), and returns the oldest schema version they
+// were written with.
+func (w *WHAM) readStepHistoryFile(path string) ([]StepState, int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, 0, err
+		}
+		return nil, 0, fmt.Errorf("failed to read history file '%s': %w", path, err)
+	}
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse history file '%s': %w", path, err)
+	}
+	history := make([]StepState, 0, len(entries))
+	oldest := StateSchemaVersion
+	for _, entry := range entries {
+		state, version, err := decodeStepState(entry)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to parse history file '%s': %w", path, err)
+		}
+		history = append(history, state)
+		oldest = min(oldest, version)
+	}
+	return history, oldest, nil
+}
+
+// saveStepHistory appends a WHAM state just saved to the history of its step, if
+// the `history_limit` setting is positive, and drops the oldest states beyond the
+// limit. Unlike the WHAM state, which only tells the last execution, the history
+// tells e.g. when a failing step last succeeded.
+//
+// The history is kept in the metadata directory, whatever the state store. A
+// history that cannot be read is started anew, and failing to write it is logged
+// but never fails the step.
+func (w *WHAM) saveStepHistory(stepName string, state StepState) {
+	limit := w.config.WhamSettings.HistoryLimit
+	if limit <= 0 {
+		return
+	}
+	history, err := w.loadStepHistory(stepName)
+	if err != nil {
+		w.logger.Warn().Str("step", stepName).Err(err).Msg("Could not read step history, starting a new one.")
+	}
+	history = append(history, state)
+	if len(history) > limit {
+		history = history[len(history)-limit:]
+	}
+
+	path := w.getStepHistoryFilePath(stepName)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		w.logger.Warn().Str("step", stepName).Err(err).Msg("Could not create history directory.")
+		return
+	}
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err == nil {
+		err = writeFileAtomically(path, data)
+	}
+	if err != nil {
+		w.logger.Warn().Str("step", stepName).Str("path", path).Err(err).Msg("Could not save step history.")
+	}
+}
+
+// lastSuccessfulState returns the latest state of a history recording an
+// execution of the step that succeeded, or nil if there is none.
+func lastSuccessfulState(history []StepState) *StepState {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].RunAction == "run" {
+			return &history[i]
+		}
+	}
+	return nil
+}
+
+// LastSuccess is the last successful execution of a step, as returned by the
+// `lastSuccess` template function. It is empty if the step never succeeded.
+type LastSuccess struct {
+	// RunID is the run_id recorded by the execution.
+	RunID string
+	// RunDate is when the execution finished.
+	RunDate time.Time
+}
+
+// String renders the date of the execution in RFC 3339 format, in UTC, or an empty
+// string if there is none, so that `{{ lastSuccess "step" }}` renders a timestamp.
+func (l LastSuccess) String() string {
+	if l.RunDate.IsZero() {
+		return ""
+	}
+	return l.RunDate.UTC().Format(time.RFC3339)
+}
+
+// lastSuccess returns the last successful execution of a step, read from its
+// history, or from its current state if it has no history (e.g., `history_limit`
+// is not set). Unlike the current state, the history remembers it across the
+// failed and skipped executions since, so that an incremental loader can start its
+// processing window where the last successful load ended. Executions with the
+// dry-run marker are ignored, as they processed nothing.
+func (w *WHAM) lastSuccess(stepName string) (LastSuccess, error) {
+	if w.findStep(stepName) == nil {
+		return LastSuccess{}, fmt.Errorf("step '%s' not found in configuration", stepName)
+	}
+	history, err := w.loadStepHistory(stepName)
+	if err != nil {
+		return LastSuccess{}, err
+	}
+	if len(history) == 0 {
+		state, err := w.loadStepWhamState(stepName)
+		if err != nil {
+			return LastSuccess{}, err
+		}
+		history = []StepState{state}
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].RunAction == "run" && !history[i].DryRun {
+			return LastSuccess{RunID: history[i].RunID, RunDate: history[i].RunDate}, nil
+		}
+	}
+	return LastSuccess{}, nil
+}
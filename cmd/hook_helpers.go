@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// errBeforeHookFailed is returned by executeStep when one of the step's `before`
+// hooks fails, in which case the step's command is not run.
+var errBeforeHookFailed = errors.New("before hook failed")
+
+// errBeforeRetryFailed is returned by executeStep when one of the step's
+// `before_retry` commands fails before a retry, which is then not run.
+var errBeforeRetryFailed = errors.New("before_retry command failed")
+
+// errAfterHookFailed is returned by executeStep when one of the step's `after`
+// hooks fails after its command succeeded.
+var errAfterHookFailed = errors.New("after hook failed")
+
+// runHooks runs the given hook commands of a step one after the other, and stops
+// at the first one that fails. The hooks share the environment and working
+// directory of the step's command, `cmd`, and their output is written to `console`
+// and the standard error. `kind` names the hooks ("before", "before_retry" or
+// "after") in messages.
+//
+// A hook is killed if `ctx` is done. Hooks are not started once the workflow run
+// is aborted.
+//
+// Returns an error wrapping `failure` if a hook cannot be run or fails.
+func (w *WHAM) runHooks(ctx context.Context, step *Step, kind string, hooks [][]string, cmd *exec.Cmd, console io.Writer, failure error) error {
+	logger := w.stepLogger(step)
+	for _, hook := range hooks {
+		if w.runContext().Err() != nil {
+			logger.Warn().Str("step", step.Name).Str("hook", kind).Msg("Hooks not run because the workflow run was aborted.")
+			return nil
+		}
+		executable, err := w.hookExecutable(hook[0])
+		if err != nil {
+			return fmt.Errorf("%w: %v", failure, err)
+		}
+		hookCmd := exec.CommandContext(ctx, executable, hook[1:]...)
+		hookCmd.Env = cmd.Env
+		hookCmd.Dir = cmd.Dir
+		// Hooks run as the same user and group as the step's command.
+		hookCmd.SysProcAttr = &syscall.SysProcAttr{Credential: cmd.SysProcAttr.Credential}
+		hookCmd.Stdout = console
+		hookCmd.Stderr = os.Stderr
+		logger.Info().Str("step", step.Name).Str("hook", kind).Str("command", hookCmd.String()).Msg("Running hook.")
+		if err := hookCmd.Run(); err != nil {
+			return fmt.Errorf("%w: '%s': %v", failure, strings.Join(hook, " "), err)
+		}
+	}
+	return nil
+}
+
+// hookExecutable resolves the executable of a hook command. A path containing a
+// separator is resolved against the config file's directory, like the command of
+// a step; a bare name is looked up on the PATH.
+func (w *WHAM) hookExecutable(name string) (string, error) {
+	if !strings.ContainsRune(name, filepath.Separator) {
+		executable, err := exec.LookPath(name)
+		if err != nil {
+			return "", fmt.Errorf("hook executable '%s' not found on the PATH", name)
+		}
+		return executable, nil
+	}
+	return w.resolvePath(name), nil
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hostGuardPollInterval is how often a step held back by the host guards checks
+// the host again.
+const hostGuardPollInterval = 5 * time.Second
+
+// defaultHostGuardTimeout is how long a step waits for the host guards when their
+// `timeout` is not set.
+const defaultHostGuardTimeout = 10 * time.Minute
+
+// HostGuardSettings defines the host-level guards checked before each step is
+// started, so that wide parallel sections do not make the host thrash. See
+// waitForHostGuards.
+type HostGuardSettings struct {
+	// MaxLoadAverage, if positive, is the 1-minute load average above which steps
+	// are not started.
+	MaxLoadAverage float64 `yaml:"max_load_average,omitempty" json:"max_load_average,omitempty"`
+	// MinFreeMemory, if set, is the available memory (e.g., "2G") below which steps
+	// are not started, in bytes or with a K, M, G or T suffix (powers of 1024).
+	MinFreeMemory string `yaml:"min_free_memory,omitempty" json:"min_free_memory,omitempty"`
+	// Timeout is how long a step waits for the guards to pass. When it elapses, the
+	// step is started anyway, with a warning. Defaults to 10 minutes.
+	Timeout time.Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+// validate checks the host guards of the settings.
+func (g *HostGuardSettings) validate() error {
+	if g.MaxLoadAverage < 0 {
+		return fmt.Errorf("max_load_average cannot be negative")
+	}
+	if g.MinFreeMemory != "" {
+		if _, err := parseByteSize(g.MinFreeMemory); err != nil {
+			return fmt.Errorf("invalid min_free_memory: %w", err)
+		}
+	}
+	if g.Timeout < 0 {
+		return fmt.Errorf("timeout cannot be negative")
+	}
+	return nil
+}
+
+// checkHostGuards tells why the host is too busy to start a step, or returns an
+// empty string if it is not. A guard whose metric cannot be read on this host is
+// ignored, and its error returned.
+func (g *HostGuardSettings) checkHostGuards() (busy string, err error) {
+	var reasons []string
+	if g.MaxLoadAverage > 0 {
+		load, loadErr := readLoadAverage()
+		if loadErr != nil {
+			err = loadErr
+		} else if load > g.MaxLoadAverage {
+			reasons = append(reasons, fmt.Sprintf("load average %.2f above %s", load, strconv.FormatFloat(g.MaxLoadAverage, 'f', -1, 64)))
+		}
+	}
+	if g.MinFreeMemory != "" {
+		minFree, _ := parseByteSize(g.MinFreeMemory) // Validated at load time.
+		free, memErr := readAvailableMemory()
+		if memErr != nil {
+			err = memErr
+		} else if free < minFree {
+			reasons = append(reasons, fmt.Sprintf("%dM of memory available, below %s", free>>20, g.MinFreeMemory))
+		}
+	}
+	return strings.Join(reasons, ", "), err
+}
+
+// waitForHostGuards holds a step back while the host guards of the settings, if
+// any, do not pass: while the load average is above `max_load_average` or the
+// available memory below `min_free_memory`. Steps with `ignore_host_guards` are
+// never held back.
+//
+// After the guards' timeout, the step is started anyway, and the returned warning
+// is recorded in its state. If the workflow run is aborted meanwhile, the cause of
+// the abort is returned. A guard that cannot be evaluated on this host (e.g., not
+// Linux) is logged and ignored.
+func (w *WHAM) waitForHostGuards(step *Step) (warning string, err error) {
+	guards := w.config.WhamSettings.HostGuards
+	if guards == nil || step.IgnoreHostGuards {
+		return "", nil
+	}
+	timeout := guards.Timeout
+	if timeout == 0 {
+		timeout = defaultHostGuardTimeout
+	}
+	waitStart := time.Now()
+	for waiting := false; ; waiting = true {
+		busy, checkErr := guards.checkHostGuards()
+		if checkErr != nil && !waiting {
+			w.logger.Warn().Str("step", step.Name).Err(checkErr).Msg("Could not evaluate host guard, ignoring it.")
+		}
+		if busy == "" {
+			if waiting {
+				w.logger.Info().Str("step", step.Name).Dur("waited", time.Since(waitStart)).Msg("Host guards passed.")
+			}
+			return "", nil
+		}
+		if waited := time.Since(waitStart); waited >= timeout {
+			fmt.Printf("⚠️ Step '%s' starting although the host is busy (%s): waited %s.\n", step.Name, busy, waited.Round(time.Second))
+			w.logger.Warn().Str("step", step.Name).Str("busy", busy).Dur("waited", waited).Msg("Host guards timed out, starting the step anyway.")
+			return fmt.Sprintf("started on a busy host (%s) after waiting %s", busy, waited.Round(time.Second)), nil
+		}
+		if !waiting {
+			fmt.Printf("🐢 Step '%s' waiting for the host to be less busy (%s)...\n", step.Name, busy)
+			w.logger.Info().Str("step", step.Name).Str("busy", busy).Msg("Waiting for host guards.")
+		}
+		select {
+		case <-time.After(min(hostGuardPollInterval, timeout-time.Since(waitStart))):
+		case <-w.runContext().Done():
+			return "", context.Cause(w.runContext())
+		}
+	}
+}
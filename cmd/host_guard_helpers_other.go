@@ -0,0 +1,19 @@
+//go:build !linux
+
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// readLoadAverage would return the 1-minute load average of the host. The host
+// guards are only implemented on Linux: they are ignored elsewhere.
+func readLoadAverage() (float64, error) {
+	return 0, fmt.Errorf("reading the load average is not supported on %s", runtime.GOOS)
+}
+
+// readAvailableMemory would return the memory available for new processes.
+func readAvailableMemory() (int64, error) {
+	return 0, fmt.Errorf("reading the available memory is not supported on %s", runtime.GOOS)
+}
@@ -73,6 +73,16 @@ func TestInit_FailInvalidStepDefinition(t *testing.T) {
 		{"stateful missing state_file", "settings_fail_step_no_statefile.yaml", "must have a 'state_file' defined"},
 		{"stateful missing run_id_var", "settings_fail_step_no_runidvar.yaml", "must have a 'run_id_var' defined"},
 		{"negative retries", "settings_fail_step_negative_retries.yaml", "retries cannot be negative"},
+		{"unknown connection", "settings_fail_unknown_connection.yaml", "connection 'does_not_exist' is not defined"},
+		{"incomplete state_files entry", "settings_fail_state_files.yaml", "state_files entry #1 must have both 'file' and 'run_id_var' defined"},
+		{"invalid must_start_by", "settings_fail_must_start_by.yaml", "invalid must_start_by"},
+		{"invalid max_failure_rate", "settings_fail_max_failure_rate.yaml", "invalid max_failure_rate '20% over a week'"},
+		{"invalid scratch_dir size", "settings_fail_scratch_dir.yaml", "invalid scratch_dir: invalid size 'two gigabytes'"},
+		{"inputs on a stateful step", "settings_fail_inputs.yaml", "only stateless steps can have 'inputs' defined"},
+		{"cleanup_outputs_after without outputs", "settings_fail_cleanup_outputs.yaml", "cleanup_outputs_after requires the step to declare its outputs"},
+		{"run_id_from_outputs with state_file", "settings_fail_run_id_from_outputs.yaml", "'run_id_from_outputs' cannot be combined with 'state_file' and 'run_id_var'"},
+		{"overlapping exit codes", "settings_fail_exit_codes.yaml", "exit code 1 cannot be in both success_exit_codes and warning_exit_codes"},
+		{"freshness file and command", "settings_fail_freshness.yaml", "freshness 'file' cannot be combined with a command"},
 	}
 
 	for _, tc := range testCases {
@@ -92,6 +102,33 @@ func TestInit_FailInvalidStepDefinition(t *testing.T) {
 	}
 }
 
+// TestInit_FailConfigPositions verifies that configuration errors point at the
+// file, line and column of the offending definition, and name its step.
+func TestInit_FailConfigPositions(t *testing.T) {
+	testCases := []struct {
+		name           string
+		configFileName string
+		errContains    []string
+	}{
+		{"type error", "settings_fail_yaml_type.yaml", []string{"settings_fail_yaml_type.yaml:11:5: cannot unmarshal", "(in step 'mistyped_step')"}},
+		{"syntax error", "settings_fail_yaml_syntax.yaml", []string{"settings_fail_yaml_syntax.yaml:6: did not find expected ',' or ']'"}},
+		{"semantic error", "settings_fail_step_negative_retries.yaml", []string{"invalid configuration for step 'invalid_step' (at ../test/settings/settings_fail_step_negative_retries.yaml:6:5)"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// The configuration cannot be loaded, so no state can be written to clean up.
+			configPath := "../test/settings/" + tc.configFileName
+			outputStr, err := runWhamCommand(t, "--config", configPath, "step", "validate", "all")
+
+			assert.Error(t, err, "The command should fail with an error exit code.")
+			for _, want := range tc.errContains {
+				assert.Contains(t, outputStr, want, "The error message should locate the error.")
+			}
+		})
+	}
+}
+
 // TestInit_MergeConfigs verifies that loading multiple configuration files correctly
 // merges them, with later files overriding earlier ones.
 func TestInit_MergeConfigs(t *testing.T) {
@@ -0,0 +1,318 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// inspectionQueryTimeout bounds how long a query waits for a running WHAM process.
+const inspectionQueryTimeout = 2 * time.Second
+
+// RunProgress is the snapshot of an in-flight WHAM execution, as reported by the
+// running process over its inspection socket.
+type RunProgress struct {
+	// PID is the process ID of the running WHAM process.
+	PID int `json:"pid" yaml:"pid"`
+	// WorkflowRunID is the ID of the workflow run in progress. Empty for single-step runs.
+	WorkflowRunID string `json:"workflow_run_id,omitempty" yaml:"workflow_run_id,omitempty"`
+	// StartedAt is the timestamp of when the execution started.
+	StartedAt time.Time `json:"started_at" yaml:"started_at"`
+	// CurrentSteps are the names of the steps being executed, if any. There is more
+	// than one when steps run in parallel.
+	CurrentSteps []string `json:"current_steps,omitempty" yaml:"current_steps,omitempty"`
+	// StepsDone is the number of steps that have finished (run, skipped or failed).
+	StepsDone int `json:"steps_done" yaml:"steps_done"`
+	// StepsTotal is the number of steps selected for execution.
+	StepsTotal int `json:"steps_total" yaml:"steps_total"`
+	// ConfigFiles are the configuration files the process was started with.
+	ConfigFiles []string `json:"config_files" yaml:"config_files"`
+}
+
+// inspection is the inspection endpoint of a running WHAM process. It serves the
+// process' RunProgress over a Unix domain socket, so that other local processes
+// (e.g., `wham status`) can tell what is in flight, and lets them cancel one of
+// the running steps (e.g., `wham cancel <step>`).
+type inspection struct {
+	mu       sync.Mutex
+	progress RunProgress
+	// cancels maps the steps whose script is running to the function cancelling it.
+	cancels map[string]context.CancelCauseFunc
+	server  *http.Server
+	path    string
+	// progressFile, if set, is the file the progress is also written to whenever it
+	// changes (see startProgressFile).
+	progressFile string
+	// planned are the steps of the execution, in execution order, finished those
+	// that have finished, stepStarts when the running steps started, and retries
+	// the latest retries, for the status dump (see dumpStatus).
+	planned    []string
+	finished   map[string]bool
+	stepStarts map[string]time.Time
+	retries    []retryRecord
+}
+
+// getInspectionSocketsDir returns the directory where running WHAM processes
+// create their inspection sockets, one per process named after its PID.
+func (w *WHAM) getInspectionSocketsDir() string {
+	return filepath.Join(w.config.WhamSettings.MetadataDir, w.config.WhamSettings.MetadataPrefix+"sockets")
+}
+
+// startInspection starts serving the progress of an execution of `total` steps
+// over the process' inspection socket, and returns a function that stops it.
+// Failing to open the socket is logged but never halts the workflow.
+func (w *WHAM) startInspection(workflowRunID string, total int) (stop func()) {
+	insp := &inspection{
+		progress: RunProgress{
+			PID:           os.Getpid(),
+			WorkflowRunID: workflowRunID,
+			StartedAt:     time.Now(),
+			StepsTotal:    total,
+			ConfigFiles:   w.config.ConfigFiles,
+		},
+		cancels:    make(map[string]context.CancelCauseFunc),
+		finished:   make(map[string]bool),
+		stepStarts: make(map[string]time.Time),
+	}
+	w.inspection = insp
+	stopDump := w.startStatusDump(insp)
+	stop = func() {
+		stopDump()
+		w.inspection = nil
+	}
+
+	socketsDir := w.getInspectionSocketsDir()
+	if err := os.MkdirAll(socketsDir, 0755); err != nil {
+		w.logger.Warn().Str("dir", socketsDir).Err(err).Msg("Could not create inspection sockets directory.")
+		return stop
+	}
+	insp.path = filepath.Join(socketsDir, strconv.Itoa(insp.progress.PID)+".sock")
+	// A socket left behind by a crashed process with the same PID would prevent listening.
+	os.Remove(insp.path)
+	listener, err := net.Listen("unix", insp.path)
+	if err != nil {
+		w.logger.Warn().Str("path", insp.path).Err(err).Msg("Could not open inspection socket.")
+		return stop
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/progress", func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(rw, "the progress is read with GET", http.StatusMethodNotAllowed)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(insp.snapshot())
+	})
+	mux.HandleFunc("/steps/{name}/cancel", func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(rw, "a step is cancelled with POST", http.StatusMethodNotAllowed)
+			return
+		}
+		name := r.PathValue("name")
+		if !insp.cancelStep(name) {
+			http.Error(rw, fmt.Sprintf("step '%s' is not running", name), http.StatusNotFound)
+			return
+		}
+		w.logger.Warn().Str("step", name).Msg("Step cancelled through the inspection socket.")
+		rw.WriteHeader(http.StatusNoContent)
+	})
+	insp.server = &http.Server{Handler: mux}
+	go insp.server.Serve(listener)
+	w.logger.Debug().Str("path", insp.path).Msg("Inspection socket opened.")
+
+	return func() {
+		// Closing the server closes the listener, which removes the socket file.
+		insp.server.Close()
+		stopDump()
+		w.inspection = nil
+		w.logger.Debug().Str("path", insp.path).Msg("Inspection socket closed.")
+	}
+}
+
+// snapshot returns a copy of the current progress.
+func (insp *inspection) snapshot() RunProgress {
+	insp.mu.Lock()
+	defer insp.mu.Unlock()
+	progress := insp.progress
+	progress.CurrentSteps = slices.Clone(progress.CurrentSteps)
+	return progress
+}
+
+// cancelStep cancels the running script of a step, and reports whether there was one.
+func (insp *inspection) cancelStep(name string) bool {
+	insp.mu.Lock()
+	defer insp.mu.Unlock()
+	cancel, ok := insp.cancels[name]
+	if ok {
+		cancel(errStepCancelled)
+	}
+	return ok
+}
+
+// trackStepCancel makes the running script of a step cancellable over the
+// inspection socket with `cancel`, and returns a function that stops tracking it.
+// It is a no-op when no execution is being inspected.
+func (w *WHAM) trackStepCancel(name string, cancel context.CancelCauseFunc) (untrack func()) {
+	insp := w.inspection
+	if insp == nil {
+		return func() {}
+	}
+	insp.mu.Lock()
+	defer insp.mu.Unlock()
+	insp.cancels[name] = cancel
+	return func() {
+		insp.mu.Lock()
+		defer insp.mu.Unlock()
+		delete(insp.cancels, name)
+	}
+}
+
+// updateInspection applies a change to the progress reported over the inspection
+// socket, and to the progress file if any. It is a no-op when no execution is being
+// inspected.
+func (w *WHAM) updateInspection(change func(*RunProgress)) {
+	insp := w.inspection
+	if insp == nil {
+		return
+	}
+	insp.mu.Lock()
+	defer insp.mu.Unlock()
+	change(&insp.progress)
+	if insp.progressFile != "" {
+		w.writeProgressFile(insp, "running")
+	}
+}
+
+// trackInspection applies a change to the bookkeeping of the execution being
+// inspected. It is a no-op when no execution is being inspected.
+func (w *WHAM) trackInspection(change func(*inspection)) {
+	insp := w.inspection
+	if insp == nil {
+		return
+	}
+	insp.mu.Lock()
+	defer insp.mu.Unlock()
+	change(insp)
+}
+
+// planInspection records the steps of the execution being inspected, in
+// execution order, whenever they change (e.g., when steps are generated).
+func (w *WHAM) planInspection(steps []*Step) {
+	w.trackInspection(func(insp *inspection) {
+		insp.planned = insp.planned[:0]
+		for _, step := range steps {
+			insp.planned = append(insp.planned, step.Name)
+		}
+	})
+	w.updateInspection(func(p *RunProgress) { p.StepsTotal = len(steps) })
+}
+
+// trackRetry records a retry of a step for the status dump, keeping the latest
+// maxDumpedRetries.
+func (w *WHAM) trackRetry(step *Step, attempt int, prevErr error) {
+	w.trackInspection(func(insp *inspection) {
+		insp.retries = append(insp.retries, retryRecord{step: step.Name, attempt: attempt, at: time.Now(), err: fmt.Sprint(prevErr)})
+		if len(insp.retries) > maxDumpedRetries {
+			insp.retries = slices.Delete(insp.retries, 0, len(insp.retries)-maxDumpedRetries)
+		}
+	})
+}
+
+// queryRunningProcesses asks every WHAM process running against the same metadata
+// directory for its progress, sorted by start time.
+//
+// Sockets whose process is gone (the connection is refused) are left-overs of a
+// crashed process and are removed. Processes that do not answer in time are
+// logged and left out.
+func (w *WHAM) queryRunningProcesses() ([]RunProgress, error) {
+	socketsDir := w.getInspectionSocketsDir()
+	entries, err := os.ReadDir(socketsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read inspection sockets directory '%s': %w", socketsDir, err)
+	}
+
+	var running []RunProgress
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".sock") {
+			continue
+		}
+		path := filepath.Join(socketsDir, entry.Name())
+		progress, err := queryInspectionSocket(path)
+		if err != nil {
+			if errors.Is(err, syscall.ECONNREFUSED) {
+				w.logger.Debug().Str("path", path).Msg("Removing stale inspection socket.")
+				os.Remove(path)
+			} else {
+				w.logger.Warn().Str("path", path).Err(err).Msg("Could not query running WHAM process.")
+			}
+			continue
+		}
+		running = append(running, progress)
+	}
+	sort.Slice(running, func(i, j int) bool { return running[i].StartedAt.Before(running[j].StartedAt) })
+	return running, nil
+}
+
+// inspectionClient returns an HTTP client of the API served on an inspection socket.
+// The host of the requested URLs is ignored, as the transport always dials the socket.
+func inspectionClient(path string) *http.Client {
+	return &http.Client{
+		Timeout: inspectionQueryTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+}
+
+// queryInspectionSocket fetches the progress served on an inspection socket.
+func queryInspectionSocket(path string) (RunProgress, error) {
+	var progress RunProgress
+	resp, err := inspectionClient(path).Get("http://wham/progress")
+	if err != nil {
+		return progress, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return progress, fmt.Errorf("unexpected response status '%s'", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&progress); err != nil {
+		return progress, fmt.Errorf("failed to parse progress: %w", err)
+	}
+	return progress, nil
+}
+
+// cancelStepOverSocket asks the process serving an inspection socket to cancel the
+// running script of a step.
+func cancelStepOverSocket(path, step string) error {
+	resp, err := inspectionClient(path).Post("http://wham/steps/"+url.PathEscape(step)+"/cancel", "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected response status '%s': %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// serviceAccountDir is where Kubernetes mounts the credentials of a pod's service account.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubeRequestTimeout bounds how long WHAM waits for the Kubernetes API server.
+const kubeRequestTimeout = 30 * time.Second
+
+// Coordinates of the Workflow custom resource served by the Kubernetes API.
+const (
+	workflowGroup    = "wham.matiq.ai"
+	workflowVersion  = "v1alpha1"
+	workflowResource = "workflows"
+)
+
+// kubeClient is a minimal client of the Kubernetes API, limited to the Workflow
+// custom resources managed by the operator.
+type kubeClient struct {
+	// baseURL is the URL of the API server (e.g., "https://10.0.0.1:443").
+	baseURL string
+	// tokenFile, if set, is the file holding the bearer token of the requests. It is
+	// read before every request, as Kubernetes rotates service account tokens.
+	tokenFile string
+	http      *http.Client
+}
+
+// newKubeClient returns a client of the API server at `apiServer`, or, if it is
+// empty, of the cluster WHAM runs in, with the credentials of its service account.
+func newKubeClient(apiServer string) (*kubeClient, error) {
+	if apiServer == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("not running in a Kubernetes cluster: use --api-server")
+		}
+		apiServer = "https://" + net.JoinHostPort(host, port)
+	}
+	client := &kubeClient{baseURL: strings.TrimSuffix(apiServer, "/"), http: &http.Client{Timeout: kubeRequestTimeout}}
+	if tokenFile := filepath.Join(serviceAccountDir, "token"); fileExists(tokenFile) {
+		client.tokenFile = tokenFile
+	}
+	if caData, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt")); err == nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("invalid service account CA certificate")
+		}
+		client.http.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	}
+	return client, nil
+}
+
+// fileExists reports whether a regular file exists at the path.
+func fileExists(path string) bool {
+	stat, err := os.Stat(path)
+	return err == nil && stat.Mode().IsRegular()
+}
+
+// workflowsPath returns the API path of the Workflow resources of a namespace, or
+// of all namespaces if it is empty.
+func workflowsPath(namespace string) string {
+	if namespace == "" {
+		return fmt.Sprintf("/apis/%s/%s/%s", workflowGroup, workflowVersion, workflowResource)
+	}
+	return fmt.Sprintf("/apis/%s/%s/namespaces/%s/%s", workflowGroup, workflowVersion, url.PathEscape(namespace), workflowResource)
+}
+
+// do sends a request to the API server and decodes its JSON response into `out`, if not nil.
+func (c *kubeClient) do(method, path, contentType string, body []byte, out any) error {
+	req, err := http.NewRequest(method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.tokenFile != "" {
+		token, err := os.ReadFile(c.tokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read service account token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response of %s %s: %w", method, path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: API server responded with status '%s': %s", method, path, resp.Status, strings.TrimSpace(string(data)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode response of %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// listWorkflows returns the Workflow resources of a namespace, or of all
+// namespaces if it is empty.
+func (c *kubeClient) listWorkflows(namespace string) ([]WorkflowResource, error) {
+	var list struct {
+		Items []WorkflowResource `json:"items"`
+	}
+	if err := c.do(http.MethodGet, workflowsPath(namespace), "", nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// updateWorkflowStatus replaces the status of a Workflow resource, through its
+// status subresource.
+func (c *kubeClient) updateWorkflowStatus(resource *WorkflowResource, status WorkflowStatus) error {
+	patch, err := json.Marshal(map[string]any{"status": status})
+	if err != nil {
+		return fmt.Errorf("failed to marshal status: %w", err)
+	}
+	path := fmt.Sprintf("%s/%s/status", workflowsPath(resource.Metadata.Namespace), url.PathEscape(resource.Metadata.Name))
+	return c.do(http.MethodPatch, path, "application/merge-patch+json", patch, nil)
+}
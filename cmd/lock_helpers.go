@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// lockPollInterval is how often a step waiting for a named lock tries to acquire it.
+const lockPollInterval = 250 * time.Millisecond
+
+// lockNamePattern restricts lock names to characters that are safe in file names.
+var lockNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// locksDir returns the directory holding the lock files of the named locks: the
+// `locks_dir` of the settings, relative to the config file's directory, or else a
+// directory shared by all the WHAM processes of the host.
+func (w *WHAM) locksDir() string {
+	if w.config.WhamSettings.LocksDir != "" {
+		return w.resolvePath(w.config.WhamSettings.LocksDir)
+	}
+	return filepath.Join(os.TempDir(), "wham-locks")
+}
+
+// acquireStepLocks acquires the named locks of a step (`locks`), in name order so
+// that steps sharing several locks cannot deadlock, and returns the function
+// releasing them.
+//
+// A named lock is an exclusive lock (flock(2)) on the file `<name>.lock` of the
+// locks directory, so it is honored by all the WHAM processes of the host, and
+// released by the kernel if WHAM dies. A lock held elsewhere is waited for, until
+// it is released or the workflow run is aborted, in which case the locks already
+// acquired are released and the cause of the abort is returned.
+func (w *WHAM) acquireStepLocks(step *Step) (func(), error) {
+	var files []*os.File
+	release := func() {
+		for _, file := range files {
+			syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+			file.Close()
+		}
+	}
+	if len(step.Locks) == 0 {
+		return release, nil
+	}
+	dir := w.locksDir()
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, fmt.Errorf("failed to create locks directory '%s': %w", dir, err)
+	}
+	names := slices.Clone(step.Locks)
+	slices.Sort(names)
+	for _, name := range slices.Compact(names) {
+		file, err := w.acquireLock(step, filepath.Join(dir, name+".lock"), name)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return release, nil
+}
+
+// acquireLock waits until it holds the exclusive lock of a lock file, then
+// records the holder in it, for the messages of the steps waiting for it.
+func (w *WHAM) acquireLock(step *Step, path, name string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file '%s': %w", path, err)
+	}
+	waitStart := time.Now()
+	for waiting := false; ; waiting = true {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			file.Close()
+			return nil, fmt.Errorf("failed to lock '%s': %w", path, err)
+		}
+		if !waiting {
+			holder := "another process"
+			if data, err := os.ReadFile(path); err == nil && strings.TrimSpace(string(data)) != "" {
+				holder = strings.TrimSpace(string(data))
+			}
+			fmt.Printf("🔒 Step '%s' waiting for lock '%s' (held by %s)...\n", step.Name, name, holder)
+			w.logger.Info().Str("step", step.Name).Str("lock", name).Str("holder", holder).Msg("Waiting for lock.")
+		}
+		select {
+		case <-time.After(lockPollInterval):
+		case <-w.runContext().Done():
+			file.Close()
+			return nil, context.Cause(w.runContext())
+		}
+	}
+	if err := file.Truncate(0); err == nil {
+		file.WriteAt([]byte(fmt.Sprintf("step '%s', PID %d\n", step.Name, os.Getpid())), 0)
+	}
+	w.logger.Debug().Str("step", step.Name).Str("lock", name).Dur("waited", time.Since(waitStart)).Msg("Lock acquired.")
+	return file, nil
+}
@@ -17,10 +17,17 @@ var whamBinaryPath string
 // TestStepState is a struct used for unmarshaling the JSON output of `state get`.
 // It mirrors the `namedState` struct used internally in the command.
 type TestStepState struct {
-	StepName  string        `json:"step_name"`
-	RunAction string        `json:"run_action"`
-	RunID     string        `json:"run_id,omitempty"`
-	Elapsed   time.Duration `json:"elapsed,omitempty"`
+	StepName      string            `json:"step_name"`
+	RunAction     string            `json:"run_action"`
+	Reason        string            `json:"reason,omitempty"`
+	FailureClass  string            `json:"failure_class,omitempty"`
+	RunID         string            `json:"run_id,omitempty"`
+	Elapsed       time.Duration     `json:"elapsed,omitempty"`
+	Warnings      []string          `json:"warnings,omitempty"`
+	Watermark     string            `json:"watermark,omitempty"`
+	Outputs       map[string]string `json:"outputs,omitempty"`
+	WorkflowRunID string            `json:"workflow_run_id,omitempty"`
+	DryRun        bool              `json:"dry_run,omitempty"`
 }
 
 // TestValidationResult is a struct used for unmarshaling the JSON output of `step validate`.
@@ -42,9 +49,29 @@ type TestDeletionResult struct {
 // TestDAGStepInfo is a struct used for unmarshaling the JSON output of `dag get`.
 // It mirrors the `DAGStepInfo` struct used internally in the command.
 type TestDAGStepInfo struct {
-	Name          string   `json:"name"`
-	Depth         int      `json:"depth"`
-	PreviousSteps []string `json:"previous_steps"`
+	Name          string             `json:"name"`
+	Depth         int                `json:"depth"`
+	PreviousSteps []string           `json:"previous_steps"`
+	Status        *TestDAGStepStatus `json:"status,omitempty"`
+}
+
+// TestDAGStepStatus is a struct used for unmarshaling the step states of `dag get --status`.
+type TestDAGStepStatus struct {
+	Action    string     `json:"action"`
+	RunID     string     `json:"run_id"`
+	RunIDDate *time.Time `json:"run_id_date,omitempty"`
+	Staleness string     `json:"staleness,omitempty"`
+	Detail    string     `json:"detail,omitempty"`
+}
+
+// TestStaleStep is a struct used for unmarshaling the JSON output of `state stale`.
+// It mirrors the `StaleStep` struct used internally in the command.
+type TestStaleStep struct {
+	StepName      string        `json:"step_name"`
+	RunID         string        `json:"run_id"`
+	UpstreamRunID string        `json:"upstream_run_id"`
+	StaleSince    time.Time     `json:"stale_since"`
+	StaleFor      time.Duration `json:"stale_for"`
 }
 
 // TestStep is a struct used for unmarshaling the JSON output of `step get`.
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// releaseVersionPattern parses a WHAM release version, as set by the Makefile from
+// `git describe` (e.g., "v1.4.2" or "v1.4.2-3-gabc1234-dirty"), or as written in
+// `min_version` (e.g., "1.4").
+var releaseVersionPattern = regexp.MustCompile(`^v?(\d+(?:\.\d+)+)(?:[-+].*)?$`)
+
+// releaseVersion returns the dotted version number of a WHAM version, or false if
+// it is not a release version (e.g., "dev" or a bare commit hash).
+func releaseVersion(version string) (string, bool) {
+	match := releaseVersionPattern.FindStringSubmatch(strings.TrimSpace(version))
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+// checkMinVersion verifies that this WHAM is at least the `min_version` required
+// by the configuration, so that a forgotten host running an older WHAM refuses a
+// configuration using features it does not know rather than misbehaving. A
+// development build, whose version is unknown, satisfies any `min_version`.
+func checkMinVersion(minVersion string) error {
+	if minVersion == "" {
+		return nil
+	}
+	required, ok := releaseVersion(minVersion)
+	if !ok {
+		return fmt.Errorf("invalid min_version '%s': expected a version such as '1.4' or 'v1.4.2'", minVersion)
+	}
+	current, ok := releaseVersion(Version)
+	if !ok {
+		return nil
+	}
+	if compareVersions(current, required) < 0 {
+		return fmt.Errorf("this configuration requires WHAM %s or later, but this is WHAM %s: upgrade WHAM", minVersion, Version)
+	}
+	return nil
+}
+
+// checkStateVersions verifies, before steps run, that none of their WHAM states
+// was written by a newer release of WHAM than this one (see StepState.WhamVersion).
+// An older WHAM does not know the fields a newer one records, and would overwrite
+// them, e.g. when a forgotten cron host still runs the workflow after an upgrade.
+// The states written by development builds, or read by one, are not checked,
+// except for their schema (see StepState.SchemaVersion), which is always.
+func (w *WHAM) checkStateVersions(steps []*Step) error {
+	current, isRelease := releaseVersion(Version)
+	var newer []string
+	for _, step := range steps {
+		state, err := w.loadStepWhamState(step.Name)
+		if errors.Is(err, errNewerStateSchema) {
+			newer = append(newer, fmt.Sprintf("'%s' (schema version above %d)", step.Name, StateSchemaVersion))
+			continue
+		}
+		if !isRelease {
+			continue
+		}
+		if written, ok := releaseVersion(state.WhamVersion); ok && compareVersions(written, current) > 0 {
+			newer = append(newer, fmt.Sprintf("'%s' (WHAM %s)", step.Name, state.WhamVersion))
+		}
+	}
+	if len(newer) > 0 {
+		return fmt.Errorf("the state of step(s) %s was written by a newer WHAM than this one (%s): upgrade WHAM", strings.Join(newer, ", "), Version)
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// notificationTimeout bounds how long WHAM waits for the webhook to accept a notification.
+const notificationTimeout = 10 * time.Second
+
+// defaultNotificationRetryDelay is the delay before the first retry of a failed
+// delivery, if the settings don't set one.
+const defaultNotificationRetryDelay = time.Second
+
+// SignatureHeader is the header carrying the HMAC-SHA256 signature of a payload,
+// as "sha256=<hex digest>", when a notification secret is configured.
+const SignatureHeader = "X-Wham-Signature-256"
+
+// Notification events.
+const (
+	// NotificationFailure is sent when a step fails, once per failure streak.
+	NotificationFailure = "failure"
+	// NotificationRecovered is sent when a step that was reported as failing succeeds again.
+	NotificationRecovered = "recovered"
+	// NotificationFailureRate is sent when the failure rate of a step over its
+	// `max_failure_rate` window exceeds the maximum, once until it falls back below it.
+	NotificationFailureRate = "failure_rate"
+)
+
+// Notification is the payload posted to the notification webhook.
+type Notification struct {
+	// Event is the kind of notification ("failure", "recovered" or "failure_rate").
+	Event string `json:"event"`
+	// Step is the name of the step the notification is about.
+	Step string `json:"step"`
+	// WorkflowRunID is the ID of the workflow run in progress, if any.
+	WorkflowRunID string `json:"workflow_run_id,omitempty"`
+	// Error is the error that made the step fail. Empty for "recovered" events.
+	Error string `json:"error,omitempty"`
+	// FailureClass is the class of the failure, if it matched a failure pattern.
+	FailureClass string `json:"failure_class,omitempty"`
+	// FailureRate is the failure rate of the step over its `max_failure_rate`
+	// window, for "failure_rate" events.
+	FailureRate *FailureRateStats `json:"failure_rate,omitempty"`
+	// Time is the timestamp of the event.
+	Time time.Time `json:"time"`
+}
+
+// notificationState is the persisted notification history of a step. It allows
+// deduplicating alerts across workflow runs and throttling them.
+type notificationState struct {
+	// Failing is true if a failure was reported and the step has not recovered since.
+	Failing bool `json:"failing"`
+	// SentAt are the timestamps of the notifications sent in the last hour.
+	SentAt []time.Time `json:"sent_at,omitempty"`
+}
+
+// getNotificationStateFilePath returns the path of the file holding a step's notification history.
+func (w *WHAM) getNotificationStateFilePath(stepName string) string {
+	return filepath.Join(w.config.WhamSettings.MetadataDir, w.config.WhamSettings.MetadataPrefix+"notifications", stepName+".json")
+}
+
+// loadNotificationState reads a step's notification history. A missing or
+// unreadable file results in an empty history.
+func (w *WHAM) loadNotificationState(stepName string) notificationState {
+	var state notificationState
+	path := w.getNotificationStateFilePath(stepName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			w.logger.Warn().Str("step", stepName).Str("path", path).Err(err).Msg("Could not read notification state, assuming none was sent.")
+		}
+		return state
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		w.logger.Warn().Str("step", stepName).Str("path", path).Err(err).Msg("Could not parse notification state, assuming none was sent.")
+		return notificationState{}
+	}
+	return state
+}
+
+// saveNotificationState writes a step's notification history.
+func (w *WHAM) saveNotificationState(stepName string, state notificationState) error {
+	path := w.getNotificationStateFilePath(stepName)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create notifications directory '%s': %w", filepath.Dir(path), err)
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification state for '%s': %w", stepName, err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write notification state file '%s': %w", path, err)
+	}
+	return nil
+}
+
+// notifyStepOutcome sends the notification warranted by the outcome of a step's
+// execution, if notifications are configured. `execErr` is nil if the step succeeded.
+//
+// To keep the channel free of spam from a repeatedly failing step:
+//   - Deduplication: a failure is only reported once per failure streak. While the
+//     step keeps failing, subsequent runs send nothing.
+//   - Recovery: when a step reported as failing succeeds again, a "recovered"
+//     notification is sent and the streak ends.
+//   - Throttling: no more than `max_per_hour` notifications are sent per step in any
+//     hour. A suppressed notification is only logged, and a suppressed failure is
+//     still considered reported.
+//
+// Failing to deliver a notification is logged but never halts the workflow; it is
+// attempted again after the next execution of the step.
+func (w *WHAM) notifyStepOutcome(step *Step, execErr error) {
+	settings := w.config.WhamSettings.Notifications
+	if settings == nil {
+		return
+	}
+	if execErr != nil && !isNotifiedFailure(execErr) {
+		// The failure streak is left unchanged: no recovery is notified for this failure.
+		w.logger.Debug().Str("step", step.Name).Str("class", failureClass(execErr)).Msg("Notification disabled for this failure class.")
+		return
+	}
+
+	state := w.loadNotificationState(step.Name)
+	notification := Notification{Step: step.Name, Time: time.Now()}
+	if w.activeRun != nil {
+		notification.WorkflowRunID = w.activeRun.ID
+	}
+	switch {
+	case execErr != nil && !state.Failing:
+		notification.Event = NotificationFailure
+		notification.Error = execErr.Error()
+		notification.FailureClass = failureClass(execErr)
+	case execErr == nil && state.Failing:
+		notification.Event = NotificationRecovered
+	default:
+		w.logger.Debug().Str("step", step.Name).Bool("failing", state.Failing).Msg("No notification needed.")
+		return
+	}
+
+	// Only keep the notifications sent in the last hour, which count towards the limit.
+	var recent []time.Time
+	for _, sentAt := range state.SentAt {
+		if notification.Time.Sub(sentAt) < time.Hour {
+			recent = append(recent, sentAt)
+		}
+	}
+	state.SentAt = recent
+
+	if settings.MaxPerHour > 0 && len(state.SentAt) >= settings.MaxPerHour {
+		w.logger.Warn().Str("step", step.Name).Str("event", notification.Event).Int("max_per_hour", settings.MaxPerHour).Msg("Notification suppressed by throttling.")
+		state.Failing = execErr != nil
+	} else if err := w.sendNotification(step, notification); err != nil {
+		// The streak is left unchanged, so that delivery is attempted again on the next run.
+		w.logger.Warn().Str("step", step.Name).Str("event", notification.Event).Err(err).Msg("Could not send notification.")
+	} else {
+		state.SentAt = append(state.SentAt, notification.Time)
+		state.Failing = execErr != nil
+		w.logger.Info().Str("step", step.Name).Str("event", notification.Event).Msg("Notification sent.")
+	}
+
+	if err := w.saveNotificationState(step.Name, state); err != nil {
+		w.logger.Warn().Str("step", step.Name).Err(err).Msg("Could not save notification state.")
+	}
+}
+
+// sendNotification posts a notification as JSON to the configured webhook. The
+// webhook URL and secret are templates, so that they can be kept out of the
+// configuration. Deliveries failing with a network error or a 429 or 5xx response
+// are retried with an exponential backoff, up to the configured retries.
+func (w *WHAM) sendNotification(step *Step, notification Notification) error {
+	settings := w.config.WhamSettings.Notifications
+	templateContext := TemplateContext{Step: step, Config: w.config, StepsMap: w.steps()}
+	url, err := w.processTemplateString(settings.WebhookURL, templateContext)
+	if err != nil {
+		return fmt.Errorf("failed to process webhook_url template: %w", err)
+	}
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+	signature := ""
+	if settings.Secret != "" {
+		secret, err := w.processTemplateString(settings.Secret, templateContext)
+		if err != nil {
+			return fmt.Errorf("failed to process secret template: %w", err)
+		}
+		signature = signPayload(secret, payload)
+	}
+
+	delay := settings.RetryDelay
+	if delay == 0 {
+		delay = defaultNotificationRetryDelay
+	}
+	for attempt := 0; ; attempt++ {
+		retryable, err := postNotification(url, payload, signature)
+		if err == nil || !retryable || attempt >= settings.Retries {
+			return err
+		}
+		w.logger.Warn().Str("step", step.Name).Str("event", notification.Event).Err(err).Dur("delay", delay).Msg("Notification delivery failed, retrying.")
+		select {
+		case <-time.After(delay):
+		case <-w.runContext().Done():
+			return err // The workflow run was aborted: do not delay its shutdown.
+		}
+		delay *= 2
+	}
+}
+
+// signPayload returns the signature of a payload, as sent in the SignatureHeader.
+func signPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// postNotification posts a payload to the webhook once, with its signature if not
+// empty. It reports whether a failed delivery is worth retrying.
+func postNotification(url string, payload []byte, signature string) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return false, fmt.Errorf("failed to create notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if signature != "" {
+		req.Header.Set(SignatureHeader, signature)
+	}
+
+	client := &http.Client{Timeout: notificationTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("failed to post notification: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retryable, fmt.Errorf("webhook responded with status '%s'", resp.Status)
+	}
+	return false, nil
+}
@@ -0,0 +1,149 @@
+package cmd_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestNotifications_DeduplicatedAndThrottled verifies that a repeatedly failing step
+// is reported once per failure streak, that its recovery is reported, and that no
+// more than max_per_hour notifications are sent.
+func TestNotifications_DeduplicatedAndThrottled(t *testing.T) {
+	const configPath = "../test/settings/settings_notifications.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	var mu sync.Mutex
+	var events []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var notification struct {
+			Event string `json:"event"`
+			Step  string `json:"step"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&notification))
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, notification.Step+":"+notification.Event)
+	}))
+	defer server.Close()
+	t.Setenv("WHAM_TEST_WEBHOOK_URL", server.URL)
+
+	for _, exitStatus := range []string{
+		"fail",    // Reported.
+		"fail",    // Same failure streak: deduplicated.
+		"success", // Recovery reported.
+		"fail",    // Third notification within the hour: throttled.
+		"success", // Throttled as well.
+	} {
+		t.Setenv("TEST_EXIT_STATUS", exitStatus)
+		_, err := runWhamCommand(t, "--config", configPath, "run", "all")
+		assert.NoError(t, err, "The failing step can fail, so the workflow should succeed.")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"flaky:failure", "flaky:recovered"}, events)
+}
+
+// TestNotifications_SignedAndRetried verifies that notifications are signed with the
+// shared secret, and that a delivery failing with a 5xx response is retried.
+func TestNotifications_SignedAndRetried(t *testing.T) {
+	const configPath = "../test/settings/settings_notifications_signed.yaml"
+	const secret = "test-secret"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	var mu sync.Mutex
+	var attempts int
+	var delivered []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 {
+			rw.WriteHeader(http.StatusServiceUnavailable) // A transient failure.
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), r.Header.Get("X-Wham-Signature-256"), "The payload should be signed with the secret.")
+		var notification struct {
+			Event string `json:"event"`
+			Step  string `json:"step"`
+		}
+		assert.NoError(t, json.Unmarshal(body, &notification))
+		delivered = append(delivered, notification.Step+":"+notification.Event)
+	}))
+	defer server.Close()
+	t.Setenv("WHAM_TEST_WEBHOOK_URL", server.URL)
+	t.Setenv("WHAM_TEST_WEBHOOK_SECRET", secret)
+
+	_, err := runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.NoError(t, err, "The failing step can fail, so the workflow should succeed.")
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 2, attempts, "The failed delivery should be retried once.")
+	assert.Equal(t, []string{"failing:failure"}, delivered)
+}
+
+// TestNotifications_FailureRate verifies that a step failing more often than its
+// max_failure_rate is reported once with a distinct event, although each of its
+// failures is tolerated by can_fail.
+func TestNotifications_FailureRate(t *testing.T) {
+	const configPath = "../test/settings/settings_failure_rate.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	var mu sync.Mutex
+	var events []string
+	var rates []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var notification struct {
+			Event       string         `json:"event"`
+			Step        string         `json:"step"`
+			FailureRate map[string]any `json:"failure_rate"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&notification))
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, notification.Step+":"+notification.Event)
+		if notification.FailureRate != nil {
+			rates = append(rates, notification.FailureRate)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("WHAM_TEST_WEBHOOK_URL", server.URL)
+
+	var output string
+	for _, exitStatus := range []string{
+		"success",
+		"fail", // Failure reported, at the maximum rate (1 of 2).
+		"fail", // Above the maximum rate (2 of 3): reported.
+		"fail", // Still above it: not reported again.
+	} {
+		t.Setenv("TEST_EXIT_STATUS", exitStatus)
+		var err error
+		output, err = runWhamCommand(t, "--config", configPath, "run", "all")
+		assert.NoError(t, err, "The failing step can fail, so the workflow should succeed.")
+	}
+	assert.Contains(t, output, "Step 'flaky' failed 3 of its 4 executions over the last 7d")
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"flaky:failure", "flaky:failure_rate"}, events)
+	if assert.Len(t, rates, 1) {
+		assert.Equal(t, map[string]any{"executions": 3.0, "failures": 2.0, "rate": 2.0 / 3, "max": 0.5, "window": "7d"}, rates[0])
+	}
+}
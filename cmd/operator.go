@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+)
+
+// Operator-related concrete command structs
+
+// OperatorCmd handles the 'operator' command.
+type OperatorCmd struct {
+	APIServer string        `help:"URL of the Kubernetes API server. Defaults to the cluster WHAM runs in." placeholder:"URL"`
+	Namespace string        `help:"Only manage the Workflow resources of this namespace. Defaults to all namespaces." short:"n"`
+	WorkDir   string        `help:"Directory where the workflows' configurations and state are kept." type:"path" default:"wham-operator"`
+	Resync    time.Duration `help:"Interval at which the Workflow resources are listed." default:"30s"`
+	MaxRuns   int           `help:"Exit after N workflow runs. Defaults to 0 (never exit)." placeholder:"N"`
+}
+
+// Operator-related command implementations
+
+func (o *OperatorCmd) Run(ctx *Context) error {
+	if o.Resync <= 0 {
+		return fmt.Errorf("--resync must be positive")
+	}
+	if o.MaxRuns < 0 {
+		return fmt.Errorf("--max-runs cannot be negative")
+	}
+	return RunOperator(OperatorOptions{
+		APIServer: o.APIServer,
+		Namespace: o.Namespace,
+		WorkDir:   o.WorkDir,
+		Resync:    o.Resync,
+		MaxRuns:   o.MaxRuns,
+	}, ctx.Logger)
+}
@@ -0,0 +1,327 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// WorkflowResource is a Workflow custom resource, as served by the Kubernetes API.
+type WorkflowResource struct {
+	Metadata struct {
+		Name       string `json:"name"`
+		Namespace  string `json:"namespace"`
+		Generation int64  `json:"generation"`
+	} `json:"metadata"`
+	Spec WorkflowSpec `json:"spec"`
+}
+
+// key returns the "namespace/name" identifying the resource.
+func (r *WorkflowResource) key() string {
+	return r.Metadata.Namespace + "/" + r.Metadata.Name
+}
+
+// WorkflowSpec is the desired state of a Workflow resource.
+type WorkflowSpec struct {
+	// Config is the WHAM configuration of the workflow, as YAML.
+	Config string `json:"config"`
+	// Schedule is the cron expression of the workflow's runs. Defaults to the
+	// schedule settings of its configuration.
+	Schedule string `json:"schedule,omitempty"`
+	// TimeZone is the time zone of the schedule. Defaults to the time_zone of the
+	// schedule settings of its configuration.
+	TimeZone string `json:"timeZone,omitempty"`
+	// Suspend, if true, stops scheduling runs of the workflow.
+	Suspend bool `json:"suspend,omitempty"`
+	// Parallel is the number of independent steps run concurrently. Defaults to 1.
+	Parallel int `json:"parallel,omitempty"`
+	// Timeout, if set, is the maximum duration of each run (e.g., "2h"), overriding
+	// the workflow_timeout setting.
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// WorkflowStatus is the observed state of a Workflow resource, written by the operator.
+// As it is written with a JSON merge patch, the fields that can be cleared are not
+// omitted when empty.
+type WorkflowStatus struct {
+	// Phase is "Scheduled", "Running", "Suspended" or "Invalid". See the WorkflowPhase* constants.
+	Phase string `json:"phase"`
+	// Message explains why the workflow is invalid, or why its last run failed.
+	Message string `json:"message"`
+	// ObservedGeneration is the generation of the spec the status reflects.
+	ObservedGeneration int64 `json:"observedGeneration"`
+	// NextRunTime is the time of the next scheduled run.
+	NextRunTime *time.Time `json:"nextRunTime"`
+	// LastRunID is the ID of the last workflow run.
+	LastRunID string `json:"lastRunID,omitempty"`
+	// LastRunStatus is the outcome of the last run ("succeeded" or "failed").
+	LastRunStatus string `json:"lastRunStatus,omitempty"`
+	// LastRunTime is the time the last run finished.
+	LastRunTime *time.Time `json:"lastRunTime,omitempty"`
+	// LastRunElapsed is the duration of the last run (e.g., "1m30s").
+	LastRunElapsed string `json:"lastRunElapsed,omitempty"`
+}
+
+// Phases of a Workflow resource.
+const (
+	WorkflowPhaseScheduled = "Scheduled"
+	WorkflowPhaseRunning   = "Running"
+	WorkflowPhaseSuspended = "Suspended"
+	WorkflowPhaseInvalid   = "Invalid"
+)
+
+// OperatorOptions are the parameters of the operator. See RunOperator.
+type OperatorOptions struct {
+	// APIServer is the URL of the Kubernetes API server. Defaults to the cluster
+	// WHAM runs in.
+	APIServer string
+	// Namespace restricts the operator to the Workflow resources of a namespace.
+	// Defaults to all namespaces.
+	Namespace string
+	// WorkDir is the directory where the configurations are materialized and the
+	// state of the workflows is kept, in a subdirectory per resource.
+	WorkDir string
+	// Resync is the interval at which the Workflow resources are listed.
+	Resync time.Duration
+	// MaxRuns, if positive, stops the operator after that number of runs.
+	MaxRuns int
+}
+
+// managedWorkflow is a Workflow resource managed by the operator.
+type managedWorkflow struct {
+	resource WorkflowResource
+	// wham is the engine of the materialized configuration. Nil if it is invalid.
+	wham     *WHAM
+	schedule *cronSchedule
+	opts     RunOptions
+	next     time.Time
+	status   WorkflowStatus
+}
+
+// operator reconciles the Workflow resources of a cluster with the workflows it runs.
+type operator struct {
+	client    *kubeClient
+	opts      OperatorOptions
+	logger    zerolog.Logger
+	workflows map[string]*managedWorkflow
+}
+
+// RunOperator runs WHAM as a Kubernetes operator: it watches the Workflow custom
+// resources of the cluster (by listing them every `opts.Resync`), materializes the
+// configuration of each one in its own directory under `opts.WorkDir`, runs it on
+// its schedule, and writes the outcome of its runs to the resource's status.
+//
+// Runs are executed one at a time, in the order they are due, as by `wham serve`.
+// A change of a resource's spec (i.e. of its generation) reloads its configuration;
+// a deleted resource is no longer scheduled, but its state is kept on disk.
+//
+// SIGINT and SIGTERM stop the operator, as described on startRunContext.
+func RunOperator(opts OperatorOptions, logger zerolog.Logger) error {
+	client, err := newKubeClient(opts.APIServer)
+	if err != nil {
+		return err
+	}
+	o := &operator{client: client, opts: opts, logger: logger, workflows: make(map[string]*managedWorkflow)}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	logger.Info().Str("api_server", client.baseURL).Str("namespace", opts.Namespace).Msg("Operator started.")
+	var lastSync time.Time
+	for runs := 0; opts.MaxRuns == 0 || runs < opts.MaxRuns; {
+		if time.Since(lastSync) >= opts.Resync {
+			if err := o.sync(); err != nil {
+				logger.Error().Err(err).Msg("Could not list the Workflow resources.")
+			}
+			lastSync = time.Now()
+		}
+
+		wakeUp := lastSync.Add(opts.Resync)
+		due := o.nextDue()
+		if due != nil && due.next.Before(wakeUp) {
+			wakeUp = due.next
+		}
+		timer := time.NewTimer(time.Until(wakeUp))
+		select {
+		case sig := <-signals:
+			timer.Stop()
+			fmt.Printf("🛑 Received %s, stopping the operator.\n", sig)
+			logger.Info().Str("signal", sig.String()).Msg("Operator stopped by signal.")
+			return nil
+		case <-timer.C:
+		}
+
+		if due == nil || time.Now().Before(due.next) {
+			continue // Time to list the resources again.
+		}
+		if err := o.run(due); errors.Is(err, errInterrupted) {
+			return err
+		}
+		runs++
+	}
+	logger.Info().Int("runs", opts.MaxRuns).Msg("Operator finished the requested number of runs.")
+	return nil
+}
+
+// sync lists the Workflow resources, loads the new and changed ones, and forgets
+// the deleted ones.
+func (o *operator) sync() error {
+	resources, err := o.client.listWorkflows(o.opts.Namespace)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, resource := range resources {
+		key := resource.key()
+		seen[key] = true
+		current, ok := o.workflows[key]
+		if ok && current.resource.Metadata.Generation == resource.Metadata.Generation {
+			continue
+		}
+		workflow := o.load(resource)
+		o.workflows[key] = workflow
+		o.writeStatus(workflow)
+	}
+	for key := range o.workflows {
+		if !seen[key] {
+			o.logger.Info().Str("workflow", key).Msg("Workflow resource deleted, no longer scheduled.")
+			delete(o.workflows, key)
+		}
+	}
+	return nil
+}
+
+// load materializes the configuration of a Workflow resource and prepares its
+// schedule. The errors are reported in the status of the returned workflow.
+func (o *operator) load(resource WorkflowResource) *managedWorkflow {
+	workflow := &managedWorkflow{resource: resource}
+	workflow.status.ObservedGeneration = resource.Metadata.Generation
+	if err := o.prepare(workflow); err != nil {
+		o.logger.Error().Str("workflow", resource.key()).Err(err).Msg("Invalid Workflow resource.")
+		workflow.wham = nil
+		workflow.status.Phase = WorkflowPhaseInvalid
+		workflow.status.Message = err.Error()
+		return workflow
+	}
+	if resource.Spec.Suspend {
+		workflow.status.Phase = WorkflowPhaseSuspended
+		return workflow
+	}
+	workflow.next = workflow.schedule.next(time.Now())
+	workflow.status.Phase = WorkflowPhaseScheduled
+	workflow.status.NextRunTime = &workflow.next
+	o.logger.Info().Str("workflow", resource.key()).Time("next_run", workflow.next).Msg("Workflow resource loaded.")
+	return workflow
+}
+
+// prepare writes the configuration of a workflow to its directory, and creates its
+// WHAM engine, run options and schedule.
+func (o *operator) prepare(workflow *managedWorkflow) error {
+	spec := workflow.resource.Spec
+	if spec.Config == "" {
+		return fmt.Errorf("spec.config cannot be empty")
+	}
+	dir := filepath.Join(o.opts.WorkDir, workflow.resource.Metadata.Namespace, workflow.resource.Metadata.Name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create workflow directory '%s': %w", dir, err)
+	}
+	configPath := filepath.Join(dir, "settings.yaml")
+	if err := os.WriteFile(configPath, []byte(spec.Config), 0644); err != nil {
+		return fmt.Errorf("failed to write configuration: %w", err)
+	}
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	wham, err := NewWHAM(config, o.logger.With().Str("workflow", workflow.resource.key()).Logger())
+	if err != nil {
+		return err
+	}
+	for _, d := range []string{config.WhamSettings.MetadataDir, config.WhamSettings.DataDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return fmt.Errorf("failed to create directory '%s': %w", d, err)
+		}
+	}
+
+	workflow.opts = RunOptions{Parallel: max(spec.Parallel, 1)}
+	if spec.Timeout != "" {
+		if workflow.opts.Timeout, err = time.ParseDuration(spec.Timeout); err != nil || workflow.opts.Timeout < 0 {
+			return fmt.Errorf("invalid spec.timeout '%s'", spec.Timeout)
+		}
+	}
+	settings := ScheduleSettings{}
+	if config.WhamSettings.Schedule != nil {
+		settings = *config.WhamSettings.Schedule
+	}
+	if spec.TimeZone != "" {
+		settings.TimeZone = spec.TimeZone
+	}
+	if spec.Schedule != "" {
+		settings.Cron = spec.Schedule
+	}
+	if settings.Cron == "" {
+		return fmt.Errorf("no schedule defined: set spec.schedule or the 'schedule' settings")
+	}
+	if workflow.schedule, err = settings.parse(settings.Cron); err != nil {
+		return err
+	}
+	workflow.wham = wham
+	return nil
+}
+
+// nextDue returns the scheduled workflow whose next run is the earliest, or nil.
+func (o *operator) nextDue() *managedWorkflow {
+	var due *managedWorkflow
+	for _, workflow := range o.workflows {
+		if workflow.status.Phase != WorkflowPhaseScheduled {
+			continue
+		}
+		if due == nil || workflow.next.Before(due.next) {
+			due = workflow
+		}
+	}
+	return due
+}
+
+// run executes a run of a workflow, and records its outcome in the resource's status.
+func (o *operator) run(workflow *managedWorkflow) error {
+	key := workflow.resource.key()
+	workflow.status.Phase = WorkflowPhaseRunning
+	workflow.status.NextRunTime = nil
+	o.writeStatus(workflow)
+
+	fmt.Printf("🏃 Running workflow '%s'.\n", key)
+	err := workflow.wham.RunAllSteps(workflow.opts)
+	if err != nil {
+		o.logger.Error().Str("workflow", key).Err(err).Msg("Workflow run failed.")
+	}
+	workflow.status.Message = ""
+	if run, loadErr := workflow.wham.loadLastFinishedWorkflowRun(); loadErr == nil && run != nil {
+		workflow.status.LastRunID = run.ID
+		workflow.status.LastRunStatus = run.Status
+		workflow.status.LastRunTime = &run.FinishedAt
+		workflow.status.LastRunElapsed = run.Elapsed.Round(time.Millisecond).String()
+		workflow.status.Message = run.Error
+	}
+
+	workflow.next = workflow.schedule.next(time.Now())
+	workflow.status.Phase = WorkflowPhaseScheduled
+	workflow.status.NextRunTime = &workflow.next
+	o.writeStatus(workflow)
+	return err
+}
+
+// writeStatus writes the status of a workflow to its resource. Failures are
+// logged, as the status is written again after the next run.
+func (o *operator) writeStatus(workflow *managedWorkflow) {
+	if err := o.client.updateWorkflowStatus(&workflow.resource, workflow.status); err != nil {
+		o.logger.Warn().Str("workflow", workflow.resource.key()).Err(err).Msg("Could not update the Workflow status.")
+	}
+}
@@ -0,0 +1,88 @@
+package cmd_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestOperator_RunsWorkflowResources verifies that the operator lists the Workflow
+// resources of the API server, runs the valid ones on their schedule, and writes
+// their status, including the reason why a resource is invalid.
+func TestOperator_RunsWorkflowResources(t *testing.T) {
+	const workflowConfig = `
+wham_settings:
+  data_dir: "data"
+  metadata_dir: "metadata"
+wham_steps:
+- name: "hello"
+  command: ["/bin/sh", "-c", "echo hello from the operator"]
+  previous_steps: []
+`
+	resources := []map[string]any{
+		{
+			"metadata": map[string]any{"name": "nightly", "namespace": "etl", "generation": 1},
+			"spec":     map[string]any{"schedule": "@every 1s", "config": workflowConfig},
+		},
+		{
+			"metadata": map[string]any{"name": "broken", "namespace": "etl", "generation": 3},
+			"spec":     map[string]any{"config": workflowConfig}, // No schedule.
+		},
+	}
+
+	var mu sync.Mutex
+	statuses := make(map[string][]map[string]any)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/apis/wham.matiq.ai/v1alpha1/namespaces/etl/workflows":
+			json.NewEncoder(rw).Encode(map[string]any{"items": resources})
+		case r.Method == http.MethodPatch:
+			assert.Equal(t, "application/merge-patch+json", r.Header.Get("Content-Type"))
+			body, _ := io.ReadAll(r.Body)
+			var patch struct {
+				Status map[string]any `json:"status"`
+			}
+			assert.NoError(t, json.Unmarshal(body, &patch))
+			mu.Lock()
+			statuses[r.URL.Path] = append(statuses[r.URL.Path], patch.Status)
+			mu.Unlock()
+		default:
+			http.NotFound(rw, r)
+		}
+	}))
+	defer server.Close()
+
+	outputStr, err := runWhamCommand(t, "operator", "--api-server", server.URL, "--namespace", "etl", "--work-dir", t.TempDir(), "--resync", "1s", "--max-runs", "1")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "Running workflow 'etl/nightly'.")
+	assert.Contains(t, outputStr, "hello from the operator")
+
+	mu.Lock()
+	defer mu.Unlock()
+	phases := func(path string) []string {
+		var result []string
+		for _, status := range statuses[path] {
+			result = append(result, fmt.Sprint(status["phase"]))
+		}
+		return result
+	}
+	const statusPath = "/apis/wham.matiq.ai/v1alpha1/namespaces/etl/workflows/%s/status"
+	assert.Equal(t, []string{"Scheduled", "Running", "Scheduled"}, phases(fmt.Sprintf(statusPath, "nightly")))
+	if nightly := statuses[fmt.Sprintf(statusPath, "nightly")]; len(nightly) == 3 {
+		assert.Equal(t, "succeeded", nightly[2]["lastRunStatus"])
+		assert.NotEmpty(t, nightly[2]["lastRunID"])
+		assert.NotNil(t, nightly[2]["nextRunTime"])
+		assert.EqualValues(t, 1, nightly[2]["observedGeneration"])
+	}
+	assert.Equal(t, []string{"Invalid"}, phases(fmt.Sprintf(statusPath, "broken")))
+	if broken := statuses[fmt.Sprintf(statusPath, "broken")]; len(broken) == 1 {
+		assert.Contains(t, broken[0]["message"], "no schedule defined")
+		assert.EqualValues(t, 3, broken[0]["observedGeneration"])
+	}
+}
@@ -0,0 +1,249 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template/parse"
+)
+
+// preflightConcurrency is the number of steps the preflight check validates at the
+// same time. The checks mostly wait on the filesystem and on `--version` probes.
+const preflightConcurrency = 8
+
+// preflightCheck validates the steps `run all` is about to execute before running
+// any of them, so that a broken step is reported at once rather than hours into the
+// run, when it is reached. The steps are checked concurrently, and all the problems
+// found are printed and returned together. For each step, it checks:
+//   - its executable (or sub-workflow) and hooks, as `step validate` does;
+//   - its `work_dir`, `run_as_user` and `run_as_group`;
+//   - the binaries it `requires` (see checkRequirements);
+//   - its templates (args, env_vars, those of its connection and env files, and
+//     `when`), which must parse, and the variables they read with `require_env`,
+//     which must be set;
+//   - unless forced, that its predecessors left out of the run have a state it can
+//     run from, as a stateless step otherwise fails its precondition check.
+//
+// The settings' `shared_args` and `env_files` are checked once. Steps that will be
+// skipped anyway (disabled, or in maintenance mode) are not checked, unless forced.
+// The problems of the steps that can fail (see stepCanFail) are only warnings, as
+// their failure does not halt the workflow.
+func (w *WHAM) preflightCheck(steps []*Step, force bool) error {
+	planned := make(map[string]bool, len(steps))
+	for _, step := range steps {
+		planned[step.Name] = true
+	}
+
+	problems := make([][]string, len(steps))
+	sem := make(chan struct{}, preflightConcurrency)
+	done := make(chan struct{})
+	for i, step := range steps {
+		go func() {
+			sem <- struct{}{}
+			defer func() { <-sem; done <- struct{}{} }()
+			if !force && (w.config.WhamSettings.Maintenance || step.Disabled || w.disabledAncestor(step) != "") {
+				return
+			}
+			for _, problem := range w.preflightStep(step, force, planned) {
+				problems[i] = append(problems[i], fmt.Sprintf("step '%s': %s", step.Name, problem))
+			}
+		}()
+	}
+	for range steps {
+		<-done
+	}
+
+	all := w.preflightSettings()
+	for i, stepProblems := range problems {
+		if !w.stepCanFail(steps[i]) {
+			all = append(all, stepProblems...)
+			continue
+		}
+		for _, problem := range stepProblems {
+			fmt.Printf("⚠️ Preflight check: %s (the step can fail, the workflow will continue).\n", problem)
+			w.logger.Warn().Str("step", steps[i].Name).Str("problem", problem).Msg("Preflight check found a problem in a step that can fail.")
+		}
+	}
+	if len(all) == 0 {
+		w.logger.Debug().Int("steps", len(steps)).Msg("Preflight check passed.")
+		return nil
+	}
+	fmt.Printf("🚫 Preflight check found %d problem(s), no step was run:\n", len(all))
+	for _, problem := range all {
+		fmt.Printf("  - %s\n", problem)
+	}
+	return fmt.Errorf("preflight check failed: %s", strings.Join(all, "; "))
+}
+
+// preflightSettings checks the settings shared by all the steps: the templates of
+// `shared_args` and the `env_files`.
+func (w *WHAM) preflightSettings() []string {
+	var problems []string
+	for _, tpl := range w.config.WhamSettings.SharedArgs {
+		if err := w.checkTemplate(tpl); err != nil {
+			problems = append(problems, fmt.Sprintf("shared_arg '%s': %v", tpl, err))
+		}
+	}
+	for _, path := range w.config.WhamSettings.EnvFiles {
+		problems = append(problems, w.checkEnvFile(path)...)
+	}
+	return problems
+}
+
+// preflightStep returns the problems found by the preflight check of a step (see
+// preflightCheck).
+func (w *WHAM) preflightStep(step *Step, force bool, planned map[string]bool) []string {
+	var problems []string
+	add := func(err error) {
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if step.Type == StepTypeWorkflow {
+		add(w.validateSubWorkflow(step))
+	} else {
+		_, err := w.validateStepExecutable(step)
+		add(err)
+	}
+	for _, hooks := range [][][]string{step.Before, step.After, step.BeforeRetry} {
+		for _, hook := range hooks {
+			add(w.checkHookExecutable(hook[0]))
+		}
+	}
+	_, err := w.resolveWorkDir(step)
+	add(err)
+	_, err = resolveRunAs(step)
+	add(err)
+	if err := checkStepRequirements(step); err != nil {
+		add(fmt.Errorf("requirements not met: %w", err))
+	}
+
+	for _, arg := range step.Args {
+		if err := w.checkTemplate(arg); err != nil {
+			add(fmt.Errorf("arg '%s': %w", arg, err))
+		}
+	}
+	for k, v := range step.EnvVars {
+		if err := w.checkTemplate(v); err != nil {
+			add(fmt.Errorf("env_var '%s': %w", k, err))
+		}
+	}
+	if step.Connection != "" {
+		for k, v := range w.config.Connections[step.Connection].EnvVars {
+			if err := w.checkTemplate(v); err != nil {
+				add(fmt.Errorf("env_var '%s' of connection '%s': %w", k, step.Connection, err))
+			}
+		}
+	}
+	for _, path := range step.EnvFiles {
+		problems = append(problems, w.checkEnvFile(path)...)
+	}
+	if err := w.checkTemplate(step.When); err != nil {
+		add(fmt.Errorf("'when' condition '%s': %w", step.When, err))
+	}
+
+	if !force && !producesOwnRunID(step) {
+		var outside []string
+		for _, prev := range step.PreviousSteps {
+			if !planned[prev] {
+				outside = append(outside, prev)
+			}
+		}
+		if len(outside) > 0 {
+			if _, err := w.checkPreviousStepsConsistency(outside); err != nil {
+				add(fmt.Errorf("precondition check failed for step '%s': %w", step.Name, err))
+			}
+		}
+	}
+	return problems
+}
+
+// checkHookExecutable verifies that the executable of a hook exists.
+func (w *WHAM) checkHookExecutable(name string) error {
+	executable, err := w.hookExecutable(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(executable); err != nil {
+		return fmt.Errorf("hook executable '%s' not found", name)
+	}
+	return nil
+}
+
+// checkEnvFile verifies that an env file can be read and that the templates of its
+// values are valid.
+func (w *WHAM) checkEnvFile(path string) []string {
+	vars, err := parseEnvFile(w.resolvePath(path))
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var problems []string
+	for _, v := range vars {
+		if err := w.checkTemplate(v[1]); err != nil {
+			problems = append(problems, fmt.Sprintf("variable '%s' of env file '%s': %v", v[0], path, err))
+		}
+	}
+	return problems
+}
+
+// checkTemplate verifies, without executing it, that a template parses and that
+// the environment variables it reads with `require_env` are set. Only the calls
+// made whatever the data are checked: those of the branches of `if`, `with` and
+// `range` may never be executed.
+func (w *WHAM) checkTemplate(tplStr string) error {
+	if tplStr == "" {
+		return nil
+	}
+	tmpl, err := w.parseTemplate(tplStr)
+	if err != nil {
+		return err
+	}
+	for _, key := range requiredEnvVars(tmpl.Root) {
+		if value, ok := os.LookupEnv(key); !ok || value == "" {
+			return fmt.Errorf("required environment variable '%s' is not set or is empty", key)
+		}
+	}
+	return nil
+}
+
+// requiredEnvVars returns the names of the environment variables a template
+// always reads with `require_env`, i.e. outside of its conditional branches, when
+// they are given as literals.
+func requiredEnvVars(node parse.Node) []string {
+	var keys []string
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n != nil {
+			for _, child := range n.Nodes {
+				keys = append(keys, requiredEnvVars(child)...)
+			}
+		}
+	case *parse.ActionNode:
+		keys = requiredEnvVars(n.Pipe)
+	case *parse.IfNode:
+		keys = requiredEnvVars(n.Pipe)
+	case *parse.WithNode:
+		keys = requiredEnvVars(n.Pipe)
+	case *parse.RangeNode:
+		keys = requiredEnvVars(n.Pipe)
+	case *parse.PipeNode:
+		if n != nil {
+			for _, cmd := range n.Cmds {
+				keys = append(keys, requiredEnvVars(cmd)...)
+			}
+		}
+	case *parse.CommandNode:
+		if len(n.Args) == 2 {
+			ident, isIdent := n.Args[0].(*parse.IdentifierNode)
+			key, isString := n.Args[1].(*parse.StringNode)
+			if isIdent && isString && ident.Ident == "require_env" {
+				keys = append(keys, key.Text)
+			}
+		}
+		for _, arg := range n.Args {
+			keys = append(keys, requiredEnvVars(arg)...)
+		}
+	}
+	return keys
+}
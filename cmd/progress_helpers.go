@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"time"
+)
+
+// ProgressFile is the content of the progress file of a `run all` invocation: the
+// progress reported over the inspection socket, written to the metadata directory
+// for the monitoring agents and dashboards that cannot query the socket.
+type ProgressFile struct {
+	RunProgress
+	// Status is "running" until the run finishes, then "succeeded" or "failed".
+	Status string `json:"status"`
+	// UpdatedAt is when the file was last written.
+	UpdatedAt time.Time `json:"updated_at"`
+	// ETA, while the run is in progress and once a step has finished, is the
+	// estimated end of the run, extrapolated from the average duration of the
+	// finished steps.
+	ETA *time.Time `json:"eta,omitempty"`
+}
+
+// getProgressFilePath returns the path of the progress file, which tells the
+// progress of the last `run all` invocation (e.g., metadata/wham_progress.json).
+func (w *WHAM) getProgressFilePath() string {
+	return filepath.Join(w.config.WhamSettings.MetadataDir, w.config.WhamSettings.MetadataPrefix+"progress.json")
+}
+
+// startProgressFile makes the execution being inspected write its progress to the
+// progress file, whenever it changes. It is a no-op when no execution is being
+// inspected.
+func (w *WHAM) startProgressFile() {
+	insp := w.inspection
+	if insp == nil {
+		return
+	}
+	insp.mu.Lock()
+	defer insp.mu.Unlock()
+	insp.progressFile = w.getProgressFilePath()
+	w.writeProgressFile(insp, "running")
+}
+
+// finishProgressFile records the final status of the run in the progress file.
+func (w *WHAM) finishProgressFile(status string) {
+	insp := w.inspection
+	if insp == nil {
+		return
+	}
+	insp.mu.Lock()
+	defer insp.mu.Unlock()
+	if insp.progressFile != "" {
+		w.writeProgressFile(insp, status)
+	}
+}
+
+// writeProgressFile writes the progress of an inspected execution to its progress
+// file, atomically, so that readers never see a partial file. The caller must hold
+// insp.mu. Failing to write the file is logged but never halts the workflow.
+func (w *WHAM) writeProgressFile(insp *inspection, status string) {
+	now := time.Now()
+	file := ProgressFile{RunProgress: insp.progress, Status: status, UpdatedAt: now}
+	if p := insp.progress; status == "running" && p.StepsDone > 0 && p.StepsTotal > p.StepsDone {
+		perStep := now.Sub(p.StartedAt) / time.Duration(p.StepsDone)
+		eta := now.Add(perStep * time.Duration(p.StepsTotal-p.StepsDone))
+		file.ETA = &eta
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		w.logger.Warn().Err(err).Msg("Could not marshal the progress file.")
+		return
+	}
+	if err := writeFileAtomically(insp.progressFile, data); err != nil {
+		w.logger.Warn().Str("path", insp.progressFile).Err(err).Msg("Could not write the progress file.")
+	}
+}
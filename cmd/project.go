@@ -0,0 +1,17 @@
+package cmd
+
+// Project-related concrete command structs
+
+// ProjectCmd groups the commands working on the projects registry.
+type ProjectCmd struct {
+	List ProjectListCmd `cmd:"" help:"List the projects of the projects registry."`
+}
+
+// ProjectListCmd handles the 'project list' command.
+type ProjectListCmd struct{}
+
+// Project-related command implementations
+
+func (p *ProjectListCmd) Run(ctx *Context) error {
+	return ShowProjects(ctx.ProjectsFile, ctx.OutputFormat)
+}
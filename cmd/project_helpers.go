@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Project is a workflow of the projects registry, selected with --project: its
+// configuration files and, optionally, its own data and metadata directories.
+type Project struct {
+	// Config are the configuration files of the project, as given with --config.
+	Config []string `json:"config" yaml:"config"`
+	// DataDir and MetadataDir, if set, override the directories of the
+	// configuration, as --data-dir and --metadata-dir.
+	DataDir     string `json:"data_dir,omitempty" yaml:"data_dir,omitempty"`
+	MetadataDir string `json:"metadata_dir,omitempty" yaml:"metadata_dir,omitempty"`
+}
+
+// ProjectRegistry is the projects registry, a YAML file mapping project names to
+// their configuration files and directories, so that a host running the workflows
+// of several teams switches between them with --project.
+type ProjectRegistry struct {
+	Projects map[string]Project `yaml:"projects"`
+	// Path is the path of the registry file.
+	Path string `yaml:"-"`
+}
+
+// projectsFileSearchPaths returns the paths where the projects registry is looked
+// up when none is given, in order of precedence.
+func projectsFileSearchPaths() []string {
+	var paths []string
+	if dir := userConfigDir(); dir != "" {
+		paths = append(paths, filepath.Join(dir, "projects.yaml"))
+	}
+	return append(paths, filepath.Join("/etc", "wham", "projects.yaml"))
+}
+
+// LoadProjectRegistry reads the projects registry at `path` or, if empty, the
+// first existing one of $XDG_CONFIG_HOME/wham/projects.yaml (~/.config if unset)
+// and /etc/wham/projects.yaml. The relative paths of the projects are resolved
+// against the directory of the registry, and made absolute.
+//
+// Projects must not share their metadata directory, as their states would then
+// overwrite each other.
+func LoadProjectRegistry(path string) (*ProjectRegistry, error) {
+	if path == "" {
+		paths := projectsFileSearchPaths()
+		for _, candidate := range paths {
+			if fileExists(candidate) {
+				path = candidate
+				break
+			}
+		}
+		if path == "" {
+			return nil, fmt.Errorf("no projects registry found in %s; use --projects-file or WHAM_PROJECTS_FILE", strings.Join(paths, ", "))
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read projects registry '%s': %w", path, err)
+	}
+	registry := &ProjectRegistry{}
+	if err := yaml.Unmarshal(data, registry); err != nil {
+		return nil, fmt.Errorf("failed to parse projects registry '%s': %w", path, err)
+	}
+	if registry.Path, err = filepath.Abs(path); err != nil {
+		return nil, fmt.Errorf("failed to resolve projects registry path '%s': %w", path, err)
+	}
+	if len(registry.Projects) == 0 {
+		return nil, fmt.Errorf("projects registry '%s' defines no project", path)
+	}
+
+	baseDir := filepath.Dir(registry.Path)
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(baseDir, p)
+	}
+	metadataDirs := make(map[string]string)
+	for _, name := range registry.Names() {
+		project := registry.Projects[name]
+		if !lockNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid project name '%s' in projects registry '%s': only letters, digits, '_', '.' and '-' are allowed", name, path)
+		}
+		if len(project.Config) == 0 {
+			return nil, fmt.Errorf("project '%s' of projects registry '%s' has no config", name, path)
+		}
+		for i, configPath := range project.Config {
+			project.Config[i] = resolve(configPath)
+		}
+		project.DataDir = resolve(project.DataDir)
+		project.MetadataDir = resolve(project.MetadataDir)
+		if project.MetadataDir != "" {
+			if other, ok := metadataDirs[project.MetadataDir]; ok {
+				return nil, fmt.Errorf("projects '%s' and '%s' of projects registry '%s' share the metadata_dir '%s'", other, name, path, project.MetadataDir)
+			}
+			metadataDirs[project.MetadataDir] = name
+		}
+		registry.Projects[name] = project
+	}
+	return registry, nil
+}
+
+// Names returns the names of the projects, sorted.
+func (r *ProjectRegistry) Names() []string {
+	names := make([]string, 0, len(r.Projects))
+	for name := range r.Projects {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Project returns the project of a name, or an error listing the known projects.
+func (r *ProjectRegistry) Project(name string) (Project, error) {
+	project, ok := r.Projects[name]
+	if !ok {
+		return Project{}, fmt.Errorf("project '%s' not found in projects registry '%s' (known projects: %s)", name, r.Path, strings.Join(r.Names(), ", "))
+	}
+	return project, nil
+}
+
+// ProjectInfo is a project as listed by `project list`.
+type ProjectInfo struct {
+	Name    string `json:"name" yaml:"name"`
+	Project `yaml:",inline"`
+}
+
+// ShowProjects lists the projects of the projects registry (see LoadProjectRegistry).
+func ShowProjects(registryPath string, outputFormat string) error {
+	registry, err := LoadProjectRegistry(registryPath)
+	if err != nil {
+		return err
+	}
+	projects := make([]ProjectInfo, 0, len(registry.Projects))
+	for _, name := range registry.Names() {
+		projects = append(projects, ProjectInfo{Name: name, Project: registry.Projects[name]})
+	}
+
+	switch outputFormat {
+	case "json", "yaml":
+		return RenderData(os.Stdout, projects, outputFormat)
+	case "table", "wide":
+		tr := NewTableRenderer(os.Stdout, "NAME", "CONFIG", "DATA DIR", "METADATA DIR")
+		for _, p := range projects {
+			tr.AddRow(p.Name, strings.Join(p.Config, ", "), orDash(p.DataDir), orDash(p.MetadataDir))
+		}
+		return tr.Render()
+	default:
+		return fmt.Errorf("unsupported output format: '%s'", outputFormat)
+	}
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// ptyDrainTimeout bounds how long the output of a script run under a pseudo-terminal
+// is drained after it exits, in case a background process still holds the terminal.
+const ptyDrainTimeout = time.Second
+
+// runInPTY runs a command with a pseudo-terminal as its standard input, output and
+// error, as `script -c` would, and copies everything the command writes to `out`.
+//
+// The terminal becomes the controlling terminal of the script, which requires a new
+// session. The script leads the session's process group, so the whole group can
+// still be killed by the command's Cancel function.
+func runInPTY(cmd *exec.Cmd, out io.Writer) error {
+	ptmx, tty, err := openPTY()
+	if err != nil {
+		return fmt.Errorf("failed to open pseudo-terminal: %w", err)
+	}
+	defer ptmx.Close()
+
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = tty, tty, tty
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0, Credential: cmd.SysProcAttr.Credential}
+	err = cmd.Start()
+	tty.Close() // Only the script holds the terminal now, so reads end when it exits.
+	if err != nil {
+		return err
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		// Reading the terminal fails with EIO once the script closed it, which is expected.
+		io.Copy(out, ptmx)
+		close(drained)
+	}()
+	err = cmd.Wait()
+	select {
+	case <-drained:
+	case <-time.After(ptyDrainTimeout):
+	}
+	return err
+}
+
+// openPTY allocates a pseudo-terminal and returns its master and slave ends.
+// Output post-processing is disabled, so that lines are not rewritten with "\r\n".
+func openPTY() (ptmx, tty *os.File, err error) {
+	ptmx, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	fd := int(ptmx.Fd())
+	n, err := unix.IoctlGetUint32(fd, unix.TIOCGPTN)
+	if err == nil {
+		err = unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0) // Unlock the slave end.
+	}
+	if err == nil {
+		tty, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	}
+	if err != nil {
+		ptmx.Close()
+		return nil, nil, err
+	}
+	termios, err := unix.IoctlGetTermios(int(tty.Fd()), unix.TCGETS)
+	if err == nil {
+		termios.Oflag &^= unix.ONLCR
+		err = unix.IoctlSetTermios(int(tty.Fd()), unix.TCSETS, termios)
+	}
+	if err != nil {
+		ptmx.Close()
+		tty.Close()
+		return nil, nil, fmt.Errorf("failed to configure pseudo-terminal: %w", err)
+	}
+	return ptmx, tty, nil
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"runtime"
+)
+
+// runInPTY would run a command under a pseudo-terminal. Allocating one is only
+// implemented on Linux.
+func runInPTY(cmd *exec.Cmd, out io.Writer) error {
+	return fmt.Errorf("running steps with 'tty: true' is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// versionProbeTimeout bounds how long WHAM waits for `<binary> --version`.
+const versionProbeTimeout = 10 * time.Second
+
+// requirementPattern parses an entry of `requires`: the name or path of a binary,
+// optionally followed by the minimum version it must have (e.g., "psql>=14").
+var requirementPattern = regexp.MustCompile(`^([^\s<>=]+)\s*(?:>=\s*(\d+(?:\.\d+)*))?$`)
+
+// versionPattern finds the version in the output of `<binary> --version`, e.g.
+// "14.5" in "psql (PostgreSQL) 14.5" or "1.6" in "jq-1.6".
+var versionPattern = regexp.MustCompile(`\d+(?:\.\d+)*`)
+
+// requirement is a binary a step needs to run (see Step.Requires).
+type requirement struct {
+	// binary is the name of the binary, looked up in the PATH, or its path.
+	binary string
+	// minVersion, if set, is the minimum version of the binary.
+	minVersion string
+}
+
+// parseRequirement parses an entry of `requires`.
+func parseRequirement(entry string) (requirement, error) {
+	match := requirementPattern.FindStringSubmatch(strings.TrimSpace(entry))
+	if match == nil {
+		return requirement{}, fmt.Errorf("invalid requirement '%s': expected a binary name or path, optionally followed by '>=<version>'", entry)
+	}
+	return requirement{binary: match[1], minVersion: match[2]}, nil
+}
+
+// check verifies that the binary exists, in the PATH of WHAM unless it is given as
+// a path, that it is executable and, with a minimum version, that the version it
+// reports with `--version` is at least that one.
+func (r requirement) check() error {
+	path, err := exec.LookPath(r.binary)
+	if err != nil {
+		if strings.Contains(r.binary, "/") {
+			return fmt.Errorf("required binary '%s' not found or not executable", r.binary)
+		}
+		return fmt.Errorf("required binary '%s' not found in PATH", r.binary)
+	}
+	if r.minVersion == "" {
+		return nil
+	}
+	version, err := binaryVersion(path)
+	if err != nil {
+		return fmt.Errorf("failed to determine the version of required binary '%s': %w", r.binary, err)
+	}
+	if compareVersions(version, r.minVersion) < 0 {
+		return fmt.Errorf("required binary '%s' has version %s, but %s or later is required", r.binary, version, r.minVersion)
+	}
+	return nil
+}
+
+// binaryVersion returns the first version number printed by `<path> --version`.
+func binaryVersion(path string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), versionProbeTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, path, "--version").CombinedOutput()
+	// Some binaries exit with an error even though they print their version.
+	if version := versionPattern.FindString(string(output)); version != "" {
+		return version, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("'%s --version' failed: %w", path, err)
+	}
+	return "", fmt.Errorf("'%s --version' did not print a version", path)
+}
+
+// compareVersions compares two dotted version numbers component by component,
+// the missing components counting as 0. It returns -1, 0 or 1.
+func compareVersions(a, b string) int {
+	aParts, bParts := strings.Split(a, "."), strings.Split(b, ".")
+	for i := range max(len(aParts), len(bParts)) {
+		var x, y int
+		if i < len(aParts) {
+			x, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			y, _ = strconv.Atoi(bParts[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// checkStepRequirements verifies the binaries a step requires (`requires`), and
+// returns the error of the first one that is not available.
+func checkStepRequirements(step *Step) error {
+	for _, entry := range step.Requires {
+		req, err := parseRequirement(entry)
+		if err != nil {
+			return err
+		}
+		if err := req.check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRequirements verifies the binaries required by the steps about to run
+// before any of them is executed, and returns an error listing the steps whose
+// requirements are not met. `run all` checks them along with the rest of its
+// preflight check (see preflightCheck).
+func (w *WHAM) checkRequirements(steps []*Step) error {
+	var problems []string
+	for _, step := range steps {
+		if err := checkStepRequirements(step); err != nil {
+			problems = append(problems, fmt.Sprintf("step '%s': %v", step.Name, err))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("requirements not met: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// runAsIdentity is the identity the processes of a step run with, resolved from
+// its `run_as_user` and `run_as_group`.
+type runAsIdentity struct {
+	credential *syscall.Credential
+	// user is the account of `run_as_user`, or nil if it is not set or is a numeric
+	// ID unknown to the system.
+	user *user.User
+}
+
+// resolveRunAs resolves the step's `run_as_user` and `run_as_group`, each given as
+// a name or a numeric ID, into the credential of its processes. It returns nil if
+// neither is set.
+//
+// Without `run_as_group`, the processes run with the user's primary group. Running
+// as a user also sets the user's supplementary groups, dropping those of WHAM;
+// running only as a group keeps the user and supplementary groups of WHAM. A numeric
+// user ID unknown to the system (e.g., an arbitrary ID in a container) requires a
+// `run_as_group`, as it has no primary group.
+func resolveRunAs(step *Step) (*runAsIdentity, error) {
+	if step.RunAsUser == "" && step.RunAsGroup == "" {
+		return nil, nil
+	}
+	identity := &runAsIdentity{credential: &syscall.Credential{Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid()), NoSetGroups: true}}
+	if step.RunAsUser != "" {
+		uid, u, err := lookupRunAsUser(step.RunAsUser)
+		if err != nil {
+			return nil, fmt.Errorf("invalid run_as_user for step '%s': %w", step.Name, err)
+		}
+		identity.credential.Uid, identity.credential.NoSetGroups, identity.user = uid, false, u
+		if u != nil {
+			gid, _ := strconv.ParseUint(u.Gid, 10, 32)
+			identity.credential.Gid = uint32(gid)
+			groupIDs, err := u.GroupIds()
+			if err != nil {
+				return nil, fmt.Errorf("failed to list the groups of user '%s' for step '%s': %w", u.Username, step.Name, err)
+			}
+			for _, groupID := range groupIDs {
+				if gid, err := strconv.ParseUint(groupID, 10, 32); err == nil {
+					identity.credential.Groups = append(identity.credential.Groups, uint32(gid))
+				}
+			}
+		} else if step.RunAsGroup == "" {
+			return nil, fmt.Errorf("run_as_group is required for step '%s', as user ID %d is unknown to the system", step.Name, uid)
+		}
+	}
+	if step.RunAsGroup != "" {
+		gid, err := lookupRunAsGroup(step.RunAsGroup)
+		if err != nil {
+			return nil, fmt.Errorf("invalid run_as_group for step '%s': %w", step.Name, err)
+		}
+		identity.credential.Gid = gid
+	}
+	return identity, nil
+}
+
+// lookupRunAsUser resolves a user name or numeric ID. A numeric ID unknown to the
+// system is accepted, with a nil user.
+func lookupRunAsUser(name string) (uint32, *user.User, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		u, err = user.LookupId(name)
+	}
+	if err == nil {
+		uid, err := strconv.ParseUint(u.Uid, 10, 32)
+		if err != nil {
+			return 0, nil, fmt.Errorf("user '%s' has a non-numeric ID '%s'", name, u.Uid)
+		}
+		return uint32(uid), u, nil
+	}
+	if uid, parseErr := strconv.ParseUint(name, 10, 32); parseErr == nil {
+		return uint32(uid), nil, nil
+	}
+	return 0, nil, fmt.Errorf("unknown user '%s'", name)
+}
+
+// lookupRunAsGroup resolves a group name or numeric ID. A numeric ID unknown to
+// the system is accepted.
+func lookupRunAsGroup(name string) (uint32, error) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		g, err = user.LookupGroupId(name)
+	}
+	if err == nil {
+		gid, err := strconv.ParseUint(g.Gid, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("group '%s' has a non-numeric ID '%s'", name, g.Gid)
+		}
+		return uint32(gid), nil
+	}
+	if gid, parseErr := strconv.ParseUint(name, 10, 32); parseErr == nil {
+		return uint32(gid), nil
+	}
+	return 0, fmt.Errorf("unknown group '%s'", name)
+}
+
+// environ returns the variables describing the user the step runs as (HOME, USER
+// and LOGNAME), which would otherwise be those of WHAM's user.
+func (id *runAsIdentity) environ() []string {
+	if id.user == nil {
+		return nil
+	}
+	return []string{"HOME=" + id.user.HomeDir, "USER=" + id.user.Username, "LOGNAME=" + id.user.Username}
+}
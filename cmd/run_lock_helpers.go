@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// errRunLocked is returned when another process is running the workflow.
+var errRunLocked = errors.New("another WHAM process is running this workflow")
+
+// getRunLockFilePath returns the path of the lock file of the metadata directory.
+func (w *WHAM) getRunLockFilePath() string {
+	return filepath.Join(w.config.WhamSettings.MetadataDir, w.config.WhamSettings.MetadataPrefix+"run.lock")
+}
+
+// acquireRunLock acquires the exclusive lock of the metadata directory, held for
+// the whole execution of `run`, and returns the function releasing it. `holder`
+// describes the execution (e.g., "workflow run '<id>'").
+//
+// The run lock is an exclusive lock (flock(2)) on the file `<metadata_prefix>run.lock`
+// of the metadata directory, so that two invocations of the same workflow, e.g.
+// started by cron while the previous one is still running, cannot interleave
+// their state writes; it is released by the kernel if WHAM dies. A lock held
+// elsewhere is not waited for: an error wrapping errRunLocked, naming the holder
+// recorded in the lock file, is returned at once.
+func (w *WHAM) acquireRunLock(holder string) (func(), error) {
+	path := w.getRunLockFilePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create metadata directory '%s': %w", filepath.Dir(path), err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open run lock file '%s': %w", path, err)
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, fmt.Errorf("failed to lock '%s': %w", path, err)
+		}
+		if data, readErr := os.ReadFile(path); readErr == nil && strings.TrimSpace(string(data)) != "" {
+			return nil, fmt.Errorf("%w (%s)", errRunLocked, strings.TrimSpace(string(data)))
+		}
+		return nil, errRunLocked
+	}
+	if err := file.Truncate(0); err == nil {
+		file.WriteAt([]byte(fmt.Sprintf("PID %d, %s, since %s\n", os.Getpid(), holder, time.Now().Format(time.RFC3339))), 0)
+	}
+	w.logger.Debug().Str("path", path).Str("holder", holder).Msg("Run lock acquired.")
+	return func() {
+		file.Truncate(0)
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
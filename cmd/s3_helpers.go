@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// s3RequestTimeout bounds how long WHAM waits for the S3 service.
+const s3RequestTimeout = 30 * time.Second
+
+// s3ProbeObject is the object written and removed by the health check of an S3
+// state store, under its prefix.
+const s3ProbeObject = ".wham_probe"
+
+// s3StateStore keeps the WHAM states as objects of an S3-compatible bucket, so
+// that they outlive the machine running WHAM (e.g., an ephemeral CI container).
+// It uses the S3 client of the AWS SDK, with the credentials of its default chain
+// (see newS3StateStore).
+type s3StateStore struct {
+	bucket string
+	// prefix is prepended to the names of the state files to form their object keys.
+	prefix string
+	// fileName returns the name of the state file of a step, and stepName the
+	// step of a file name, if it is one.
+	fileName func(stepName string) string
+	stepName func(fileName string) (string, bool)
+	client   *s3.Client
+}
+
+// newS3StateStore returns the S3 state store configured by the settings.
+//
+// The requests are signed with the credentials found by the default chain of the
+// AWS SDK, as any AWS tool would: the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
+// environment variables, the shared credentials and config files (AWS_PROFILE),
+// a web identity token (AWS_WEB_IDENTITY_TOKEN_FILE and AWS_ROLE_ARN, e.g. IAM
+// roles for service accounts), the ECS container credentials, then the instance
+// profile, through IMDSv2. They are only retrieved by the first request.
+//
+// A custom endpoint (e.g., MinIO) is sent path-style requests, and only the
+// checksums S3 requires, which not every S3-compatible service supports.
+func newS3StateStore(settings *StateBackendSettings, fileName func(string) string, stepName func(string) (string, bool)) (*s3StateStore, error) {
+	if settings.Bucket == "" {
+		return nil, fmt.Errorf("state_backend bucket cannot be empty for type '%s'", StateBackendS3)
+	}
+	if settings.Endpoint != "" {
+		endpoint, err := url.Parse(settings.Endpoint)
+		if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+			return nil, fmt.Errorf("state_backend endpoint '%s' must be a URL such as 'https://minio.example.com:9000'", settings.Endpoint)
+		}
+	}
+	awsConfig, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the AWS configuration: %w", err)
+	}
+	client := s3.NewFromConfig(awsConfig, func(o *s3.Options) {
+		o.Region = cmp.Or(settings.Region, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), awsConfig.Region, "us-east-1")
+		if settings.Endpoint != "" {
+			o.BaseEndpoint = aws.String(strings.TrimSuffix(settings.Endpoint, "/"))
+			o.UsePathStyle = true
+			o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+			o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+		}
+	})
+	return &s3StateStore{
+		bucket:   settings.Bucket,
+		prefix:   settings.Prefix,
+		fileName: fileName,
+		stepName: stepName,
+		client:   client,
+	}, nil
+}
+
+func (s *s3StateStore) Load(stepName string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s3RequestTimeout)
+	defer cancel()
+	key := s.key(stepName)
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, s.wrapError("GET", key, err)
+	}
+	defer out.Body.Close()
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s.Location(stepName), err)
+	}
+	return data, nil
+}
+
+func (s *s3StateStore) Save(stepName string, data []byte) error {
+	return s.put(s.key(stepName), data)
+}
+
+// Delete checks that the object exists, as S3 reports the deletion of a missing
+// object as a success.
+func (s *s3StateStore) Delete(stepName string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s3RequestTimeout)
+	defer cancel()
+	key := s.key(stepName)
+	if _, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)}); err != nil {
+		return s.wrapError("HEAD", key, err)
+	}
+	return s.delete(key)
+}
+
+// List lists the objects directly under the prefix with ListObjectsV2, page by page.
+func (s *s3StateStore) List() ([]string, error) {
+	var names []string
+	pages := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.bucket),
+		Prefix:    aws.String(s.prefix),
+		Delimiter: aws.String("/"),
+	})
+	for pages.HasMorePages() {
+		ctx, cancel := context.WithTimeout(context.Background(), s3RequestTimeout)
+		page, err := pages.NextPage(ctx)
+		cancel()
+		if err != nil {
+			return nil, s.wrapError("LIST", s.prefix, err)
+		}
+		for _, object := range page.Contents {
+			if name, ok := s.stepName(strings.TrimPrefix(aws.ToString(object.Key), s.prefix)); ok {
+				names = append(names, name)
+			}
+		}
+	}
+	return names, nil
+}
+
+func (s *s3StateStore) Location(stepName string) string {
+	if stepName == "" {
+		return "s3://" + s.bucket + "/" + s.prefix
+	}
+	return "s3://" + s.bucket + "/" + s.key(stepName)
+}
+
+// key returns the object key of the state of a step.
+func (s *s3StateStore) key(stepName string) string {
+	return s.prefix + s.fileName(stepName)
+}
+
+// Check writes and removes a probe object under the prefix.
+func (s *s3StateStore) Check() error {
+	if err := s.put(s.prefix+s3ProbeObject, nil); err != nil {
+		return err
+	}
+	return s.delete(s.prefix + s3ProbeObject)
+}
+
+// put writes an object.
+func (s *s3StateStore) put(key string, data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s3RequestTimeout)
+	defer cancel()
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	return s.wrapError("PUT", key, err)
+}
+
+// delete removes an object.
+func (s *s3StateStore) delete(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s3RequestTimeout)
+	defer cancel()
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
+	return s.wrapError("DELETE", key, err)
+}
+
+// wrapError returns the error of a request on an object, or nil without error. A
+// missing object is reported as an error wrapping fs.ErrNotExist.
+func (s *s3StateStore) wrapError(method, key string, err error) error {
+	if err == nil {
+		return nil
+	}
+	location := "s3://" + s.bucket + "/" + key
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusNotFound {
+		return fmt.Errorf("%s %s: %w", method, location, fs.ErrNotExist)
+	}
+	return fmt.Errorf("%s %s failed: %w", method, location, err)
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ScratchDirSpec is the `scratch_dir` of a step: a private temporary directory
+// provisioned for each attempt of the step and removed after it, so that scripts
+// neither collide in /tmp nor leave their temporary files behind.
+type ScratchDirSpec struct {
+	// Size is the maximum size of the directory (e.g., "2G" or "512M"), in bytes
+	// or with a K, M, G or T suffix (powers of 1024). It is enforced when the
+	// directory is a tmpfs (see createScratchDir).
+	Size string `yaml:"size,omitempty" json:"size,omitempty"`
+}
+
+// byteSizePattern parses a size such as "2G", "512Mi" or "1024".
+var byteSizePattern = regexp.MustCompile(`^(\d+)\s*([KMGT]?)(?:I?B)?$`)
+
+// parseByteSize parses a size in bytes, with an optional K, M, G or T suffix.
+func parseByteSize(value string) (int64, error) {
+	match := byteSizePattern.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(value)))
+	if match == nil {
+		return 0, fmt.Errorf("invalid size '%s': expected a number of bytes, optionally followed by K, M, G or T (e.g., '2G')", value)
+	}
+	size, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size '%s': %w", value, err)
+	}
+	if match[2] != "" {
+		for range strings.Index("KMGT", match[2]) + 1 {
+			if size > math.MaxInt64/1024 {
+				return 0, fmt.Errorf("invalid size '%s': too large", value)
+			}
+			size *= 1024
+		}
+	}
+	if size <= 0 {
+		return 0, fmt.Errorf("invalid size '%s': the size must be positive", value)
+	}
+	return size, nil
+}
+
+// validate checks the scratch directory of a step.
+func (s *ScratchDirSpec) validate() error {
+	if s.Size == "" {
+		return nil
+	}
+	_, err := parseByteSize(s.Size)
+	return err
+}
+
+// scratchDir is the scratch directory of an attempt of a step.
+type scratchDir struct {
+	path string
+	// mounted is true if the directory is a tmpfs mounted by WHAM.
+	mounted bool
+}
+
+// createScratchDir provisions the scratch directory of an attempt of a step: a new
+// directory of the system's temporary directory, only accessible to the user the
+// step runs as. Where WHAM may mount file systems (on Linux, as root), it is a
+// tmpfs limited to the step's `size`, which the script cannot exceed; elsewhere it
+// is a plain directory, and the size is not enforced.
+//
+// The directory is given to the script in VAR_SCRATCH_DIR and TMPDIR, and is
+// removed with its content by remove once the attempt is over.
+func (w *WHAM) createScratchDir(step *Step, identity *runAsIdentity) (*scratchDir, error) {
+	var size int64
+	if step.ScratchDir.Size != "" {
+		var err error
+		if size, err = parseByteSize(step.ScratchDir.Size); err != nil {
+			return nil, err // Already validated at load time; kept for robustness.
+		}
+	}
+	path, err := os.MkdirTemp("", "wham_scratch_"+step.Name+"_*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scratch directory for step '%s': %w", step.Name, err)
+	}
+	dir := &scratchDir{path: path}
+	uid, gid := os.Getuid(), os.Getgid()
+	if identity != nil {
+		uid, gid = int(identity.credential.Uid), int(identity.credential.Gid)
+	}
+	if err := mountTmpfs(path, size, uid, gid); err == nil {
+		dir.mounted = true
+	} else if size > 0 {
+		w.logger.Warn().Str("step", step.Name).Str("size", step.ScratchDir.Size).Err(err).Msg("Could not mount a tmpfs for the scratch directory: its size is not enforced.")
+	} else {
+		w.logger.Debug().Str("step", step.Name).Err(err).Msg("Could not mount a tmpfs for the scratch directory, using a plain directory.")
+	}
+	if !dir.mounted && identity != nil {
+		// The script must be able to write to the directory as the user it runs as.
+		if err := os.Chown(path, uid, gid); err != nil {
+			dir.remove()
+			return nil, fmt.Errorf("failed to hand the scratch directory of step '%s' over to its user: %w", step.Name, err)
+		}
+	}
+	w.logger.Debug().Str("step", step.Name).Str("path", path).Bool("tmpfs", dir.mounted).Msg("Scratch directory created.")
+	return dir, nil
+}
+
+// remove unmounts the scratch directory, if it is a tmpfs, and removes it with
+// whatever the script left in it.
+func (d *scratchDir) remove() error {
+	if d.mounted {
+		if err := unmountTmpfs(d.path); err != nil {
+			return fmt.Errorf("failed to unmount scratch directory '%s': %w", d.path, err)
+		}
+	}
+	return os.RemoveAll(d.path)
+}
@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// mountTmpfs mounts a tmpfs owned by the given user on a directory, limited to
+// `size` bytes if positive. It fails unless WHAM may mount file systems.
+func mountTmpfs(path string, size int64, uid, gid int) error {
+	options := fmt.Sprintf("mode=0700,uid=%d,gid=%d", uid, gid)
+	if size > 0 {
+		options += fmt.Sprintf(",size=%d", size)
+	}
+	return unix.Mount("tmpfs", path, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, options)
+}
+
+// unmountTmpfs unmounts a tmpfs mounted by mountTmpfs, even if a process the
+// script left behind still uses it.
+func unmountTmpfs(path string) error {
+	return unix.Unmount(path, unix.MNT_DETACH)
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// mountTmpfs would mount a tmpfs on a directory. Mounting one is only implemented
+// on Linux: the scratch directories are plain directories elsewhere.
+func mountTmpfs(path string, size int64, uid, gid int) error {
+	return fmt.Errorf("mounting a tmpfs is not supported on %s", runtime.GOOS)
+}
+
+// unmountTmpfs is never called, as mountTmpfs always fails.
+func unmountTmpfs(path string) error {
+	return nil
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// StepSelector selects steps by their `owner` and `tags`, for the commands acting
+// on several steps at once. A step matches if it has the owner, if set, and all of
+// the tags. An empty selector matches every step.
+type StepSelector struct {
+	Owner string
+	Tags  []string
+}
+
+// IsEmpty reports whether the selector selects every step.
+func (s StepSelector) IsEmpty() bool {
+	return s.Owner == "" && len(s.Tags) == 0
+}
+
+// Matches reports whether a step is selected.
+func (s StepSelector) Matches(step *Step) bool {
+	if s.Owner != "" && step.Owner != s.Owner {
+		return false
+	}
+	for _, tag := range s.Tags {
+		if !slices.Contains(step.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// String describes the selector, e.g. "owner 'team-data' and tag 'etl'".
+func (s StepSelector) String() string {
+	var parts []string
+	if s.Owner != "" {
+		parts = append(parts, fmt.Sprintf("owner '%s'", s.Owner))
+	}
+	for _, tag := range s.Tags {
+		parts = append(parts, fmt.Sprintf("tag '%s'", tag))
+	}
+	return strings.Join(parts, " and ")
+}
+
+// checkTarget verifies that a non-empty selector is used with the 'all' target,
+// the steps it selects.
+func (s StepSelector) checkTarget(target string) error {
+	if !s.IsEmpty() && target != "all" {
+		return fmt.Errorf("--owner and --tag flags can only be used with the 'all' target")
+	}
+	return nil
+}
+
+// selectSteps returns the steps of the configuration matching the selector, in
+// configuration order. A non-empty selector matching no step is an error, so that
+// a mistyped owner or tag is not mistaken for steps with nothing to show.
+func (w *WHAM) selectSteps(selector StepSelector) ([]*Step, error) {
+	var steps []*Step
+	for i := range w.config.WhamSteps {
+		if selector.Matches(&w.config.WhamSteps[i]) {
+			steps = append(steps, &w.config.WhamSteps[i])
+		}
+	}
+	if len(steps) == 0 && !selector.IsEmpty() {
+		return nil, fmt.Errorf("no step matches %s", selector)
+	}
+	return steps, nil
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+)
+
+// Serve-related concrete command structs
+
+// ServeCmd handles the 'serve' command.
+type ServeCmd struct {
+	Schedule string        `help:"Cron expression of the schedule (e.g. '0 3 * * *'), overriding the schedule settings." placeholder:"CRON"`
+	Parallel int           `help:"Run up to N independent steps concurrently in each run." default:"1" placeholder:"N"`
+	Timeout  time.Duration `help:"Maximum duration of each run (e.g. 2h), overriding the workflow_timeout setting."`
+	MaxRuns  int           `help:"Exit after N runs, scheduled or triggered. Defaults to 0 (never exit)." placeholder:"N"`
+	Listen   string        `help:"Serve the HTTP API, to trigger runs and query the state, on this address (e.g. '127.0.0.1:8080')." placeholder:"ADDR"`
+	APIToken string        `help:"Bearer token required by the HTTP API. Required to listen on a non-loopback address." name:"api-token" env:"WHAM_API_TOKEN" placeholder:"TOKEN"`
+}
+
+// Serve-related command implementations
+
+func (s *ServeCmd) Run(ctx *Context) error {
+	if s.Parallel < 1 {
+		return fmt.Errorf("--parallel must be at least 1")
+	}
+	if s.Timeout < 0 {
+		return fmt.Errorf("--timeout cannot be negative")
+	}
+	if s.MaxRuns < 0 {
+		return fmt.Errorf("--max-runs cannot be negative")
+	}
+	schedule, err := ctx.WHAM.resolveSchedule(s.Schedule)
+	if err != nil {
+		return err
+	}
+	return ctx.WHAM.Serve(schedule, RunOptions{Parallel: s.Parallel, Timeout: s.Timeout}, s.MaxRuns, ctx.OutputFormat, s.Listen, s.APIToken)
+}
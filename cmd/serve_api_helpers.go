@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"matiq.ai/wham/client"
+)
+
+// ServeStatus is the status of the scheduler of `wham serve`, as reported by its
+// HTTP API.
+type ServeStatus struct {
+	// Running is true while a workflow run is in progress.
+	Running bool `json:"running" yaml:"running"`
+	// NextRunAt is when the next scheduled run is due. Zero while a run is in progress.
+	NextRunAt time.Time `json:"next_run_at" yaml:"next_run_at"`
+	// TriggerPending is true if a run was triggered through the API and has not
+	// started yet.
+	TriggerPending bool `json:"trigger_pending" yaml:"trigger_pending"`
+	// Runs is the number of runs executed since the scheduler started.
+	Runs int `json:"runs" yaml:"runs"`
+}
+
+// serveAPI is the HTTP API served by `wham serve --listen`, through which other
+// services trigger workflow runs and query the state of the steps (see the client
+// package and its OpenAPI specification).
+//
+// As it is served while the scheduler runs the workflow, it only reads: steps are
+// looked up with findStep and their states read from the state store, which are
+// safe to use concurrently with a run.
+type serveAPI struct {
+	mu     sync.Mutex
+	status ServeStatus
+	// trigger receives a value for every run triggered through the API. It holds at
+	// most one, as a pending trigger already runs the workflow as soon as possible.
+	trigger chan struct{}
+	// stepNames are the steps of the configuration when the API started, in
+	// configuration order, listed by GET /v1/states.
+	stepNames []string
+	server    *http.Server
+}
+
+// startServeAPI starts serving the API on a TCP address (e.g., "127.0.0.1:8080").
+// Unlike the inspection socket, failing to listen is an error, as the services
+// relying on the API could not reach the scheduler.
+//
+// With a `token`, every route but /openapi.yaml requires it as a bearer token
+// (see requireAPIToken). Without one, the API can trigger runs for anyone who can
+// reach it, so it is only served on a loopback address.
+func (w *WHAM) startServeAPI(addr, token string) (*serveAPI, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on '%s': %w", addr, err)
+	}
+	if tcpAddr, ok := listener.Addr().(*net.TCPAddr); token == "" && (!ok || !tcpAddr.IP.IsLoopback()) {
+		listener.Close()
+		return nil, fmt.Errorf("refusing to serve the API on the non-loopback address '%s' without a token: use --api-token or WHAM_API_TOKEN", addr)
+	}
+	api := &serveAPI{trigger: make(chan struct{}, 1)}
+	for _, step := range w.config.WhamSteps {
+		api.stepNames = append(api.stepNames, step.Name)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/status", func(rw http.ResponseWriter, r *http.Request) {
+		writeAPIResponse(rw, http.StatusOK, api.snapshot())
+	})
+	mux.HandleFunc("POST /v1/runs", func(rw http.ResponseWriter, r *http.Request) {
+		if !api.triggerRun() {
+			writeAPIError(rw, http.StatusConflict, "a triggered run is already pending")
+			return
+		}
+		w.logger.Info().Str("remote", r.RemoteAddr).Msg("Workflow run triggered through the API.")
+		writeAPIResponse(rw, http.StatusAccepted, api.snapshot())
+	})
+	mux.HandleFunc("GET /v1/runs/last", func(rw http.ResponseWriter, r *http.Request) {
+		run, err := w.loadLastFinishedWorkflowRun()
+		if err != nil {
+			writeAPIError(rw, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if run == nil {
+			writeAPIError(rw, http.StatusNotFound, "no workflow run has finished yet")
+			return
+		}
+		writeAPIResponse(rw, http.StatusOK, run)
+	})
+	mux.HandleFunc("GET /v1/states", func(rw http.ResponseWriter, r *http.Request) {
+		states := []namedStepState{} // Render an empty list rather than null.
+		for _, name := range api.stepNames {
+			states = append(states, namedStepState{StepName: name, StepState: w.getCurrentStepWhamState(name)})
+		}
+		writeAPIResponse(rw, http.StatusOK, states)
+	})
+	mux.HandleFunc("GET /v1/states/{step}", func(rw http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("step")
+		if w.findStep(name) == nil {
+			writeAPIError(rw, http.StatusNotFound, fmt.Sprintf("step '%s' not found", name))
+			return
+		}
+		state, err := w.loadStepWhamState(name)
+		if err != nil {
+			writeAPIError(rw, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeAPIResponse(rw, http.StatusOK, namedStepState{StepName: name, StepState: state})
+	})
+	mux.HandleFunc("GET /openapi.yaml", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/yaml")
+		rw.Write(client.OpenAPISpec)
+	})
+
+	api.server = &http.Server{Handler: requireAPIToken(mux, token), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := api.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			w.logger.Error().Err(err).Msg("API server stopped.")
+		}
+	}()
+	fmt.Printf("🌐 Serving the API on http://%s.\n", listener.Addr())
+	w.logger.Info().Str("addr", listener.Addr().String()).Msg("API server started.")
+	return api, nil
+}
+
+// requireAPIToken wraps the handler of the API so that its requests must carry
+// `token` in an "Authorization: Bearer" header, except for the specification at
+// /openapi.yaml, which is public. Without token, every request is handled.
+func requireAPIToken(next http.Handler, token string) http.Handler {
+	if token == "" {
+		return next
+	}
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openapi.yaml" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			rw.Header().Set("WWW-Authenticate", `Bearer realm="wham"`)
+			writeAPIError(rw, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// triggers returns the channel receiving the runs triggered through the API, or
+// nil, which never receives, without API.
+func (api *serveAPI) triggers() <-chan struct{} {
+	if api == nil {
+		return nil
+	}
+	return api.trigger
+}
+
+// triggerRun queues a run, and reports whether it was not already pending.
+func (api *serveAPI) triggerRun() bool {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	select {
+	case api.trigger <- struct{}{}:
+		api.status.TriggerPending = true
+		return true
+	default:
+		return false
+	}
+}
+
+// startRun records that a run starts. As the run serves any pending trigger, the
+// trigger is dropped: only the runs triggered from now on run the workflow again
+// after this one. It is a no-op without API.
+func (api *serveAPI) startRun() {
+	if api == nil {
+		return
+	}
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	select {
+	case <-api.trigger:
+	default:
+	}
+	api.status.Running, api.status.NextRunAt, api.status.TriggerPending = true, time.Time{}, false
+}
+
+// update applies a change to the status reported by the API. It is a no-op
+// without API.
+func (api *serveAPI) update(change func(*ServeStatus)) {
+	if api == nil {
+		return
+	}
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	change(&api.status)
+}
+
+// snapshot returns a copy of the status.
+func (api *serveAPI) snapshot() ServeStatus {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	return api.status
+}
+
+// close stops serving the API. It is a no-op without API.
+func (api *serveAPI) close() {
+	if api != nil {
+		api.server.Close()
+	}
+}
+
+// writeAPIResponse writes a JSON response of the API.
+func writeAPIResponse(rw http.ResponseWriter, status int, body any) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	json.NewEncoder(rw).Encode(body)
+}
+
+// writeAPIError writes an error response of the API, whose body is a JSON object
+// with the error message.
+func writeAPIError(rw http.ResponseWriter, status int, message string) {
+	writeAPIResponse(rw, status, map[string]string{"error": message})
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// location returns the time zone of the schedule settings.
+func (s *ScheduleSettings) location() (*time.Location, error) {
+	if s.TimeZone == "" {
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time_zone '%s': %w", s.TimeZone, err)
+	}
+	return location, nil
+}
+
+// parse parses a cron expression in the time zone of the schedule settings.
+func (s *ScheduleSettings) parse(expr string) (*cronSchedule, error) {
+	location, err := s.location()
+	if err != nil {
+		return nil, err
+	}
+	return parseCronSchedule(expr, location)
+}
+
+// resolveSchedule returns the schedule of `wham serve`: the given cron expression
+// if any, or else the one of the schedule settings. Either is evaluated in the
+// time zone of the settings.
+func (w *WHAM) resolveSchedule(expr string) (*cronSchedule, error) {
+	settings := w.config.WhamSettings.Schedule
+	if settings == nil {
+		settings = &ScheduleSettings{}
+	}
+	if expr == "" {
+		expr = settings.Cron
+	}
+	if expr == "" {
+		return nil, fmt.Errorf("no schedule defined: use --schedule or the 'schedule' settings")
+	}
+	return settings.parse(expr)
+}
+
+// Serve runs the workflow on a schedule as a long-lived process, executing a
+// `run all` with the given options at every time matched by the schedule, until
+// `maxRuns` runs have been executed (if positive) or WHAM receives SIGINT or SIGTERM.
+//
+// Runs never overlap: a run still in progress when the next one is due delays it,
+// and the scheduled times missed meanwhile are skipped with a warning. A failed run
+// is reported and does not stop the scheduler. After every run, its outcome is
+// logged, the execution summary is printed in `outputFormat` and the outputs past
+// their `cleanup_outputs_after` retention are deleted (see CleanOutputs).
+//
+// SIGINT and SIGTERM stop the scheduler, as described on startRunContext.
+//
+// When run as a systemd service of type "notify", the scheduler reports its
+// readiness and status to systemd, and pings its watchdog (see notifySystemd).
+//
+// With a `listen` address, the scheduler also serves an HTTP API (see serveAPI),
+// through which runs can be triggered between the scheduled ones, protected by
+// `apiToken` if set. A triggered run counts towards `maxRuns`.
+func (w *WHAM) Serve(schedule *cronSchedule, opts RunOptions, maxRuns int, outputFormat string, listen, apiToken string) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	var api *serveAPI
+	if listen != "" {
+		var err error
+		if api, err = w.startServeAPI(listen, apiToken); err != nil {
+			return err
+		}
+		defer api.close()
+	}
+
+	stopWatchdog := w.startSystemdWatchdog()
+	defer stopWatchdog()
+	defer w.notifySystemd("STOPPING=1")
+
+	w.logger.Info().Int("max_runs", maxRuns).Msg("Scheduler started.")
+	w.notifySystemd("READY=1")
+	for runs := 0; maxRuns == 0 || runs < maxRuns; runs++ {
+		due := schedule.next(time.Now())
+		fmt.Printf("⏰ Next workflow run scheduled at %s.\n", due.Format(time.RFC3339))
+		w.notifySystemd("STATUS=Next workflow run scheduled at " + due.Format(time.RFC3339))
+		api.update(func(s *ServeStatus) { s.NextRunAt = due })
+		timer := time.NewTimer(time.Until(due))
+		select {
+		case sig := <-signals:
+			timer.Stop()
+			fmt.Printf("🛑 Received %s, stopping the scheduler.\n", sig)
+			w.logger.Info().Str("signal", sig.String()).Msg("Scheduler stopped by signal.")
+			return nil
+		case <-timer.C:
+		case <-api.triggers():
+			timer.Stop()
+			due = time.Now()
+			fmt.Println("▶️ Workflow run triggered through the API.")
+		}
+
+		w.notifySystemd("STATUS=Running the workflow")
+		api.startRun()
+		err := w.RunAllSteps(opts)
+		api.update(func(s *ServeStatus) { s.Running = false; s.Runs++ })
+		w.logScheduledRun(err)
+		if summaryErr := w.ShowExecutionSummary(outputFormat); summaryErr != nil {
+			return summaryErr
+		}
+		if errors.Is(err, errInterrupted) {
+			return err
+		}
+		w.cleanScheduledOutputs()
+		if missed := schedule.next(due); missed.Before(time.Now()) {
+			fmt.Printf("⚠️ The workflow run outlasted its schedule: the runs due since %s are skipped.\n", missed.Format(time.RFC3339))
+			w.logger.Warn().Time("missed", missed).Msg("Scheduled runs skipped because the previous run was still in progress.")
+		}
+	}
+	w.logger.Info().Int("runs", maxRuns).Msg("Scheduler finished the requested number of runs.")
+	return nil
+}
+
+// logScheduledRun logs the outcome of the workflow run just executed by the
+// scheduler, with the number of steps per action.
+func (w *WHAM) logScheduledRun(runErr error) {
+	run, err := w.loadLastFinishedWorkflowRun()
+	if err != nil || run == nil {
+		w.logger.Warn().Err(err).Msg("Could not load the record of the scheduled workflow run.")
+		return
+	}
+	actions := make(map[string]int)
+	for _, state := range w.namedStepStates() {
+		actions[state.RunAction]++
+	}
+	event := w.logger.Info()
+	if runErr != nil {
+		event = w.logger.Error().Err(runErr)
+		fmt.Printf("❌ Scheduled workflow run '%s' failed: %v\n", run.ID, runErr)
+	} else {
+		fmt.Printf("✅ Scheduled workflow run '%s' finished.\n", run.ID)
+	}
+	event.Str("workflow_run_id", run.ID).Str("status", run.Status).Dur("elapsed", run.Elapsed).
+		Int("run", actions["run"]).Int("skipped", actions["skipped"]).Int("failed", actions["failed"]).
+		Msg("Scheduled workflow run finished.")
+}
+
+// notifySystemd sends a state notification to systemd, logging a failure.
+func (w *WHAM) notifySystemd(state string) {
+	if err := notifySystemd(state); err != nil {
+		w.logger.Warn().Err(err).Msg("Could not notify systemd.")
+	}
+}
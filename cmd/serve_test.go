@@ -0,0 +1,232 @@
+package cmd_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"matiq.ai/wham/client"
+	"matiq.ai/wham/cmd"
+)
+
+// TestServe_MaxRuns verifies that `serve` runs the workflow on its schedule and
+// exits after the requested number of runs, logging a summary of each one.
+func TestServe_MaxRuns(t *testing.T) {
+	const configPath = "../test/settings/settings_priority.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "serve", "--schedule", "@every 1s", "--max-runs", "2")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(outputStr, "Next workflow run scheduled at"), "Each run should be scheduled.")
+	assert.Equal(t, 2, strings.Count(outputStr, "Starting workflow run"), "The workflow should have run twice.")
+	assert.Equal(t, 2, strings.Count(outputStr, "Scheduled workflow run '"), "The outcome of each run should be reported.")
+	assert.Equal(t, 2, strings.Count(outputStr, "RUN DATE"), "The summary of each run should be printed.")
+}
+
+// TestServe_InvalidSchedule verifies that `serve` refuses an invalid or missing schedule.
+func TestServe_InvalidSchedule(t *testing.T) {
+	const configPath = "../test/settings/settings_priority.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	testCases := []struct {
+		name        string
+		args        []string
+		errContains string
+	}{
+		{"no schedule", nil, "no schedule defined"},
+		{"wrong field count", []string{"--schedule", "0 3 * *"}, "expected 5 fields, got 4"},
+		{"out of range", []string{"--schedule", "0 24 * * *"}, "invalid value '24' in hour field"},
+		{"never matches", []string{"--schedule", "0 0 30 feb *"}, "it never matches"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			args := append([]string{"--config", configPath, "serve"}, tc.args...)
+			outputStr, err := runWhamCommand(t, args...)
+			assert.Error(t, err)
+			assert.Contains(t, outputStr, tc.errContains)
+			assert.NotContains(t, outputStr, "Starting workflow run")
+		})
+	}
+}
+
+// TestServe_API verifies that `serve --listen` runs the workflow when triggered
+// through the API, whose state can be queried with the client package.
+func TestServe_API(t *testing.T) {
+	const configPath = "../test/settings/settings_priority.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+
+	// The schedule is never due during the test: the only run is the triggered one.
+	serve := exec.Command(whamBinaryPath, "--config", configPath, "serve", "--schedule", "0 0 1 1 *", "--max-runs", "1", "--listen", addr)
+	serve.Env = append(os.Environ(), "NO_COLOR=true")
+	assert.NoError(t, serve.Start())
+	t.Cleanup(func() { serve.Process.Kill() })
+
+	ctx := context.Background()
+	c := client.New("http://"+addr, nil)
+	assert.Eventually(t, func() bool {
+		_, err := c.Status(ctx)
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond, "The API should be served.")
+
+	_, err = c.LastRun(ctx)
+	assert.ErrorIs(t, err, client.ErrNotFound, "No run should have finished yet.")
+	_, err = c.State(ctx, "unknown")
+	assert.ErrorIs(t, err, client.ErrNotFound)
+
+	status, err := c.TriggerRun(ctx)
+	if assert.NoError(t, err) {
+		assert.True(t, status.TriggerPending)
+	}
+	assert.NoError(t, serve.Wait(), "The scheduler should exit after the triggered run.")
+
+	// Query the state of the run with another scheduler.
+	serve = exec.Command(whamBinaryPath, "--config", configPath, "serve", "--schedule", "0 0 1 1 *", "--listen", addr)
+	serve.Env = append(os.Environ(), "NO_COLOR=true")
+	assert.NoError(t, serve.Start())
+	t.Cleanup(func() { serve.Process.Kill() })
+	var states []client.StepState
+	assert.Eventually(t, func() bool {
+		states, err = c.States(ctx)
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond, "The API should be served.")
+	assert.NotEmpty(t, states)
+	for _, state := range states {
+		assert.Equal(t, "run", state.RunAction, state.StepName)
+	}
+	run, err := c.LastRun(ctx)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "succeeded", run.Status)
+	}
+}
+
+// TestServe_APIToken verifies that the API requires the token given by
+// WHAM_API_TOKEN on every route but its specification, and that it is not served
+// on a non-loopback address without a token.
+func TestServe_APIToken(t *testing.T) {
+	const configPath = "../test/settings/settings_priority.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "serve", "--schedule", "0 0 1 1 *", "--listen", "0.0.0.0:0")
+	assert.Error(t, err, "The API should not be served on all interfaces without a token.")
+	assert.Contains(t, outputStr, "refusing to serve the API on the non-loopback address '0.0.0.0:0' without a token")
+
+	addr := startServeAPI(t, configPath, "WHAM_API_TOKEN=s3cret")
+	c := client.New("http://"+addr, nil)
+	_, err = c.Status(context.Background())
+	var apiErr *client.APIError
+	if assert.True(t, errors.As(err, &apiErr), "A request without token should be refused.") {
+		assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	}
+	c.SetToken("wrong")
+	_, err = c.Status(context.Background())
+	assert.Error(t, err, "A request with another token should be refused.")
+	c.SetToken("s3cret")
+	_, err = c.Status(context.Background())
+	assert.NoError(t, err)
+
+	resp, err := http.Get("http://" + addr + "/openapi.yaml")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "The specification should be public.")
+	}
+}
+
+// TestServe_APIStateModel verifies that a state with every field set, as served by
+// the API, decodes into the client's StepState without unknown fields, so that the
+// client model keeps up with the fields added to the state.
+func TestServe_APIStateModel(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "wham.yaml")
+	config := "wham_settings:\n  data_dir: data\n  metadata_dir: metadata\n  metadata_prefix: wham_\n  metadata_suffix: .state\nwham_steps:\n" +
+		"- name: load\n  command: [\"/bin/true\"]\n  previous_steps: []\n"
+	assert.NoError(t, os.WriteFile(configPath, []byte(config), 0644))
+
+	date := time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC)
+	state := cmd.StepState{
+		RunID:         "abc",
+		RunDate:       date,
+		RunIDDate:     date,
+		RunAction:     "failed",
+		Reason:        "timeout",
+		FailureClass:  "transient",
+		Elapsed:       1500 * time.Millisecond,
+		Outputs:       map[string]string{"rows": "42"},
+		Warnings:      []string{"slow"},
+		Watermark:     "2026-03-01",
+		WorkflowRunID: "run-1",
+		DryRun:        true,
+		WhamVersion:   "v1.0.0",
+		InputsHash:    "0123abcd",
+		SchemaVersion: cmd.StateSchemaVersion,
+	}
+	fields := reflect.ValueOf(state)
+	for i := range fields.NumField() {
+		assert.False(t, fields.Field(i).IsZero(), "The test state should set %s.", fields.Type().Field(i).Name)
+	}
+	data, err := json.Marshal(state)
+	assert.NoError(t, err)
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "metadata"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "metadata", "wham_load.state"), data, 0644))
+
+	addr := startServeAPI(t, configPath)
+	resp, err := http.Get("http://" + addr + "/v1/states/load")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	var served client.StepState
+	decoder := json.NewDecoder(resp.Body)
+	decoder.DisallowUnknownFields()
+	assert.NoError(t, decoder.Decode(&served), "The client model should know every field of the state.")
+	assert.Equal(t, "load", served.StepName)
+	assert.Equal(t, state.InputsHash, served.InputsHash)
+	assert.Equal(t, state.Elapsed, served.Elapsed)
+	assert.Equal(t, state.Outputs, served.Outputs)
+}
+
+// startServeAPI starts `serve --listen` on a free loopback port, with the given
+// extra environment variables, and returns its address once the API is served.
+func startServeAPI(t *testing.T, configPath string, env ...string) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+
+	serve := exec.Command(whamBinaryPath, "--config", configPath, "serve", "--schedule", "0 0 1 1 *", "--listen", addr)
+	serve.Env = append(append(os.Environ(), "NO_COLOR=true"), env...)
+	assert.NoError(t, serve.Start())
+	t.Cleanup(func() {
+		serve.Process.Kill()
+		serve.Wait()
+	})
+	assert.Eventually(t, func() bool {
+		resp, err := http.Get("http://" + addr + "/openapi.yaml")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return true
+	}, 5*time.Second, 50*time.Millisecond, "The API should be served.")
+	return addr
+}
@@ -36,12 +36,32 @@ func (ew *errorWriter) Println(a ...any) {
 	_, ew.err = fmt.Fprintln(ew.w, a...)
 }
 
+// ANSI escape codes of the colors used to highlight table rows.
+const (
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorReset  = "\033[0m"
+)
+
+// colorsEnabled reports whether the output written to `f` can be colored: `f` must
+// be a terminal, and the NO_COLOR environment variable must not be set.
+func colorsEnabled(f *os.File) bool {
+	return os.Getenv("NO_COLOR") == "" && term.IsTerminal(int(f.Fd()))
+}
+
 // TableRenderer helps build and render clean, kubectl-style tables.
 type TableRenderer struct {
 	ew        *errorWriter
 	headers   []string
 	rows      [][]string
 	maxWidths []int
+	// sections maps the index of a row to the titles of the sections starting before it.
+	sections map[int][]string
+	// colors maps the index of a row to the ANSI color it is printed in.
+	colors map[int]string
+	// wrap, if true, wraps the cells of the last column across lines instead of truncating them.
+	wrap bool
 }
 
 // NewTableRenderer creates a new table renderer.
@@ -68,6 +88,36 @@ func (tr *TableRenderer) AddRow(cells ...string) {
 	}
 }
 
+// AddColoredRow adds a row of cells printed in the given ANSI color (e.g.,
+// colorRed), or in the default color if it is empty. The escape codes wrap the
+// whole line, so they do not affect the alignment of the columns.
+func (tr *TableRenderer) AddColoredRow(color string, cells ...string) {
+	if color != "" {
+		if tr.colors == nil {
+			tr.colors = make(map[int]string)
+		}
+		tr.colors[len(tr.rows)] = color
+	}
+	tr.AddRow(cells...)
+}
+
+// AddSection starts a new section of the table: its title is printed on a line of
+// its own, outside of the columns, before the rows added next.
+func (tr *TableRenderer) AddSection(title string) {
+	if tr.sections == nil {
+		tr.sections = make(map[int][]string)
+	}
+	tr.sections[len(tr.rows)] = append(tr.sections[len(tr.rows)], title)
+}
+
+// SetWrap sets whether the cells of the last column that do not fit in the
+// terminal are word-wrapped across continuation lines, aligned under the column,
+// rather than truncated with "...". With wrapping, a cell containing newlines is
+// also printed on as many lines.
+func (tr *TableRenderer) SetWrap(wrap bool) {
+	tr.wrap = wrap
+}
+
 // Render prints the complete, formatted table to the writer.
 func (tr *TableRenderer) Render() error {
 	if len(tr.headers) == 0 {
@@ -118,12 +168,19 @@ func (tr *TableRenderer) Render() error {
 	}
 	tr.ew.Printf(rowFmt+"\n", headerArgs...)
 
-	// Print each data row
-	for _, row := range tr.rows {
+	// Print each data row, preceded by the titles of the sections it starts.
+	for r, row := range tr.rows {
+		for _, title := range tr.sections[r] {
+			tr.ew.Printf("── %s\n", title)
+		}
+		var continuation []string
 		rowArgs := make([]any, 0, len(row)*2)
 		for i, cell := range row {
-			// For the last column, truncate if the cell content is wider than the allowed max width.
-			if i == numCols-1 && len(cell) > tr.maxWidths[i] {
+			if i == numCols-1 && tr.wrap {
+				lines := wrapCell(cell, tr.maxWidths[i])
+				cell, continuation = lines[0], lines[1:]
+			} else if i == numCols-1 && len(cell) > tr.maxWidths[i] {
+				// For the last column, truncate if the cell content is wider than the allowed max width.
 				if tr.maxWidths[i] > 3 {
 					cell = cell[:tr.maxWidths[i]-3] + "..."
 				} else {
@@ -132,12 +189,56 @@ func (tr *TableRenderer) Render() error {
 			}
 			rowArgs = append(rowArgs, tr.maxWidths[i], cell)
 		}
-		tr.ew.Printf(rowFmt+"\n", rowArgs...)
+		color := tr.colors[r]
+		tr.printLine(color, rowFmt, rowArgs)
+		// The continuation lines of a wrapped cell leave the other columns blank.
+		for _, line := range continuation {
+			for i := 0; i < numCols-1; i++ {
+				rowArgs[2*i+1] = ""
+			}
+			rowArgs[2*(numCols-1)+1] = line
+			tr.printLine(color, rowFmt, rowArgs)
+		}
 	}
 
 	return tr.ew.err
 }
 
+// printLine prints a line of the table in the given color, if any.
+func (tr *TableRenderer) printLine(color, rowFmt string, args []any) {
+	if color != "" {
+		tr.ew.Printf(color+rowFmt+colorReset+"\n", args...)
+	} else {
+		tr.ew.Printf(rowFmt+"\n", args...)
+	}
+}
+
+// wrapCell splits a cell into lines of at most `width` characters: it breaks it at
+// its newlines, then word-wraps each of them, splitting the words that are longer
+// than a line. It always returns at least one line.
+func wrapCell(cell string, width int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(cell, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			if line != "" && len(line)+1+len(word) <= width {
+				line += " " + word
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+			for len(word) > width {
+				lines = append(lines, word[:width])
+				word = word[width:]
+			}
+			line = word
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
 // RenderData marshals the given data structure into the specified format (json or yaml)
 // and writes it to the provided writer. It centralizes the logic for structured output.
 func RenderData(w io.Writer, data any, format string) error {
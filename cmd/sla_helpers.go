@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+)
+
+// parseClockTime parses a wall-clock time of day in the "HH:MM" format and returns
+// it as an offset from midnight.
+func parseClockTime(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day '%s', expected format HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// mustStartByDeadline returns the deadline of a step's `must_start_by` constraint.
+// The deadline falls on the local day the workflow run started, or on the current
+// day when the step is run on its own.
+func (w *WHAM) mustStartByDeadline(step *Step) (time.Time, error) {
+	offset, err := parseClockTime(step.MustStartBy)
+	if err != nil {
+		return time.Time{}, err
+	}
+	ref := time.Now()
+	if w.activeRun != nil {
+		ref = w.activeRun.StartedAt
+	}
+	midnight := time.Date(ref.Year(), ref.Month(), ref.Day(), 0, 0, 0, 0, ref.Location())
+	return midnight.Add(offset), nil
+}
+
+// checkMustStartBy verifies that a step is being started before its `must_start_by`
+// deadline. When the deadline has passed, a warning is printed and, if the step's
+// `must_start_by_policy` is "fail", an error is returned so that the step is not
+// executed. Otherwise, the warning is returned to be recorded in the step's state.
+func (w *WHAM) checkMustStartBy(step *Step) (warning string, err error) {
+	if step.MustStartBy == "" {
+		return "", nil
+	}
+	deadline, err := w.mustStartByDeadline(step)
+	if err != nil {
+		return "", err // Already validated at load time; kept for robustness.
+	}
+	late := time.Since(deadline)
+	if late <= 0 {
+		return "", nil
+	}
+	late = late.Round(time.Second)
+	fmt.Printf("⏰ Step '%s' is starting %s after its must_start_by time (%s): its SLA is at risk.\n", step.Name, late, step.MustStartBy)
+	w.logger.Warn().Str("step", step.Name).Str("must_start_by", step.MustStartBy).Dur("late", late).Msg("Step started after its must_start_by time.")
+	if step.MustStartByPolicy == "fail" {
+		return "", fmt.Errorf("step missed its must_start_by time (%s) by %s", step.MustStartBy, late)
+	}
+	return fmt.Sprintf("started %s after its must_start_by time (%s)", late, step.MustStartBy), nil
+}
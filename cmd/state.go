@@ -1,33 +1,193 @@
 package cmd
 
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
 // State-related concrete Command Structs (Verbs)
 
 type GetStateCmd struct {
-	Target string `arg:"" help:"Step name to get state for, or 'all'"`
+	Target     string   `arg:"" help:"Step name to get state for, or 'all'"`
+	NoTruncate bool     `help:"Wrap long cells across lines instead of truncating them."`
+	Owner      string   `help:"Only get the state of the steps with this owner. Requires 'all' target."`
+	Tag        []string `help:"Only get the state of the steps with this tag. Can be repeated: steps must have all the tags. Requires 'all' target." placeholder:"TAG"`
 }
 
 type DeleteStateCmd struct {
-	Target string `arg:"" help:"Step name to delete state for, or 'all'"`
+	Target     string   `arg:"" help:"Step name to delete state for, or 'all'"`
+	Yes        bool     `help:"Bypass confirmation prompt." short:"y"`
+	Cascade    bool     `help:"Also delete the state of all descendant steps."`
+	Backup     bool     `help:"Move the deleted states to a timestamped directory of delete_backup_dir, from which 'state import' restores them."`
+	NoTruncate bool     `help:"Wrap long messages across lines instead of truncating them."`
+	Owner      string   `help:"Only delete the state of the steps with this owner. Requires 'all' target."`
+	Tag        []string `help:"Only delete the state of the steps with this tag. Can be repeated: steps must have all the tags. Requires 'all' target." placeholder:"TAG"`
+}
+
+type StaleStateCmd struct{}
+
+type DiffStateCmd struct {
+	From       string `arg:"" optional:"" help:"ID of the workflow run to compare from. Defaults to the run preceding the last one." name:"from-workflow-run-id"`
+	To         string `arg:"" optional:"" help:"ID of the workflow run to compare to. Defaults to the current states." name:"to-workflow-run-id"`
+	NoTruncate bool   `help:"Wrap long cells across lines instead of truncating them."`
+}
+
+type ExportStateCmd struct {
+	Out        string `help:"Path of the archive to write." default:"wham_state.tar.gz"`
+	StateFiles bool   `help:"Also export the state files generated by the stateful steps."`
+}
+
+type ImportStateCmd struct {
+	Bundle string `arg:"" help:"Path of the archive written by 'state export', or of a backup directory written by 'state delete --backup'." type:"path"`
 	Yes    bool   `help:"Bypass confirmation prompt." short:"y"`
 }
 
+type PruneStateCmd struct {
+	Yes        bool `help:"Bypass confirmation prompt." short:"y"`
+	DryRun     bool `help:"List what would be pruned without removing anything."`
+	Force      bool `help:"Also prune the metadata of unknown steps when the workflow generates steps at runtime."`
+	NoTruncate bool `help:"Wrap long cells across lines instead of truncating them."`
+}
+
+type MigrateStateCmd struct {
+	DryRun     bool `help:"List what would be migrated without rewriting anything."`
+	NoTruncate bool `help:"Wrap long cells across lines instead of truncating them."`
+}
+
+type HistoryStateCmd struct {
+	Target     string `arg:"" help:"Step name to list the history of."`
+	NoTruncate bool   `help:"Wrap long cells across lines instead of truncating them."`
+}
+
 // State-related command groups (objects)
 
 // StateCmd holds subcommands for managing state.
 type StateCmd struct {
-	Get    GetStateCmd    `cmd:"" help:"Get the final state of a step or all steps."`
-	Delete DeleteStateCmd `cmd:"" help:"Delete the state file for a step or all steps." aliases:"rm"`
+	Get     GetStateCmd     `cmd:"" help:"Get the final state of a step or all steps."`
+	Delete  DeleteStateCmd  `cmd:"" help:"Delete the state file for a step or all steps." aliases:"rm"`
+	Stale   StaleStateCmd   `cmd:"" help:"List the steps whose predecessors changed since they last ran, and since when."`
+	History HistoryStateCmd `cmd:"" help:"List the previous executions of a step kept by the history_limit setting."`
+	Diff    DiffStateCmd    `cmd:"" help:"List the steps whose run_id, action or duration changed between two workflow runs, or since the previous one."`
+	Export  ExportStateCmd  `cmd:"" help:"Write the state of the workflow to an archive, to move it to another machine."`
+	Import  ImportStateCmd  `cmd:"" help:"Restore the state of the workflow from an archive written by 'state export'."`
+	Prune   PruneStateCmd   `cmd:"" help:"Remove the state of the steps no longer in the configuration, and the history beyond history_limit."`
+	Migrate MigrateStateCmd `cmd:"" help:"Rewrite the states written with an older schema to the current one."`
 }
 
 // State-related command implementations
 
 func (g *GetStateCmd) Run(ctx *Context) error {
+	ctx.WHAM.noTruncate = g.NoTruncate
+	selector := StepSelector{Owner: g.Owner, Tags: g.Tag}
+	if err := selector.checkTarget(g.Target); err != nil {
+		return err
+	}
 	if g.Target == "all" {
-		return ctx.WHAM.ShowExecutionSummary(ctx.OutputFormat)
+		return ctx.WHAM.ShowSelectedStepStates(selector, ctx.OutputFormat)
 	}
 	return ctx.WHAM.GetStepState(g.Target, ctx.OutputFormat)
 }
 
 func (d *DeleteStateCmd) Run(ctx *Context) error {
-	return ctx.WHAM.DeleteStepState(d.Target, ctx.OutputFormat, d.Yes)
+	// Without a prompt, an unconfirmed deletion gets the prompt's default answer: no.
+	if ctx.NonInteractive && !d.Yes {
+		return fmt.Errorf("deleting the state of '%s' requires --yes in non-interactive mode", d.Target)
+	}
+	ctx.WHAM.noTruncate = d.NoTruncate
+	return ctx.WHAM.DeleteStepState(d.Target, StepSelector{Owner: d.Owner, Tags: d.Tag}, ctx.OutputFormat, d.Yes, d.Cascade, d.Backup)
+}
+
+func (s *StaleStateCmd) Run(ctx *Context) error {
+	return ctx.WHAM.ShowStaleSteps(ctx.OutputFormat)
+}
+
+func (h *HistoryStateCmd) Run(ctx *Context) error {
+	ctx.WHAM.noTruncate = h.NoTruncate
+	return ctx.WHAM.ShowStepHistory(h.Target, ctx.OutputFormat)
+}
+
+func (d *DiffStateCmd) Run(ctx *Context) error {
+	ctx.WHAM.noTruncate = d.NoTruncate
+	return ctx.WHAM.ShowStateDiff(d.From, d.To, ctx.OutputFormat)
+}
+
+func (e *ExportStateCmd) Run(ctx *Context) error {
+	manifest, err := ctx.WHAM.ExportState(e.Out, e.StateFiles)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Printf("📦 State of %d step(s) and %d state file(s) exported to '%s'.\n", len(manifest.Steps), len(manifest.StateFiles), e.Out)
+	return err
+}
+
+func (i *ImportStateCmd) Run(ctx *Context) error {
+	// Without a prompt, an unconfirmed import gets the prompt's default answer: no.
+	if ctx.NonInteractive && !i.Yes {
+		return fmt.Errorf("importing '%s' requires --yes in non-interactive mode", i.Bundle)
+	}
+	if !i.Yes && term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Printf("Are you sure you want to replace the state of the workflow with '%s'? [y/N]: ", i.Bundle)
+		input, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.TrimSpace(strings.ToLower(input)) != "y" {
+			fmt.Println("Aborted.")
+			return nil
+		}
+	}
+	releaseRunLock, err := ctx.WHAM.acquireRunLock("state import")
+	if err != nil {
+		return err
+	}
+	defer releaseRunLock()
+	result, err := ctx.WHAM.ImportState(i.Bundle)
+	if err != nil {
+		return err
+	}
+	switch ctx.OutputFormat {
+	case "json", "yaml":
+		return RenderData(os.Stdout, result, ctx.OutputFormat)
+	}
+	_, err = fmt.Printf("📥 Imported the state of %d step(s), %d workflow run(s) and %d state file(s) from '%s'.\n", result.Steps, result.WorkflowRuns, result.StateFiles, i.Bundle)
+	return err
+}
+
+func (p *PruneStateCmd) Run(ctx *Context) error {
+	ctx.WHAM.noTruncate = p.NoTruncate
+	if p.DryRun {
+		return ctx.WHAM.ShowPruneState(true, p.Force, ctx.OutputFormat)
+	}
+	// Without a prompt, an unconfirmed pruning gets the prompt's default answer: no.
+	if ctx.NonInteractive && !p.Yes {
+		return fmt.Errorf("pruning the state requires --yes in non-interactive mode")
+	}
+	if !p.Yes && term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Print("Are you sure you want to remove the state of the steps no longer in the configuration, and the history beyond history_limit? [y/N]: ")
+		input, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.TrimSpace(strings.ToLower(input)) != "y" {
+			fmt.Println("Aborted.")
+			return nil
+		}
+	}
+	releaseRunLock, err := ctx.WHAM.acquireRunLock("state prune")
+	if err != nil {
+		return err
+	}
+	defer releaseRunLock()
+	return ctx.WHAM.ShowPruneState(false, p.Force, ctx.OutputFormat)
+}
+
+func (m *MigrateStateCmd) Run(ctx *Context) error {
+	ctx.WHAM.noTruncate = m.NoTruncate
+	if m.DryRun {
+		return ctx.WHAM.ShowMigrateState(true, ctx.OutputFormat)
+	}
+	releaseRunLock, err := ctx.WHAM.acquireRunLock("state migrate")
+	if err != nil {
+		return err
+	}
+	defer releaseRunLock()
+	return ctx.WHAM.ShowMigrateState(false, ctx.OutputFormat)
 }
@@ -0,0 +1,301 @@
+package cmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// stateBundleManifest describes a state bundle. It is the `manifest.json` entry of
+// the archive.
+type stateBundleManifest struct {
+	// WhamVersion is the version of the WHAM that exported the bundle.
+	WhamVersion string `json:"wham_version"`
+	// ExportedAt is when the bundle was exported.
+	ExportedAt time.Time `json:"exported_at"`
+	// Steps are the steps whose WHAM state is in the bundle.
+	Steps []string `json:"steps"`
+	// StateFiles are the state files of the stateful steps in the bundle, relative
+	// to the metadata directory. Empty unless exported with --state-files.
+	StateFiles []string `json:"state_files,omitempty"`
+}
+
+// ExportState writes the state of the workflow to a gzipped tar archive, to be
+// imported with ImportState, e.g. on the new host of a pipeline. It contains:
+//   - states/<step>.json: the WHAM state of every step, from the state store,
+//     whatever its backend;
+//   - history/<step>.json: the history of every step (see saveStepHistory);
+//   - runs/<id>.json: the records of all the workflow runs;
+//   - state_files/: with `withStateFiles`, the state files generated by the
+//     stateful steps, at their path relative to the metadata directory;
+//   - manifest.json: the description of the bundle (see stateBundleManifest).
+//
+// The WHAM states are stored by step name rather than by file name, so that they
+// can be imported into a workflow with other metadata settings or state backend.
+// Missing files (e.g., of steps that never ran) are skipped.
+func (w *WHAM) ExportState(outPath string, withStateFiles bool) (*stateBundleManifest, error) {
+	f, err := os.Create(outPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create state bundle '%s': %w", outPath, err)
+	}
+	defer f.Close()
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+
+	manifest := &stateBundleManifest{WhamVersion: Version, ExportedAt: time.Now(), Steps: []string{}}
+
+	for _, step := range w.config.WhamSteps {
+		data, err := w.stateStore.Load(step.Name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read '%s' for state bundle: %w", w.stateStore.Location(step.Name), err)
+		}
+		manifest.Steps = append(manifest.Steps, step.Name)
+		if err := addBundleEntry(tw, "states/"+step.Name+".json", data); err != nil {
+			return nil, err
+		}
+
+		data, err = os.ReadFile(w.getStepHistoryFilePath(step.Name))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read history of step '%s' for state bundle: %w", step.Name, err)
+		}
+		if err == nil {
+			if err := addBundleEntry(tw, "history/"+step.Name+".json", data); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	runsDir := w.getWorkflowRunsDir()
+	runEntries, err := os.ReadDir(runsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read workflow runs directory '%s': %w", runsDir, err)
+	}
+	for _, entry := range runEntries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(runsDir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read workflow run '%s' for state bundle: %w", entry.Name(), err)
+		}
+		if err := addBundleEntry(tw, "runs/"+entry.Name(), data); err != nil {
+			return nil, err
+		}
+	}
+
+	if withStateFiles {
+		for _, file := range w.stepStateFiles() {
+			data, err := os.ReadFile(filepath.Join(w.config.WhamSettings.MetadataDir, file))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read state file '%s' for state bundle: %w", file, err)
+			}
+			manifest.StateFiles = append(manifest.StateFiles, file)
+			if err := addBundleEntry(tw, "state_files/"+filepath.ToSlash(file), data); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal state bundle manifest: %w", err)
+	}
+	if err := addBundleEntry(tw, "manifest.json", data); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finalize state bundle '%s': %w", outPath, err)
+	}
+	if err := gw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finalize state bundle '%s': %w", outPath, err)
+	}
+	w.logger.Info().Str("path", outPath).Int("steps", len(manifest.Steps)).Int("state_files", len(manifest.StateFiles)).Msg("State bundle written.")
+	return manifest, nil
+}
+
+// stepStateFiles returns the state files of the stateful steps, relative to the
+// metadata directory, sorted and without duplicates (steps may share a state file).
+func (w *WHAM) stepStateFiles() []string {
+	seen := make(map[string]bool)
+	var files []string
+	for _, step := range w.config.WhamSteps {
+		candidates := []string{step.StateFile}
+		for _, sf := range step.StateFiles {
+			candidates = append(candidates, sf.File)
+		}
+		for _, file := range candidates {
+			if file != "" && !seen[file] {
+				seen[file] = true
+				files = append(files, file)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// StateImportResult counts what ImportState restored.
+type StateImportResult struct {
+	Steps        int `json:"steps" yaml:"steps"`
+	History      int `json:"history" yaml:"history"`
+	WorkflowRuns int `json:"workflow_runs" yaml:"workflow_runs"`
+	StateFiles   int `json:"state_files" yaml:"state_files"`
+	// SkippedSteps are the steps of the bundle that are not in the configuration.
+	SkippedSteps []string `json:"skipped_steps,omitempty" yaml:"skipped_steps,omitempty"`
+}
+
+// ImportState restores the state of the workflow from a bundle written by
+// ExportState, replacing the current state of the steps it contains. The WHAM
+// states are written to the state store, whatever its backend, and the other
+// files to the metadata directory. The steps of the bundle that are not in the
+// configuration are skipped.
+//
+// The whole bundle is read and checked before anything is written, so that a
+// corrupt bundle leaves the state untouched.
+func (w *WHAM) ImportState(bundlePath string) (*StateImportResult, error) {
+	entries, err := readStateBundle(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := entries["manifest.json"]; !ok {
+		return nil, fmt.Errorf("'%s' is not a WHAM state bundle: manifest.json is missing", bundlePath)
+	}
+
+	names := make([]string, 0, len(entries))
+	for name, data := range entries {
+		if strings.HasSuffix(name, ".json") && !strings.HasPrefix(name, "state_files/") && !json.Valid(data) {
+			return nil, fmt.Errorf("invalid JSON in '%s' of state bundle '%s'", name, bundlePath)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := &StateImportResult{}
+	metadataDir := w.config.WhamSettings.MetadataDir
+	for _, name := range names {
+		data := entries[name]
+		dir, rest, _ := strings.Cut(name, "/")
+		var target string
+		switch dir {
+		case "states":
+			stepName := strings.TrimSuffix(rest, ".json")
+			if w.findStep(stepName) == nil {
+				result.SkippedSteps = append(result.SkippedSteps, stepName)
+				w.logger.Warn().Str("step", stepName).Msg("Step of the state bundle not found in the configuration, skipping.")
+				continue
+			}
+			if err := w.stateStore.Save(stepName, data); err != nil {
+				return result, fmt.Errorf("failed to write WHAM state of step '%s': %w", stepName, err)
+			}
+			result.Steps++
+			continue
+		case "history":
+			stepName := strings.TrimSuffix(rest, ".json")
+			if w.findStep(stepName) == nil {
+				continue
+			}
+			target = w.getStepHistoryFilePath(stepName)
+			result.History++
+		case "runs":
+			target = filepath.Join(w.getWorkflowRunsDir(), rest)
+			result.WorkflowRuns++
+		case "state_files":
+			target = filepath.Join(metadataDir, filepath.FromSlash(rest))
+			result.StateFiles++
+		default:
+			continue // manifest.json, or entries of a newer WHAM.
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return result, fmt.Errorf("failed to create directory '%s': %w", filepath.Dir(target), err)
+		}
+		if err := writeFileAtomically(target, data); err != nil {
+			return result, err
+		}
+	}
+	w.logger.Info().Str("path", bundlePath).Int("steps", result.Steps).Int("workflow_runs", result.WorkflowRuns).Int("state_files", result.StateFiles).Msg("State bundle imported.")
+	return result, nil
+}
+
+// readStateBundle reads the regular files of a state bundle, by name. Entries whose
+// name could escape the metadata directory are rejected. A directory, such as a
+// backup of `state delete` (see newDeleteBackup), is read as an extracted bundle.
+func readStateBundle(bundlePath string) (map[string][]byte, error) {
+	if info, err := os.Stat(bundlePath); err == nil && info.IsDir() {
+		return readStateBundleDir(bundlePath)
+	}
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state bundle '%s': %w", bundlePath, err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state bundle '%s': %w", bundlePath, err)
+	}
+	defer gr.Close()
+	tr := tar.NewReader(gr)
+
+	entries := make(map[string][]byte)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read state bundle '%s': %w", bundlePath, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if name := path.Clean(header.Name); name != header.Name || !filepath.IsLocal(filepath.FromSlash(name)) {
+			return nil, fmt.Errorf("invalid entry '%s' in state bundle '%s'", header.Name, bundlePath)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read '%s' from state bundle '%s': %w", header.Name, bundlePath, err)
+		}
+		entries[header.Name] = data
+	}
+	return entries, nil
+}
+
+// readStateBundleDir reads the regular files of a directory laid out as a state
+// bundle, by slash-separated path relative to it.
+func readStateBundleDir(dir string) (map[string][]byte, error) {
+	entries := make(map[string][]byte)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		entries[filepath.ToSlash(rel)] = data
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state bundle '%s': %w", dir, err)
+	}
+	return entries, nil
+}
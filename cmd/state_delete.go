@@ -2,9 +2,15 @@ package cmd
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"golang.org/x/term"
 )
@@ -17,13 +23,70 @@ type DeletionResult struct {
 }
 
 // DeleteStepState orchestrates the deletion of one or all step states and renders the result.
-func (w *WHAM) DeleteStepState(target string, outputFormat string, bypassPrompt bool) error {
+//
+// Deleting the state of a single step leaves the state of its descendants pointing
+// at a run_id that no longer exists upstream. If any descendant holds state derived
+// from the step's current run (see descendantsDerivedFrom), a warning is printed to
+// stderr and logged, unless `cascade` is true, in which case the state of all
+// descendants is deleted as well.
+//
+// With the 'all' target, only the steps matching the selector are deleted, along
+// with their descendants if `cascade` is true.
+//
+// If `backup` is true, or `delete_backup_dir` is set, the states are moved to a new
+// backup directory rather than just deleted (see newDeleteBackup), so that the
+// deletion can be undone with ImportState.
+func (w *WHAM) DeleteStepState(target string, selector StepSelector, outputFormat string, bypassPrompt bool, cascade bool, backup bool) error {
+	if err := selector.checkTarget(target); err != nil {
+		return err
+	}
+	// Determine the full set of steps whose state will be deleted.
+	var stepNames []string
+	if target == "all" {
+		selected, err := w.selectSteps(selector)
+		if err != nil {
+			return err
+		}
+		for _, step := range selected {
+			stepNames = append(stepNames, step.Name)
+		}
+		if cascade && !selector.IsEmpty() {
+			for _, step := range selected {
+				for _, descendant := range w.getDescendants(step.Name) {
+					if !slices.Contains(stepNames, descendant) {
+						stepNames = append(stepNames, descendant)
+					}
+				}
+			}
+		}
+	} else {
+		// Ensure the step exists before trying to delete its state.
+		if w.findStep(target) == nil {
+			return fmt.Errorf("step '%s' not found", target)
+		}
+		stepNames = []string{target}
+
+		descendants := w.getDescendants(target)
+		if cascade {
+			stepNames = append(stepNames, descendants...)
+		} else if affected := w.descendantsDerivedFrom(target, descendants); len(affected) > 0 {
+			w.logger.Warn().Str("step", target).Strs("descendants", affected).Msg("Descendant steps still hold state derived from this step and will become inconsistent. Use --cascade to delete their state too.")
+			// On stderr, so that the structured output remains parseable.
+			fmt.Fprintf(os.Stderr, "⚠️ Descendant steps of '%s' still hold state derived from its run and will become inconsistent: %s. Use --cascade to delete their state too.\n", target, strings.Join(affected, ", "))
+		}
+	}
+
 	// Safety check: for any deletion, only proceed if the --yes flag is provided
 	// or if the user confirms interactively.
 	if !bypassPrompt {
 		// Check if we are in an interactive terminal.
 		if term.IsTerminal(int(os.Stdin.Fd())) {
 			prompt := fmt.Sprintf("Are you sure you want to delete the state for '%s'? [y/N]: ", target)
+			if len(stepNames) > 1 && target != "all" {
+				prompt = fmt.Sprintf("Are you sure you want to delete the state for '%s' and its descendants (%s)? [y/N]: ", target, strings.Join(stepNames[1:], ", "))
+			} else if !selector.IsEmpty() {
+				prompt = fmt.Sprintf("Are you sure you want to delete the state for the steps with %s (%s)? [y/N]: ", selector, strings.Join(stepNames, ", "))
+			}
 			fmt.Print(prompt)
 			reader := bufio.NewReader(os.Stdin)
 			input, _ := reader.ReadString('\n')
@@ -34,17 +97,23 @@ func (w *WHAM) DeleteStepState(target string, outputFormat string, bypassPrompt
 		}
 	}
 
-	var results []DeletionResult
-	if target == "all" {
-		for _, step := range w.config.WhamSteps {
-			results = append(results, w.deleteSingleState(step.Name))
+	var backupDir string
+	if backup || w.config.WhamSettings.DeleteBackupDir != "" {
+		dir, err := w.newDeleteBackup()
+		if err != nil {
+			return err
 		}
-	} else {
-		// Ensure the step exists before trying to delete its state.
-		if w.findStep(target) == nil {
-			return fmt.Errorf("step '%s' not found", target)
+		backupDir = dir
+	}
+
+	var results []DeletionResult
+	for _, stepName := range stepNames {
+		results = append(results, w.deleteSingleState(stepName, backupDir))
+	}
+	if backupDir != "" {
+		if err := w.finishDeleteBackup(backupDir, results); err != nil {
+			return err
 		}
-		results = []DeletionResult{w.deleteSingleState(target)}
 	}
 
 	switch outputFormat {
@@ -53,7 +122,7 @@ func (w *WHAM) DeleteStepState(target string, outputFormat string, bypassPrompt
 			return RenderData(os.Stdout, results[0], outputFormat)
 		}
 		return RenderData(os.Stdout, results, outputFormat)
-	case "table":
+	case "table", "wide":
 		return w.renderDeletionResultsAsTable(results)
 	default:
 		// This case is for future-proofing; kong should prevent invalid values.
@@ -61,13 +130,29 @@ func (w *WHAM) DeleteStepState(target string, outputFormat string, bypassPrompt
 	}
 }
 
-// deleteSingleState performs the actual file deletion for a step's state.
-func (w *WHAM) deleteSingleState(stepName string) DeletionResult {
-	stateFilePath := w.getWhamStateFilePath(stepName)
-	err := os.Remove(stateFilePath)
+// deleteSingleState performs the actual deletion of a step's state file from the state store.
+// With a `backupDir`, the state is first copied to it, as `states/<step>.json`.
+func (w *WHAM) deleteSingleState(stepName string, backupDir string) DeletionResult {
+	var backupPath string
+	if backupDir != "" {
+		data, err := w.stateStore.Load(stepName)
+		if err == nil {
+			backupPath = filepath.Join(backupDir, "states", stepName+".json")
+			if err = os.MkdirAll(filepath.Dir(backupPath), 0755); err == nil {
+				err = writeFileAtomically(backupPath, data)
+			}
+		}
+		// A missing state is reported by its deletion below.
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			w.logger.Error().Str("step", stepName).Err(err).Msg("failed to back up state file, not deleting it")
+			return DeletionResult{StepName: stepName, Status: "error", Message: fmt.Sprintf("failed to back up state file: %v", err)}
+		}
+	}
+
+	err := w.stateStore.Delete(stepName)
 
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, fs.ErrNotExist) {
 			w.logger.Info().Str("step", stepName).Msg("state file did not exist, already clean")
 			return DeletionResult{StepName: stepName, Status: "already_clean", Message: "state file did not exist"}
 		}
@@ -76,13 +161,90 @@ func (w *WHAM) deleteSingleState(stepName string) DeletionResult {
 		return DeletionResult{StepName: stepName, Status: "error", Message: err.Error()}
 	}
 
+	if backupPath != "" {
+		w.logger.Info().Str("step", stepName).Str("backup", backupPath).Msg("state file moved to backup")
+		return DeletionResult{StepName: stepName, Status: "deleted", Message: fmt.Sprintf("state file moved to '%s'", backupPath)}
+	}
 	w.logger.Info().Str("step", stepName).Msg("state file deleted successfully")
 	return DeletionResult{StepName: stepName, Status: "deleted", Message: "state file deleted successfully"}
 }
 
+// deleteBackupDir returns the directory of the backups of `state delete`: the
+// `delete_backup_dir` of the settings, relative to the config file's directory, or
+// else the `<metadata_prefix>backups` directory of the metadata directory.
+func (w *WHAM) deleteBackupDir() string {
+	if w.config.WhamSettings.DeleteBackupDir != "" {
+		return w.resolvePath(w.config.WhamSettings.DeleteBackupDir)
+	}
+	return filepath.Join(w.config.WhamSettings.MetadataDir, w.config.WhamSettings.MetadataPrefix+"backups")
+}
+
+// newDeleteBackup creates the directory receiving the states deleted by one
+// `state delete`, named after the current time in the directory of the backups.
+// Once filled by deleteSingleState and finishDeleteBackup, it has the layout of a
+// state bundle (see ExportState), so that ImportState restores it.
+func (w *WHAM) newDeleteBackup() (string, error) {
+	parent := w.deleteBackupDir()
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory '%s': %w", parent, err)
+	}
+	dir := filepath.Join(parent, time.Now().UTC().Format("20060102T150405.000Z"))
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory '%s': %w", dir, err)
+	}
+	return dir, nil
+}
+
+// finishDeleteBackup writes the manifest of a backup directory, listing the steps
+// whose state was moved to it, or removes the directory if there are none.
+func (w *WHAM) finishDeleteBackup(dir string, results []DeletionResult) error {
+	manifest := &stateBundleManifest{WhamVersion: Version, ExportedAt: time.Now(), Steps: []string{}}
+	for _, res := range results {
+		if res.Status == "deleted" {
+			manifest.Steps = append(manifest.Steps, res.StepName)
+		}
+	}
+	if len(manifest.Steps) == 0 {
+		return os.RemoveAll(dir)
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal backup manifest: %w", err)
+	}
+	if err := writeFileAtomically(filepath.Join(dir, "manifest.json"), data); err != nil {
+		return err
+	}
+	w.logger.Info().Str("dir", dir).Int("steps", len(manifest.Steps)).Msg("Deleted states backed up.")
+	return nil
+}
+
+// descendantsDerivedFrom filters the given descendants of a step, keeping those
+// whose state derives from the step's current run: their run_id is the step's, or
+// was reached since the step's (see StepState.RunIDDate). A descendant whose state
+// predates the step's run_id is already behind it, and deleting the step's state
+// does not make it any more inconsistent.
+func (w *WHAM) descendantsDerivedFrom(stepName string, descendants []string) []string {
+	state := w.getCurrentStepWhamState(stepName)
+	if state.RunAction == "" {
+		return nil
+	}
+	var derived []string
+	for _, descendant := range descendants {
+		descendantState := w.getCurrentStepWhamState(descendant)
+		if descendantState.RunAction == "" {
+			continue
+		}
+		if descendantState.RunID == state.RunID || !descendantState.RunIDDate.Before(state.RunIDDate) {
+			derived = append(derived, descendant)
+		}
+	}
+	return derived
+}
+
 // renderDeletionResultsAsTable displays deletion results in a table.
 func (w *WHAM) renderDeletionResultsAsTable(results []DeletionResult) error {
 	tr := NewTableRenderer(os.Stdout, "NAME", "STATUS", "MESSAGE")
+	tr.SetWrap(w.noTruncate)
 	for _, res := range results {
 		tr.AddRow(res.StepName, res.Status, res.Message)
 	}
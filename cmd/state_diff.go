@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Changes of a step reported by `state diff`.
+const (
+	// StateChangeRunID is reported when the step's run_id changed.
+	StateChangeRunID = "run_id"
+	// StateChangeAction is reported when the step's action changed, e.g. from "run"
+	// to "skipped".
+	StateChangeAction = "action"
+	// StateChangeElapsed is reported when the step ran both times and took
+	// noticeably longer the second time (see elapsedRegressed).
+	StateChangeElapsed = "elapsed"
+)
+
+// A step's duration has regressed if it grew by both elapsedRegressionRatio and
+// elapsedRegressionMin, so that the jitter of short steps is not reported.
+const (
+	elapsedRegressionRatio = 1.5
+	elapsedRegressionMin   = time.Second
+)
+
+// StepStateDiff is a step whose state changed between two points in time, as
+// listed by `state diff`.
+type StepStateDiff struct {
+	StepName string `json:"step_name" yaml:"step_name"`
+	// Changes are the changes of the step (see the StateChange* constants).
+	Changes []string `json:"changes" yaml:"changes"`
+	// Before and After are the states of the step at both points. A state is empty
+	// if the step had none, or it is no longer in the step's history.
+	Before StepState `json:"before" yaml:"before"`
+	After  StepState `json:"after" yaml:"after"`
+}
+
+// StateDiff is the result of `state diff`.
+type StateDiff struct {
+	// From and To are the IDs of the workflow runs compared. To is empty when the
+	// current states are compared.
+	From  string          `json:"from" yaml:"from"`
+	To    string          `json:"to,omitempty" yaml:"to,omitempty"`
+	Steps []StepStateDiff `json:"steps" yaml:"steps"`
+}
+
+// ShowStateDiff lists the steps whose state changed between two workflow runs:
+// those whose run_id changed, whose action flipped (e.g., from "run" to "skipped"),
+// or whose duration regressed. The state of a step at a workflow run is its last
+// state recorded before the run finished, read from the step's history (see
+// saveStepHistory), so `history_limit` must be set.
+//
+// Without `toRunID`, the current states are compared with the states at
+// `fromRunID`; without either, with the states at the workflow run preceding the
+// last one, i.e. the changes made by the last run.
+func (w *WHAM) ShowStateDiff(fromRunID, toRunID string, outputFormat string) error {
+	if w.config.WhamSettings.HistoryLimit <= 0 {
+		return fmt.Errorf("state diff reads the history of the steps: set history_limit to keep it")
+	}
+	var from, to *WorkflowRun
+	var err error
+	if fromRunID == "" {
+		runs, err := w.loadRecentFinishedWorkflowRuns(2)
+		if err != nil {
+			return err
+		}
+		if len(runs) < 2 {
+			return fmt.Errorf("no previous workflow run to compare the current states with")
+		}
+		from = runs[1]
+	} else if from, err = w.loadWorkflowRun(fromRunID); err != nil {
+		return err
+	}
+	if toRunID != "" {
+		if to, err = w.loadWorkflowRun(toRunID); err != nil {
+			return err
+		}
+	}
+
+	diff, err := w.collectStateDiff(from, to)
+	if err != nil {
+		return err
+	}
+	switch outputFormat {
+	case "json", "yaml":
+		return RenderData(os.Stdout, diff, outputFormat)
+	case "table", "wide":
+		return w.renderStateDiffAsTable(diff)
+	default:
+		return fmt.Errorf("unsupported output format: '%s'", outputFormat)
+	}
+}
+
+// collectStateDiff compares the states of the steps at two workflow runs, or at a
+// workflow run and now if `to` is nil, in configuration order.
+func (w *WHAM) collectStateDiff(from, to *WorkflowRun) (StateDiff, error) {
+	diff := StateDiff{From: from.ID, Steps: []StepStateDiff{}} // Render an empty list rather than null.
+	if to != nil {
+		diff.To = to.ID
+	}
+	for _, step := range w.config.WhamSteps {
+		history, err := w.loadStepHistory(step.Name)
+		if err != nil {
+			return StateDiff{}, err
+		}
+		before := stateAt(history, from.FinishedAt)
+		var after StepState
+		if to != nil {
+			after = stateAt(history, to.FinishedAt)
+		} else {
+			after = w.getCurrentStepWhamState(step.Name)
+		}
+		if changes := stateChanges(before, after); len(changes) > 0 {
+			diff.Steps = append(diff.Steps, StepStateDiff{StepName: step.Name, Changes: changes, Before: before, After: after})
+		}
+	}
+	return diff, nil
+}
+
+// stateAt returns the last state of a history recorded at or before a time, or an
+// empty state if there is none.
+func stateAt(history []StepState, at time.Time) StepState {
+	for i := len(history) - 1; i >= 0; i-- {
+		if !history[i].RunDate.After(at) {
+			return history[i]
+		}
+	}
+	return StepState{}
+}
+
+// stateChanges returns the changes between two states of a step.
+func stateChanges(before, after StepState) []string {
+	var changes []string
+	if before.RunID != after.RunID {
+		changes = append(changes, StateChangeRunID)
+	}
+	if before.RunAction != after.RunAction {
+		changes = append(changes, StateChangeAction)
+	}
+	if elapsedRegressed(before, after) {
+		changes = append(changes, StateChangeElapsed)
+	}
+	return changes
+}
+
+// elapsedRegressed reports whether a step that ran both times took noticeably
+// longer the second time.
+func elapsedRegressed(before, after StepState) bool {
+	if before.RunAction != "run" || after.RunAction != "run" {
+		return false
+	}
+	return float64(after.Elapsed) > float64(before.Elapsed)*elapsedRegressionRatio && after.Elapsed-before.Elapsed >= elapsedRegressionMin
+}
+
+// renderStateDiffAsTable displays the steps whose state changed, or a message if
+// there is none.
+func (w *WHAM) renderStateDiffAsTable(diff StateDiff) error {
+	to := "the current states"
+	if diff.To != "" {
+		to = fmt.Sprintf("workflow run '%s'", diff.To)
+	}
+	if len(diff.Steps) == 0 {
+		_, err := fmt.Printf("✅ No step changed between workflow run '%s' and %s.\n", diff.From, to)
+		return err
+	}
+	if _, err := fmt.Printf("🔀 %d step(s) changed between workflow run '%s' and %s.\n", len(diff.Steps), diff.From, to); err != nil {
+		return err
+	}
+
+	tr := NewTableRenderer(os.Stdout, "NAME", "CHANGES", "ACTION", "RUN ID", "ELAPSED")
+	tr.SetWrap(w.noTruncate)
+	for _, s := range diff.Steps {
+		tr.AddRow(
+			s.StepName,
+			strings.Join(s.Changes, ", "),
+			diffCell(orDash(s.Before.RunAction), orDash(s.After.RunAction)),
+			diffCell(orDash(s.Before.RunID), orDash(s.After.RunID)),
+			diffCell(diffElapsed(s.Before), diffElapsed(s.After)),
+		)
+	}
+	return tr.Render()
+}
+
+// diffCell shows a value before and after, or once if it did not change.
+func diffCell(before, after string) string {
+	if before == after {
+		return after
+	}
+	return before + " → " + after
+}
+
+// diffElapsed shows the duration of a state, or a dash for an empty state.
+func diffElapsed(state StepState) string {
+	if state.RunAction == "" {
+		return "-"
+	}
+	return state.Elapsed.Round(time.Millisecond).String()
+}
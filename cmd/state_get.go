@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -19,9 +21,9 @@ func (w *WHAM) GetStepState(stepName string, outputFormat string) error {
 	switch outputFormat {
 	case "json", "yaml":
 		return RenderData(os.Stdout, state, outputFormat)
-	case "table":
+	case "table", "wide":
 		// Reuse the 'all states' table renderer for consistency.
-		return w.renderStatesAsTable([]Step{*step})
+		return w.renderStatesAsTable([]Step{*step}, outputFormat == "wide", false)
 	default:
 		return fmt.Errorf("unsupported output format: '%s'", outputFormat)
 	}
@@ -31,27 +33,35 @@ func (w *WHAM) GetStepState(stepName string, outputFormat string) error {
 //
 // It reads the last known state for each step from its corresponding WHAM state file
 // and prints a formatted table with the step name, the last action performed
-// ("run", "skipped", "failed"), the recorded run_id, and the timestamp of the run.
-// Steps are sorted by DAG depth for readability.
+// ("run", "skipped", "failed"), the recorded run_id, the timestamp of the run and
+// the number of warnings it recorded.
+// Steps are sorted by DAG depth for readability, and grouped by depth if the
+// `summary_group_by` setting is "depth". The "wide" format adds one column for each
+// output reported by the steps.
 func (w *WHAM) ShowExecutionSummary(outputFormat string) error {
-	// Collect all states first, regardless of output format.
+	return w.ShowSelectedStepStates(StepSelector{}, outputFormat)
+}
+
+// ShowSelectedStepStates displays the execution summary of the steps matching the
+// selector (see ShowExecutionSummary).
+func (w *WHAM) ShowSelectedStepStates(selector StepSelector, outputFormat string) error {
+	selected, err := w.selectSteps(selector)
+	if err != nil {
+		return err
+	}
 	switch outputFormat {
 	case "json", "yaml":
-		// For structured output, we collect states into a more descriptive struct.
-		type namedState struct {
-			StepName string `json:"step_name" yaml:"step_name"`
-			StepState
+		var states []namedStepState
+		for _, step := range selected {
+			states = append(states, namedStepState{StepName: step.Name, StepState: w.getCurrentStepWhamState(step.Name)})
 		}
-		var allNamedStates []namedState
-		for _, step := range w.config.WhamSteps {
-			state := w.getCurrentStepWhamState(step.Name)
-			allNamedStates = append(allNamedStates, namedState{StepName: step.Name, StepState: state})
-		}
-		return RenderData(os.Stdout, allNamedStates, outputFormat)
-	case "table":
+		return RenderData(os.Stdout, states, outputFormat)
+	case "table", "wide":
 		// For table output, we sort the steps first and then render them.
-		stepsToSort := make([]Step, len(w.config.WhamSteps))
-		copy(stepsToSort, w.config.WhamSteps)
+		stepsToSort := make([]Step, len(selected))
+		for i, step := range selected {
+			stepsToSort[i] = *step
+		}
 
 		// Sort by depth for a consistent, logical order.
 		sort.Slice(stepsToSort, func(i, j int) bool {
@@ -62,17 +72,60 @@ func (w *WHAM) ShowExecutionSummary(outputFormat string) error {
 			}
 			return stepsToSort[i].Name < stepsToSort[j].Name
 		})
-		return w.renderStatesAsTable(stepsToSort)
+		return w.renderStatesAsTable(stepsToSort, outputFormat == "wide", w.config.WhamSettings.SummaryGroupBy == "depth")
 	default:
 		return fmt.Errorf("unsupported output format: '%s'", outputFormat)
 	}
 }
 
-func (w *WHAM) renderStatesAsTable(steps []Step) error {
-	tr := NewTableRenderer(os.Stdout, "NAME", "ACTION", "RUN ID", "RUN DATE", "ELAPSED")
+// namedStepState is the state of a step together with its name, as rendered in
+// the structured formats of the execution summary.
+type namedStepState struct {
+	StepName string `json:"step_name" yaml:"step_name"`
+	StepState
+}
+
+// namedStepStates returns the current state of every step, in configuration order.
+func (w *WHAM) namedStepStates() []namedStepState {
+	var states []namedStepState
+	for _, step := range w.config.WhamSteps {
+		states = append(states, namedStepState{StepName: step.Name, StepState: w.getCurrentStepWhamState(step.Name)})
+	}
+	return states
+}
+
+// renderStatesAsTable displays the state of the given steps in a table.
+// If `wide` is true, each output key reported by any of the steps gets its own column.
+// If `groupByDepth` is true, the steps, which must be sorted by depth, are grouped
+// under a header per depth with the number of steps and their total elapsed time.
+func (w *WHAM) renderStatesAsTable(steps []Step, wide, groupByDepth bool) error {
+	states := make([]StepState, len(steps))
+	stepCounts := make(map[int]int)
+	subtotals := make(map[int]time.Duration)
+	for i, step := range steps {
+		states[i] = w.getCurrentStepWhamState(step.Name)
+		depth := w.stepDepths[step.Name]
+		stepCounts[depth]++
+		subtotals[depth] += states[i].Elapsed
+	}
+
+	headers := []string{"NAME", "ACTION", "RUN ID", "RUN DATE", "ELAPSED", "WARNINGS"}
+	var outputKeys []string
+	if wide {
+		outputKeys = collectOutputKeys(states)
+		for _, key := range outputKeys {
+			headers = append(headers, strings.ToUpper(key))
+		}
+	}
+	tr := NewTableRenderer(os.Stdout, headers...)
+	tr.SetWrap(w.noTruncate)
 
-	for _, step := range steps {
-		state := w.getCurrentStepWhamState(step.Name)
+	for i, step := range steps {
+		depth := w.stepDepths[step.Name]
+		if groupByDepth && (i == 0 || w.stepDepths[steps[i-1].Name] != depth) {
+			tr.AddSection(fmt.Sprintf("Depth %d: %d step(s), %s", depth, stepCounts[depth], subtotals[depth].Round(time.Millisecond)))
+		}
+		state := states[i]
 		runDate := "N/A"
 		if !state.RunDate.IsZero() {
 			runDate = state.RunDate.Format("2006-01-02 15:04:05")
@@ -81,8 +134,40 @@ func (w *WHAM) renderStatesAsTable(steps []Step) error {
 		if state.RunAction != "" { // Only show elapsed time if there's a state
 			elapsedStr = state.Elapsed.Round(time.Millisecond).String()
 		}
-		tr.AddRow(step.Name, state.RunAction, state.RunID, runDate, elapsedStr)
+		action := state.RunAction
+		if state.Reason != "" {
+			action += " (" + state.Reason + ")"
+		}
+		warnings := "-"
+		if len(state.Warnings) > 0 {
+			warnings = strconv.Itoa(len(state.Warnings))
+		}
+		row := []string{step.Name, action, state.RunID, runDate, elapsedStr, warnings}
+		for _, key := range outputKeys {
+			value, ok := state.Outputs[key]
+			if !ok {
+				value = "-"
+			}
+			row = append(row, value)
+		}
+		tr.AddRow(row...)
 	}
 
 	return tr.Render()
 }
+
+// collectOutputKeys returns the sorted union of the output keys found in the given states.
+func collectOutputKeys(states []StepState) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, state := range states {
+		for key := range state.Outputs {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,22 @@
+package cmd
+
+// State helper-related concrete command structs
+
+// StateHelperCmd groups the commands that scripts call to report their state to WHAM.
+type StateHelperCmd struct {
+	Write StateHelperWriteCmd `cmd:"" help:"Write the state file of a stateful step, from within its script."`
+}
+
+// StateHelperWriteCmd handles the 'state-helper write' command.
+type StateHelperWriteCmd struct {
+	RunID    string   `help:"The new run_id of the step." required:"" name:"run-id"`
+	Outputs  []string `help:"An output of the step, as key=value (repeatable)." name:"out" placeholder:"KEY=VALUE" sep:"none"`
+	File     string   `help:"The state file, relative to the metadata directory. Defaults to the step's state_file." env:"VAR_STATE_FILE"`
+	RunIDVar string   `help:"The variable holding the run_id in the state file. Defaults to the step's run_id_var." name:"run-id-var" env:"VAR_RUN_ID_VAR"`
+}
+
+// State helper-related command implementations
+
+func (s *StateHelperWriteCmd) Run(ctx *Context) error {
+	return WriteStateFile(StateFileWrite{File: s.File, RunIDVar: s.RunIDVar, RunID: s.RunID, Outputs: s.Outputs})
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// StateFileWrite is what `wham state-helper write` writes to the state file of a
+// stateful step.
+type StateFileWrite struct {
+	// File is the path of the state file. A relative path is relative to the
+	// metadata directory given to the script in VAR_METADATA_DIR, as `state_file` is.
+	File string
+	// RunIDVar is the variable holding the run ID in the file (the step's `run_id_var`).
+	RunIDVar string
+	// RunID is the new run ID of the step.
+	RunID string
+	// Outputs are `key=value` pairs written to the file after the run ID, and
+	// reported as the step's outputs when called from a step (see VAR_OUTPUT_FILE).
+	Outputs []string
+}
+
+// WriteStateFile writes the state file of a stateful step in the format WHAM reads
+// (see readStateFileRunId), so that scripts do not have to format it by hand.
+// It validates the variable names and values, which must fit on a line, and
+// replaces the file atomically, so that WHAM never reads a partial state file.
+//
+// When called from a step's script, the outputs are also appended to the file
+// named by VAR_OUTPUT_FILE, so that they are recorded in the step's WHAM state.
+func WriteStateFile(s StateFileWrite) error {
+	if s.File == "" {
+		return fmt.Errorf("no state file: use --file, or call it from a step with a 'state_file' (VAR_STATE_FILE)")
+	}
+	if s.RunIDVar == "" {
+		return fmt.Errorf("no run_id variable: use --run-id-var, or call it from a step with a 'run_id_var' (VAR_RUN_ID_VAR)")
+	}
+	if err := validateStateKey(s.RunIDVar); err != nil {
+		return fmt.Errorf("invalid --run-id-var: %w", err)
+	}
+	if s.RunID == "" || strings.ContainsAny(s.RunID, "\r\n") {
+		return fmt.Errorf("invalid --run-id: it must be a non-empty, single-line value")
+	}
+
+	var b strings.Builder
+	b.WriteString("# Written by `wham state-helper write`.\n")
+	fmt.Fprintf(&b, "%s=%s\n", s.RunIDVar, s.RunID)
+	var outputs strings.Builder
+	for _, output := range s.Outputs {
+		key, value, found := strings.Cut(output, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !found {
+			return fmt.Errorf("invalid --out '%s': expected key=value", output)
+		}
+		if err := validateStateKey(key); err != nil {
+			return fmt.Errorf("invalid --out '%s': %w", output, err)
+		}
+		if key == s.RunIDVar {
+			return fmt.Errorf("invalid --out '%s': the key is the run_id variable", output)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("invalid --out '%s': the value must fit on a single line", output)
+		}
+		fmt.Fprintf(&outputs, "%s=%s\n", key, value)
+	}
+	b.WriteString(outputs.String())
+
+	path := s.File
+	if metadataDir := os.Getenv("VAR_METADATA_DIR"); !filepath.IsAbs(path) && metadataDir != "" {
+		path = filepath.Join(metadataDir, path)
+	}
+	if err := writeFileAtomically(path, []byte(b.String())); err != nil {
+		return fmt.Errorf("failed to write state file '%s': %w", path, err)
+	}
+
+	if outputFile := os.Getenv("VAR_OUTPUT_FILE"); outputFile != "" && outputs.Len() > 0 {
+		f, err := os.OpenFile(outputFile, os.O_APPEND|os.O_WRONLY, 0)
+		if err != nil {
+			return fmt.Errorf("failed to open outputs file '%s': %w", outputFile, err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(outputs.String()); err != nil {
+			return fmt.Errorf("failed to write outputs file '%s': %w", outputFile, err)
+		}
+	}
+	return nil
+}
+
+// validateStateKey checks that a variable name of a state file is read back as is.
+func validateStateKey(key string) error {
+	switch {
+	case key == "":
+		return fmt.Errorf("the key cannot be empty")
+	case strings.HasPrefix(key, "#"):
+		return fmt.Errorf("the key cannot start with '#'")
+	case strings.ContainsAny(key, "= \t\r\n"):
+		return fmt.Errorf("the key cannot contain '=' or whitespace")
+	}
+	return nil
+}
+
+// writeFileAtomically writes a file through a temporary file in the same directory,
+// flushed to disk and renamed over it, so that readers see either its previous or
+// its new content, even if WHAM or the machine crashes while it is written.
+func writeFileAtomically(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // A no-op once renamed.
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	// Without it, the rename may reach the disk before the data, leaving an empty
+	// file after a crash.
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	// Persist the rename itself. Some file systems cannot sync a directory: the
+	// file is written all the same.
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package cmd_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestStateHelperWrite verifies that a stateful step can write its state file with
+// `state-helper write`, which WHAM then reads its run_id and outputs from.
+func TestStateHelperWrite(t *testing.T) {
+	const configPath = "../test/settings/settings_state_helper.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+	t.Setenv("WHAM_BIN", whamBinaryPath)
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "-o", "json")
+	assert.NoError(t, err)
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, outputStr, &states)
+	statesMap := make(map[string]TestStepState)
+	for _, s := range states {
+		statesMap[s.StepName] = s
+	}
+	assert.Equal(t, "20240501", statesMap["extract"].RunID)
+	assert.Equal(t, map[string]string{"rows_processed": "42"}, statesMap["extract"].Outputs)
+	assert.Equal(t, "20240501", statesMap["load"].RunID)
+
+	data, err := os.ReadFile("../test/states/metadata/extract.state")
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "LATEST_EXPORT=20240501\nrows_processed=42\n")
+
+	// Outside of a step, the state file and its variable must be given.
+	outputStr, err = runWhamCommand(t, "state-helper", "write", "--run-id", "20240502")
+	assert.Error(t, err)
+	assert.Contains(t, outputStr, "no state file")
+	outputStr, err = runWhamCommand(t, "state-helper", "write", "--run-id", "20240502", "--file", "../test/states/metadata/extract.state", "--run-id-var", "LATEST_EXPORT", "--out", "bad key=1")
+	assert.Error(t, err)
+	assert.Contains(t, outputStr, "the key cannot contain '=' or whitespace")
+}
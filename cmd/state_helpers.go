@@ -2,62 +2,136 @@ package cmd
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
-	"path/filepath"
+	"strings"
 	"time"
 )
 
+// stateReadAttempts is how many times a WHAM state file that cannot be read is
+// tried before giving up, and stateReadBackoff is the delay before the first retry,
+// doubled after each attempt. This rides out transient errors of network filesystems.
+const (
+	stateReadAttempts = 4
+	stateReadBackoff  = 100 * time.Millisecond
+)
+
 // getCurrentStepWhamState reads and parses the WHAM state file for a specific step.
 //
-// It constructs the path to the step's WHAM state file (e.g., wham_001_my-step.state)
-// and attempts to read and unmarshal its JSON content into a StepState struct.
-//
-// If the file does not exist, cannot be read, or contains invalid JSON, the function
-// logs the issue and returns an empty StepState{}. This is a safe default, as an
-// empty run_id will typically trigger a re-run for dependent steps.
+// It is the lenient counterpart of loadStepWhamState, meant for reporting: if the
+// file cannot be read even after retries, the function logs the issue and returns an
+// empty StepState{}. Decisions about whether a step runs must use loadStepWhamState,
+// so that an unreadable state never silently triggers a re-run.
 func (w *WHAM) getCurrentStepWhamState(stepName string) StepState {
-	whamStateFilePath := w.getWhamStateFilePath(stepName)
-	data, err := os.ReadFile(whamStateFilePath)
+	state, err := w.loadStepWhamState(stepName)
 	if err != nil {
-		// Handle cases where the file doesn't exist or can't be read.
-		if os.IsNotExist(err) {
+		w.logger.Warn().Str("step", stepName).Err(err).Msg("Could not read WHAM state file, returning empty state.")
+		return StepState{}
+	}
+	return state
+}
+
+// loadStepWhamState reads and parses the WHAM state file for a specific step.
+//
+// It reads the step's WHAM state from the state store, by default the step's WHAM
+// state file (e.g., wham_001_my-step.state), and unmarshals its JSON content into a
+// StepState struct.
+//
+// If the file does not exist or contains invalid JSON, the function logs the issue
+// and returns an empty StepState{}. This is a safe default, as an empty run_id will
+// typically trigger a re-run for dependent steps. A state written with an older
+// schema is upgraded (see decodeStepState), and one written with a newer schema is
+// an error, rather than being parsed partially.
+//
+// Any other read error is retried with an exponential backoff (see stateReadAttempts),
+// and returned if the file still cannot be read.
+func (w *WHAM) loadStepWhamState(stepName string) (StepState, error) {
+	whamStateFilePath := w.stateStore.Location(stepName)
+	var data []byte
+	var err error
+	backoff := stateReadBackoff
+	for attempt := 1; ; attempt++ {
+		data, err = w.stateStore.Load(stepName)
+		if err == nil {
+			break
+		}
+		if errors.Is(err, fs.ErrNotExist) {
 			w.logger.Debug().Str("step", stepName).Str("path", whamStateFilePath).Msg("WHAM state file does not exist, returning empty state.")
-		} else {
-			w.logger.Warn().Str("step", stepName).Str("path", whamStateFilePath).Err(err).Msg("Could not read WHAM state file, returning empty state.")
+			// Return an empty state, which is the expected behavior for a step that has never run.
+			return StepState{}, nil
 		}
-		// Return an empty state, which is the expected behavior for a step that has never run.
-		return StepState{}
+		if attempt == stateReadAttempts {
+			return StepState{}, fmt.Errorf("failed to read WHAM state file '%s' after %d attempts: %w", whamStateFilePath, attempt, err)
+		}
+		w.logger.Warn().Str("step", stepName).Str("path", whamStateFilePath).Int("attempt", attempt).Err(err).Msgf("Could not read WHAM state file, retrying in %s...", backoff)
+		time.Sleep(backoff)
+		backoff *= 2
 	}
 
-	var state StepState
 	// The WHAM state files are stored in JSON format.
-	err = json.Unmarshal(data, &state)
+	state, version, err := decodeStepState(data)
+	if errors.Is(err, errNewerStateSchema) {
+		return StepState{}, fmt.Errorf("WHAM state file '%s' is a %w", whamStateFilePath, err)
+	}
 	if err != nil {
 		w.logger.Warn().Str("step", stepName).Str("path", whamStateFilePath).Err(err).Msg("Could not parse WHAM state file, returning empty state.")
 		// Return an empty state if the file is corrupted or not valid JSON.
-		return StepState{}
+		return StepState{}, nil
 	}
-	return state
+	if version < StateSchemaVersion {
+		w.logger.Debug().Str("step", stepName).Int("schema_version", version).Msg("WHAM state upgraded from an older schema. Run 'state migrate' to rewrite it.")
+	}
+	return state, nil
 }
 
 // saveStepWhamState creates and saves the WHAM state file for a specific step.
 //
-// It takes the step's name, its resulting run_id, and the action performed
-// ("run", "skipped", or "failed"). It constructs a StepState object, marshals it
-// into a human-readable JSON format, and writes it to the appropriate state file,
-// overwriting any previous state. The file path is determined by getWhamStateFilePath.
+// It takes the step's name and the state to record, which holds its resulting
+// run_id, the action performed ("run", "skipped", or "failed") and any other
+// outcome details. The run date is set to the current time. The state is
+// marshalled into a human-readable JSON format and written to the state store,
+// by default to the step's state file (see getWhamStateFileName), overwriting any
+// previous state. The state file is replaced atomically (see writeFileAtomically),
+// so that a crash while it is written never leaves a truncated state behind.
+//
+// A state recording the same run_id as the previous state keeps its run_id date,
+// so that it tells how old the run_id is, however often the step was skipped or
+// failed since. For a step with a `watermark_from_output`, a state without a
+// watermark keeps the watermark of the previous state, so that only a successful
+// execution reporting the output advances it. A skipped state without outputs of
+// its own keeps the outputs of the previous state, so that the metrics of the step
+// (e.g., rows_processed) remain known while it has nothing to do. Likewise, the
+// hash of the inputs of a step is only recorded by its successful executions
+// without the dry-run marker, which alone consumed them. With a `history_limit`,
+// the state is also appended to the history of the step (see saveStepHistory).
 //
 // Returns an error if the JSON marshalling or file writing fails.
-func (w *WHAM) saveStepWhamState(stepName, newRunID, action string, elapsed time.Duration) error {
-	whamStateFilePath := w.getWhamStateFilePath(stepName)
-
-	state := StepState{
-		RunID:     newRunID,
-		RunDate:   time.Now(),
-		RunAction: action,
-		Elapsed:   elapsed,
+func (w *WHAM) saveStepWhamState(stepName string, state StepState) error {
+	whamStateFilePath := w.stateStore.Location(stepName)
+	previous := w.getCurrentStepWhamState(stepName)
+	state.RunDate = time.Now()
+	state.WorkflowRunID = w.workflowRunID()
+	if state.RunID != "" {
+		state.RunIDDate = state.RunDate
+		if previous.RunID == state.RunID && !previous.RunIDDate.IsZero() {
+			state.RunIDDate = previous.RunIDDate
+		}
+	}
+	step := w.findStep(stepName)
+	if step != nil && step.WatermarkFromOutput != "" && state.Watermark == "" {
+		state.Watermark = previous.Watermark
 	}
+	if state.RunAction == "skipped" && len(state.Outputs) == 0 {
+		state.Outputs = previous.Outputs
+	}
+	state.DryRun = step != nil && w.dryRunMarked(step)
+	if step != nil && len(step.Inputs) > 0 && (state.InputsHash == "" || state.DryRun) {
+		state.InputsHash = previous.InputsHash
+	}
+	state.WhamVersion = Version
+	state.SchemaVersion = StateSchemaVersion
 
 	// Marshal the state to a human-readable, indented JSON format.
 	data, err := json.MarshalIndent(state, "", "  ")
@@ -65,36 +139,74 @@ func (w *WHAM) saveStepWhamState(stepName, newRunID, action string, elapsed time
 		return fmt.Errorf("failed to marshal WHAM step state for '%s': %w", stepName, err)
 	}
 
-	// Write the state to the file with standard read/write permissions.
-	err = os.WriteFile(whamStateFilePath, data, 0644)
+	err = w.stateStore.Save(stepName, data)
 	if err != nil {
 		return fmt.Errorf("failed to write WHAM state file '%s': %w", whamStateFilePath, err)
 	}
 
-	w.logger.Debug().Str("step", stepName).Str("run_id", newRunID).Str("action", action).Str("path", whamStateFilePath).Msg("WHAM state saved.")
+	w.logger.Debug().Str("step", stepName).Str("run_id", state.RunID).Str("action", state.RunAction).Str("path", whamStateFilePath).Msg("WHAM state saved.")
+	w.saveStepHistory(stepName, state)
 	return nil
 }
 
-// getWhamStateFilePath constructs the absolute path for a step's WHAM state file.
+// getWhamStateFileName constructs the name of a step's WHAM state file in the state store.
 //
 // The filename is assembled based on global settings.
 //   - Base format: `[prefix][step_name][suffix]`
 //   - With depth enabled (`metadata_add_depth: true`), the format becomes:
 //     `[prefix][padded_depth]_[step_name][suffix]`
 //
-// The final path is created by joining this filename with the configured metadata directory.
-// For example: `/path/to/metadata/wham_001_my-step.state`.
-func (w *WHAM) getWhamStateFilePath(stepName string) string {
+// With the default store, the file is located in the metadata directory, e.g.
+// `/path/to/metadata/wham_001_my-step.state`.
+func (w *WHAM) getWhamStateFileName(stepName string) string {
 	// Default filename format without depth.
 	filename := w.config.WhamSettings.MetadataPrefix + stepName + w.config.WhamSettings.MetadataSuffix
 
 	// If configured, overwrite the filename to include the step's depth.
 	if w.config.WhamSettings.MetadataAddDepth {
-		depth := w.stepDepths[stepName]
+		depth := w.stepDepth(stepName)
 		// Format the depth with leading zeros for consistent sorting (e.g., 001, 010, 100).
 		depthStr := fmt.Sprintf("%0*d", w.config.WhamSettings.MetadataDepthPadding, depth)
 		filename = w.config.WhamSettings.MetadataPrefix + depthStr + "_" + stepName + w.config.WhamSettings.MetadataSuffix
 	}
-	// Join with the absolute metadata directory path to get the full path.
-	return filepath.Join(w.config.WhamSettings.MetadataDir, filename)
+	return filename
+}
+
+// parseWhamStateFileName returns the name of the step of a WHAM state file name
+// (see getWhamStateFileName), and false if the name cannot be one. As the depth of
+// a step no longer in the configuration is unknown, any depth is accepted.
+func (w *WHAM) parseWhamStateFileName(fileName string) (string, bool) {
+	settings := &w.config.WhamSettings
+	name, hasPrefix := strings.CutPrefix(fileName, settings.MetadataPrefix)
+	name, hasSuffix := strings.CutSuffix(name, settings.MetadataSuffix)
+	if !hasPrefix || !hasSuffix {
+		return "", false
+	}
+	if settings.MetadataAddDepth {
+		depth, rest, found := strings.Cut(name, "_")
+		if !found || depth == "" || len(depth) < settings.MetadataDepthPadding || strings.Trim(depth, "0123456789") != "" {
+			return "", false
+		}
+		name = rest
+	}
+	return name, name != ""
+}
+
+// UseEphemeralState redirects the metadata directory, where all WHAM state is kept,
+// and the state store, whatever its backend, to a new temporary directory, so that
+// a configuration can be exercised without reading or modifying its real state.
+// The returned function removes the directory and must be called before exiting.
+func (w *WHAM) UseEphemeralState() (func(), error) {
+	dir, err := os.MkdirTemp("", "wham_ephemeral_state_*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ephemeral metadata directory: %w", err)
+	}
+	w.logger.Info().Str("dir", dir).Str("replaces", w.config.WhamSettings.MetadataDir).Msg("Using ephemeral state.")
+	w.config.WhamSettings.MetadataDir = dir
+	w.stateStore = &fileStateStore{dir: dir, fileName: w.getWhamStateFileName, stepName: w.parseWhamStateFileName}
+	return func() {
+		if err := os.RemoveAll(dir); err != nil {
+			w.logger.Warn().Str("dir", dir).Err(err).Msg("Could not remove ephemeral metadata directory.")
+		}
+	}, nil
 }
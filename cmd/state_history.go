@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ShowStepHistory lists the previous executions of a step recorded in its history
+// (see saveStepHistory), most recent first, with their action, run_id, date and
+// elapsed time. The "wide" format adds one column for each output reported by the
+// executions.
+//
+// A step has a history only if the `history_limit` setting is positive; the
+// executions recorded before it was set are not listed.
+func (w *WHAM) ShowStepHistory(stepName string, outputFormat string) error {
+	if w.findStep(stepName) == nil {
+		return fmt.Errorf("step '%s' not found", stepName)
+	}
+	history, err := w.loadStepHistory(stepName)
+	if err != nil {
+		return err
+	}
+	slices.Reverse(history)
+	if history == nil {
+		history = []StepState{} // Render an empty list rather than null.
+	}
+
+	switch outputFormat {
+	case "json", "yaml":
+		return RenderData(os.Stdout, history, outputFormat)
+	case "table", "wide":
+		return w.renderStepHistoryAsTable(stepName, history, outputFormat == "wide")
+	default:
+		return fmt.Errorf("unsupported output format: '%s'", outputFormat)
+	}
+}
+
+// renderStepHistoryAsTable displays the history of a step, or a message if it has none.
+func (w *WHAM) renderStepHistoryAsTable(stepName string, history []StepState, wide bool) error {
+	if len(history) == 0 {
+		if w.config.WhamSettings.HistoryLimit <= 0 {
+			_, err := fmt.Printf("No history for step '%s': set history_limit to keep the states of its previous executions.\n", stepName)
+			return err
+		}
+		_, err := fmt.Printf("No history for step '%s' yet.\n", stepName)
+		return err
+	}
+
+	headers := []string{"RUN DATE", "ACTION", "RUN ID", "ELAPSED", "WARNINGS"}
+	var outputKeys []string
+	if wide {
+		outputKeys = collectOutputKeys(history)
+		for _, key := range outputKeys {
+			headers = append(headers, strings.ToUpper(key))
+		}
+	}
+	tr := NewTableRenderer(os.Stdout, headers...)
+	tr.SetWrap(w.noTruncate)
+
+	for _, state := range history {
+		action := state.RunAction
+		if state.Reason != "" {
+			action += " (" + state.Reason + ")"
+		}
+		warnings := "-"
+		if len(state.Warnings) > 0 {
+			warnings = strconv.Itoa(len(state.Warnings))
+		}
+		row := []string{state.RunDate.Format("2006-01-02 15:04:05"), action, orDash(state.RunID), state.Elapsed.Round(time.Millisecond).String(), warnings}
+		for _, key := range outputKeys {
+			value, ok := state.Outputs[key]
+			if !ok {
+				value = "-"
+			}
+			row = append(row, value)
+		}
+		tr.AddRow(row...)
+	}
+	return tr.Render()
+}
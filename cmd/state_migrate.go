@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// StateSchemaVersion is the version of the layout of the WHAM states written by
+// this WHAM (see StepState.SchemaVersion). A change of StepState that the states
+// written before cannot be parsed into as they are bumps it, along with a new
+// entry of stateMigrations upgrading them.
+const StateSchemaVersion = 1
+
+// stateMigrations upgrade a WHAM state, decoded as a JSON object, from the schema
+// version of their index to the next one.
+var stateMigrations = []func(state map[string]any){
+	// 0 to 1: the states written before run_id_date was recorded get their run_date,
+	// the best known date of their run_id.
+	func(state map[string]any) {
+		runID, _ := state["run_id"].(string)
+		runIDDate, _ := state["run_id_date"].(string)
+		if runID != "" && (runIDDate == "" || strings.HasPrefix(runIDDate, "0001-01-01")) {
+			state["run_id_date"] = state["run_date"]
+		}
+	},
+}
+
+// errNewerStateSchema is wrapped by the errors on the WHAM states written with a
+// newer schema than StateSchemaVersion, which this WHAM would only parse partially.
+var errNewerStateSchema = errors.New("state written with a newer schema")
+
+// decodeStepState parses a WHAM state, upgrading it to StateSchemaVersion if it
+// was written with an older schema, and returns the schema version it was written
+// with. The states without schema_version predate it, and have the version 0.
+func decodeStepState(data []byte) (state StepState, version int, err error) {
+	// Numbers are kept as written, so that e.g. elapsed durations do not lose
+	// precision through float64.
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var fields map[string]any
+	if err := decoder.Decode(&fields); err != nil {
+		return StepState{}, 0, err
+	}
+	if raw, ok := fields["schema_version"]; ok {
+		number, isNumber := raw.(json.Number)
+		v, err := number.Int64()
+		if !isNumber || err != nil || v < 0 {
+			return StepState{}, 0, fmt.Errorf("invalid schema_version %v", raw)
+		}
+		version = int(v)
+	}
+	if version > StateSchemaVersion {
+		return StepState{}, version, fmt.Errorf("%w (version %d, this WHAM knows up to %d): upgrade WHAM", errNewerStateSchema, version, StateSchemaVersion)
+	}
+	if version < StateSchemaVersion {
+		if fields == nil {
+			fields = map[string]any{} // A JSON null.
+		}
+		for _, migrate := range stateMigrations[version:] {
+			migrate(fields)
+		}
+		fields["schema_version"] = StateSchemaVersion
+		if data, err = json.Marshal(fields); err != nil {
+			return StepState{}, version, err
+		}
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return StepState{}, version, err
+	}
+	return state, version, nil
+}
+
+// Kinds of the metadata upgraded by `state migrate`.
+const (
+	// MigratedState is the WHAM state of a step, in the state store.
+	MigratedState = "state"
+	// MigratedHistory is the history of a step, in the metadata directory.
+	MigratedHistory = "history"
+)
+
+// MigratedItem is a piece of metadata upgraded by `state migrate`.
+type MigratedItem struct {
+	StepName string `json:"step_name" yaml:"step_name"`
+	// Kind is the kind of the metadata (see the Migrated* constants).
+	Kind     string `json:"kind" yaml:"kind"`
+	Location string `json:"location" yaml:"location"`
+	// FromVersion is the schema version it was written with; the oldest one of
+	// its states for a history.
+	FromVersion int `json:"from_version" yaml:"from_version"`
+	ToVersion   int `json:"to_version" yaml:"to_version"`
+}
+
+// MigrateState rewrites the WHAM states written with an older schema than
+// StateSchemaVersion, and returns them:
+//   - the WHAM states of the state store, whatever its backend, including those of
+//     the steps no longer in the configuration. An entry of the state store that is
+//     not a WHAM state is left alone;
+//   - the histories of the metadata directory holding such states.
+//
+// Older states are upgraded whenever they are read, so migrating is not required
+// to run the workflow, but it keeps the states readable by the tools parsing them
+// directly. With `dryRun`, nothing is rewritten. It fails on the first state
+// written with a newer schema, which this WHAM cannot upgrade.
+func (w *WHAM) MigrateState(dryRun bool) ([]MigratedItem, error) {
+	migrated := []MigratedItem{} // Render an empty list rather than null.
+	names, err := w.stateStore.List()
+	if err != nil {
+		return migrated, fmt.Errorf("failed to list the states of %s: %w", w.stateStore.Location(""), err)
+	}
+	for _, name := range names {
+		location := w.stateStore.Location(name)
+		data, err := w.stateStore.Load(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return migrated, fmt.Errorf("failed to read '%s': %w", location, err)
+		}
+		state, version, err := decodeStepState(data)
+		if errors.Is(err, errNewerStateSchema) {
+			return migrated, fmt.Errorf("failed to migrate the state of step '%s': %w", name, err)
+		}
+		if err != nil || state.RunAction == "" || version == StateSchemaVersion {
+			continue // Another file of the store, e.g. a state file of a stateful step.
+		}
+		if !dryRun {
+			data, err := json.MarshalIndent(state, "", "  ")
+			if err != nil {
+				return migrated, fmt.Errorf("failed to marshal WHAM step state for '%s': %w", name, err)
+			}
+			if err := w.stateStore.Save(name, data); err != nil {
+				return migrated, fmt.Errorf("failed to write WHAM state file '%s': %w", location, err)
+			}
+		}
+		migrated = append(migrated, MigratedItem{StepName: name, Kind: MigratedState, Location: location, FromVersion: version, ToVersion: StateSchemaVersion})
+	}
+
+	items, err := w.migrateHistories(dryRun)
+	migrated = append(migrated, items...)
+	if err != nil {
+		return migrated, err
+	}
+
+	slices.SortStableFunc(migrated, func(a, b MigratedItem) int {
+		return strings.Compare(a.StepName+"\x00"+a.Kind, b.StepName+"\x00"+b.Kind)
+	})
+	w.logger.Info().Bool("dry_run", dryRun).Int("migrated", len(migrated)).Int("schema_version", StateSchemaVersion).Msg("State migrated.")
+	return migrated, nil
+}
+
+// migrateHistories rewrites the histories holding states written with an older
+// schema than StateSchemaVersion.
+func (w *WHAM) migrateHistories(dryRun bool) ([]MigratedItem, error) {
+	dir := filepath.Dir(w.getStepHistoryFilePath("_"))
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read directory '%s': %w", dir, err)
+	}
+	var migrated []MigratedItem
+	for _, entry := range entries {
+		name, isJSON := strings.CutSuffix(entry.Name(), ".json")
+		if !entry.Type().IsRegular() || !isJSON {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		history, oldest, err := w.readStepHistoryFile(path)
+		if err != nil {
+			return migrated, err
+		}
+		if oldest == StateSchemaVersion {
+			continue
+		}
+		if !dryRun {
+			data, err := json.MarshalIndent(history, "", "  ")
+			if err != nil {
+				return migrated, fmt.Errorf("failed to marshal history of step '%s': %w", name, err)
+			}
+			if err := writeFileAtomically(path, data); err != nil {
+				return migrated, err
+			}
+		}
+		migrated = append(migrated, MigratedItem{StepName: name, Kind: MigratedHistory, Location: path, FromVersion: oldest, ToVersion: StateSchemaVersion})
+	}
+	return migrated, nil
+}
+
+// ShowMigrateState runs MigrateState and lists what was upgraded, or would be
+// with `dryRun`.
+func (w *WHAM) ShowMigrateState(dryRun bool, outputFormat string) error {
+	migrated, err := w.MigrateState(dryRun)
+	if err != nil {
+		return err
+	}
+	switch outputFormat {
+	case "json", "yaml":
+		return RenderData(os.Stdout, migrated, outputFormat)
+	case "table", "wide":
+		return w.renderMigratedItems(migrated, dryRun)
+	default:
+		return fmt.Errorf("unsupported output format: '%s'", outputFormat)
+	}
+}
+
+// renderMigratedItems displays the metadata upgraded by MigrateState, or a message
+// if there is none.
+func (w *WHAM) renderMigratedItems(migrated []MigratedItem, dryRun bool) error {
+	if len(migrated) == 0 {
+		_, err := fmt.Printf("✅ All states are at schema version %d.\n", StateSchemaVersion)
+		return err
+	}
+	verb := "Migrated"
+	if dryRun {
+		verb = "Would migrate"
+	}
+	if _, err := fmt.Printf("🔧 %s %d item(s) to schema version %d.\n", verb, len(migrated), StateSchemaVersion); err != nil {
+		return err
+	}
+	tr := NewTableRenderer(os.Stdout, "NAME", "KIND", "FROM", "TO", "LOCATION")
+	tr.SetWrap(w.noTruncate)
+	for _, item := range migrated {
+		tr.AddRow(item.StepName, item.Kind, fmt.Sprint(item.FromVersion), fmt.Sprint(item.ToVersion), item.Location)
+	}
+	return tr.Render()
+}
@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Kinds of the metadata removed by `state prune`.
+const (
+	// PrunedState is the WHAM state of a step no longer in the configuration.
+	PrunedState = "state"
+	// PrunedHistory is the history of a step no longer in the configuration, or
+	// the states of a history beyond `history_limit`.
+	PrunedHistory = "history"
+	// PrunedFailureRate is the execution history of a step no longer in the
+	// configuration, kept for its `max_failure_rate`.
+	PrunedFailureRate = "failure_rate"
+	// PrunedNotification is the notification state of a step no longer in the
+	// configuration.
+	PrunedNotification = "notification"
+)
+
+// PrunedItem is a piece of metadata removed by `state prune`.
+type PrunedItem struct {
+	StepName string `json:"step_name" yaml:"step_name"`
+	// Kind is the kind of the metadata (see the Pruned* constants).
+	Kind     string `json:"kind" yaml:"kind"`
+	Location string `json:"location" yaml:"location"`
+	// Detail tells why it was removed.
+	Detail string `json:"detail" yaml:"detail"`
+}
+
+// PruneState removes the metadata the workflow no longer needs, and returns it:
+//   - the WHAM states of the steps no longer in the configuration, from the state
+//     store, whatever its backend;
+//   - their history, failure rate and notification files, from the metadata
+//     directory;
+//   - the states of the histories of the other steps beyond `history_limit`, e.g.
+//     after the limit was lowered. Histories are left alone if it is not set.
+//
+// With `dryRun`, nothing is removed. The steps generated at runtime (see
+// parseGeneratedSteps) are not in the configuration: unless `force` is set, the
+// metadata of unknown steps is kept if a step of the workflow generates steps, and
+// a warning is printed. An entry of the state store that is not a WHAM state is
+// never removed.
+func (w *WHAM) PruneState(dryRun bool, force bool) ([]PrunedItem, error) {
+	pruned := []PrunedItem{} // Render an empty list rather than null.
+	pruneUnknown := force || !slices.ContainsFunc(w.config.WhamSteps, func(s Step) bool { return s.GeneratesSteps })
+	if !pruneUnknown {
+		fmt.Println("⚠️ The workflow generates steps at runtime, which are not in the configuration: the metadata of unknown steps is kept. Use --force to prune it anyway.")
+		w.logger.Warn().Msg("Metadata of unknown steps kept, as the workflow has generator steps.")
+	}
+
+	if pruneUnknown {
+		names, err := w.stateStore.List()
+		if err != nil {
+			return pruned, fmt.Errorf("failed to list the states of %s: %w", w.stateStore.Location(""), err)
+		}
+		for _, name := range names {
+			if w.findStep(name) != nil {
+				continue
+			}
+			data, err := w.stateStore.Load(name)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return pruned, fmt.Errorf("failed to read '%s': %w", w.stateStore.Location(name), err)
+			}
+			var state StepState
+			if json.Unmarshal(data, &state) != nil || state.RunAction == "" {
+				continue // Another file of the store, e.g. a state file of a stateful step.
+			}
+			if !dryRun {
+				if err := w.stateStore.Delete(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+					return pruned, fmt.Errorf("failed to delete '%s': %w", w.stateStore.Location(name), err)
+				}
+			}
+			pruned = append(pruned, PrunedItem{StepName: name, Kind: PrunedState, Location: w.stateStore.Location(name), Detail: "step not in the configuration"})
+		}
+
+		for kind, dir := range map[string]string{
+			PrunedHistory:      filepath.Dir(w.getStepHistoryFilePath("_")),
+			PrunedFailureRate:  filepath.Dir(w.getFailureRateStateFilePath("_")),
+			PrunedNotification: filepath.Dir(w.getNotificationStateFilePath("_")),
+		} {
+			items, err := w.pruneUnknownStepFiles(kind, dir, dryRun)
+			pruned = append(pruned, items...)
+			if err != nil {
+				return pruned, err
+			}
+		}
+	}
+
+	if limit := w.config.WhamSettings.HistoryLimit; limit > 0 {
+		for _, step := range w.config.WhamSteps {
+			history, err := w.loadStepHistory(step.Name)
+			if err != nil {
+				return pruned, err
+			}
+			if len(history) <= limit {
+				continue
+			}
+			path := w.getStepHistoryFilePath(step.Name)
+			if !dryRun {
+				data, err := json.MarshalIndent(history[len(history)-limit:], "", "  ")
+				if err != nil {
+					return pruned, fmt.Errorf("failed to marshal history of step '%s': %w", step.Name, err)
+				}
+				if err := writeFileAtomically(path, data); err != nil {
+					return pruned, err
+				}
+			}
+			pruned = append(pruned, PrunedItem{StepName: step.Name, Kind: PrunedHistory, Location: path, Detail: fmt.Sprintf("%d state(s) beyond history_limit (%d)", len(history)-limit, limit)})
+		}
+	}
+
+	slices.SortStableFunc(pruned, func(a, b PrunedItem) int {
+		return strings.Compare(a.StepName+"\x00"+a.Kind, b.StepName+"\x00"+b.Kind)
+	})
+	w.logger.Info().Bool("dry_run", dryRun).Int("removed", len(pruned)).Msg("State pruned.")
+	return pruned, nil
+}
+
+// pruneUnknownStepFiles removes the files of a directory of per-step metadata,
+// named `<step>.json`, whose step is no longer in the configuration.
+func (w *WHAM) pruneUnknownStepFiles(kind, dir string, dryRun bool) ([]PrunedItem, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read directory '%s': %w", dir, err)
+	}
+	var pruned []PrunedItem
+	for _, entry := range entries {
+		name, isJSON := strings.CutSuffix(entry.Name(), ".json")
+		if !entry.Type().IsRegular() || !isJSON || w.findStep(name) != nil {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if !dryRun {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return pruned, fmt.Errorf("failed to delete '%s': %w", path, err)
+			}
+		}
+		pruned = append(pruned, PrunedItem{StepName: name, Kind: kind, Location: path, Detail: "step not in the configuration"})
+	}
+	return pruned, nil
+}
+
+// ShowPruneState runs PruneState and lists what was removed, or would be with
+// `dryRun`.
+func (w *WHAM) ShowPruneState(dryRun bool, force bool, outputFormat string) error {
+	pruned, err := w.PruneState(dryRun, force)
+	if err != nil {
+		return err
+	}
+	switch outputFormat {
+	case "json", "yaml":
+		return RenderData(os.Stdout, pruned, outputFormat)
+	case "table", "wide":
+		return w.renderPrunedItems(pruned, dryRun)
+	default:
+		return fmt.Errorf("unsupported output format: '%s'", outputFormat)
+	}
+}
+
+// renderPrunedItems displays the metadata removed by PruneState, or a message if
+// there is none.
+func (w *WHAM) renderPrunedItems(pruned []PrunedItem, dryRun bool) error {
+	if len(pruned) == 0 {
+		_, err := fmt.Println("✅ Nothing to prune.")
+		return err
+	}
+	verb := "Pruned"
+	if dryRun {
+		verb = "Would prune"
+	}
+	if _, err := fmt.Printf("🧹 %s %d item(s).\n", verb, len(pruned)); err != nil {
+		return err
+	}
+	tr := NewTableRenderer(os.Stdout, "NAME", "KIND", "DETAIL", "LOCATION")
+	tr.SetWrap(w.noTruncate)
+	for _, item := range pruned {
+		tr.AddRow(item.StepName, item.Kind, item.Detail, item.Location)
+	}
+	return tr.Render()
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// StaleStep is a step whose predecessors changed since it last ran, as listed by
+// `state stale`.
+type StaleStep struct {
+	StepName string `json:"step_name" yaml:"step_name"`
+	// RunID is the run_id the step recorded when it last ran.
+	RunID string `json:"run_id" yaml:"run_id"`
+	// UpstreamRunID is the current run_id of its predecessors.
+	UpstreamRunID string `json:"upstream_run_id" yaml:"upstream_run_id"`
+	// StaleSince is when the last of its predecessors reached UpstreamRunID.
+	StaleSince time.Time `json:"stale_since" yaml:"stale_since"`
+	// StaleFor is how long the step has been stale.
+	StaleFor      time.Duration `json:"stale_for" yaml:"stale_for"`
+	PreviousSteps []string      `json:"previous_steps" yaml:"previous_steps"`
+}
+
+// ShowStaleSteps lists the steps inheriting their run_id from their predecessors
+// whose recorded run_id no longer matches the current run_id of the predecessors,
+// i.e. the steps the next `run all` would execute, with how long they have been
+// stale. It reads the recorded states only, without running anything.
+//
+// Steps whose predecessors are not in a consistent state, and steps that never
+// ran, are not listed (see `dag get --status`).
+func (w *WHAM) ShowStaleSteps(outputFormat string) error {
+	stale, err := w.collectStaleSteps()
+	if err != nil {
+		return err
+	}
+	switch outputFormat {
+	case "json", "yaml":
+		return RenderData(os.Stdout, stale, outputFormat)
+	case "table", "wide":
+		return w.renderStaleStepsAsTable(stale)
+	default:
+		return fmt.Errorf("unsupported output format: '%s'", outputFormat)
+	}
+}
+
+// collectStaleSteps returns the stale steps in topological order.
+func (w *WHAM) collectStaleSteps() ([]StaleStep, error) {
+	sortedSteps, err := w.getTopologicalOrder()
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine step execution order: %w", err)
+	}
+	stale := []StaleStep{} // Render an empty list rather than null.
+	now := time.Now()
+	for _, step := range sortedSteps {
+		status := w.dagStepStatus(step)
+		if status.Staleness != StalenessStale {
+			continue
+		}
+		upstreamRunID, _ := w.checkPreviousStepsConsistency(step.PreviousSteps)
+		var since time.Time
+		for _, prevStepName := range step.PreviousSteps {
+			prevState := w.getCurrentStepWhamState(prevStepName)
+			if prevState.RunID != upstreamRunID {
+				continue // A can_fail predecessor with a stale run_id.
+			}
+			reachedAt := prevState.RunIDDate
+			if reachedAt.After(since) {
+				since = reachedAt
+			}
+		}
+		stale = append(stale, StaleStep{
+			StepName:      step.Name,
+			RunID:         status.RunID,
+			UpstreamRunID: upstreamRunID,
+			StaleSince:    since,
+			StaleFor:      now.Sub(since),
+			PreviousSteps: step.PreviousSteps,
+		})
+	}
+	return stale, nil
+}
+
+// renderStaleStepsAsTable displays the stale steps, or a message if there is none.
+func (w *WHAM) renderStaleStepsAsTable(stale []StaleStep) error {
+	if len(stale) == 0 {
+		_, err := fmt.Println("✅ No stale step: every step has caught up with its predecessors.")
+		return err
+	}
+	tr := NewTableRenderer(os.Stdout, "NAME", "RUN ID", "UPSTREAM RUN ID", "STALE SINCE", "STALE FOR", "PREDECESSORS")
+	for _, s := range stale {
+		tr.AddRow(s.StepName, orDash(s.RunID), s.UpstreamRunID, s.StaleSince.Format("2006-01-02 15:04:05"), s.StaleFor.Round(time.Second).String(), strings.Join(s.PreviousSteps, ", "))
+	}
+	return tr.Render()
+}
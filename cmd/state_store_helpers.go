@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Supported state backends (see StateBackendSettings).
+const (
+	// StateBackendFile keeps the WHAM states as files of the metadata directory.
+	StateBackendFile = "file"
+	// StateBackendS3 keeps the WHAM states as objects of an S3-compatible bucket.
+	StateBackendS3 = "s3"
+	// StateBackendPostgres keeps the WHAM states as rows of a PostgreSQL table.
+	StateBackendPostgres = "postgres"
+)
+
+// StateStore persists the WHAM states of the steps, the JSON documents of their
+// StepState. The metadata directory keeps everything else (run records,
+// notifications, sockets, ...), whatever the store.
+type StateStore interface {
+	// Load returns the state of a step, or an error wrapping fs.ErrNotExist if it
+	// has none.
+	Load(stepName string) ([]byte, error)
+	// Save writes the state of a step, replacing any previous one.
+	Save(stepName string, data []byte) error
+	// Delete removes the state of a step, or returns an error wrapping
+	// fs.ErrNotExist if it has none.
+	Delete(stepName string) error
+	// List returns the names of the steps that may have a state, including steps
+	// no longer in the configuration. The stores of files derive them from the
+	// file names, so a name may also belong to another file of the store: its
+	// state must be loaded to tell.
+	List() ([]string, error)
+	// Location returns where the state of a step is kept, e.g. a path or an s3://
+	// URL, or for an empty step name where all the states are kept.
+	Location(stepName string) string
+	// Check verifies that states can be written.
+	Check() error
+}
+
+// newStateStore returns the store of the WHAM states configured by the settings:
+// the files of the metadata directory, unless a `state_backend` is set. The stores
+// of files, in a directory or a bucket, name them with getWhamStateFileName, and
+// list them with parseWhamStateFileName.
+func (w *WHAM) newStateStore() (StateStore, error) {
+	settings := &w.config.WhamSettings
+	backend := settings.StateBackend
+	if backend == nil || backend.Type == "" || backend.Type == StateBackendFile {
+		return &fileStateStore{dir: settings.MetadataDir, fileName: w.getWhamStateFileName, stepName: w.parseWhamStateFileName}, nil
+	}
+	switch backend.Type {
+	case StateBackendS3:
+		return newS3StateStore(backend, w.getWhamStateFileName, w.parseWhamStateFileName)
+	case StateBackendPostgres:
+		return w.newPostgresStateStore(backend)
+	}
+	return nil, fmt.Errorf("state_backend type must be '%s', '%s' or '%s', got '%s'", StateBackendFile, StateBackendS3, StateBackendPostgres, backend.Type)
+}
+
+// fileStateStore keeps the WHAM states as files of a directory.
+type fileStateStore struct {
+	dir string
+	// fileName returns the name of the state file of a step, and stepName the
+	// step of a file name, if it is one.
+	fileName func(stepName string) string
+	stepName func(fileName string) (string, bool)
+}
+
+func (s *fileStateStore) Load(stepName string) ([]byte, error) {
+	return os.ReadFile(s.Location(stepName))
+}
+
+func (s *fileStateStore) Save(stepName string, data []byte) error {
+	// A crash while the state is written must not leave a truncated state, which
+	// would read as a step that never ran.
+	return writeFileAtomically(s.Location(stepName), data)
+}
+
+func (s *fileStateStore) Delete(stepName string) error {
+	return os.Remove(s.Location(stepName))
+}
+
+func (s *fileStateStore) List() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if name, ok := s.stepName(entry.Name()); ok {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (s *fileStateStore) Location(stepName string) string {
+	if stepName == "" {
+		return s.dir
+	}
+	return filepath.Join(s.dir, s.fileName(stepName))
+}
+
+// Check creates and removes a temporary file in the directory.
+func (s *fileStateStore) Check() error {
+	probe, err := os.CreateTemp(s.dir, ".wham_probe_*")
+	if err != nil {
+		return err
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return nil
+}
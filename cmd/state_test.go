@@ -1,9 +1,28 @@
 package cmd_test
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgproto3"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -30,6 +49,89 @@ func TestStateDelete_Single(t *testing.T) {
 	assert.Equal(t, "stateful_sh_succeed", result.StepName, "The step name should match.")
 }
 
+// TestStateDelete_NonInteractive verifies that --non-interactive refuses a deletion
+// that is not confirmed with --yes, instead of deleting without asking.
+func TestStateDelete_NonInteractive(t *testing.T) {
+	const configPath = "../test/settings/settings_ok.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	_, err := runWhamCommand(t, "--config", configPath, "run", "stateful_sh_succeed")
+	assert.NoError(t, err, "Initial run should succeed.")
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "--non-interactive", "state", "delete", "stateful_sh_succeed")
+	assert.Error(t, err, "An unconfirmed deletion should be refused.")
+	assert.Contains(t, outputStr, "requires --yes in non-interactive mode")
+
+	var state TestStepState
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "get", "stateful_sh_succeed", "-o", "json")
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &state))
+	assert.Equal(t, "run", state.RunAction, "The state should not have been deleted.")
+
+	_, err = runWhamCommand(t, "--config", configPath, "--non-interactive", "state", "delete", "stateful_sh_succeed", "--yes")
+	assert.NoError(t, err, "A deletion confirmed with --yes should proceed.")
+}
+
+// TestRun_EphemeralState verifies that a run with --ephemeral-state neither reads
+// nor modifies the configured state.
+func TestRun_EphemeralState(t *testing.T) {
+	const configPath = "../test/settings/settings_ok.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	_, err := runWhamCommand(t, "--config", configPath, "--ephemeral-state", "run", "stateful_sh_succeed")
+	assert.NoError(t, err, "An ephemeral run should succeed.")
+
+	entries, err := os.ReadDir("../test/states/metadata")
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("Failed to read the metadata directory: %v", err)
+	}
+	for _, entry := range entries {
+		assert.False(t, strings.HasPrefix(entry.Name(), "wham_"), "An ephemeral run should not write to the metadata directory, found '%s'.", entry.Name())
+	}
+
+	_, err = runWhamCommand(t, "--config", configPath, "run", "stateful_sh_succeed")
+	assert.NoError(t, err)
+	var before TestStepState
+	outputStr, err := runWhamCommand(t, "--config", configPath, "state", "get", "stateful_sh_succeed", "-o", "json")
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &before))
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "--ephemeral-state", "run", "stateful_sh_succeed")
+	assert.NoError(t, err)
+	assert.NotContains(t, outputStr, "skipped", "An ephemeral run should not see the real state.")
+
+	var after TestStepState
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "get", "stateful_sh_succeed", "-o", "json")
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &after))
+	assert.Equal(t, before, after, "The real state should be untouched.")
+}
+
+// TestRun_DirectoryFlags verifies that --data-dir and --metadata-dir override
+// the directories of the configuration.
+func TestRun_DirectoryFlags(t *testing.T) {
+	const configPath = "../test/settings/settings_ok.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+	dataDir, metadataDir := t.TempDir(), t.TempDir()
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "--data-dir", dataDir, "--metadata-dir", metadataDir, "run", "stateful_sh_succeed")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "DATA_DIR = "+dataDir, "The step should receive the overridden data directory.")
+	stateFiles, _ := filepath.Glob(filepath.Join(metadataDir, "wham_*stateful_sh_succeed.state"))
+	assert.Len(t, stateFiles, 1, "The state should be saved in the overridden metadata directory.")
+
+	entries, err := os.ReadDir("../test/states/metadata")
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("Failed to read the metadata directory: %v", err)
+	}
+	for _, entry := range entries {
+		assert.False(t, strings.HasPrefix(entry.Name(), "wham_"), "The configured metadata directory should not be written to, found '%s'.", entry.Name())
+	}
+}
+
 // TestStateGet_AllJsonOutput verifies that `state get all -o json` produces a correct
 // JSON array of all step states after a full run.
 func TestStateGet_AllJsonOutput(t *testing.T) {
@@ -73,3 +175,1062 @@ func TestStateDelete_AllWithYesFlag(t *testing.T) {
 	assert.Len(t, results, 6, "Should receive deletion results for all 6 steps.")
 	assert.Equal(t, "deleted", results[0].Status, "The status for the first step should be 'deleted'.")
 }
+
+// TestStateDelete_Cascade verifies that `state delete --cascade` also deletes the
+// state of all descendants of the target step.
+func TestStateDelete_Cascade(t *testing.T) {
+	const configPath = "../test/settings/settings_ok.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	_, err := runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.NoError(t, err, "Initial 'run all' should succeed.")
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "state", "delete", "stateless_sh_succeed", "--cascade", "--yes", "-o", "json")
+	assert.NoError(t, err, "state delete --cascade should succeed.")
+
+	var results []TestDeletionResult
+	err = json.Unmarshal([]byte(outputStr), &results)
+	assert.NoError(t, err, "Should be able to unmarshal the JSON output.")
+
+	// stateless_sh_succeed -> stateless_sh_maybe_fail -> final_aggregator_step
+	deleted := make(map[string]string)
+	for _, res := range results {
+		deleted[res.StepName] = res.Status
+	}
+	assert.Len(t, results, 3, "The target and its two descendants should be deleted.")
+	assert.Equal(t, "deleted", deleted["stateless_sh_succeed"])
+	assert.Equal(t, "deleted", deleted["stateless_sh_maybe_fail"])
+	assert.Equal(t, "deleted", deleted["final_aggregator_step"])
+	assert.NotContains(t, deleted, "stateful_sh_succeed", "Ancestors must not be deleted.")
+}
+
+// TestStateDelete_DescendantWarning verifies that deleting the state of a single
+// step warns, on stderr, about the descendants whose state derives from its run,
+// and not about those whose state predates it.
+func TestStateDelete_DescendantWarning(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "wham.yaml")
+	script, err := filepath.Abs("../test/scripts/bash/stateful.sh")
+	assert.NoError(t, err)
+	config := "wham_settings:\n  data_dir: data\n  metadata_dir: metadata\n  metadata_prefix: wham_\n  metadata_suffix: .state\nwham_steps:\n" +
+		"- name: extract\n  command: [\"" + script + "\"]\n  env_vars:\n    STATE_FILE: extract.state\n  is_stateful: true\n  state_file: extract.state\n  run_id_var: run_id\n  previous_steps: []\n" +
+		"- name: transform\n  command: [\"/bin/true\"]\n  previous_steps: [extract]\n" +
+		"- name: load\n  command: [\"/bin/true\"]\n  previous_steps: [transform]\n"
+	assert.NoError(t, os.WriteFile(configPath, []byte(config), 0644))
+	deleteState := func(step string) (string, string) {
+		cmd := exec.Command(whamBinaryPath, "--config", configPath, "state", "delete", step, "--yes", "-o", "json")
+		cmd.Env = append(os.Environ(), "NO_COLOR=true")
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		stdout, err := cmd.Output()
+		assert.NoError(t, err, stderr.String())
+		return string(stdout), stderr.String()
+	}
+	statePath := func(step string) string { return filepath.Join(dir, "metadata", "wham_"+step+".state") }
+	// writeState writes the state of a step, with its run_id moved to a later date
+	// if runID is set, as a new run would.
+	writeState := func(step string, data []byte, runID string, runIDDate time.Time) {
+		if runID != "" {
+			var state map[string]any
+			assert.NoError(t, json.Unmarshal(data, &state))
+			state["run_id"], state["run_id_date"] = runID, runIDDate
+			var err error
+			data, err = json.Marshal(state)
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, os.WriteFile(statePath(step), data, 0644))
+	}
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.NoError(t, err, outputStr)
+	extractState, err := os.ReadFile(statePath("extract"))
+	assert.NoError(t, err)
+	loadState, err := os.ReadFile(statePath("load"))
+	assert.NoError(t, err)
+	stdout, stderr := deleteState("extract")
+	var result TestDeletionResult
+	assert.NoError(t, json.Unmarshal([]byte(stdout), &result), "The warning should not be mixed into the structured output.")
+	assert.Equal(t, "deleted", result.Status)
+	assert.Contains(t, stderr, "Descendant steps of 'extract' still hold state derived from its run and will become inconsistent: transform, load.")
+
+	later := time.Now().Add(time.Hour)
+	writeState("extract", extractState, "newer-run", later)
+	writeState("load", loadState, "newer-run", later)
+	_, stderr = deleteState("extract")
+	assert.Contains(t, stderr, "inconsistent: load.", "Only the descendants that reached the run of the step should be listed.")
+
+	writeState("extract", extractState, "newer-run", later)
+	writeState("load", loadState, "", time.Time{})
+	_, stderr = deleteState("extract")
+	assert.NotContains(t, stderr, "Descendant steps", "Descendants behind the run of the step should not be warned about.")
+}
+
+// TestStateDelete_Backup verifies that `state delete --backup` moves the states to
+// a backup directory, from which `state import` restores them.
+func TestStateDelete_Backup(t *testing.T) {
+	const configPath = "../test/settings/settings_ok.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	_, err := runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.NoError(t, err, "Initial 'run all' should succeed.")
+	statesBefore, err := runWhamCommand(t, "--config", configPath, "state", "get", "all", "-o", "json")
+	assert.NoError(t, err)
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "state", "delete", "all", "--yes", "--backup", "-o", "json")
+	assert.NoError(t, err, outputStr)
+	var results []TestDeletionResult
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &results))
+	assert.Len(t, results, 6)
+	for _, res := range results {
+		assert.Equal(t, "deleted", res.Status, res.StepName)
+		assert.Contains(t, res.Message, "moved to", res.StepName)
+	}
+
+	backups, err := filepath.Glob("../test/states/metadata/wham_backups/*")
+	assert.NoError(t, err)
+	if assert.Len(t, backups, 1, "A single backup directory should be created.") {
+		_, err = os.Stat(filepath.Join(backups[0], "manifest.json"))
+		assert.NoError(t, err, "The backup should have a manifest.")
+
+		outputStr, err = runWhamCommand(t, "--config", configPath, "state", "import", backups[0], "--yes")
+		assert.NoError(t, err, outputStr)
+		statesAfter, err := runWhamCommand(t, "--config", configPath, "state", "get", "all", "-o", "json")
+		assert.NoError(t, err)
+		assert.JSONEq(t, statesBefore, statesAfter, "The restored states should be the deleted ones.")
+	}
+}
+
+// TestStateGet_Outputs verifies that outputs reported by a script are stored in
+// its state, kept while it is skipped, and rendered as extra columns by `state get
+// all -o wide`.
+func TestStateGet_Outputs(t *testing.T) {
+	const configPath = "../test/settings/settings_outputs.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	_, err := runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.NoError(t, err, "The 'run all' should succeed.")
+
+	// The outputs are part of the structured state.
+	outputStr, err := runWhamCommand(t, "--config", configPath, "state", "get", "load_rows", "-o", "json")
+	assert.NoError(t, err, "state get should succeed.")
+	var state struct {
+		Outputs map[string]string `json:"outputs"`
+	}
+	err = json.Unmarshal([]byte(outputStr), &state)
+	assert.NoError(t, err, "Should be able to unmarshal the JSON output.")
+	assert.Equal(t, map[string]string{"rows_processed": "42", "bytes_written": "2048"}, state.Outputs)
+
+	// The wide table shows one column per output key.
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "get", "all", "-o", "wide")
+	assert.NoError(t, err, "state get all -o wide should succeed.")
+	assert.Contains(t, outputStr, "BYTES_WRITTEN", "The wide table should have a column for each output.")
+	assert.Contains(t, outputStr, "ROWS_PROCESSED", "The wide table should have a column for each output.")
+	assert.Regexp(t, `load_rows\s+run\s+.*\s2048\s+42`, outputStr, "The output values should be shown in the step's row.")
+
+	// A skipped step keeps the outputs of its last execution.
+	_, err = runWhamCommand(t, "--config", configPath, "run", "all", "--only", "no_outputs")
+	assert.NoError(t, err)
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "get", "load_rows", "-o", "json")
+	assert.NoError(t, err)
+	var skipped struct {
+		RunAction string            `json:"run_action"`
+		Outputs   map[string]string `json:"outputs"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &skipped))
+	assert.Equal(t, "skipped", skipped.RunAction)
+	assert.Equal(t, map[string]string{"rows_processed": "42", "bytes_written": "2048"}, skipped.Outputs, "The outputs should be carried over by the skipped state.")
+}
+
+// TestStateGet_GroupByDepth verifies that `summary_group_by: depth` groups the
+// state table under a header per DAG depth.
+func TestStateGet_GroupByDepth(t *testing.T) {
+	const configPath = "../test/settings/settings_ok.yaml"
+	const overridePath = "../test/settings/settings_summary_group_by.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "--config", overridePath, "state", "get", "all")
+	assert.NoError(t, err)
+	assert.Regexp(t, `(?s)── Depth 0: 2 step\(s\), 0s\n.*── Depth 1: 2 step\(s\), 0s\n.*── Depth 2: 1 step\(s\).*── Depth 3: 1 step\(s\)`, outputStr)
+
+	// Structured output is not affected.
+	outputStr, err = runWhamCommand(t, "--config", configPath, "--config", overridePath, "state", "get", "all", "-o", "json")
+	assert.NoError(t, err)
+	assert.NotContains(t, outputStr, "Depth")
+}
+
+// TestStateStale verifies that `state stale` lists the steps behind their
+// predecessors, with the run_id they are behind and since when, without running
+// anything.
+func TestStateStale(t *testing.T) {
+	const configPath = "../test/settings/settings_resume.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	getStale := func() []TestStaleStep {
+		outputStr, err := runWhamCommand(t, "--config", configPath, "state", "stale", "-o", "json")
+		assert.NoError(t, err)
+		var stale []TestStaleStep
+		assert.NoError(t, json.Unmarshal([]byte(outputStr), &stale))
+		return stale
+	}
+
+	_, err := runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.Error(t, err, "The workflow should halt at the failing step.")
+	stale := getStale()
+	if assert.Len(t, stale, 1, "Only the failed step should be behind its predecessor.") {
+		assert.Equal(t, "transform", stale[0].StepName)
+		assert.NotEmpty(t, stale[0].UpstreamRunID)
+		assert.NotEqual(t, stale[0].UpstreamRunID, stale[0].RunID)
+		assert.False(t, stale[0].StaleSince.IsZero())
+		assert.Less(t, stale[0].StaleFor, time.Minute)
+	}
+	outputStr, err := runWhamCommand(t, "--config", configPath, "state", "stale")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "UPSTREAM RUN ID")
+	assert.Contains(t, outputStr, "transform")
+
+	t.Setenv("TEST_EXIT_STATUS", "success")
+	_, err = runWhamCommand(t, "--config", configPath, "run", "all", "--resume")
+	assert.NoError(t, err)
+	assert.Empty(t, getStale())
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "stale")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "No stale step")
+}
+
+// TestState_S3Backend verifies that, with an S3 state backend, the WHAM states of
+// the steps are kept as objects of the bucket, under the prefix, rather than in the
+// metadata directory, and that the requests are signed with the AWS credentials.
+func TestState_S3Backend(t *testing.T) {
+	server := startFakeS3(t, "AKIDTEST", "")
+	mu, objects := &server.mu, server.objects
+	isolateAWSEnv(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDTEST")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "wham.yaml")
+	config := `
+wham_settings:
+  data_dir: "data"
+  metadata_dir: "metadata"
+  metadata_prefix: "wham_"
+  metadata_suffix: ".state"
+  state_backend:
+    type: "s3"
+    bucket: "states"
+    prefix: "ci/"
+    endpoint: "` + server.URL + `"
+wham_steps:
+- name: "extract"
+  command: ["/bin/sh", "-c", "echo extracting"]
+  previous_steps: []
+`
+	assert.NoError(t, os.WriteFile(configPath, []byte(config), 0644))
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.NoError(t, err, outputStr)
+	mu.Lock()
+	assert.Contains(t, string(objects["/states/ci/wham_extract.state"]), `"run_action": "run"`)
+	mu.Unlock()
+	assert.NoFileExists(t, filepath.Join(dir, "metadata", "wham_extract.state"), "The state should not be kept in the metadata directory.")
+
+	var state TestStepState
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "get", "extract", "-o", "json")
+	assert.NoError(t, err, outputStr)
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &state))
+	assert.Equal(t, "run", state.RunAction, "The state should be read from the bucket.")
+
+	mu.Lock()
+	objects["/states/ci/wham_removed.state"] = objects["/states/ci/wham_extract.state"]
+	mu.Unlock()
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "prune", "--yes", "-o", "json")
+	assert.NoError(t, err, outputStr)
+	assert.Contains(t, outputStr, `"location": "s3://states/ci/wham_removed.state"`, "The state of the removed step should be listed from the bucket.")
+	mu.Lock()
+	assert.NotContains(t, objects, "/states/ci/wham_removed.state")
+	assert.Contains(t, objects, "/states/ci/wham_extract.state")
+	mu.Unlock()
+
+	var result TestDeletionResult
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "delete", "extract", "--yes", "-o", "json")
+	assert.NoError(t, err, outputStr)
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &result))
+	assert.Equal(t, "deleted", result.Status)
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "delete", "extract", "--yes", "-o", "json")
+	assert.NoError(t, err, outputStr)
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &result))
+	assert.Equal(t, "already_clean", result.Status)
+}
+
+// TestState_S3Credentials verifies that the requests of an S3 state backend are
+// signed with the credentials found by the default chain of the AWS SDK, beyond
+// the environment variables: a profile of the shared credentials file, a web
+// identity token exchanged with STS, and the instance profile, through IMDSv2.
+func TestState_S3Credentials(t *testing.T) {
+	runWithS3 := func(t *testing.T, server *fakeS3) {
+		t.Helper()
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "wham.yaml")
+		config := "wham_settings:\n  data_dir: data\n  metadata_dir: metadata\n  metadata_prefix: wham_\n  metadata_suffix: .state\n" +
+			"  state_backend:\n    type: s3\n    bucket: states\n    endpoint: " + server.URL + "\n" +
+			"wham_steps:\n- name: extract\n  command: [\"/bin/true\"]\n  previous_steps: []\n"
+		assert.NoError(t, os.WriteFile(configPath, []byte(config), 0644))
+		outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all")
+		assert.NoError(t, err, outputStr)
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		assert.Contains(t, server.objects, "/states/wham_extract.state")
+	}
+
+	t.Run("SharedCredentialsFile", func(t *testing.T) {
+		server := startFakeS3(t, "AKIDPROFILE", "")
+		isolateAWSEnv(t)
+		credentials := filepath.Join(t.TempDir(), "credentials")
+		assert.NoError(t, os.WriteFile(credentials, []byte("[ci]\naws_access_key_id = AKIDPROFILE\naws_secret_access_key = secret\n"), 0600))
+		t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentials)
+		t.Setenv("AWS_PROFILE", "ci")
+		runWithS3(t, server)
+	})
+
+	t.Run("WebIdentity", func(t *testing.T) {
+		server := startFakeS3(t, "AKIDWEB", "web-session")
+		sts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			if r.Form.Get("Action") != "AssumeRoleWithWebIdentity" || r.Form.Get("WebIdentityToken") != "service-account-token" {
+				http.Error(rw, "unexpected request", http.StatusBadRequest)
+				return
+			}
+			rw.Header().Set("Content-Type", "text/xml")
+			fmt.Fprint(rw, `<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><AssumeRoleWithWebIdentityResult>`+
+				`<Credentials><AccessKeyId>AKIDWEB</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>web-session</SessionToken><Expiration>2099-01-01T00:00:00Z</Expiration></Credentials>`+
+				`<AssumedRoleUser><Arn>arn:aws:sts::123456789012:assumed-role/ci/wham</Arn><AssumedRoleId>AROA:wham</AssumedRoleId></AssumedRoleUser>`+
+				`</AssumeRoleWithWebIdentityResult><ResponseMetadata><RequestId>1</RequestId></ResponseMetadata></AssumeRoleWithWebIdentityResponse>`)
+		}))
+		defer sts.Close()
+		isolateAWSEnv(t)
+		token := filepath.Join(t.TempDir(), "token")
+		assert.NoError(t, os.WriteFile(token, []byte("service-account-token"), 0600))
+		t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", token)
+		t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/ci")
+		t.Setenv("AWS_ENDPOINT_URL_STS", sts.URL)
+		runWithS3(t, server)
+	})
+
+	t.Run("InstanceProfile", func(t *testing.T) {
+		server := startFakeS3(t, "AKIDIMDS", "imds-session")
+		imds := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPut && r.URL.Path == "/latest/api/token" {
+				rw.Header().Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+				fmt.Fprint(rw, "imds-v2-token")
+				return
+			}
+			if r.Header.Get("X-Aws-Ec2-Metadata-Token") != "imds-v2-token" {
+				http.Error(rw, "IMDSv2 token required", http.StatusUnauthorized)
+				return
+			}
+			switch r.URL.Path {
+			case "/latest/meta-data/iam/security-credentials/":
+				fmt.Fprint(rw, "wham-role")
+			case "/latest/meta-data/iam/security-credentials/wham-role":
+				fmt.Fprint(rw, `{"Code": "Success", "Type": "AWS-HMAC", "AccessKeyId": "AKIDIMDS", "SecretAccessKey": "secret", "Token": "imds-session", "Expiration": "2099-01-01T00:00:00Z"}`)
+			default:
+				http.NotFound(rw, r)
+			}
+		}))
+		defer imds.Close()
+		isolateAWSEnv(t)
+		t.Setenv("AWS_EC2_METADATA_DISABLED", "false")
+		t.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", imds.URL)
+		runWithS3(t, server)
+	})
+}
+
+// fakeS3 is a fake S3 service, keeping the objects by path ("/<bucket>/<key>").
+type fakeS3 struct {
+	*httptest.Server
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+// startFakeS3 starts a fake S3 service, which checks that the requests are signed
+// with the access key ID and, if set, the session token.
+func startFakeS3(t *testing.T, accessKeyID, sessionToken string) *fakeS3 {
+	t.Helper()
+	s3 := &fakeS3{objects: make(map[string][]byte)}
+	s3.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="+accessKeyID+"/"), r.Header.Get("Authorization"))
+		assert.Equal(t, sessionToken, r.Header.Get("X-Amz-Security-Token"))
+		body, _ := io.ReadAll(r.Body)
+		hash := sha256.Sum256(body)
+		assert.Equal(t, hex.EncodeToString(hash[:]), r.Header.Get("X-Amz-Content-Sha256"))
+		s3.mu.Lock()
+		defer s3.mu.Unlock()
+		if r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2" {
+			prefix := "/states/" + r.URL.Query().Get("prefix")
+			fmt.Fprint(rw, "<ListBucketResult>")
+			for path := range s3.objects {
+				if strings.HasPrefix(path, prefix) {
+					fmt.Fprintf(rw, "<Contents><Key>%s</Key></Contents>", strings.TrimPrefix(path, "/states/"))
+				}
+			}
+			fmt.Fprint(rw, "<IsTruncated>false</IsTruncated></ListBucketResult>")
+			return
+		}
+		data, ok := s3.objects[r.URL.Path]
+		switch r.Method {
+		case http.MethodPut:
+			s3.objects[r.URL.Path] = body
+		case http.MethodDelete:
+			delete(s3.objects, r.URL.Path)
+			rw.WriteHeader(http.StatusNoContent)
+		case http.MethodGet, http.MethodHead:
+			if !ok {
+				http.NotFound(rw, r)
+				return
+			}
+			rw.Write(data)
+		}
+	}))
+	t.Cleanup(s3.Close)
+	return s3
+}
+
+// isolateAWSEnv clears the AWS credentials and configuration of the environment,
+// and disables the instance metadata service, so that a test only finds the
+// credentials it sets.
+func isolateAWSEnv(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE", "AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_ROLE_ARN", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+}
+
+// TestState_PostgresBackend verifies that, with a PostgreSQL state backend, the
+// WHAM states of the steps are kept as rows of the table, with their run_id and
+// action in columns, rather than in the metadata directory. The server is a fake
+// speaking just enough of the PostgreSQL protocol, with SCRAM-SHA-256
+// authentication (see startFakePostgres).
+func TestState_PostgresBackend(t *testing.T) {
+	server := startFakePostgres(t, "wham", "secret")
+	mu, rows := &server.mu, server.rows
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "nightly.yaml")
+	config := `
+wham_settings:
+  data_dir: "data"
+  metadata_dir: "metadata"
+  metadata_prefix: "wham_"
+  metadata_suffix: ".state"
+  state_backend:
+    type: "postgres"
+    dsn: "postgres://wham:{{ require_env \"WHAM_TEST_PG_PASSWORD\" }}@` + server.addr + `/ops?sslmode=disable"
+wham_steps:
+- name: "extract"
+  command: ["/bin/sh", "-c", "echo extracting"]
+  previous_steps: []
+`
+	assert.NoError(t, os.WriteFile(configPath, []byte(config), 0644))
+	t.Setenv("WHAM_TEST_PG_PASSWORD", "secret")
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.NoError(t, err, outputStr)
+	mu.Lock()
+	row := rows["nightly/extract"]
+	assert.Len(t, row, 7, "The row should hold the workflow, step, run_id, action, elapsed time, run date and state.")
+	if len(row) == 7 {
+		assert.Equal(t, "run", row[3])
+		assert.Contains(t, row[6], `"run_action": "run"`)
+	}
+	queries := strings.Join(server.queries, "\n")
+	assert.Contains(t, queries, "CREATE TABLE IF NOT EXISTS wham_step_states")
+	assert.Contains(t, queries, "WHERE workflow = $1 AND step = $2", "The queries should be parameterized.")
+	mu.Unlock()
+	assert.NoFileExists(t, filepath.Join(dir, "metadata", "wham_extract.state"), "The state should not be kept in the metadata directory.")
+
+	var state TestStepState
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "get", "extract", "-o", "json")
+	assert.NoError(t, err, outputStr)
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &state))
+	assert.Equal(t, "run", state.RunAction, "The state should be read from the table.")
+
+	var result TestDeletionResult
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "delete", "extract", "--yes", "-o", "json")
+	assert.NoError(t, err, outputStr)
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &result))
+	assert.Equal(t, "deleted", result.Status)
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "delete", "extract", "--yes", "-o", "json")
+	assert.NoError(t, err, outputStr)
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &result))
+	assert.Equal(t, "already_clean", result.Status)
+
+	t.Setenv("WHAM_TEST_PG_PASSWORD", "wrong")
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "delete", "extract", "--yes", "-o", "json")
+	assert.NoError(t, err, outputStr)
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &result))
+	assert.Equal(t, "error", result.Status)
+	assert.Contains(t, result.Message, "password authentication failed", "A wrong password should fail the SCRAM authentication.")
+}
+
+// fakePostgres is a fake PostgreSQL server, recording the rows upserted by the
+// state store, by "workflow/step", as the values of their parameters.
+type fakePostgres struct {
+	addr    string
+	mu      sync.Mutex
+	rows    map[string][]string
+	queries []string
+}
+
+// startFakePostgres starts a fake PostgreSQL server authenticating `user` with
+// SCRAM-SHA-256 and `password`, and answering the queries of the state store
+// with the extended protocol.
+func startFakePostgres(t *testing.T, user, password string) *fakePostgres {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	server := &fakePostgres{addr: listener.Addr().String(), rows: make(map[string][]string)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				backend := pgproto3.NewBackend(conn, conn)
+				if !fakePostgresStartup(backend, user, password) {
+					return
+				}
+				server.serve(backend)
+			}()
+		}
+	}()
+	return server
+}
+
+// fakePostgresStartup authenticates the client with SCRAM-SHA-256, and reports
+// whether it succeeded.
+func fakePostgresStartup(backend *pgproto3.Backend, user, password string) bool {
+	startup, err := backend.ReceiveStartupMessage()
+	if err != nil {
+		return false
+	}
+	if message, ok := startup.(*pgproto3.StartupMessage); !ok || message.Parameters["user"] != user {
+		return false
+	}
+	fail := func() bool {
+		backend.Send(&pgproto3.ErrorResponse{Severity: "FATAL", Code: "28P01", Message: "password authentication failed"})
+		backend.Flush()
+		return false
+	}
+
+	backend.Send(&pgproto3.AuthenticationSASL{AuthMechanisms: []string{"SCRAM-SHA-256"}})
+	backend.Flush()
+	backend.SetAuthType(pgproto3.AuthTypeSASL)
+	message, err := backend.Receive()
+	initial, ok := message.(*pgproto3.SASLInitialResponse)
+	if err != nil || !ok {
+		return false
+	}
+	clientFirstBare := strings.TrimPrefix(string(initial.Data), "n,,")
+	clientNonce := strings.TrimPrefix(clientFirstBare[strings.Index(clientFirstBare, "r="):], "r=")
+	salt, iterations := []byte("fake-salt"), 4096
+	serverFirst := fmt.Sprintf("r=%sserver-nonce,s=%s,i=%d", clientNonce, base64.StdEncoding.EncodeToString(salt), iterations)
+	backend.Send(&pgproto3.AuthenticationSASLContinue{Data: []byte(serverFirst)})
+	backend.Flush()
+
+	backend.SetAuthType(pgproto3.AuthTypeSASLContinue)
+	message, err = backend.Receive()
+	response, ok := message.(*pgproto3.SASLResponse)
+	if err != nil || !ok {
+		return false
+	}
+	clientFinal := string(response.Data)
+	proofAt := strings.LastIndex(clientFinal, ",p=")
+	if proofAt < 0 {
+		return fail()
+	}
+	proof, err := base64.StdEncoding.DecodeString(clientFinal[proofAt+3:])
+	if err != nil {
+		return fail()
+	}
+	hmacSHA256 := func(key []byte, data string) []byte {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(data))
+		return h.Sum(nil)
+	}
+	saltedPassword, _ := pbkdf2.Key(sha256.New, password, salt, iterations, 32)
+	clientKey := hmacSHA256(saltedPassword, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	authMessage := clientFirstBare + "," + serverFirst + "," + clientFinal[:proofAt]
+	expected := hmacSHA256(storedKey[:], authMessage)
+	for i := range expected {
+		expected[i] ^= clientKey[i]
+	}
+	if !hmac.Equal(proof, expected) {
+		return fail()
+	}
+	serverSignature := hmacSHA256(hmacSHA256(saltedPassword, "Server Key"), authMessage)
+	backend.Send(&pgproto3.AuthenticationSASLFinal{Data: []byte("v=" + base64.StdEncoding.EncodeToString(serverSignature))})
+	backend.Send(&pgproto3.AuthenticationOk{})
+	backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	return backend.Flush() == nil
+}
+
+// serve answers the queries of an authenticated client until it terminates.
+func (s *fakePostgres) serve(backend *pgproto3.Backend) {
+	var query string
+	var params []string
+	for {
+		message, err := backend.Receive()
+		if err != nil {
+			return
+		}
+		switch m := message.(type) {
+		case *pgproto3.Query: // The simple protocol, e.g. for BEGIN or pings.
+			s.mu.Lock()
+			s.queries = append(s.queries, m.String)
+			s.mu.Unlock()
+			if strings.HasPrefix(m.String, "--") {
+				backend.Send(&pgproto3.EmptyQueryResponse{})
+			} else {
+				backend.Send(&pgproto3.CommandComplete{CommandTag: []byte(strings.ToUpper(strings.Fields(m.String)[0]))})
+			}
+			backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+			backend.Flush()
+		case *pgproto3.Parse:
+			query = m.Query
+			backend.Send(&pgproto3.ParseComplete{})
+		case *pgproto3.Bind:
+			params = nil
+			for _, param := range m.Parameters {
+				params = append(params, string(param))
+			}
+			backend.Send(&pgproto3.BindComplete{})
+		case *pgproto3.Describe:
+			switch {
+			case strings.HasPrefix(query, "SELECT state"):
+				backend.Send(&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{{Name: []byte("state"), DataTypeOID: 25, DataTypeSize: -1, TypeModifier: -1}}})
+			case strings.HasPrefix(query, "SELECT step"):
+				backend.Send(&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{{Name: []byte("step"), DataTypeOID: 25, DataTypeSize: -1, TypeModifier: -1}}})
+			default:
+				backend.Send(&pgproto3.NoData{})
+			}
+		case *pgproto3.Execute:
+			backend.Send(&pgproto3.CommandComplete{CommandTag: []byte(s.execute(backend, query, params))})
+		case *pgproto3.Sync:
+			backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+			backend.Flush()
+		case *pgproto3.Terminate:
+			return
+		}
+	}
+}
+
+// execute runs a query of the state store on the rows, sending the rows it
+// returns, and returns its command tag.
+func (s *fakePostgres) execute(backend *pgproto3.Backend, query string, params []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queries = append(s.queries, query)
+	switch {
+	case strings.HasPrefix(query, "INSERT"):
+		s.rows[params[0]+"/"+params[1]] = params
+		return "INSERT 0 1"
+	case strings.HasPrefix(query, "SELECT state"):
+		row, ok := s.rows[params[0]+"/"+params[1]]
+		if !ok {
+			return "SELECT 0"
+		}
+		backend.Send(&pgproto3.DataRow{Values: [][]byte{[]byte(row[len(row)-1])}})
+		return "SELECT 1"
+	case strings.HasPrefix(query, "SELECT step"):
+		var steps []string
+		for key := range s.rows {
+			if workflow, step, _ := strings.Cut(key, "/"); workflow == params[0] {
+				steps = append(steps, step)
+			}
+		}
+		slices.Sort(steps)
+		for _, step := range steps {
+			backend.Send(&pgproto3.DataRow{Values: [][]byte{[]byte(step)}})
+		}
+		return fmt.Sprintf("SELECT %d", len(steps))
+	case strings.HasPrefix(query, "DELETE"):
+		if _, ok := s.rows[params[0]+"/"+params[1]]; !ok {
+			return "DELETE 0"
+		}
+		delete(s.rows, params[0]+"/"+params[1])
+		return "DELETE 1"
+	default:
+		return "CREATE TABLE"
+	}
+}
+
+// TestState_Selectors verifies that `state get all`, `state delete all` and
+// `validate all` only act on the steps matching --owner and --tag.
+func TestState_Selectors(t *testing.T) {
+	const configPath = "../test/settings/settings_selectors.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	_, err := runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.NoError(t, err, "Initial 'run all' should succeed.")
+
+	stepNames := func(outputStr string) []string {
+		var states []TestStepState
+		assert.NoError(t, json.Unmarshal([]byte(outputStr), &states))
+		var names []string
+		for _, state := range states {
+			names = append(names, state.StepName)
+		}
+		return names
+	}
+	outputStr, err := runWhamCommand(t, "--config", configPath, "state", "get", "all", "--owner", "team-data", "-o", "json")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"extract_orders", "extract_customers"}, stepNames(outputStr))
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "get", "all", "--tag", "etl", "--tag", "orders", "-o", "json")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"extract_orders"}, stepNames(outputStr), "A step should have all the tags to be selected.")
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "step", "validate", "all", "--tag", "etl", "-o", "json")
+	assert.NoError(t, err)
+	var validations []TestValidationResult
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &validations))
+	assert.Len(t, validations, 2)
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "delete", "all", "--owner", "team-data", "--cascade", "--yes", "-o", "json")
+	assert.NoError(t, err)
+	var results []TestDeletionResult
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &results))
+	deleted := make(map[string]string)
+	for _, res := range results {
+		deleted[res.StepName] = res.Status
+	}
+	assert.Equal(t, map[string]string{"extract_orders": "deleted", "extract_customers": "deleted", "report": "deleted"}, deleted, "The selected steps and their descendants should be deleted.")
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "get", "all", "--owner", "nobody")
+	assert.Error(t, err, "A selection matching no step should fail.")
+	assert.Contains(t, outputStr, "no step matches owner 'nobody'")
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "delete", "report", "--tag", "reporting", "--yes")
+	assert.Error(t, err)
+	assert.Contains(t, outputStr, "--owner and --tag flags can only be used with the 'all' target")
+}
+
+// TestState_History verifies that the latest states of a step are kept in its
+// history, up to history_limit, and that describe tells when a failing step last
+// succeeded.
+func TestState_History(t *testing.T) {
+	const configPath = "../test/settings/settings_history.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	historyActions := func() []string {
+		data, err := os.ReadFile("../test/states/metadata/wham_history/flaky.json")
+		assert.NoError(t, err)
+		var history []TestStepState
+		assert.NoError(t, json.Unmarshal(data, &history))
+		var actions []string
+		for _, state := range history {
+			actions = append(actions, state.RunAction)
+		}
+		return actions
+	}
+
+	for _, exitStatus := range []string{"success", "fail", "fail"} {
+		t.Setenv("TEST_EXIT_STATUS", exitStatus)
+		_, err := runWhamCommand(t, "--config", configPath, "run", "flaky")
+		assert.NoError(t, err, "The failing step can fail.")
+	}
+	assert.Equal(t, []string{"run", "failed", "failed"}, historyActions())
+	outputStr, err := runWhamCommand(t, "--config", configPath, "describe", "flaky")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "Last Success", "describe should tell when the failing step last succeeded.")
+
+	_, err = runWhamCommand(t, "--config", configPath, "run", "flaky")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"failed", "failed", "failed"}, historyActions(), "The oldest state should be dropped beyond history_limit.")
+	outputStr, err = runWhamCommand(t, "--config", configPath, "describe", "flaky")
+	assert.NoError(t, err)
+	assert.NotContains(t, outputStr, "Last Success", "The success is no longer in the history.")
+}
+
+// TestState_HistoryCommand verifies that `state history` lists the executions of a
+// step kept in its history, most recent first.
+func TestState_HistoryCommand(t *testing.T) {
+	const configPath = "../test/settings/settings_history.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "state", "history", "flaky")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "No history for step 'flaky' yet.")
+
+	for _, exitStatus := range []string{"success", "fail"} {
+		t.Setenv("TEST_EXIT_STATUS", exitStatus)
+		_, err := runWhamCommand(t, "--config", configPath, "run", "flaky")
+		assert.NoError(t, err, "The failing step can fail.")
+	}
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "history", "flaky", "-o", "json")
+	assert.NoError(t, err)
+	var history []TestStepState
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &history), outputStr)
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, "failed", history[0].RunAction, "The most recent execution should come first.")
+		assert.Equal(t, "run", history[1].RunAction)
+	}
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "history", "flaky")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "RUN DATE")
+	assert.Contains(t, outputStr, "failed")
+
+	_, err = runWhamCommand(t, "--config", configPath, "state", "history", "missing")
+	assert.Error(t, err, "An unknown step should be reported.")
+}
+
+// TestState_Diff verifies that `state diff` lists the steps whose state changed
+// since the previous workflow run, or between two workflow runs.
+func TestState_Diff(t *testing.T) {
+	const configPath = "../test/settings/settings_history.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	_, err := runWhamCommand(t, "--config", configPath, "state", "diff")
+	assert.Error(t, err, "Without two workflow runs, there is nothing to compare.")
+
+	for _, exitStatus := range []string{"success", "fail"} {
+		t.Setenv("TEST_EXIT_STATUS", exitStatus)
+		_, err := runWhamCommand(t, "--config", configPath, "run", "all")
+		assert.NoError(t, err, "The failing step can fail.")
+	}
+	entries, err := os.ReadDir("../test/states/metadata/wham_runs")
+	assert.NoError(t, err)
+	if !assert.Len(t, entries, 2) {
+		return
+	}
+	firstRunID := strings.TrimSuffix(entries[0].Name(), ".json")
+	secondRunID := strings.TrimSuffix(entries[1].Name(), ".json")
+
+	type stateDiff struct {
+		From  string `json:"from"`
+		To    string `json:"to"`
+		Steps []struct {
+			StepName string        `json:"step_name"`
+			Changes  []string      `json:"changes"`
+			Before   TestStepState `json:"before"`
+			After    TestStepState `json:"after"`
+		} `json:"steps"`
+	}
+	diffOf := func(args ...string) stateDiff {
+		outputStr, err := runWhamCommand(t, append([]string{"--config", configPath, "state", "diff", "-o", "json"}, args...)...)
+		assert.NoError(t, err, outputStr)
+		var diff stateDiff
+		assert.NoError(t, json.Unmarshal([]byte(outputStr), &diff), outputStr)
+		return diff
+	}
+
+	diff := diffOf()
+	assert.Equal(t, firstRunID, diff.From, "The current states should be compared with the previous workflow run.")
+	if assert.Len(t, diff.Steps, 1) {
+		assert.Equal(t, "flaky", diff.Steps[0].StepName)
+		assert.Contains(t, diff.Steps[0].Changes, "action")
+		assert.Equal(t, "run", diff.Steps[0].Before.RunAction)
+		assert.Equal(t, "failed", diff.Steps[0].After.RunAction)
+	}
+	diff = diffOf(firstRunID, secondRunID)
+	assert.Equal(t, secondRunID, diff.To)
+	assert.Len(t, diff.Steps, 1, "Two explicit workflow runs should be compared.")
+	assert.Empty(t, diffOf(secondRunID).Steps, "Nothing changed since the last workflow run.")
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "state", "diff")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "run → failed")
+}
+
+// TestState_ExportImport verifies that `state import` restores the state written
+// by `state export`, including the state files of the stateful steps.
+func TestState_ExportImport(t *testing.T) {
+	const configPath = "../test/settings/settings_ok.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	_, err := runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.NoError(t, err)
+	statesBefore, err := runWhamCommand(t, "--config", configPath, "state", "get", "all", "-o", "json")
+	assert.NoError(t, err)
+
+	bundlePath := filepath.Join(t.TempDir(), "state.tar.gz")
+	outputStr, err := runWhamCommand(t, "--config", configPath, "state", "export", "--out", bundlePath, "--state-files")
+	assert.NoError(t, err, outputStr)
+	assert.Contains(t, outputStr, "exported to")
+
+	cleanTestStates(t, configPath)
+	_, err = runWhamCommand(t, "--non-interactive", "--config", configPath, "state", "import", bundlePath)
+	assert.Error(t, err, "An import should require --yes in non-interactive mode.")
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "import", bundlePath, "--yes")
+	assert.NoError(t, err, outputStr)
+	statesAfter, err := runWhamCommand(t, "--config", configPath, "state", "get", "all", "-o", "json")
+	assert.NoError(t, err)
+	assert.JSONEq(t, statesBefore, statesAfter, "The imported states should be the exported ones.")
+	_, err = os.Stat("../test/states/metadata/stateful_sh_succeed.state")
+	assert.NoError(t, err, "The state file of the stateful step should be imported.")
+
+	notABundle := filepath.Join(t.TempDir(), "not_a_bundle.tar.gz")
+	assert.NoError(t, os.WriteFile(notABundle, []byte("garbage"), 0644))
+	_, err = runWhamCommand(t, "--config", configPath, "state", "import", notABundle, "--yes")
+	assert.Error(t, err, "An invalid bundle should be rejected.")
+}
+
+// TestState_Prune verifies that `state prune` removes the state, history and other
+// metadata of the steps no longer in the configuration, and trims the histories
+// beyond history_limit, while --dry-run only lists them.
+func TestState_Prune(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "wham.yaml")
+	writeConfig := func(historyLimit int, steps ...string) {
+		config := fmt.Sprintf("wham_settings:\n  data_dir: data\n  metadata_dir: metadata\n  metadata_prefix: wham_\n  metadata_suffix: .state\n  history_limit: %d\nwham_steps:\n", historyLimit)
+		for _, step := range steps {
+			config += "- name: " + step + "\n  command: [\"/bin/true\"]\n  previous_steps: []\n"
+		}
+		assert.NoError(t, os.WriteFile(configPath, []byte(config), 0644))
+	}
+	metadataDir := filepath.Join(dir, "metadata")
+
+	writeConfig(5, "extract", "legacy")
+	for range 3 {
+		outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "--force")
+		assert.NoError(t, err, outputStr)
+	}
+	notes := filepath.Join(metadataDir, "wham_notes.state")
+	assert.NoError(t, os.WriteFile(notes, []byte(`{"run_id": "not a WHAM state"}`), 0644))
+
+	writeConfig(2, "extract")
+	var pruned []struct {
+		StepName string `json:"step_name"`
+		Kind     string `json:"kind"`
+		Detail   string `json:"detail"`
+	}
+	outputStr, err := runWhamCommand(t, "--config", configPath, "state", "prune", "--dry-run", "-o", "json")
+	assert.NoError(t, err, outputStr)
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &pruned))
+	if assert.Len(t, pruned, 3) {
+		assert.Equal(t, "extract", pruned[0].StepName)
+		assert.Equal(t, "history", pruned[0].Kind)
+		assert.Contains(t, pruned[0].Detail, "1 state(s) beyond history_limit (2)")
+		assert.Equal(t, "legacy", pruned[1].StepName)
+		assert.Equal(t, "history", pruned[1].Kind)
+		assert.Equal(t, "legacy", pruned[2].StepName)
+		assert.Equal(t, "state", pruned[2].Kind)
+	}
+	assert.FileExists(t, filepath.Join(metadataDir, "wham_legacy.state"), "--dry-run should not remove anything.")
+
+	outputStr, err = runWhamCommand(t, "--non-interactive", "--config", configPath, "state", "prune")
+	assert.Error(t, err)
+	assert.Contains(t, outputStr, "requires --yes in non-interactive mode")
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "prune", "--yes")
+	assert.NoError(t, err, outputStr)
+	assert.Contains(t, outputStr, "Pruned 3 item(s).")
+	assert.NoFileExists(t, filepath.Join(metadataDir, "wham_legacy.state"))
+	assert.NoFileExists(t, filepath.Join(metadataDir, "wham_history", "legacy.json"))
+	assert.FileExists(t, filepath.Join(metadataDir, "wham_extract.state"))
+	assert.FileExists(t, notes, "A file that is not a WHAM state should be kept.")
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "history", "extract", "-o", "json")
+	assert.NoError(t, err, outputStr)
+	var history []TestStepState
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &history))
+	assert.Len(t, history, 2, "The history should be trimmed to history_limit.")
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "prune", "--yes")
+	assert.NoError(t, err, outputStr)
+	assert.Contains(t, outputStr, "Nothing to prune.")
+}
+
+// TestState_Migrate verifies that `state migrate` rewrites the states and histories
+// written before schema versioning, and that a state written with a newer schema
+// is refused rather than parsed partially.
+func TestState_Migrate(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "wham.yaml")
+	config := "wham_settings:\n  data_dir: data\n  metadata_dir: metadata\n  metadata_prefix: wham_\n  metadata_suffix: .state\n  history_limit: 5\nwham_steps:\n- name: extract\n  command: [\"/bin/true\"]\n  previous_steps: []\n"
+	assert.NoError(t, os.WriteFile(configPath, []byte(config), 0644))
+	metadataDir := filepath.Join(dir, "metadata")
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.NoError(t, err, outputStr)
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "migrate")
+	assert.NoError(t, err, outputStr)
+	assert.Contains(t, outputStr, "All states are at schema version 1.")
+
+	// States written before run_id_date and schema_version were recorded.
+	const legacy = `{"run_id": "abc", "run_date": "2026-01-02T03:04:05Z", "run_action": "run", "elapsed": 1500000000}`
+	statePath := filepath.Join(metadataDir, "wham_extract.state")
+	assert.NoError(t, os.WriteFile(statePath, []byte(legacy), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(metadataDir, "wham_legacy.state"), []byte(legacy), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(metadataDir, "wham_history", "extract.json"), []byte("["+legacy+"]"), 0644))
+	notes := filepath.Join(metadataDir, "wham_notes.state")
+	assert.NoError(t, os.WriteFile(notes, []byte(`{"run_id": "not a WHAM state"}`), 0644))
+
+	var migrated []struct {
+		StepName    string `json:"step_name"`
+		Kind        string `json:"kind"`
+		FromVersion int    `json:"from_version"`
+		ToVersion   int    `json:"to_version"`
+	}
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "migrate", "--dry-run", "-o", "json")
+	assert.NoError(t, err, outputStr)
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &migrated))
+	if assert.Len(t, migrated, 3) {
+		assert.Equal(t, "extract", migrated[0].StepName)
+		assert.Equal(t, "history", migrated[0].Kind)
+		assert.Equal(t, "extract", migrated[1].StepName)
+		assert.Equal(t, "state", migrated[1].Kind)
+		assert.Equal(t, "legacy", migrated[2].StepName)
+		assert.Equal(t, 0, migrated[2].FromVersion)
+		assert.Equal(t, 1, migrated[2].ToVersion)
+	}
+	data, err := os.ReadFile(statePath)
+	assert.NoError(t, err)
+	assert.Equal(t, legacy, string(data), "--dry-run should not rewrite anything.")
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "migrate")
+	assert.NoError(t, err, outputStr)
+	assert.Contains(t, outputStr, "Migrated 3 item(s) to schema version 1.")
+	var state map[string]any
+	data, err = os.ReadFile(statePath)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(data, &state))
+	assert.Equal(t, float64(1), state["schema_version"])
+	assert.Equal(t, "2026-01-02T03:04:05Z", state["run_id_date"], "The run_id date should be upgraded from the run date.")
+	assert.Equal(t, float64(1500000000), state["elapsed"])
+	data, err = os.ReadFile(notes)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"run_id": "not a WHAM state"}`, string(data), "A file that is not a WHAM state should be kept.")
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "migrate", "-o", "json")
+	assert.NoError(t, err, outputStr)
+	assert.JSONEq(t, "[]", outputStr)
+
+	assert.NoError(t, os.WriteFile(statePath, []byte(`{"run_id": "abc", "run_action": "run", "schema_version": 99}`), 0644))
+	outputStr, err = runWhamCommand(t, "--config", configPath, "run", "extract")
+	assert.Error(t, err, outputStr)
+	assert.Contains(t, outputStr, "was written by a newer WHAM than this one")
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "migrate")
+	assert.Error(t, err, outputStr)
+	assert.Contains(t, outputStr, "state written with a newer schema (version 99, this WHAM knows up to 1)")
+}
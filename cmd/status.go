@@ -0,0 +1,12 @@
+package cmd
+
+// Status-related concrete command structs
+
+// StatusCmd handles the 'status' command.
+type StatusCmd struct{}
+
+// Status-related command implementations
+
+func (s *StatusCmd) Run(ctx *Context) error {
+	return ctx.WHAM.ShowStatus(ctx.OutputFormat)
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// maxDumpedRetries is the number of recent retries kept for the status dump.
+const maxDumpedRetries = 10
+
+// retryRecord is a retry of a step, kept for the status dump.
+type retryRecord struct {
+	step    string
+	attempt int
+	at      time.Time
+	// err is the failure of the previous attempt.
+	err string
+}
+
+// startStatusDump makes the execution being inspected dump its status to stderr
+// whenever WHAM receives SIGUSR1 (see dumpStatus), and returns a function that
+// stops trapping the signal.
+func (w *WHAM) startStatusDump(insp *inspection) (stop func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-signals:
+				w.dumpStatus(os.Stderr, insp)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// dumpStatus writes the status of an inspected execution: the steps running and
+// for how long, the steps queued, in execution order, and the latest retries.
+func (w *WHAM) dumpStatus(out io.Writer, insp *inspection) {
+	insp.mu.Lock()
+	progress := insp.progress
+	now := time.Now()
+	var running, queued []string
+	for _, name := range progress.CurrentSteps {
+		running = append(running, fmt.Sprintf("%s (%s)", name, now.Sub(insp.stepStarts[name]).Round(time.Second)))
+	}
+	for _, name := range insp.planned {
+		if !insp.finished[name] && !slices.Contains(progress.CurrentSteps, name) {
+			queued = append(queued, name)
+		}
+	}
+	retries := slices.Clone(insp.retries)
+	insp.mu.Unlock()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n📋 WHAM status (PID %d", progress.PID)
+	if progress.WorkflowRunID != "" {
+		fmt.Fprintf(&b, ", workflow run '%s'", progress.WorkflowRunID)
+	}
+	fmt.Fprintf(&b, "), running for %s\n", now.Sub(progress.StartedAt).Round(time.Second))
+	fmt.Fprintf(&b, "  Steps done: %d/%d\n", progress.StepsDone, progress.StepsTotal)
+	fmt.Fprintf(&b, "  Running: %s\n", cmp.Or(strings.Join(running, ", "), "none"))
+	fmt.Fprintf(&b, "  Queued (%d): %s\n", len(queued), cmp.Or(strings.Join(queued, ", "), "none"))
+	if len(retries) == 0 {
+		b.WriteString("  Recent retries: none\n")
+	} else {
+		b.WriteString("  Recent retries:\n")
+	}
+	for _, retry := range retries {
+		fmt.Fprintf(&b, "    %s '%s' attempt %d after: %s\n", retry.at.Format(time.TimeOnly), retry.step, retry.attempt+1, retry.err)
+	}
+	fmt.Fprint(out, b.String())
+	w.logger.Info().Strs("running", progress.CurrentSteps).Int("queued", len(queued)).Int("retries", len(retries)).Msg("Status dumped on SIGUSR1.")
+}
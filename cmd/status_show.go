@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// StatusReport is the operational snapshot of a workflow shown by `wham status`.
+type StatusReport struct {
+	// Running lists the WHAM processes currently running against the metadata directory.
+	Running []RunProgress `json:"running" yaml:"running"`
+	// Detached lists the runs started with `run all --detach` that are still running.
+	Detached []DetachedRun `json:"detached" yaml:"detached"`
+	// LastRun is the most recent finished workflow run, if any.
+	LastRun *WorkflowRun `json:"last_run,omitempty" yaml:"last_run,omitempty"`
+	// FailedSteps lists the steps whose last recorded action is "failed".
+	FailedSteps []string `json:"failed_steps" yaml:"failed_steps"`
+	// WarningSteps lists the steps whose last execution recorded warnings.
+	WarningSteps []string `json:"warning_steps" yaml:"warning_steps"`
+	// StaleSteps lists the steps whose predecessors changed since they last ran,
+	// i.e. the steps that the next `run all` would execute.
+	StaleSteps []string `json:"stale_steps" yaml:"stale_steps"`
+	// StateBackend reports whether WHAM can persist state.
+	StateBackend StateBackendHealth `json:"state_backend" yaml:"state_backend"`
+}
+
+// StateBackendHealth reports the health of the storage holding the WHAM state files.
+type StateBackendHealth struct {
+	// Path is the location of the state files (by default, the metadata directory).
+	Path string `json:"path" yaml:"path"`
+	// Healthy is true if state files can be written.
+	Healthy bool `json:"healthy" yaml:"healthy"`
+	// Error explains why the backend is not healthy.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// ShowStatus displays an operational snapshot of the workflow, combining:
+//   - the WHAM processes currently running, as reported over their inspection
+//     sockets, with the steps each one is executing and its progress;
+//   - the detached runs still running, with their log files;
+//   - the outcome of the last finished workflow run;
+//   - the steps that failed, recorded warnings or are stale;
+//   - the health of the state backend.
+func (w *WHAM) ShowStatus(outputFormat string) error {
+	report, err := w.collectStatus()
+	if err != nil {
+		return err
+	}
+
+	switch outputFormat {
+	case "json", "yaml":
+		return RenderData(os.Stdout, report, outputFormat)
+	case "table", "wide":
+		return w.renderStatus(report)
+	default:
+		return fmt.Errorf("unsupported output format: '%s'", outputFormat)
+	}
+}
+
+// collectStatus gathers the information shown by ShowStatus.
+func (w *WHAM) collectStatus() (*StatusReport, error) {
+	running, err := w.queryRunningProcesses()
+	if err != nil {
+		return nil, err
+	}
+	detached, err := w.listDetachedRuns()
+	if err != nil {
+		return nil, err
+	}
+	lastRun, err := w.loadLastFinishedWorkflowRun()
+	if err != nil {
+		return nil, err
+	}
+	report := &StatusReport{
+		Running:      running,
+		Detached:     detached,
+		LastRun:      lastRun,
+		FailedSteps:  []string{},
+		WarningSteps: []string{},
+		StaleSteps:   []string{},
+		StateBackend: w.checkStateBackend(),
+	}
+	if report.Running == nil {
+		report.Running = []RunProgress{} // Render an empty list rather than null.
+	}
+	if report.Detached == nil {
+		report.Detached = []DetachedRun{}
+	}
+
+	sortedSteps, err := w.getTopologicalOrder()
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine step execution order: %w", err)
+	}
+	for _, step := range sortedSteps {
+		state := w.getCurrentStepWhamState(step.Name)
+		if state.RunAction == "failed" {
+			report.FailedSteps = append(report.FailedSteps, step.Name)
+		}
+		if len(state.Warnings) > 0 {
+			report.WarningSteps = append(report.WarningSteps, step.Name)
+		}
+		if w.isStepStale(step, state) {
+			report.StaleSteps = append(report.StaleSteps, step.Name)
+		}
+	}
+	return report, nil
+}
+
+// isStepStale reports whether a step inheriting its run_id from its predecessors
+// holds a different run_id than theirs, meaning it has not caught up with them yet.
+// Steps whose predecessors are not in a consistent state are not considered stale,
+// as they could not run anyway.
+func (w *WHAM) isStepStale(step *Step, state StepState) bool {
+	if producesOwnRunID(step) || len(step.PreviousSteps) == 0 {
+		return false
+	}
+	prevRunID, err := w.checkPreviousStepsConsistency(step.PreviousSteps)
+	if err != nil || prevRunID == "" {
+		return false
+	}
+	return prevRunID != state.RunID
+}
+
+// checkStateBackend verifies that the state store can be written: by default,
+// that the metadata directory exists and is writable.
+func (w *WHAM) checkStateBackend() StateBackendHealth {
+	health := StateBackendHealth{Path: w.stateStore.Location("")}
+	if err := w.stateStore.Check(); err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	health.Healthy = true
+	return health
+}
+
+// renderStatus prints a status report in a human-readable format.
+func (w *WHAM) renderStatus(report *StatusReport) error {
+	ew := &errorWriter{w: os.Stdout}
+	const keyFormat = "  %-18s: %s\n"
+
+	ew.Println("Running:")
+	if len(report.Running) == 0 {
+		ew.Println("  No WHAM process is running.")
+	} else {
+		tr := NewTableRenderer(ew.w, "PID", "WORKFLOW RUN", "CURRENT STEPS", "PROGRESS", "STARTED", "ELAPSED")
+		for _, p := range report.Running {
+			tr.AddRow(
+				fmt.Sprint(p.PID),
+				orDash(p.WorkflowRunID),
+				orDash(strings.Join(p.CurrentSteps, ", ")),
+				fmt.Sprintf("%d/%d", p.StepsDone, p.StepsTotal),
+				p.StartedAt.Format("2006-01-02 15:04:05"),
+				time.Since(p.StartedAt).Round(time.Second).String(),
+			)
+		}
+		if ew.err == nil {
+			ew.err = tr.Render()
+		}
+	}
+
+	if len(report.Detached) > 0 {
+		ew.Println("\nDetached Runs:")
+		tr := NewTableRenderer(ew.w, "PID", "STARTED", "ELAPSED", "LOG FILE")
+		for _, d := range report.Detached {
+			tr.AddRow(
+				fmt.Sprint(d.PID),
+				d.StartedAt.Format("2006-01-02 15:04:05"),
+				time.Since(d.StartedAt).Round(time.Second).String(),
+				d.LogFile,
+			)
+		}
+		if ew.err == nil {
+			ew.err = tr.Render()
+		}
+	}
+
+	ew.Println("\nLast Workflow Run:")
+	if report.LastRun == nil {
+		ew.Println("  <none>")
+	} else {
+		ew.Printf(keyFormat, "ID", report.LastRun.ID)
+		ew.Printf(keyFormat, "Status", report.LastRun.Status)
+		if report.LastRun.Options.Staging {
+			ew.Printf(keyFormat, "Staging", "true")
+		}
+		ew.Printf(keyFormat, "Finished At", report.LastRun.FinishedAt.Format("2006-01-02 15:04:05"))
+		ew.Printf(keyFormat, "Elapsed", report.LastRun.Elapsed.Round(time.Millisecond).String())
+		if report.LastRun.Error != "" {
+			ew.Printf(keyFormat, "Error", report.LastRun.Error)
+		}
+	}
+
+	ew.Println("\nSteps:")
+	ew.Printf(keyFormat, "Failed", formatStepCount(report.FailedSteps))
+	ew.Printf(keyFormat, "With Warnings", formatStepCount(report.WarningSteps))
+	ew.Printf(keyFormat, "Stale", formatStepCount(report.StaleSteps))
+
+	ew.Println("\nState Backend:")
+	ew.Printf(keyFormat, "Path", report.StateBackend.Path)
+	if report.StateBackend.Healthy {
+		ew.Printf(keyFormat, "Health", "ok")
+	} else {
+		ew.Printf(keyFormat, "Health", "unhealthy: "+report.StateBackend.Error)
+	}
+	return ew.err
+}
+
+// orDash is a display helper that replaces an empty value with "-".
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// formatStepCount is a display helper that formats a list of step names as
+// their count followed by the names, e.g. "2 (load, transform)".
+func formatStepCount(steps []string) string {
+	if len(steps) == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%d (%s)", len(steps), strings.Join(steps, ", "))
+}
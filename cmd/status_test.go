@@ -0,0 +1,191 @@
+package cmd_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRunProgress is a struct used for unmarshaling the JSON output of `status`.
+// It mirrors the `RunProgress` struct used internally in the command.
+type TestRunProgress struct {
+	PID           int      `json:"pid"`
+	WorkflowRunID string   `json:"workflow_run_id"`
+	CurrentSteps  []string `json:"current_steps"`
+	StepsDone     int      `json:"steps_done"`
+	StepsTotal    int      `json:"steps_total"`
+}
+
+// TestStatusReport is a struct used for unmarshaling the JSON output of `status`.
+// It mirrors the `StatusReport` struct used internally in the command.
+type TestStatusReport struct {
+	Running  []TestRunProgress `json:"running"`
+	Detached []struct {
+		PID     int    `json:"pid"`
+		LogFile string `json:"log_file"`
+	} `json:"detached"`
+	LastRun *struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	} `json:"last_run"`
+	FailedSteps  []string `json:"failed_steps"`
+	StaleSteps   []string `json:"stale_steps"`
+	StateBackend struct {
+		Healthy bool `json:"healthy"`
+	} `json:"state_backend"`
+}
+
+// TestStatus_ShowsRunningWorkflow verifies that a second invocation of `status`
+// reports the progress of a `run all` in flight, and nothing once it has finished.
+func TestStatus_ShowsRunningWorkflow(t *testing.T) {
+	const configPath = "../test/settings/settings_inspection.yaml"
+	const socketsDir = "../test/states/metadata/wham_sockets"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	run := exec.Command(whamBinaryPath, "--config", configPath, "run", "all")
+	run.Env = append(os.Environ(), "NO_COLOR=true")
+	assert.NoError(t, run.Start())
+	t.Cleanup(func() { run.Process.Kill() })
+
+	// Wait for the running process to open its inspection socket and reach the slow step.
+	socketPath := filepath.Join(socketsDir, strconv.Itoa(run.Process.Pid)+".sock")
+	var running []TestRunProgress
+	assert.Eventually(t, func() bool {
+		if _, err := os.Stat(socketPath); err != nil {
+			return false
+		}
+		outputStr, err := runWhamCommand(t, "--config", configPath, "status", "-o", "json")
+		var report TestStatusReport
+		if err != nil || json.Unmarshal([]byte(outputStr), &report) != nil {
+			return false
+		}
+		running = report.Running
+		return len(running) == 1 && slices.Equal(running[0].CurrentSteps, []string{"slow"})
+	}, 3*time.Second, 50*time.Millisecond, "The running workflow should be reported while executing the slow step.")
+
+	if assert.Len(t, running, 1) {
+		assert.Equal(t, run.Process.Pid, running[0].PID)
+		assert.NotEmpty(t, running[0].WorkflowRunID)
+		assert.Equal(t, 1, running[0].StepsDone)
+		assert.Equal(t, 2, running[0].StepsTotal)
+	}
+
+	assert.NoError(t, run.Wait(), "The inspected workflow should succeed.")
+	_, err := os.Stat(socketPath)
+	assert.True(t, os.IsNotExist(err), "The inspection socket should be removed once the run finishes.")
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "status")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "No WHAM process is running.")
+}
+
+// TestStatus_DumpOnSIGUSR1 verifies that a running workflow dumps its status to
+// stderr on SIGUSR1: the running step, the queued steps and the recent retries.
+func TestStatus_DumpOnSIGUSR1(t *testing.T) {
+	const configPath = "../test/settings/settings_status_dump.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	var stderr bytes.Buffer
+	run := exec.Command(whamBinaryPath, "--config", configPath, "run", "all")
+	run.Env = append(os.Environ(), "NO_COLOR=true")
+	run.Stderr = &stderr
+	assert.NoError(t, run.Start())
+	t.Cleanup(func() { run.Process.Kill() })
+
+	assert.Eventually(t, func() bool {
+		outputStr, err := runWhamCommand(t, "--config", configPath, "status", "-o", "json")
+		var report TestStatusReport
+		if err != nil || json.Unmarshal([]byte(outputStr), &report) != nil {
+			return false
+		}
+		return len(report.Running) == 1 && slices.Equal(report.Running[0].CurrentSteps, []string{"slow"})
+	}, 3*time.Second, 50*time.Millisecond, "The workflow should reach the slow step.")
+	assert.NoError(t, run.Process.Signal(syscall.SIGUSR1))
+
+	assert.NoError(t, run.Wait(), "The signal should not stop the workflow.")
+	dump := stderr.String()
+	assert.Contains(t, dump, "📋 WHAM status (PID "+strconv.Itoa(run.Process.Pid))
+	assert.Contains(t, dump, "Steps done: 1/3")
+	assert.Regexp(t, `Running: slow \(\d+s\)`, dump)
+	assert.Contains(t, dump, "Queued (1): last")
+	assert.Contains(t, dump, "'flaky' attempt 2 after: ")
+}
+
+// TestStatus_ReportsLastRunAndStaleSteps verifies that `status` reports the outcome
+// of the last workflow run, the stale steps and the health of the state backend.
+func TestStatus_ReportsLastRunAndStaleSteps(t *testing.T) {
+	const configPath = "../test/settings/settings_state_files.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	_, err := runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.NoError(t, err)
+	// Losing the state of the successor makes it lag behind its predecessor.
+	_, err = runWhamCommand(t, "--config", configPath, "state", "delete", "build_report", "-y")
+	assert.NoError(t, err)
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "status", "-o", "json")
+	assert.NoError(t, err)
+	var report TestStatusReport
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &report))
+
+	assert.Empty(t, report.Running, "No process should be running.")
+	if assert.NotNil(t, report.LastRun, "The last workflow run should be reported.") {
+		assert.Equal(t, "succeeded", report.LastRun.Status)
+	}
+	assert.Empty(t, report.FailedSteps)
+	assert.Equal(t, []string{"build_report"}, report.StaleSteps)
+	assert.True(t, report.StateBackend.Healthy, "The metadata directory should be writable.")
+}
+
+// TestStatus_DetachedRun verifies that `run all --detach` returns immediately, that
+// `status` reports the detached run and its progress while it runs, and that its
+// output is written to its log file.
+func TestStatus_DetachedRun(t *testing.T) {
+	const configPath = "../test/settings/settings_inspection.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	start := time.Now()
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "--detach")
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second, "A detached run should return immediately.")
+	assert.Contains(t, outputStr, "Workflow run detached")
+
+	var report TestStatusReport
+	assert.Eventually(t, func() bool {
+		outputStr, err := runWhamCommand(t, "--config", configPath, "status", "-o", "json")
+		if err != nil || json.Unmarshal([]byte(outputStr), &report) != nil {
+			return false
+		}
+		return len(report.Running) == 1 && slices.Equal(report.Running[0].CurrentSteps, []string{"slow"})
+	}, 3*time.Second, 50*time.Millisecond, "The detached run should be reported while executing the slow step.")
+	if !assert.Len(t, report.Detached, 1) {
+		return
+	}
+	detached := report.Detached[0]
+	assert.Equal(t, detached.PID, report.Running[0].PID, "The detached process should be the running one.")
+
+	// Once the process has exited, it is no longer reported, but its log is kept.
+	assert.Eventually(t, func() bool {
+		outputStr, err := runWhamCommand(t, "--config", configPath, "status", "-o", "json")
+		return err == nil && json.Unmarshal([]byte(outputStr), &report) == nil && len(report.Detached) == 0
+	}, 5*time.Second, 100*time.Millisecond, "The finished detached run should no longer be reported.")
+	if assert.NotNil(t, report.LastRun) {
+		assert.Equal(t, "succeeded", report.LastRun.Status)
+	}
+	data, err := os.ReadFile(detached.LogFile)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "Workflow execution finished.")
+}
@@ -1,14 +1,29 @@
 package cmd
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 // Step-related concrete Command Structs (Verbs)
 
 type RunStepCmd struct {
-	Target string `arg:"" help:"Step name to run, or 'all'"`
-	Force  bool   `help:"Force the step to run, ignoring state." short:"f"`
-	From   string `help:"Start execution from this step (inclusive). Requires 'all' target."`
-	To     string `help:"End execution at this step (inclusive). Requires 'all' target."`
+	Target          string        `arg:"" help:"Step name to run, 'all', or 'failed' to re-run the failed steps and their descendants"`
+	Force           bool          `help:"Force the step to run, ignoring state." short:"f"`
+	From            string        `help:"Start execution from this step (inclusive). Requires 'all' target."`
+	To              string        `help:"End execution at this step (inclusive). Requires 'all' target."`
+	Only            []string      `help:"Run exactly these steps, comma-separated or repeated, in topological order, without their ancestors or descendants. Requires 'all' target." placeholder:"STEP"`
+	Skip            []string      `help:"Exclude this step from the execution. Can be repeated. Requires 'all' target." placeholder:"STEP"`
+	SkipDescendants bool          `help:"Also exclude the descendants of the skipped steps that depend only on excluded steps. Requires --skip."`
+	Parallel        int           `help:"Run up to N independent steps concurrently. Requires 'all' target." default:"1" placeholder:"N"`
+	Timeout         time.Duration `help:"Abort the workflow if it runs longer than this (e.g. 30m). Overrides 'workflow_timeout'. Requires 'all' target."`
+	DryRun          bool          `help:"Show which steps would run or be skipped, and why, without executing anything. Requires 'all' target."`
+	Resume          bool          `help:"Run the steps that failed, were cancelled or never ran, and their descendants, as with --only. Requires 'all' target."`
+	Watch           []string      `help:"Re-run the workflow whenever a file matching this glob changes. Can be repeated. Requires 'all' target." placeholder:"GLOB"`
+	Detach          bool          `help:"Run the workflow in the background, and return immediately. Follow it with 'wham status'. Requires 'all' target."`
+	ContinueOnError bool          `help:"Continue the workflow after any step failure, as if every step had 'can_fail: true'. Requires 'all' target."`
+	Staging         bool          `help:"Run the steps with VAR_WHAM_DRY_RUN=1, so that they can avoid side effects, and mark their states as dry runs."`
 }
 
 type GetStepCmd struct {
@@ -18,7 +33,10 @@ type DescribeStepCmd struct {
 	Target string `arg:"" help:"Step name to describe, or 'all'"`
 }
 type ValidateStepCmd struct {
-	Target string `arg:"" help:"Step name to validate, or 'all'"`
+	Target     string   `arg:"" help:"Step name to validate, or 'all'"`
+	NoTruncate bool     `help:"Wrap long reasons across lines instead of truncating them."`
+	Owner      string   `help:"Only validate the steps with this owner. Requires 'all' target."`
+	Tag        []string `help:"Only validate the steps with this tag. Can be repeated: steps must have all the tags. Requires 'all' target." placeholder:"TAG"`
 }
 
 // Step-related command groups (objects)
@@ -34,19 +52,137 @@ type StepCmd struct {
 // Step-related command implementations
 
 func (r *RunStepCmd) Run(ctx *Context) error {
+	// 'run failed' is a 'run all' restricted to the failed steps and their descendants,
+	// unless a step is named "failed".
+	rerunFailed := r.Target == "failed" && ctx.WHAM.findStep(r.Target) == nil
+	if rerunFailed {
+		if r.From != "" || r.To != "" || len(r.Only) > 0 || r.Resume || len(r.Watch) > 0 {
+			return fmt.Errorf("--from, --to, --only, --resume and --watch flags cannot be used with the 'failed' target")
+		}
+		r.Target = "all"
+	}
 	if (r.From != "" || r.To != "") && r.Target != "all" {
 		return fmt.Errorf("--from and --to flags can only be used with the 'all' target")
 	}
-	if r.Target == "all" {
-		if err := ctx.WHAM.RunAllSteps(r.Force, r.From, r.To); err != nil {
+	if len(r.Only) > 0 && r.Target != "all" {
+		return fmt.Errorf("--only flag can only be used with the 'all' target")
+	}
+	if len(r.Only) > 0 && (r.From != "" || r.To != "" || r.Resume) {
+		return fmt.Errorf("--only flag cannot be used with --from, --to or --resume")
+	}
+	if len(r.Skip) > 0 && r.Target != "all" {
+		return fmt.Errorf("--skip flag can only be used with the 'all' target")
+	}
+	if r.SkipDescendants && len(r.Skip) == 0 {
+		return fmt.Errorf("--skip-descendants flag requires --skip")
+	}
+	if r.Parallel < 1 {
+		return fmt.Errorf("--parallel must be at least 1")
+	}
+	if r.Parallel > 1 && r.Target != "all" {
+		return fmt.Errorf("--parallel flag can only be used with the 'all' target")
+	}
+	if r.Timeout < 0 {
+		return fmt.Errorf("--timeout cannot be negative")
+	}
+	if r.Timeout > 0 && r.Target != "all" {
+		return fmt.Errorf("--timeout flag can only be used with the 'all' target")
+	}
+	if r.DryRun && r.Target != "all" {
+		return fmt.Errorf("--dry-run flag can only be used with the 'all' target")
+	}
+	if r.Resume && r.Target != "all" {
+		return fmt.Errorf("--resume flag can only be used with the 'all' target")
+	}
+	if r.Resume && r.From != "" {
+		return fmt.Errorf("--resume and --from flags cannot be used together")
+	}
+	if len(r.Watch) > 0 && r.Target != "all" {
+		return fmt.Errorf("--watch flag can only be used with the 'all' target")
+	}
+	if len(r.Watch) > 0 && (r.DryRun || r.Resume) {
+		return fmt.Errorf("--watch flag cannot be used with --dry-run or --resume")
+	}
+	if r.ContinueOnError && r.Target != "all" {
+		return fmt.Errorf("--continue-on-error flag can only be used with the 'all' target")
+	}
+	if r.Detach && r.Target != "all" {
+		return fmt.Errorf("--detach flag can only be used with the 'all' target")
+	}
+	if r.Detach && r.DryRun {
+		return fmt.Errorf("--detach and --dry-run flags cannot be used together")
+	}
+	if r.Detach {
+		run, err := ctx.WHAM.Detach()
+		if err != nil {
 			return err
 		}
+		_, err = fmt.Printf("🚀 Workflow run detached (PID %d), writing its output to '%s'. Follow it with 'wham status'.\n", run.PID, run.LogFile)
+		return err
+	}
+	if r.Target == "all" {
+		opts := RunOptions{Force: r.Force, From: r.From, To: r.To, Only: r.Only, Skip: r.Skip, SkipDescendants: r.SkipDescendants, Parallel: r.Parallel, Timeout: r.Timeout, ContinueOnError: r.ContinueOnError, Staging: r.Staging}
+		if r.Resume {
+			selected, err := ctx.WHAM.resumeSteps()
+			if err != nil {
+				return err
+			}
+			if len(selected) == 0 {
+				_, err := fmt.Println("✅ Nothing to resume: every step has run without failing.")
+				return err
+			}
+			if _, err := fmt.Printf("⏯️ Resuming workflow from step '%s' (%s).\n", selected[0], strings.Join(selected, ", ")); err != nil {
+				return err
+			}
+			opts.Only = selected
+		}
+		if rerunFailed {
+			failed, selected, err := ctx.WHAM.failedStepsToRerun()
+			if err != nil {
+				return err
+			}
+			if len(failed) == 0 {
+				_, err := fmt.Println("✅ Nothing to re-run: no step failed.")
+				return err
+			}
+			if _, err := fmt.Printf("🔁 Re-running failed step(s) %s and %d descendant(s).\n", strings.Join(failed, ", "), len(selected)-len(failed)); err != nil {
+				return err
+			}
+			opts.Only = selected
+		}
+		if r.DryRun {
+			return ctx.WHAM.ShowPlan(opts, ctx.OutputFormat)
+		}
+		if len(r.Watch) > 0 {
+			return ctx.WHAM.Watch(r.Watch, opts, ctx.OutputFormat)
+		}
+		if err := ctx.WHAM.RunAllSteps(opts); err != nil {
+			return reportAbortedRun(ctx, err)
+		}
 		// After a successful run, print the summary using the format from the context.
 		if _, err := fmt.Println("\n✅ Workflow execution finished."); err != nil {
 			return err
 		}
 		return ctx.WHAM.ShowExecutionSummary(ctx.OutputFormat)
 	}
+	if step := ctx.WHAM.findStep(r.Target); step != nil {
+		if err := ctx.WHAM.checkRequirements([]*Step{step}); err != nil {
+			return err
+		}
+		if err := ctx.WHAM.checkStateVersions([]*Step{step}); err != nil {
+			return err
+		}
+	}
+	releaseRunLock, err := ctx.WHAM.acquireRunLock(fmt.Sprintf("step '%s'", r.Target))
+	if err != nil {
+		return err
+	}
+	defer releaseRunLock()
+	stopInspection := ctx.WHAM.startInspection("", 1)
+	defer stopInspection()
+	stopRunContext := ctx.WHAM.startRunContext(0)
+	defer stopRunContext()
+	ctx.WHAM.staging = r.Staging
 	return ctx.WHAM.RunStep(r.Target, r.Force)
 }
 
@@ -62,5 +198,6 @@ func (d *DescribeStepCmd) Run(ctx *Context) error {
 }
 
 func (v *ValidateStepCmd) Run(ctx *Context) error {
-	return ctx.WHAM.GetValidationStatus(v.Target, ctx.OutputFormat)
+	ctx.WHAM.noTruncate = v.NoTruncate
+	return ctx.WHAM.GetValidationStatus(v.Target, StepSelector{Owner: v.Owner, Tags: v.Tag}, ctx.OutputFormat)
 }
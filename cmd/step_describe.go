@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"cmp"
 	"fmt"
 	"os"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -30,26 +33,160 @@ func (w *WHAM) DescribeStep(stepName string) error {
 
 	// --- Configuration Section ---
 	ew.Println("\nConfiguration:")
+	if step.Type != "" {
+		ew.Printf(keyFormat, "Type", step.Type)
+	}
+	if step.Owner != "" {
+		ew.Printf(keyFormat, "Owner", step.Owner)
+	}
+	if len(step.Tags) > 0 {
+		ew.Printf(keyFormat, "Tags", strings.Join(step.Tags, ", "))
+	}
 	ew.Printf(keyFormat, "Command", strings.Join(step.Command, " "))
+	if step.Check != nil {
+		ew.Printf(keyFormat, "Check", formatCheckSpec(step.Check))
+	}
+	if step.Dbt != nil {
+		ew.Printf(keyFormat, "dbt Args", strings.Join(w.dbtArgs(step), " "))
+	}
+	if step.Freshness != nil {
+		ew.Printf(keyFormat, "Freshness", formatFreshnessSpec(step.Freshness))
+	}
+	if step.Workflow != "" {
+		ew.Printf(keyFormat, "Workflow", fmt.Sprintf("%s (metadata: %s)", step.Workflow, w.subWorkflowMetadataDir(step)))
+	}
 	if step.Image != "" {
 		ew.Printf(keyFormat, "Image", step.Image)
 	}
 	ew.Printf(keyFormat, "Args", formatStringSlice(step.Args))
+	if len(step.Before) > 0 {
+		ew.Printf(keyFormat, "Before", formatHooks(step.Before))
+	}
+	if len(step.After) > 0 {
+		ew.Printf(keyFormat, "After", formatHooks(step.After))
+	}
+	if len(step.BeforeRetry) > 0 {
+		ew.Printf(keyFormat, "Before Retry", formatHooks(step.BeforeRetry))
+	}
 	ew.Printf(keyFormat, "Stateful", fmt.Sprintf("%t", step.IsStateful))
 	if step.WorkDir != "" {
 		ew.Printf(keyFormat, "Work Dir", step.WorkDir)
 	} else {
 		ew.Printf(keyFormat, "Work Dir", "<default>")
 	}
-	if step.IsStateful {
+	if step.IsStateful && len(step.StateFiles) > 0 {
+		ew.Println("  State Files:")
+		for _, sf := range step.StateFiles {
+			ew.Printf("    - %s (run_id_var: %s)\n", sf.File, sf.RunIdVar)
+		}
+	} else if step.IsStateful && len(step.RunIDFromOutputs) > 0 {
+		ew.Printf(keyFormat, "Run ID From", formatStringSlice(step.RunIDFromOutputs))
+	} else if step.IsStateful {
 		ew.Printf(keyFormat, "State File", step.StateFile)
 		ew.Printf(keyFormat, "Run ID Var", step.RunIdVar)
 	}
+	if step.SuccessCriteria != "" {
+		policy := step.SuccessCriteriaPolicy
+		if policy == "" {
+			policy = "fail"
+		}
+		ew.Printf(keyFormat, "Success Criteria", fmt.Sprintf("%s (on miss: %s)", step.SuccessCriteria, policy))
+	}
+	if step.RunAsUser != "" || step.RunAsGroup != "" {
+		ew.Printf(keyFormat, "Run As", fmt.Sprintf("%s:%s", orDash(step.RunAsUser), orDash(step.RunAsGroup)))
+	}
+	if len(step.Inputs) > 0 {
+		ew.Printf(keyFormat, "Inputs", formatStringSlice(step.Inputs))
+	}
+	if len(step.ExpectedOutputs) > 0 {
+		policy := step.ExpectedOutputsPolicy
+		if policy == "" {
+			policy = "fail"
+		}
+		ew.Printf(keyFormat, "Expected Outputs", fmt.Sprintf("%s (on miss: %s)", strings.Join(step.ExpectedOutputs, ", "), policy))
+	}
+	if step.CleanupOutputsAfter != "" {
+		ew.Printf(keyFormat, "Cleanup Outputs", "after "+step.CleanupOutputsAfter)
+	}
+	if step.GeneratesSteps {
+		ew.Printf(keyFormat, "Generates Steps", "yes")
+	}
+	if step.WatermarkFromOutput != "" {
+		ew.Printf(keyFormat, "Watermark From", step.WatermarkFromOutput)
+	}
+	if step.MustStartBy != "" {
+		policy := step.MustStartByPolicy
+		if policy == "" {
+			policy = "warn"
+		}
+		ew.Printf(keyFormat, "Must Start By", fmt.Sprintf("%s (on miss: %s)", step.MustStartBy, policy))
+	}
+	if step.MaxFailureRate != "" {
+		ew.Printf(keyFormat, "Max Failure Rate", step.MaxFailureRate)
+	}
+	if step.Priority != 0 {
+		ew.Printf(keyFormat, "Priority", fmt.Sprintf("%d", step.Priority))
+	}
+	if step.ConcurrencyGroup != "" {
+		ew.Printf(keyFormat, "Concurrency Group", step.ConcurrencyGroup)
+	}
+	if len(step.Locks) > 0 {
+		ew.Printf(keyFormat, "Locks", strings.Join(step.Locks, ", "))
+	}
+	if len(step.Requires) > 0 {
+		ew.Printf(keyFormat, "Requires", strings.Join(step.Requires, ", "))
+	}
 	ew.Printf(keyFormat, "Can Fail", fmt.Sprintf("%t", step.CanFail))
+	if step.Disabled {
+		ew.Printf(keyFormat, "Disabled", "true")
+	}
+	if step.When != "" {
+		ew.Printf(keyFormat, "When", step.When)
+	}
 	ew.Printf(keyFormat, "Retries", fmt.Sprintf("%d", step.Retries))
 	ew.Printf(keyFormat, "Retry Delay", step.RetryDelay.String())
+	if patterns := append(slices.Clone(step.FailurePatterns), w.config.WhamSettings.FailurePatterns...); len(patterns) > 0 {
+		classes := make([]string, len(patterns))
+		for i, p := range patterns {
+			classes[i] = fmt.Sprintf("%s (%s)", p.Class, p.action())
+		}
+		ew.Printf(keyFormat, "Failure Classes", strings.Join(classes, ", "))
+	}
+	if step.Timeout > 0 {
+		ew.Printf(keyFormat, "Timeout", step.Timeout.String())
+	}
+	if step.DryRun {
+		ew.Printf(keyFormat, "Dry Run", "true")
+	}
+	if step.KillGracePeriod > 0 {
+		ew.Printf(keyFormat, "Kill Grace Period", step.KillGracePeriod.String())
+	}
+	if step.TTY {
+		ew.Printf(keyFormat, "TTY", "true")
+	}
+	if step.IgnoreHostGuards {
+		ew.Printf(keyFormat, "Ignore Host Guards", "true")
+	}
+	if step.ScratchDir != nil {
+		ew.Printf(keyFormat, "Scratch Dir", cmp.Or(step.ScratchDir.Size, "unlimited"))
+	}
+	if step.LogLevel != "" {
+		ew.Printf(keyFormat, "Log Level", step.LogLevel)
+	}
+	if len(step.SuccessExitCodes) > 0 {
+		ew.Printf(keyFormat, "Success Exit Codes", formatExitCodes(step.SuccessExitCodes))
+	}
+	if len(step.WarningExitCodes) > 0 {
+		ew.Printf(keyFormat, "Warning Exit Codes", formatExitCodes(step.WarningExitCodes))
+	}
 	ew.Printf(keyFormat, "Previous Steps", formatPreviousSteps(step.PreviousSteps))
 
+	if envFiles := append(slices.Clone(w.config.WhamSettings.EnvFiles), step.EnvFiles...); len(envFiles) > 0 {
+		ew.Printf(keyFormat, "Env Files", strings.Join(envFiles, ", "))
+	}
+	if step.Connection != "" {
+		ew.Printf(keyFormat, "Connection", step.Connection)
+	}
 	ew.Println("  Env Vars:")
 	if len(step.EnvVars) > 0 {
 		// Sort keys for consistent output, which is good for testing and readability.
@@ -76,9 +213,51 @@ func (w *WHAM) DescribeStep(stepName string) error {
 			runDate = state.RunDate.Format("2006-01-02 15:04:05")
 		}
 		ew.Printf(keyFormat, "Last Action", state.RunAction)
+		if state.Reason != "" {
+			ew.Printf(keyFormat, "Last Reason", state.Reason)
+		}
+		if state.FailureClass != "" {
+			ew.Printf(keyFormat, "Failure Class", state.FailureClass)
+		}
 		ew.Printf(keyFormat, "Last Run ID", state.RunID)
+		if state.WorkflowRunID != "" {
+			ew.Printf(keyFormat, "Workflow Run ID", state.WorkflowRunID)
+		}
+		if state.DryRun {
+			ew.Printf(keyFormat, "Dry Run", "true (staging)")
+		}
 		ew.Printf(keyFormat, "Last Run Date", runDate)
 		ew.Printf(keyFormat, "Last Elapsed", state.Elapsed.Round(time.Millisecond).String())
+		// The history tells when a step that did not just succeed last did.
+		if history, err := w.loadStepHistory(stepName); err == nil && state.RunAction != "run" {
+			if last := lastSuccessfulState(history); last != nil {
+				lastSuccess := last.RunDate.Format("2006-01-02 15:04:05")
+				if last.RunID != "" {
+					lastSuccess += fmt.Sprintf(" (run_id: %s)", last.RunID)
+				}
+				ew.Printf(keyFormat, "Last Success", lastSuccess)
+			}
+		}
+		if state.Watermark != "" {
+			ew.Printf(keyFormat, "Watermark", state.Watermark)
+		}
+		if len(state.Warnings) > 0 {
+			ew.Println("  Last Warnings:")
+			for _, warning := range state.Warnings {
+				ew.Printf("    - %s\n", warning)
+			}
+		}
+		if len(state.Outputs) > 0 {
+			ew.Println("  Last Outputs:")
+			keys := make([]string, 0, len(state.Outputs))
+			for k := range state.Outputs {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				ew.Printf("    %s: %s\n", k, state.Outputs[k])
+			}
+		}
 	}
 
 	// Return the first error that occurred, or nil if all writes succeeded.
@@ -116,3 +295,62 @@ func formatStringSlice(slice []string) string {
 	}
 	return strings.Join(slice, " ")
 }
+
+// formatHooks is a display helper for lists of hook commands, e.g. "a.sh; rm -f x".
+func formatHooks(hooks [][]string) string {
+	parts := make([]string, len(hooks))
+	for i, hook := range hooks {
+		parts[i] = strings.Join(hook, " ")
+	}
+	return strings.Join(parts, "; ")
+}
+
+// formatExitCodes is a display helper for lists of exit codes, e.g. "0, 1".
+func formatExitCodes(codes []int) string {
+	parts := make([]string, len(codes))
+	for i, code := range codes {
+		parts[i] = strconv.Itoa(code)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatCheckSpec is a display helper that summarizes the expectations of a check step.
+func formatCheckSpec(c *CheckSpec) string {
+	var parts []string
+	if c.NotNull {
+		parts = append(parts, "not null")
+	}
+	if c.Min != nil {
+		parts = append(parts, fmt.Sprintf("min %v", *c.Min))
+	}
+	if c.Max != nil {
+		parts = append(parts, fmt.Sprintf("max %v", *c.Max))
+	}
+	if c.MaxChangePct != nil {
+		parts = append(parts, fmt.Sprintf("max change %v%%", *c.MaxChangePct))
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "<no expectations>")
+	}
+	policy := c.Policy
+	if policy == "" {
+		policy = "fail"
+	}
+	return fmt.Sprintf("%s (on miss: %s)", strings.Join(parts, ", "), policy)
+}
+
+// formatFreshnessSpec is a display helper that summarizes the source and threshold of a freshness step.
+func formatFreshnessSpec(f *FreshnessSpec) string {
+	source := "command output"
+	if f.File != "" {
+		source = "mtime of " + f.File
+	}
+	if f.MaxAge == 0 {
+		return source
+	}
+	policy := f.Policy
+	if policy == "" {
+		policy = "fail"
+	}
+	return fmt.Sprintf("%s, max age %s (on miss: %s)", source, f.MaxAge, policy)
+}
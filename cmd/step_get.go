@@ -26,7 +26,7 @@ func (w *WHAM) getSingleStep(stepName string, outputFormat string) error {
 	switch outputFormat {
 	case "json", "yaml":
 		return RenderData(os.Stdout, step, outputFormat)
-	case "table":
+	case "table", "wide":
 		// Reuse the 'all steps' table renderer for consistency,
 		// passing a slice with just the single step.
 		return w.renderAllStepsAsTable([]Step{*step})
@@ -42,7 +42,7 @@ func (w *WHAM) getAllSteps(outputFormat string) error {
 	switch outputFormat {
 	case "json", "yaml":
 		return RenderData(os.Stdout, steps, outputFormat)
-	case "table":
+	case "table", "wide":
 		return w.renderAllStepsAsTable(steps)
 	default:
 		return fmt.Errorf("unsupported output format: '%s'", outputFormat)
@@ -1,32 +1,238 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
 )
 
+// errStepTimeout is returned by executeStep when the script exceeds the step's timeout.
+var errStepTimeout = errors.New("step timed out")
+
+// errStepCancelled is the cause of the cancellation of a step's script by
+// `wham cancel <step>`, and is returned by executeStep (see trackStepCancel).
+var errStepCancelled = errors.New("step cancelled")
+
+// errWorkflowTimeout is the cause of the cancellation of a workflow run that
+// exceeds its timeout.
+var errWorkflowTimeout = errors.New("workflow timed out")
+
+// errInterrupted is the cause of the cancellation of an execution interrupted by
+// SIGINT or SIGTERM. The actual cause is an interruption, which matches it.
+var errInterrupted = errors.New("interrupted")
+
+// signalGracePeriod is how long a script is given to exit after WHAM forwarded it
+// the signal that interrupted the execution, or SIGTERM when the step alone was
+// cancelled, before its process group is killed, unless the step sets its own
+// `kill_grace_period`.
+const signalGracePeriod = 10 * time.Second
+
+// interruption is the cause of the cancellation of an execution interrupted by a signal.
+type interruption struct {
+	signal syscall.Signal
+}
+
+func (i interruption) Error() string {
+	return fmt.Sprintf("interrupted by signal '%s'", i.signal)
+}
+
+// Is makes an interruption match errInterrupted.
+func (i interruption) Is(target error) bool {
+	return target == errInterrupted
+}
+
+// runContext returns the context of the execution in progress, or a context that
+// is never cancelled if there is none.
+func (w *WHAM) runContext() context.Context {
+	if w.runCtx == nil {
+		return context.Background()
+	}
+	return w.runCtx
+}
+
+// startRunContext sets up the context of an execution, which is cancelled when
+// WHAM receives SIGINT or SIGTERM, or when `timeout` elapses if it is positive.
+// The cause of the cancellation wraps errInterrupted or errWorkflowTimeout.
+// It returns a function that releases the context and stops trapping signals.
+//
+// The long-lived commands running the workflow again and again (`serve`, `watch`
+// and the operator) trap the signals themselves between runs, and stop gracefully
+// on one. During a run, the signal is received here instead: it aborts the run as
+// it would abort `run all`, and the command returns the run's error.
+func (w *WHAM) startRunContext(timeout time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancelTimeout := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancelTimeout = context.WithTimeoutCause(ctx, timeout, fmt.Errorf("%w after %s", errWorkflowTimeout, timeout))
+	}
+	w.runCtx = ctx
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			fmt.Printf("\n🛑 Received %s, stopping the execution...\n", sig)
+			w.logger.Warn().Str("signal", sig.String()).Msg("Execution interrupted by signal.")
+			cancel(interruption{signal: sig.(syscall.Signal)})
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+		cancelTimeout()
+		cancel(nil)
+		w.runCtx = nil
+	}
+}
+
 // TemplateContext holds dynamic data available at runtime for a step's execution.
 // This data is passed to the template engine when processing parameter strings.
 type TemplateContext struct {
-	Forced   bool             // True if the step was forced to run.
-	Step     *Step            // A pointer to the step's own configuration.
-	RunID    string           // The step's run_id from its previous execution.
-	Config   *Config          // A pointer to the entire WHAM configuration.
-	StepsMap map[string]*Step // A map of all steps for easy lookup by name.
+	Forced         bool             // True if the step was forced to run.
+	IdempotencyKey string           // The key shared by the attempts of the step in the workflow run.
+	WorkflowRunID  string           // The ID of the workflow run in progress, if any.
+	Step           *Step            // A pointer to the step's own configuration.
+	RunID          string           // The step's run_id from its previous execution.
+	Watermark      string           // The step's watermark, recorded from the output named by watermark_from_output.
+	Config         *Config          // A pointer to the entire WHAM configuration.
+	StepsMap       map[string]*Step // A map of all steps for easy lookup by name.
+	Workflow       *WorkflowRun     // The finished workflow run, in workflow handlers only.
+	DryRun         bool             // True if the step runs with the dry-run marker (see dryRunMarked).
+}
+
+// stepResult holds the information reported by a step's script during its execution.
+type stepResult struct {
+	// Outputs are the key=value pairs written by the script to VAR_OUTPUT_FILE.
+	Outputs map[string]string
+	// Stdout is the captured standard output of the script. It is only captured
+	// for step types that need to interpret it (see capturesStdout).
+	Stdout string
+	// Stderr is the end of the script's standard error (or of its output, under a
+	// pseudo-terminal), kept to classify its failures (see classifyFailure).
+	Stderr string
+	// RunID is the run_id reported by the step type itself (e.g., the invocation ID
+	// of a dbt step). If set, it takes precedence over getActualStepRunId.
+	RunID string
+	// Warnings describe the degradations of the execution that did not make it fail.
+	Warnings []string
+	// GeneratedSteps are the steps parsed from the output of a generator step, to be
+	// added to the DAG once the execution is successful (see parseGeneratedSteps).
+	GeneratedSteps []*Step
 }
 
 // Helper methods
 
+// stepLogger returns the logger for the messages about a step, honoring its `log_level`:
+// "debug" shows the step's debug messages even without --debug.
+func (w *WHAM) stepLogger(step *Step) zerolog.Logger {
+	if step.LogLevel == LogLevelDebug {
+		return w.logger.Level(zerolog.DebugLevel)
+	}
+	return w.logger
+}
+
+// producesOwnRunID reports whether a step determines its own run_id when it runs,
+// rather than inheriting it from its predecessors. This is the case for stateful
+// steps, dbt steps, freshness steps and workflow steps. Such steps are always executed when not forced, as only
+// their execution can tell whether their state has changed.
+func producesOwnRunID(step *Step) bool {
+	return step.IsStateful || step.Type == StepTypeDbt || step.Type == StepTypeFreshness || step.Type == StepTypeWorkflow
+}
+
+// workflowRunID returns the ID of the workflow run in progress: the run of `run all`,
+// or, in a sub-workflow, the run of its parent workflow. It is empty outside of a
+// workflow run (e.g., `run <step>`).
+func (w *WHAM) workflowRunID() string {
+	if w.activeRun != nil {
+		return w.activeRun.ID
+	}
+	return w.parentRunID
+}
+
+// idempotencyKey returns the idempotency key of the attempts of a step within the
+// workflow run in progress: a hash of the workflow run ID and the step name, so that
+// all the attempts (retries included) of the step share it, while another workflow
+// run gets another one. Outside of `run all`, each invocation gets its own key.
+func (w *WHAM) idempotencyKey(step *Step) string {
+	runID := w.workflowRunID()
+	if runID == "" {
+		runID = newWorkflowRunID()
+	}
+	hash := sha256.Sum256([]byte(runID + "\x00" + step.Name))
+	return hex.EncodeToString(hash[:16])
+}
+
 // findStep retrieves a pointer to a Step definition by its name.
 // It performs a fast lookup using an internal map for efficiency.
 // Returns nil if no step with the given name is found.
 func (w *WHAM) findStep(name string) *Step {
+	w.stepsMu.RLock()
+	defer w.stepsMu.RUnlock()
 	return w.stepsMap[name]
 }
 
+// steps returns the map of the steps by name. As it is replaced rather than
+// modified when steps are generated, it can be read without locking.
+func (w *WHAM) steps() map[string]*Step {
+	w.stepsMu.RLock()
+	defer w.stepsMu.RUnlock()
+	return w.stepsMap
+}
+
+// stepDepth returns the depth of a step in the DAG.
+func (w *WHAM) stepDepth(name string) int {
+	w.stepsMu.RLock()
+	defer w.stepsMu.RUnlock()
+	return w.stepDepths[name]
+}
+
+// evaluateWhen renders the `when` template of a step against its template context
+// and returns whether the step may run. A step without a `when` condition always
+// may. Returns an error if the template fails or does not render to a boolean.
+func (w *WHAM) evaluateWhen(step *Step, force bool, prevState StepState) (bool, error) {
+	if step.When == "" {
+		return true, nil
+	}
+	templateContext := TemplateContext{
+		Forced:        force,
+		WorkflowRunID: w.workflowRunID(),
+		Step:          step,
+		RunID:         prevState.RunID,
+		Watermark:     prevState.Watermark,
+		Config:        w.config,
+		StepsMap:      w.steps(),
+	}
+	rendered, err := w.processTemplateString(step.When, templateContext)
+	if err != nil {
+		return false, fmt.Errorf("failed to evaluate 'when' condition '%s': %w", step.When, err)
+	}
+	value, err := strconv.ParseBool(strings.TrimSpace(rendered))
+	if err != nil {
+		return false, fmt.Errorf("'when' condition '%s' must evaluate to true or false, got '%s'", step.When, strings.TrimSpace(rendered))
+	}
+	w.logger.Debug().Str("step", step.Name).Str("when", step.When).Bool("value", value).Msg("Evaluated 'when' condition.")
+	return value, nil
+}
+
 // shouldRunStep determines if a stateless step, in a non-forced run, should be executed.
 //
 // This function is the core of the conditional execution logic for stateless steps.
@@ -40,10 +246,20 @@ func (w *WHAM) findStep(name string) *Step {
 //  2. If the step has no predecessors (it's a source node), it always returns `true`
 //     as there is no prior state to compare against.
 //  3. It returns an error if any predecessor is not ready (missing a state file or `run_id`)
-//     or if predecessors have inconsistent `run_id`s.
-func (w *WHAM) shouldRunStep(step *Step) (bool, error) {
+//     or if predecessors have inconsistent `run_id`s, and if a state file cannot be read.
+//
+// A step with `inputs` also runs if `inputsHash`, the current hash of its inputs
+// (see inputsHash), differs from the one recorded by its last successful execution,
+// or if its last execution failed, as `make` rebuilds a target older than its
+// prerequisites. When the predecessors give no run_id to compare (2., or all of
+// them being stateless source nodes or `can_fail` steps), its inputs alone decide.
+func (w *WHAM) shouldRunStep(step *Step, inputsHash string) (bool, error) {
 	// Get the run_id from this step's last execution.
-	currentWhamRunID := w.getCurrentStepWhamState(step.Name).RunID
+	currentWhamState, err := w.loadStepWhamState(step.Name)
+	if err != nil {
+		return false, err
+	}
+	currentWhamRunID := currentWhamState.RunID
 	w.logger.Debug().Str("step", step.Name).Str("current_wham_run_id", currentWhamRunID).Msg("Current WHAM run ID for stateless step.")
 
 	if len(step.PreviousSteps) > 0 {
@@ -60,14 +276,21 @@ func (w *WHAM) shouldRunStep(step *Step) (bool, error) {
 		// stateless source nodes or can_fail steps). In this scenario, the current
 		// step should always run, as there's no meaningful prior state to compare against.
 		if prevRunID == "" {
-			return true, nil
+			return len(step.Inputs) == 0 || inputsChanged(currentWhamState, inputsHash), nil
 		}
 		// Run only if the predecessors' state has changed since our last run.
-		return prevRunID != currentWhamRunID, nil
+		return prevRunID != currentWhamRunID || (len(step.Inputs) > 0 && inputsChanged(currentWhamState, inputsHash)), nil
 	}
 
-	// A stateless step with no predecessors should always run.
-	return true, nil
+	// A stateless step with no predecessors should always run, unless its inputs tell.
+	return len(step.Inputs) == 0 || inputsChanged(currentWhamState, inputsHash), nil
+}
+
+// inputsChanged reports whether a step with `inputs` must run again for them: their
+// hash differs from the one recorded by its last successful execution, or its last
+// execution failed.
+func inputsChanged(state StepState, inputsHash string) bool {
+	return inputsHash != state.InputsHash || state.RunAction == "failed"
 }
 
 // checkPreviousStepsConsistency verifies that all direct predecessors of a step are in a
@@ -90,17 +313,20 @@ func (w *WHAM) checkPreviousStepsConsistency(previousSteps []string) (string, er
 		// Case 1: Handle stateless source nodes.
 		// It's acceptable for them to have no run_id, as they are just entry points.
 		// We can safely skip them in consistency checks.
-		if predStep != nil && !predStep.IsStateful && len(predStep.PreviousSteps) == 0 {
+		if predStep != nil && !producesOwnRunID(predStep) && len(predStep.PreviousSteps) == 0 {
 			w.logger.Debug().Str("previous_step", stepName).Msg("Skipping run_id consistency check for stateless source node.")
 			continue
 		}
 
-		whamState := w.getCurrentStepWhamState(stepName)
+		whamState, err := w.loadStepWhamState(stepName)
+		if err != nil {
+			return "", err
+		}
 		w.logger.Debug().Str("previous_step", stepName).Str("wham_run_id", whamState.RunID).Msg("Checking previous step WHAM run ID.")
 
 		// Case 2: If a predecessor can fail, we accept its state as-is (potentially stale)
 		// and skip the consistency check for it. We only care that it has run at least once.
-		if predStep != nil && predStep.CanFail {
+		if predStep != nil && w.stepCanFail(predStep) {
 			w.logger.Warn().Str("previous_step", stepName).Str("stale_run_id", whamState.RunID).Msg("Accepting potentially stale state from predecessor marked with 'can_fail'.")
 			continue
 		}
@@ -126,6 +352,68 @@ func (w *WHAM) checkPreviousStepsConsistency(previousSteps []string) (string, er
 	return commonRunID, nil
 }
 
+// stepCanFail reports whether the failure of a step lets the workflow continue,
+// i.e. whether it is marked with `can_fail: true` or the workflow runs with
+// `--continue-on-error`.
+func (w *WHAM) stepCanFail(step *Step) bool {
+	return step.CanFail || w.continueOnError
+}
+
+// dryRunMarked reports whether a step runs with the dry-run marker, i.e. whether
+// it is marked with `dry_run: true` or the workflow runs with `--staging`. Such a
+// step is still executed, but its script gets VAR_WHAM_DRY_RUN=1 so that it can
+// avoid side effects, and its states are recorded as `dry_run`.
+func (w *WHAM) dryRunMarked(step *Step) bool {
+	return step.DryRun || w.staging
+}
+
+// staleInputWarnings returns a warning for each predecessor of a step that is
+// marked with `can_fail` and failed its last execution: the step then works on
+// the data of that predecessor's last successful run, which may be stale.
+func (w *WHAM) staleInputWarnings(step *Step) []string {
+	var warnings []string
+	for _, stepName := range step.PreviousSteps {
+		predStep := w.findStep(stepName)
+		if predStep == nil || !w.stepCanFail(predStep) {
+			continue
+		}
+		if w.getCurrentStepWhamState(stepName).RunAction == "failed" {
+			warnings = append(warnings, fmt.Sprintf("previous step '%s' failed, its data may be stale", stepName))
+		}
+	}
+	return warnings
+}
+
+// readStateFileRunId reads the value of `runIdVar` from a state file generated by a
+// stateful step. It returns an empty string if the file or the variable is missing.
+func (w *WHAM) readStateFileRunId(step *Step, stateFile, runIdVar string) string {
+	stepStateFilePath := filepath.Join(w.config.WhamSettings.MetadataDir, stateFile)
+
+	data, err := os.ReadFile(stepStateFilePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			w.logger.Warn().Str("step", step.Name).Str("path", stepStateFilePath).Msg("Stateful step's state file does not exist after execution. Using empty string as run_id.")
+		} else {
+			w.logger.Error().Str("step", step.Name).Str("path", stepStateFilePath).Err(err).Msg("Failed to read stateful step's state file after execution.")
+		}
+		return "" // If the file doesn't exist or can't be read, there's no valid run_id.
+	}
+
+	// Parse the file content line-by-line to find the run_id variable (e.g., "run_id=...").
+	lines := strings.Split(string(data), "\n")
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, runIdVar+"=") {
+			runID := strings.TrimPrefix(line, runIdVar+"=")
+			return strings.TrimSpace(runID)
+		}
+	}
+
+	// If the run_id_var line is not found in the file.
+	w.logger.Warn().Str("step", step.Name).Str("path", stepStateFilePath).Str("run_id_var", runIdVar).Msg("Run ID variable not found in stateful step's state file.")
+	return ""
+}
+
 // getActualStepRunId determines the definitive run_id for a step *after* its execution
 // and returns it.
 //
@@ -134,38 +422,32 @@ func (w *WHAM) checkPreviousStepsConsistency(previousSteps []string) (string, er
 //     generated by the script in the metadata directory. It then parses this file
 //     to find the line containing the configured `run_id_var` (e.g., `run_id=some_value`)
 //     and extracts the value. It returns an empty string with no error if the file is
-//     missing, unreadable, or the `run_id_var` is not found.
+//     missing, unreadable, or the `run_id_var` is not found. A step with `state_files`
+//     reads each of them this way and combines the run IDs into a hash, and a step
+//     with `run_id_from_outputs` hashes the files it produced (see outputsRunID).
 //   - For a `stateless` step, it inherits the consistent `run_id` from its direct
 //     predecessors. If predecessors are inconsistent, it returns an error. If it has
 //     no predecessors, it returns an empty string.
 func (w *WHAM) getActualStepRunId(step *Step) (string, error) {
 	if step.IsStateful {
-		// For stateful steps, the run_id is read from the state file they generate.
-		stepStateFilePath := filepath.Join(w.config.WhamSettings.MetadataDir, step.StateFile)
-
-		data, err := os.ReadFile(stepStateFilePath)
-		if err != nil {
-			if os.IsNotExist(err) {
-				w.logger.Warn().Str("step", step.Name).Str("path", stepStateFilePath).Msg("Stateful step's state file does not exist after execution. Using empty string as run_id.")
-			} else {
-				w.logger.Error().Str("step", step.Name).Str("path", stepStateFilePath).Err(err).Msg("Failed to read stateful step's state file after execution.")
-			}
-			return "", nil // If the file doesn't exist or can't be read, there's no valid run_id.
+		if len(step.RunIDFromOutputs) > 0 {
+			return w.outputsRunID(step)
 		}
-
-		// Parse the file content line-by-line to find the run_id variable (e.g., "run_id=...").
-		lines := strings.Split(string(data), "\n")
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if strings.HasPrefix(line, step.RunIdVar+"=") {
-				runID := strings.TrimPrefix(line, step.RunIdVar+"=")
-				return strings.TrimSpace(runID), nil
+		// For stateful steps, the run_id is read from the state file(s) they generate.
+		if len(step.StateFiles) == 0 {
+			return w.readStateFileRunId(step, step.StateFile, step.RunIdVar), nil
+		}
+		// A step with several state files combines their run IDs into a single one.
+		// If any of them is missing, the step has no valid run_id.
+		hash := sha256.New()
+		for _, sf := range step.StateFiles {
+			runID := w.readStateFileRunId(step, sf.File, sf.RunIdVar)
+			if runID == "" {
+				return "", nil
 			}
+			fmt.Fprintf(hash, "%s=%s\n", sf.File, runID)
 		}
-
-		// If the run_id_var line is not found in the file.
-		w.logger.Warn().Str("step", step.Name).Str("path", stepStateFilePath).Str("run_id_var", step.RunIdVar).Msg("Run ID variable not found in stateful step's state file.")
-		return "", nil
+		return hex.EncodeToString(hash.Sum(nil))[:16], nil
 	}
 	// For stateless steps, the run_id is derived from its predecessors.
 	if len(step.PreviousSteps) == 0 {
@@ -192,102 +474,438 @@ func (w *WHAM) getActualStepRunId(step *Step) (string, error) {
 //  2. Pre-flight Checks: It performs a quick check to ensure the script file exists,
 //     is not a directory, and has execute permissions before attempting to run it.
 //  3. Argument Assembly: It combines any shared parameters from `wham_settings` with
-//     the step-specific parameters.
+//     the step-specific parameters. For dbt steps, the arguments derived from the
+//     `dbt` block take the place of the shared parameters.
 //  4. Environment Setup: It prepares the environment for the script by:
 //     - Inheriting the parent process's environment.
-//     - Injecting WHAM-specific variables (`VAR_DATA_DIR`, `VAR_METADATA_DIR`).
+//     - Injecting WHAM-specific variables (`VAR_DATA_DIR`, `VAR_METADATA_DIR`,
+//     `VAR_IDEMPOTENCY_KEY`, `VAR_WHAM_RUN_ID`, `VAR_OUTPUT_FILE`, for a
+//     stateful step with a `state_file`, `VAR_STATE_FILE` and `VAR_RUN_ID_VAR`,
+//     with the dry-run marker, `VAR_WHAM_DRY_RUN=1`, and if the step succeeded
+//     before, `VAR_LAST_SUCCESS_DATE` and `VAR_LAST_SUCCESS_RUN_ID`).
+//     - With a `scratch_dir`, setting `VAR_SCRATCH_DIR` and `TMPDIR` to a private
+//     temporary directory, removed after the attempt (see createScratchDir).
+//     - Setting `HOME`, `USER` and `LOGNAME` for the step's `run_as_user`, if any.
+//     - Adding the variables of the `env_files` of the settings and of the step.
+//     - Adding the environment variables of the step's connection, if any.
 //     - Adding any custom environment variables defined for the step.
-//  5. Execution: It runs the command and pipes the script's stdout and stderr to the
-//     main WHAM process to ensure visibility of its output.
+//  5. Execution: It runs the command in its own process group and pipes the script's
+//     stdout and stderr to the main WHAM process to ensure visibility of its output.
+//     With `run_as_user` or `run_as_group`, the command and hooks run with that
+//     identity (see resolveRunAs).
+//     With `tty: true`, the script runs under a pseudo-terminal instead, whose output
+//     is piped the same way (see runInPTY).
+//     If the step has a `timeout`, or the workflow run exceeds its own, the whole
+//     process group is killed, so that processes spawned by the script do not
+//     outlive it; with a `kill_grace_period`, it is sent SIGTERM first, and killed
+//     once the script exits or after the grace period. If WHAM is interrupted by
+//     SIGINT or SIGTERM, the signal is forwarded to the process group, which is
+//     killed once the script exits or after the step's `kill_grace_period`, or
+//     signalGracePeriod by default; so is SIGTERM if the step alone is cancelled
+//     with `wham cancel <step>`, which fails the attempt with errStepCancelled.
+//     The script's exit code is interpreted according to the step's
+//     `success_exit_codes` and `warning_exit_codes` (see checkExitCode).
+//  6. Outputs: It collects the `key=value` outputs the script wrote to the file
+//     named by `VAR_OUTPUT_FILE`, even if the script failed.
+//  7. Hooks: The step's `before` hooks run just before the script, which is not
+//     run if one of them fails, and its `after` hooks run after it, even if it
+//     failed (see runHooks). When `retry` is true, i.e. for every attempt but the
+//     first, the step's `before_retry` commands run first, the same way.
 //
-// Returns an error if any part of the setup or the script execution itself fails.
-func (w *WHAM) executeStep(step *Step, force bool, prevRunID string) error {
+// Returns the step's result and an error if any part of the setup or the script
+// execution itself fails.
+func (w *WHAM) executeStep(step *Step, force bool, prevState StepState, idempotencyKey string, retry bool) (stepResult, error) {
+	var result stepResult
+	if step.Type == StepTypeFreshness && step.Freshness.File != "" {
+		// The watermark is the file's modification time: there is no command to run.
+		return result, nil
+	}
+	if step.Type == StepTypeWorkflow {
+		return w.executeSubWorkflow(step, force)
+	}
+	logger := w.stepLogger(step)
 	executable, err := w.validateStepExecutable(step)
 	if err != nil {
-		return err // Error already contains context about the step name.
+		return result, err // Error already contains context about the step name.
 	}
 
 	// 3. Assemble command-line arguments with runtime templating.
 	templateContext := TemplateContext{
-		Forced:   force,      // Is this a forced run?
-		Step:     step,       // The current step's data.
-		RunID:    prevRunID,  // The previous run_id for this step.
-		Config:   w.config,   // The entire configuration.
-		StepsMap: w.stepsMap, // Provide access to all steps by name.
+		Forced:         force,                // Is this a forced run?
+		IdempotencyKey: idempotencyKey,       // The key shared by all the attempts of the step.
+		WorkflowRunID:  w.workflowRunID(),    // The ID of the workflow run in progress, if any.
+		Step:           step,                 // The current step's data.
+		RunID:          prevState.RunID,      // The previous run_id for this step.
+		Watermark:      prevState.Watermark,  // The watermark recorded by the previous runs of this step.
+		Config:         w.config,             // The entire configuration.
+		StepsMap:       w.steps(),            // Provide access to all steps by name.
+		DryRun:         w.dryRunMarked(step), // Should the step avoid side effects?
 	}
 
 	// Combine command, shared, and local args into the final args slice.
 	// Start with the arguments from the command definition itself.
-	args := step.Command[1:]
+	var args []string
+	if len(step.Command) > 1 {
+		args = append(args, step.Command[1:]...)
+	}
+
+	// For dbt steps, the dbt arguments replace the shared args, which are meant for scripts.
+	sharedArgs := w.config.WhamSettings.SharedArgs
+	if step.Type == StepTypeDbt {
+		args = append(args, w.dbtArgs(step)...)
+		sharedArgs = nil
+	}
 
 	// Process and append shared args. Each template can expand into multiple space-separated arguments.
-	for _, sharedArgTpl := range w.config.WhamSettings.SharedArgs {
+	for _, sharedArgTpl := range sharedArgs {
 		processedArg, err := w.processTemplateString(sharedArgTpl, templateContext)
 		if err != nil {
-			return fmt.Errorf("failed to process shared_arg template '%s' for step '%s': %w", sharedArgTpl, step.Name, err)
+			return result, fmt.Errorf("failed to process shared_arg template '%s' for step '%s': %w", sharedArgTpl, step.Name, err)
 		}
 		if processedArg != "" {
 			args = append(args, strings.Fields(processedArg)...)
 		}
 	}
 
-	// Process and append local args. Each element in the slice is a single argument.
+	// Process and append local args. Each element in the slice is a single argument,
+	// unless it renders a list (e.g., the files matched by `glob`), which expands into
+	// one argument per item.
 	for _, argTpl := range step.Args {
-		processedArg, err := w.processTemplateString(argTpl, templateContext)
+		processedArgs, err := w.processTemplateArgs(argTpl, templateContext)
 		if err != nil {
-			return fmt.Errorf("failed to process arg template '%s' for step '%s': %w", argTpl, step.Name, err)
-		}
-		// Append the processed argument as a whole. This handles spaces correctly.
-		if processedArg != "" {
-			args = append(args, processedArg)
+			return result, fmt.Errorf("failed to process arg template '%s' for step '%s': %w", argTpl, step.Name, err)
 		}
+		// Append the processed arguments as a whole. This handles spaces correctly.
+		args = append(args, processedArgs...)
 	}
 
 	// 4. Prepare the command and its environment.
-	cmd := exec.Command(executable, args...)
+	ctx := w.runContext()
+	if step.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, step.Timeout)
+		defer cancel()
+	}
+	// The script of the step alone can be cancelled with `wham cancel <step>`.
+	ctx, cancelStep := context.WithCancelCause(ctx)
+	defer cancelStep(nil)
+	defer w.trackStepCancel(step.Name, cancelStep)()
+	cmd := exec.CommandContext(ctx, executable, args...)
+	// Run the script in its own process group, so that it can be signaled along with
+	// any process it spawned (a negative PID signals the whole group).
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	// Drop privileges if the step runs as another user or group.
+	identity, err := resolveRunAs(step)
+	if err != nil {
+		return result, err
+	}
+	if identity != nil {
+		cmd.SysProcAttr.Credential = identity.credential
+	}
+	var forceKill *time.Timer
+	cmd.Cancel = func() error {
+		pgid := -cmd.Process.Pid
+		gracePeriod, sig := step.KillGracePeriod, syscall.SIGTERM
+		var intr interruption
+		interrupted := errors.As(context.Cause(ctx), &intr)
+		if interrupted {
+			// Forward the signal, so the script can clean up as if it had been
+			// interrupted directly.
+			sig = intr.signal
+		}
+		if gracePeriod == 0 {
+			if !interrupted && !errors.Is(context.Cause(ctx), errStepCancelled) {
+				return syscall.Kill(pgid, syscall.SIGKILL) // Timed out.
+			}
+			gracePeriod = signalGracePeriod
+		}
+		// Do not let the script delay the shutdown indefinitely.
+		forceKill = time.AfterFunc(gracePeriod, func() { syscall.Kill(pgid, syscall.SIGKILL) })
+		return syscall.Kill(pgid, sig)
+	}
 	cmd.Env = os.Environ() // Inherit the current process's environment.
 
 	// Set the working directory for the script if specified.
-	if step.WorkDir != "" {
-		workDir := step.WorkDir
-		// Resolve relative paths based on the config file's directory.
-		if !filepath.IsAbs(workDir) {
-			workDir = filepath.Join(w.config.ConfigDir, workDir)
-		}
-		workDir = filepath.Clean(workDir)
-
-		// Verify the working directory exists and is a directory.
-		stat, err := os.Stat(workDir)
-		if err != nil || !stat.IsDir() {
-			return fmt.Errorf("invalid work_dir '%s' for step '%s': path does not exist or is not a directory", step.WorkDir, step.Name)
-		}
-		cmd.Dir = workDir
+	if cmd.Dir, err = w.resolveWorkDir(step); err != nil {
+		return result, err
 	}
 
 	cmd.Env = append(cmd.Env, fmt.Sprintf("VAR_DATA_DIR=%s", w.config.WhamSettings.DataDir))
 	cmd.Env = append(cmd.Env, fmt.Sprintf("VAR_METADATA_DIR=%s", w.config.WhamSettings.MetadataDir))
+	cmd.Env = append(cmd.Env, fmt.Sprintf("VAR_IDEMPOTENCY_KEY=%s", idempotencyKey))
+	cmd.Env = append(cmd.Env, fmt.Sprintf("VAR_WHAM_RUN_ID=%s", w.workflowRunID()))
+	if w.dryRunMarked(step) {
+		cmd.Env = append(cmd.Env, "VAR_WHAM_DRY_RUN=1")
+	}
+	// Where an incremental script resumes from (see lastSuccess).
+	if last, err := w.lastSuccess(step.Name); err != nil {
+		logger.Warn().Str("step", step.Name).Err(err).Msg("Could not determine the last successful execution of the step.")
+	} else if !last.RunDate.IsZero() {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("VAR_LAST_SUCCESS_DATE=%s", last), fmt.Sprintf("VAR_LAST_SUCCESS_RUN_ID=%s", last.RunID))
+	}
+	if step.IsStateful && step.StateFile != "" {
+		// Where `wham state-helper write` writes the state file by default.
+		cmd.Env = append(cmd.Env, fmt.Sprintf("VAR_STATE_FILE=%s", filepath.Join(w.config.WhamSettings.MetadataDir, step.StateFile)))
+		cmd.Env = append(cmd.Env, fmt.Sprintf("VAR_RUN_ID_VAR=%s", step.RunIdVar))
+	}
+
+	// Provide an empty file where the script can report its outputs as key=value lines.
+	outputFile, err := os.CreateTemp("", "wham_outputs_*")
+	if err != nil {
+		return result, fmt.Errorf("failed to create outputs file for step '%s': %w", step.Name, err)
+	}
+	outputFile.Close()
+	defer os.Remove(outputFile.Name())
+	if identity != nil {
+		// The script must be able to write its outputs as the user it runs as.
+		if err := os.Chown(outputFile.Name(), int(identity.credential.Uid), int(identity.credential.Gid)); err != nil {
+			return result, fmt.Errorf("failed to hand the outputs file of step '%s' over to its user: %w", step.Name, err)
+		}
+		cmd.Env = append(cmd.Env, identity.environ()...)
+	}
+	cmd.Env = append(cmd.Env, fmt.Sprintf("VAR_OUTPUT_FILE=%s", outputFile.Name()))
+	if step.ScratchDir != nil {
+		scratch, err := w.createScratchDir(step, identity)
+		if err != nil {
+			return result, err
+		}
+		defer func() {
+			if err := scratch.remove(); err != nil {
+				logger.Warn().Str("step", step.Name).Err(err).Msg("Could not remove scratch directory.")
+			}
+		}()
+		cmd.Env = append(cmd.Env, fmt.Sprintf("VAR_SCRATCH_DIR=%s", scratch.path), fmt.Sprintf("TMPDIR=%s", scratch.path))
+	}
+	// Inject the variables of the env files, which connections and env_vars can override.
+	envFileVars, err := w.loadEnvFiles(step, templateContext)
+	if err != nil {
+		return result, fmt.Errorf("failed to load env files of step '%s': %w", step.Name, err)
+	}
+	cmd.Env = append(cmd.Env, envFileVars...)
+	// Inject the variables of the step's connection, which the step's own env_vars can override.
+	if step.Connection != "" {
+		for k, v := range w.config.Connections[step.Connection].EnvVars {
+			processedVal, err := w.processTemplateString(v, templateContext)
+			if err != nil {
+				return result, fmt.Errorf("failed to process template for env_var '%s' of connection '%s' in step '%s': %w", k, step.Connection, step.Name, err)
+			}
+			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, processedVal))
+		}
+	}
 	for k, v := range step.EnvVars {
 		// Process the template for the value of the environment variable.
 		processedVal, err := w.processTemplateString(v, templateContext)
 		if err != nil {
 			// Provide a more specific error message.
-			return fmt.Errorf("failed to process template for env_var '%s' in step '%s': %w", k, step.Name, err)
+			return result, fmt.Errorf("failed to process template for env_var '%s' in step '%s': %w", k, step.Name, err)
 		}
 		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, processedVal))
 	}
 
 	// 5. Execute the command and stream its output.
-	cmd.Stdout = os.Stdout
+	var console io.Writer = os.Stdout
+	if step.LogLevel == LogLevelQuiet {
+		console = io.Discard // Errors are still reported on stderr.
+	}
+	cmd.Stdout = console
 	cmd.Stderr = os.Stderr
+	stderr := tailBuffer{limit: stderrTailLimit}
+	var stdout bytes.Buffer
+	if capturesStdout(step) {
+		// Keep streaming the output while capturing it for later interpretation.
+		cmd.Stdout = io.MultiWriter(console, &stdout)
+	}
+
+	logger.Debug().Str("step", step.Name).Str("command", cmd.String()).Interface("templateContext", templateContext).Msg("Executing command with runtime context.")
+
+	var hookErr error
+	if retry {
+		// Repair what the failed attempt left behind before trying again.
+		hookErr = w.runHooks(ctx, step, "before_retry", step.BeforeRetry, cmd, console, errBeforeRetryFailed)
+	}
+	if hookErr == nil {
+		hookErr = w.runHooks(ctx, step, "before", step.Before, cmd, console, errBeforeHookFailed)
+	}
+	if hookErr != nil {
+		// The command is not run, but the `after` hooks still clean up.
+		if afterErr := w.runHooks(w.runContext(), step, "after", step.After, cmd, console, errAfterHookFailed); afterErr != nil {
+			result.Warnings = append(result.Warnings, afterErr.Error())
+		}
+		return result, hookErr
+	}
+
+	startedAt := time.Now()
+	var pipe *stderrPipe
+	if step.TTY {
+		// Under a pseudo-terminal, the standard error is merged into the output.
+		err = runInPTY(cmd, io.MultiWriter(cmd.Stdout, &stderr))
+	} else if pipe, err = pipeStderr(cmd, io.MultiWriter(os.Stderr, &stderr)); err == nil {
+		err = cmd.Run()
+	}
+	if forceKill != nil {
+		// The script exited after being interrupted: kill what is left of its group,
+		// so that no process it spawned is orphaned.
+		forceKill.Stop()
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	if pipe != nil {
+		pipe.close()
+	}
+	result.Outputs = w.readStepOutputs(step, outputFile.Name())
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+	if step.Type == StepTypeDbt {
+		// dbt writes its artifacts in the project directory, or in its working directory.
+		projectDir := cmd.Dir
+		if step.Dbt.ProjectDir != "" {
+			projectDir = w.resolvePath(step.Dbt.ProjectDir)
+		} else if projectDir == "" {
+			projectDir, _ = os.Getwd()
+		}
+		w.collectDbtResults(step, projectDir, startedAt, &result)
+	}
+	err = w.checkRunOutcome(ctx, step, err, &result)
+
+	// The `after` hooks run even if the command failed or timed out. Their failure
+	// fails a successful execution, and is recorded as a warning otherwise.
+	if afterErr := w.runHooks(w.runContext(), step, "after", step.After, cmd, console, errAfterHookFailed); afterErr != nil {
+		if err == nil {
+			return result, afterErr
+		}
+		result.Warnings = append(result.Warnings, afterErr.Error())
+		logger.Warn().Str("step", step.Name).Err(afterErr).Msg("Hook failed after the step failed.")
+	}
+	return result, err
+}
+
+// checkRunOutcome returns the error of a finished execution of a step's command:
+// the cause of the workflow run's abortion, the cancellation of the step or its
+// timeout (`ctx` being the context of the command), or its exit code as
+// interpreted by checkExitCode.
+func (w *WHAM) checkRunOutcome(ctx context.Context, step *Step, runErr error, result *stepResult) error {
+	if w.runContext().Err() != nil {
+		return context.Cause(w.runContext())
+	}
+	if errors.Is(context.Cause(ctx), errStepCancelled) {
+		return errStepCancelled
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%w after %s", errStepTimeout, step.Timeout)
+	}
+	return w.checkExitCode(step, runErr, result)
+}
+
+// checkExitCode interprets the outcome of a script's execution according to the
+// step's `success_exit_codes` and `warning_exit_codes`.
+//
+// By default, only the exit code 0 means success; `success_exit_codes` replaces that
+// default when set. An exit code listed in `warning_exit_codes` prints a warning but
+// counts as a success, and is recorded in the result. Any other exit code, and any
+// error that kept the script from running to completion (e.g., a signal), is
+// returned as an error.
+func (w *WHAM) checkExitCode(step *Step, runErr error, result *stepResult) error {
+	code := 0
+	if runErr != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(runErr, &exitErr) || exitErr.ExitCode() < 0 {
+			return fmt.Errorf("script execution failed: %w", runErr)
+		}
+		code = exitErr.ExitCode()
+	}
+	successCodes := step.SuccessExitCodes
+	if len(successCodes) == 0 {
+		successCodes = []int{0}
+	}
+	switch {
+	case slices.Contains(successCodes, code):
+		if code != 0 {
+			w.logger.Info().Str("step", step.Name).Int("exit_code", code).Msg("Script exited with a success exit code.")
+		}
+		return nil
+	case slices.Contains(step.WarningExitCodes, code):
+		result.Warnings = append(result.Warnings, fmt.Sprintf("exited with warning exit code %d", code))
+		fmt.Printf("⚠️ Step '%s' exited with warning exit code %d.\n", step.Name, code)
+		w.logger.Warn().Str("step", step.Name).Int("exit_code", code).Msg("Script exited with a warning exit code, continuing.")
+		return nil
+	case runErr != nil:
+		return fmt.Errorf("script execution failed: %w", runErr)
+	default:
+		return fmt.Errorf("script execution failed: exit status %d is not a success exit code", code)
+	}
+}
+
+// failureReason returns the reason recorded in the state of a step that failed
+// with the given error, or an empty string if the failure needs no explanation.
+func failureReason(err error) string {
+	if errors.Is(err, errStepTimeout) {
+		return ReasonTimeout
+	}
+	if errors.Is(err, errWorkflowTimeout) {
+		return ReasonWorkflowTimeout
+	}
+	if errors.Is(err, errInterrupted) {
+		return ReasonInterrupted
+	}
+	if errors.Is(err, errStepCancelled) {
+		return ReasonStepCancelled
+	}
+	if errors.Is(err, errBeforeHookFailed) {
+		return ReasonBeforeHookFailed
+	}
+	if errors.Is(err, errBeforeRetryFailed) {
+		return ReasonBeforeRetryFailed
+	}
+	if errors.Is(err, errAfterHookFailed) {
+		return ReasonAfterHookFailed
+	}
+	if errors.Is(err, errStaleOutputs) {
+		return ReasonStaleOutputs
+	}
+	return ""
+}
 
-	w.logger.Debug().Str("step", step.Name).Str("command", cmd.String()).Interface("templateContext", templateContext).Msg("Executing command with runtime context.")
+// capturesStdout reports whether the standard output of a step must be captured
+// in its result, in addition to being streamed to the console.
+func capturesStdout(step *Step) bool {
+	return step.Type == StepTypeCheck || step.Type == StepTypeFreshness || step.GeneratesSteps
+}
 
-	err = cmd.Run()
+// readStepOutputs reads the outputs a script reported in its outputs file.
+// A missing or unreadable file is logged and results in no outputs.
+func (w *WHAM) readStepOutputs(step *Step, path string) map[string]string {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return fmt.Errorf("script execution failed: %w", err)
+		w.logger.Warn().Str("step", step.Name).Str("path", path).Err(err).Msg("Could not read step outputs file.")
+		return nil
+	}
+	outputs := parseKeyValues(string(data))
+	if len(outputs) > 0 {
+		w.logger.Debug().Str("step", step.Name).Interface("outputs", outputs).Msg("Step reported outputs.")
 	}
+	return outputs
+}
 
-	return nil
+// parseKeyValues parses `key=value` lines, such as those of a state or outputs file.
+// Empty lines, comments (starting with '#') and lines without '=' are ignored.
+// If a key appears more than once, the last value wins.
+// Returns nil if no key-value pair was found.
+func parseKeyValues(content string) map[string]string {
+	var values map[string]string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found || strings.TrimSpace(key) == "" {
+			continue
+		}
+		if values == nil {
+			values = make(map[string]string)
+		}
+		values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return values
 }
 
 // validateStepExecutable centralizes the logic for checking if a step's command is valid.
@@ -296,6 +914,18 @@ func (w *WHAM) executeStep(step *Step, force bool, prevRunID string) error {
 func (w *WHAM) validateStepExecutable(step *Step) (string, error) {
 	// 1. Validate and resolve the command executable.
 	if len(step.Command) == 0 {
+		if step.Type == StepTypeFreshness && step.Freshness != nil && step.Freshness.File != "" {
+			// A freshness step observing a file runs no command.
+			return "", nil
+		}
+		if step.Type == StepTypeDbt {
+			// dbt steps default to the dbt executable found on the PATH.
+			executable, err := exec.LookPath("dbt")
+			if err != nil {
+				return "", fmt.Errorf("dbt executable for step '%s' not found on the PATH", step.Name)
+			}
+			return executable, nil
+		}
 		return "", fmt.Errorf("step '%s' has an empty 'command' definition", step.Name)
 	}
 	executable := step.Command[0]
@@ -320,6 +950,28 @@ func (w *WHAM) validateStepExecutable(step *Step) (string, error) {
 	return executable, nil
 }
 
+// resolveWorkDir returns the working directory of a step's script, resolved
+// against the config file's directory, or "" if the step has no `work_dir`. It
+// must be an existing directory.
+func (w *WHAM) resolveWorkDir(step *Step) (string, error) {
+	if step.WorkDir == "" {
+		return "", nil
+	}
+	workDir := step.WorkDir
+	// Resolve relative paths based on the config file's directory.
+	if !filepath.IsAbs(workDir) {
+		workDir = filepath.Join(w.config.ConfigDir, workDir)
+	}
+	workDir = filepath.Clean(workDir)
+
+	// Verify the working directory exists and is a directory.
+	stat, err := os.Stat(workDir)
+	if err != nil || !stat.IsDir() {
+		return "", fmt.Errorf("invalid work_dir '%s' for step '%s': path does not exist or is not a directory", step.WorkDir, step.Name)
+	}
+	return workDir, nil
+}
+
 // formatPreviousSteps is a display helper that formats a slice of predecessor names
 // into a human-readable string.
 //
@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+)
+
+// PlannedStep is the outcome a step would have in a `run all`, as predicted by a dry run.
+type PlannedStep struct {
+	// StepName is the name of the step.
+	StepName string `json:"step_name" yaml:"step_name"`
+	// Action is the predicted action ("run" or "skipped").
+	Action string `json:"action" yaml:"action"`
+	// Reason is the reason the step would be skipped. See the Reason* constants.
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+	// Detail explains the prediction in human-readable terms.
+	Detail string `json:"detail" yaml:"detail"`
+}
+
+// ShowPlan performs a dry run of `run all`: it displays which steps would run or be
+// skipped, and why, without executing any script or writing any state.
+func (w *WHAM) ShowPlan(opts RunOptions, outputFormat string) error {
+	plan, err := w.planAllSteps(opts)
+	if err != nil {
+		return err
+	}
+
+	switch outputFormat {
+	case "json", "yaml":
+		return RenderData(os.Stdout, plan, outputFormat)
+	case "table", "wide":
+		tr := NewTableRenderer(os.Stdout, "NAME", "ACTION", "DETAIL")
+		for _, p := range plan {
+			action := p.Action
+			if p.Reason != "" {
+				action += " (" + p.Reason + ")"
+			}
+			tr.AddRow(p.StepName, action, p.Detail)
+		}
+		return tr.Render()
+	default:
+		return fmt.Errorf("unsupported output format: '%s'", outputFormat)
+	}
+}
+
+// planAllSteps predicts the outcome of every step of a `run all` with the given
+// options, in topological order, applying the same decisions as RunStep.
+//
+// Since nothing is executed, the run_id a step would produce is unknown. A stateless
+// step with a predecessor that would run is therefore predicted to run, as it does
+// whenever that predecessor's run_id changes. Its precondition checks are left to
+// the actual run, once its predecessors have produced their state.
+//
+// As in a serial `run all`, a failed precondition halts the workflow: the steps
+// after it are predicted as skipped with the reason "cancelled".
+func (w *WHAM) planAllSteps(opts RunOptions) ([]PlannedStep, error) {
+	sortedSteps, err := w.getExecutionOrder()
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine step execution order: %w", err)
+	}
+	filteredSteps, err := w.filterDAGForExecution(sortedSteps, opts.From, opts.To)
+	if err != nil {
+		return nil, err
+	}
+	filteredSteps, err = w.selectOnlySteps(filteredSteps, opts.Only)
+	if err != nil {
+		return nil, err
+	}
+	stepsToRun, excludedSteps, err := w.excludeSkippedSteps(filteredSteps, opts.Skip, opts.SkipDescendants)
+	if err != nil {
+		return nil, err
+	}
+	selected := make(map[string]bool, len(stepsToRun))
+	for _, step := range stepsToRun {
+		selected[step.Name] = true
+	}
+	excluded := make(map[string]bool, len(excludedSteps))
+	for _, step := range excludedSteps {
+		excluded[step.Name] = true
+	}
+
+	plan := make([]PlannedStep, 0, len(sortedSteps))
+	willRun := make(map[string]bool)
+	haltedAt := ""
+	for _, step := range sortedSteps {
+		if excluded[step.Name] {
+			plan = append(plan, PlannedStep{StepName: step.Name, Action: "skipped", Reason: ReasonExcludedBySkip, Detail: "excluded by --skip"})
+			continue
+		}
+		if !selected[step.Name] && len(opts.Only) > 0 {
+			plan = append(plan, PlannedStep{StepName: step.Name, Action: "skipped", Reason: ReasonNotInOnly, Detail: "not listed in --only"})
+			continue
+		}
+		planned := w.planStep(step, opts.Force, selected[step.Name], haltedAt, willRun)
+		if planned.Action == "run" {
+			willRun[step.Name] = true
+		}
+		if planned.Reason == ReasonPreconditionFailed {
+			haltedAt = step.Name
+		}
+		plan = append(plan, planned)
+	}
+	return plan, nil
+}
+
+// planStep predicts the outcome of a single step. See planAllSteps.
+func (w *WHAM) planStep(step *Step, force, selected bool, haltedAt string, willRun map[string]bool) PlannedStep {
+	skipped := func(reason, detail string) PlannedStep {
+		return PlannedStep{StepName: step.Name, Action: "skipped", Reason: reason, Detail: detail}
+	}
+	run := func(detail string) PlannedStep {
+		return PlannedStep{StepName: step.Name, Action: "run", Detail: detail}
+	}
+
+	switch {
+	case !selected:
+		return skipped(ReasonFilteredByFromTo, "left out by --from/--to")
+	case haltedAt != "":
+		return skipped(ReasonCancelled, fmt.Sprintf("not reached, the workflow halts at step '%s'", haltedAt))
+	case !force && w.config.WhamSettings.Maintenance:
+		return skipped(ReasonMaintenance, "the workflow is in maintenance mode")
+	case !force && step.Disabled:
+		return skipped(ReasonDisabled, "the step is disabled")
+	case !force && w.disabledAncestor(step) != "":
+		return skipped(ReasonDisabled, fmt.Sprintf("its ancestor '%s' is disabled", w.disabledAncestor(step)))
+	}
+	if !force && step.When != "" {
+		ok, err := w.evaluateWhen(step, force, w.getCurrentStepWhamState(step.Name))
+		if err != nil {
+			return skipped(ReasonPreconditionFailed, err.Error())
+		}
+		if !ok {
+			return skipped(ReasonWhenFalse, fmt.Sprintf("the 'when' condition %s is false", step.When))
+		}
+	}
+	switch {
+	case force:
+		return run("forced")
+	case producesOwnRunID(step):
+		return run("stateful steps always run")
+	}
+
+	for _, prev := range step.PreviousSteps {
+		predStep := w.findStep(prev)
+		// Stateless source nodes do not contribute a run_id, so their execution changes nothing.
+		if willRun[prev] && predStep != nil && (producesOwnRunID(predStep) || len(predStep.PreviousSteps) > 0) {
+			return run(fmt.Sprintf("previous step '%s' will run, the step runs if its run_id changes", prev))
+		}
+	}
+	inputsHash, err := w.inputsHash(step)
+	if err != nil {
+		return skipped(ReasonPreconditionFailed, err.Error())
+	}
+	shouldRun, err := w.shouldRunStep(step, inputsHash)
+	if err != nil {
+		return skipped(ReasonPreconditionFailed, err.Error())
+	}
+	if !shouldRun {
+		if len(step.Inputs) > 0 {
+			return skipped(ReasonNoChange, "no changes in previous steps or inputs since the last run")
+		}
+		return skipped(ReasonNoChange, "no changes in previous steps since the last run")
+	}
+	if len(step.Inputs) > 0 && inputsChanged(w.getCurrentStepWhamState(step.Name), inputsHash) {
+		return run("inputs changed since the last successful run")
+	}
+	if len(step.PreviousSteps) == 0 {
+		return run("stateless source steps always run")
+	}
+	return run("previous steps changed since the last run")
+}
@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"slices"
 	"time"
 )
 
@@ -19,8 +21,9 @@ import (
 //     if its state (and thus its `run_id`) has changed.
 //  3. Stateless Step: If the step is stateless (and not forced), its execution depends
 //     on the `shouldRunStep` helper. This function checks if the `run_id` of its
-//     predecessors has changed since this step's last successful run. If a predecessor
-//     is not ready (e.g., has not run yet), this function will return an error.
+//     predecessors has changed since this step's last successful run, and for a step
+//     with `inputs`, whether their content changed. If a predecessor is not ready
+//     (e.g., has not run yet), this function will return an error.
 //
 // # Outcome Recording
 //
@@ -29,47 +32,142 @@ import (
 //     is always "run". For a `stateless` step, the action is "skipped" if its `run_id`
 //     is unchanged, otherwise it is "run".
 //   - Skipped (Pre-execution): If `shouldRunStep` returns false, the step is not executed.
-//     The state is saved with the previous `run_id` and the action "skipped".
-//   - Failure (`can_fail: true`): The script fails, but the workflow continues. The state
-//     is saved with the action "failed". A `stateless` step inherits the `run_id` from
-//     its predecessors to maintain DAG consistency, while a `stateful` step retains its
-//     previous `run_id` as it failed to generate a new state.
+//     The state is saved with the previous `run_id`, the action "skipped" and a reason
+//     (see the Reason* constants). Disabled steps and their descendants, steps whose
+//     `when` condition is false and all steps of a workflow in maintenance mode are
+//     skipped the same way, unless forced.
+//   - Failure (`can_fail: true`, or any step of a `run all --continue-on-error`): The
+//     script fails, but the workflow continues. The state is saved with the action
+//     "failed". A `stateless` step inherits the `run_id` from its predecessors to
+//     maintain DAG consistency, while a `stateful` step retains its previous `run_id`
+//     as it failed to generate a new state.
 //   - Failure (`can_fail: false`): The script fails, and the function returns an error,
 //     halting the entire workflow.
+//
+// A step with named locks (`locks`) waits until it holds all of them before its
+// first attempt, and releases them once its last attempt is over; if the workflow
+// run is aborted meanwhile, it is recorded as skipped with the reason "cancelled".
+//
+// An execution whose outputs do not meet the step's `success_criteria` counts as a
+// failed attempt, unless the step's `success_criteria_policy` is "warn"; so does one
+// that does not produce the step's `expected_outputs`, with the reason "stale_outputs",
+// unless its `expected_outputs_policy` is "warn". A step reached after its
+// `must_start_by` time prints an SLA warning; with the "fail" policy, it is recorded
+// as failed without being executed. An attempt exceeding the step's `timeout` is
+// killed and counts as failed; if no attempt succeeds, the step is recorded as
+// failed with the reason "timeout". A step killed because the execution was aborted
+// is not retried, and is recorded as failed with the reason "workflow_timeout" or
+// "interrupted".
+//
+// Degradations that do not make the step fail (a warning exit code, a missed
+// `must_start_by` time, unmet criteria, checks or expected outputs with the "warn"
+// policy, or stale data from a failed `can_fail` predecessor) are recorded as
+// warnings in its state.
+//
+// A WHAM state file that cannot be read, after retries, halts the step with an
+// error instead of being treated as empty (see loadStepWhamState).
+//
+// When notifications are configured, failures and recoveries of executed steps
+// are reported (see notifyStepOutcome). A step whose failure rate exceeds its
+// `max_failure_rate` is reported as well, even if it can fail (see checkFailureRate).
+//
+// The steps printed by a successful generator step (`generates_steps: true`) are
+// added to the DAG; an output that cannot be parsed into valid steps counts as a
+// failed attempt. Only `run all` executes them (see takeGeneratedSteps).
 func (w *WHAM) RunStep(stepName string, force bool) error {
 	step := w.findStep(stepName)
 	if step == nil {
 		return fmt.Errorf("step '%s' not found", stepName)
 	}
+	logger := w.stepLogger(step)
 
-	w.logger.Debug().Str("step", stepName).Bool("force", force).Msg("Attempting to run step")
+	logger.Debug().Str("step", stepName).Bool("force", force).Msg("Attempting to run step")
+	w.trackInspection(func(insp *inspection) { insp.stepStarts[stepName] = time.Now() })
+	w.updateInspection(func(p *RunProgress) { p.CurrentSteps = append(p.CurrentSteps, stepName) })
+	defer w.updateInspection(func(p *RunProgress) {
+		p.CurrentSteps = slices.DeleteFunc(p.CurrentSteps, func(s string) bool { return s == stepName })
+		p.StepsDone++
+	})
+	defer w.trackInspection(func(insp *inspection) {
+		delete(insp.stepStarts, stepName)
+		insp.finished[stepName] = true
+	})
 
 	// Pre-read current WHAM state (run_id from previous WHAM execution)
-	prevWhamState := w.getCurrentStepWhamState(stepName)
+	// A state that cannot be read halts the step rather than being mistaken for a
+	// step that never ran, which would re-run it.
+	prevWhamState, err := w.loadStepWhamState(stepName)
+	if err != nil {
+		return fmt.Errorf("could not read the state of step '%s': %w", stepName, err)
+	}
 	prevWhamRunID := prevWhamState.RunID // Can be empty if no previous state
 
 	var shouldRun bool
 	var elapsed time.Duration
-	var err error
+
+	if !force {
+		// Disabled steps and workflows in maintenance mode are skipped before any other check.
+		if w.config.WhamSettings.Maintenance {
+			w.recordNotExecuted(stepName, ReasonMaintenance)
+			fmt.Printf("⏸️ Step '%s' skipped (maintenance mode).\n", stepName)
+			logger.Info().Str("step", stepName).Msg("Step skipped due to maintenance mode.")
+			return nil
+		}
+		if step.Disabled {
+			w.recordNotExecuted(stepName, ReasonDisabled)
+			fmt.Printf("⏸️ Step '%s' skipped (disabled).\n", stepName)
+			logger.Info().Str("step", stepName).Msg("Disabled step skipped.")
+			return nil
+		}
+		if ancestor := w.disabledAncestor(step); ancestor != "" {
+			w.recordNotExecuted(stepName, ReasonDisabled)
+			fmt.Printf("⏸️ Step '%s' skipped (its ancestor '%s' is disabled).\n", stepName, ancestor)
+			logger.Info().Str("step", stepName).Str("ancestor", ancestor).Msg("Step skipped as an ancestor is disabled.")
+			return nil
+		}
+		// A `when` condition that cannot be evaluated fails the step's preconditions.
+		run, err := w.evaluateWhen(step, force, prevWhamState)
+		if err != nil {
+			w.saveStepWhamState(stepName, StepState{RunID: prevWhamRunID, RunAction: "skipped", Reason: ReasonPreconditionFailed})
+			fmt.Printf("🚫 Step '%s' skipped (precondition check failed).\n", stepName)
+			logger.Warn().Str("step", stepName).Err(err).Msg("Step skipped due to precondition failure.")
+			return fmt.Errorf("precondition check failed for step '%s': %w", stepName, err)
+		}
+		if !run {
+			w.saveStepWhamState(stepName, StepState{RunID: prevWhamRunID, RunAction: "skipped", Reason: ReasonWhenFalse})
+			fmt.Printf("⏭️ Step '%s' skipped (when: %s is false).\n", stepName, step.When)
+			logger.Info().Str("step", stepName).Str("when", step.When).Msg("Step skipped as its 'when' condition is false.")
+			return nil
+		}
+	}
+
+	// The inputs are hashed before the execution, which consumes them as they are now.
+	inputsHash, err := w.inputsHash(step)
+	if err != nil {
+		w.saveStepWhamState(stepName, StepState{RunID: prevWhamRunID, RunAction: "skipped", Reason: ReasonPreconditionFailed})
+		fmt.Printf("🚫 Step '%s' skipped (precondition check failed).\n", stepName)
+		logger.Warn().Str("step", stepName).Err(err).Msg("Step skipped due to precondition failure.")
+		return fmt.Errorf("precondition check failed for step '%s': %w", stepName, err)
+	}
 
 	if force {
 		shouldRun = true // Always run if forced
-		w.logger.Info().Str("step", stepName).Msg("Step forced to run.")
-	} else if step.IsStateful {
-		// Stateful steps are ALWAYS executed if not forced.
+		logger.Info().Str("step", stepName).Msg("Step forced to run.")
+	} else if producesOwnRunID(step) {
+		// Stateful (and dbt) steps are ALWAYS executed if not forced.
 		// Their run_id is determined by their internal logic after execution.
 		shouldRun = true
-		w.logger.Info().Str("step", stepName).Msg("Stateful step will always execute (not forced).")
+		logger.Info().Str("step", stepName).Msg("Stateful step will always execute (not forced).")
 	} else { // Stateless step, not forced
-		shouldRun, err = w.shouldRunStep(step)
+		shouldRun, err = w.shouldRunStep(step, inputsHash)
 		if err != nil {
 			// An error from shouldRunStep indicates a precondition failure, such as
 			// an inconsistent or not-yet-run predecessor.
 			// The step is effectively skipped. We save this state and then return the
 			// error to halt a `run all` workflow, ensuring the failure is propagated.
-			w.saveStepWhamState(stepName, prevWhamRunID, "skipped", 0)
+			w.saveStepWhamState(stepName, StepState{RunID: prevWhamRunID, RunAction: "skipped", Reason: ReasonPreconditionFailed})
 			fmt.Printf("🚫 Step '%s' skipped (precondition check failed).\n", stepName)
-			w.logger.Warn().Str("step", stepName).Err(err).Msg("Step skipped due to precondition failure.")
+			logger.Warn().Str("step", stepName).Err(err).Msg("Step skipped due to precondition failure.")
 			return fmt.Errorf("precondition check failed for step '%s': %w", stepName, err)
 		}
 	}
@@ -77,36 +175,128 @@ func (w *WHAM) RunStep(stepName string, force bool) error {
 	if !shouldRun {
 		// Stateless step skipped. Save WHAM state based on previous state.
 		// A skipped step has an execution time of 0.
-		w.saveStepWhamState(stepName, prevWhamRunID, "skipped", 0)
+		w.saveStepWhamState(stepName, StepState{RunID: prevWhamRunID, RunAction: "skipped", Reason: ReasonNoChange})
 		fmt.Printf("✅ Step '%s' skipped (no changes detected).\n", stepName)
-		w.logger.Info().Str("step", stepName).Msg("Stateless step skipped.")
+		logger.Info().Str("step", stepName).Msg("Stateless step skipped.")
 		return nil
 	}
 
+	// A step is not started while the host is too busy, unless it waited long
+	// enough. It waits before taking its named locks, so as not to hold them.
+	hostWarning, guardErr := w.waitForHostGuards(step)
+	if guardErr != nil {
+		// The workflow run was aborted while the step was waiting: it did not start.
+		w.cancelSteps([]*Step{step}, cancelCauseAborted)
+		return guardErr
+	}
+
+	// A step sharing a resource with other steps waits for its named locks, if any.
+	// A step whose locks cannot be acquired is not attempted.
+	releaseLocks, lockErr := w.acquireStepLocks(step)
+	if lockErr != nil && w.runContext().Err() != nil {
+		// The workflow run was aborted while the step was waiting: it did not start.
+		w.cancelSteps([]*Step{step}, cancelCauseAborted)
+		return lockErr
+	}
+	if lockErr == nil {
+		defer releaseLocks()
+	}
+
 	// --- Execute the step with retry logic ---
+	var result stepResult
 	var execErr error
+	// A step that missed its must_start_by time is not attempted if its policy is "fail".
+	slaWarning, deadlineErr := w.checkMustStartBy(step)
 	startTime := time.Now()
+	// All the attempts share the same idempotency key, so that downstream systems can
+	// deduplicate the side effects of an attempt that timed out but succeeded.
+	idempotencyKey := w.idempotencyKey(step)
 	// The loop runs for the initial attempt (attempt 0) plus the number of retries.
-	for attempt := 0; attempt <= step.Retries; attempt++ {
+	for attempt := 0; deadlineErr == nil && lockErr == nil && attempt <= step.Retries; attempt++ {
 		if attempt > 0 {
-			w.logger.Warn().Str("step", step.Name).Int("attempt", attempt).Msgf("Retrying in %s...", step.RetryDelay)
-			time.Sleep(step.RetryDelay)
+			w.trackRetry(step, attempt, execErr)
+			logger.Warn().Str("step", step.Name).Int("attempt", attempt).Msgf("Retrying in %s...", step.RetryDelay)
+			select {
+			case <-time.After(step.RetryDelay):
+			case <-w.runContext().Done():
+			}
+		}
+		if w.runContext().Err() != nil {
+			// The execution was aborted: there is no point in (re)trying.
+			execErr = context.Cause(w.runContext())
+			break
 		}
 		fmt.Printf("🚀 Running step '%s' (attempt %d/%d)...\n", stepName, attempt+1, step.Retries+1)
-		w.logger.Info().Str("step", stepName).Int("attempt", attempt+1).Int("total_attempts", step.Retries+1).Msg("Executing step.")
+		logger.Info().Str("step", stepName).Int("attempt", attempt+1).Int("total_attempts", step.Retries+1).Msg("Executing step.")
 
-		execErr = w.executeStep(step, force, prevWhamRunID)
+		// The expected outputs must be written by this attempt, not a previous one.
+		attemptStart, outputSnapshots := time.Now(), w.snapshotExpectedOutputs(step)
+		result, execErr = w.executeStep(step, force, prevWhamState, idempotencyKey, attempt > 0)
+		if execErr == nil {
+			// A check step must observe a value that meets its expectations.
+			execErr = w.evaluateCheck(step, &result, prevWhamState)
+		}
+		if execErr == nil {
+			// A freshness step must observe a watermark that is recent enough.
+			execErr = w.evaluateFreshness(step, &result)
+		}
+		if execErr == nil {
+			// A successful execution must also meet the step's success criteria, if any.
+			execErr = w.checkSuccessCriteria(step, &result)
+		}
+		if execErr == nil {
+			// It must also have produced its expected outputs, if any.
+			execErr = w.checkExpectedOutputs(step, outputSnapshots, attemptStart, &result)
+		}
+		if execErr == nil {
+			// A generator step must print valid step definitions.
+			execErr = w.parseGeneratedSteps(step, &result)
+		}
 		if execErr == nil {
 			break // Success, exit the retry loop
 		}
+		// The failure patterns of the step decide whether the failure is worth retrying.
+		execErr = w.classifyFailure(step, execErr, result)
+		if isFatalFailure(execErr) {
+			if attempt < step.Retries {
+				fmt.Printf("⛔ Step '%s' failed with a fatal failure (%s), not retrying.\n", stepName, failureClass(execErr))
+				logger.Warn().Str("step", stepName).Str("class", failureClass(execErr)).Msg("Fatal failure, skipping the remaining retries.")
+			}
+			break
+		}
+	}
+
+	if deadlineErr != nil {
+		execErr = deadlineErr
+	}
+	if lockErr != nil {
+		execErr = lockErr
+	}
+	// Degradations that did not make the step fail are recorded in its state.
+	var warnings []string
+	if hostWarning != "" {
+		warnings = append(warnings, hostWarning)
+	}
+	if slaWarning != "" {
+		warnings = append(warnings, slaWarning)
+	}
+	warnings = append(warnings, w.staleInputWarnings(step)...)
+	warnings = append(warnings, result.Warnings...)
+	// The step's failure rate is checked with the outcome of this execution.
+	if warning := w.checkFailureRate(step, execErr); warning != "" {
+		warnings = append(warnings, warning)
 	}
 
 	// If execErr is not nil here, it means all attempts have failed.
 	elapsed = time.Since(startTime)
 	if execErr != nil {
-		if step.CanFail {
-			fmt.Printf("⚠️ Step '%s' failed but continuing (can_fail=true): %v\n", stepName, execErr)
-			w.logger.Warn().Str("step", step.Name).Err(execErr).Msg("Step failed but allowed to continue.")
+		if w.stepCanFail(step) {
+			if step.CanFail {
+				fmt.Printf("⚠️ Step '%s' failed but continuing (can_fail=true): %v\n", stepName, execErr)
+			} else {
+				fmt.Printf("⚠️ Step '%s' failed but continuing (--continue-on-error): %v\n", stepName, execErr)
+			}
+			logger.Warn().Str("step", step.Name).Err(execErr).Msg("Step failed but allowed to continue.")
 			// If a step with can_fail:true fails, we must decide which run_id to save.
 			// - A STATELESS step inherits the run_id from its predecessors to maintain
 			//   DAG consistency and avoid re-running unnecessarily.
@@ -117,34 +307,52 @@ func (w *WHAM) RunStep(stepName string, force bool) error {
 			// an accurate history of the step's last known good state.
 			runIdToSaveOnFailure := prevWhamRunID
 
-			w.saveStepWhamState(step.Name, runIdToSaveOnFailure, "failed", elapsed)
+			w.saveStepWhamState(step.Name, StepState{RunID: runIdToSaveOnFailure, RunAction: "failed", Reason: failureReason(execErr), FailureClass: failureClass(execErr), Elapsed: elapsed, Outputs: result.Outputs, Warnings: warnings})
+			w.notifyStepOutcome(step, execErr)
 		} else {
-			w.logger.Error().Str("step", step.Name).Err(execErr).Msg("Step failed and cannot continue. Saving failed state.")
+			logger.Error().Str("step", step.Name).Err(execErr).Msg("Step failed and cannot continue. Saving failed state.")
 			// On a hard failure, we still save the state to record the failure event.
 			// The run_id is the *previous* one, because the step did not successfully
 			// complete a new run. If there was no previous run, this will be an empty string,
 			// which correctly signals to dependent steps that this predecessor is not in a valid state.
-			w.saveStepWhamState(step.Name, prevWhamRunID, "failed", elapsed)
+			w.saveStepWhamState(step.Name, StepState{RunID: prevWhamRunID, RunAction: "failed", Reason: failureReason(execErr), FailureClass: failureClass(execErr), Elapsed: elapsed, Outputs: result.Outputs, Warnings: warnings})
+			w.notifyStepOutcome(step, execErr)
 			return fmt.Errorf("step '%s' failed: %w", stepName, execErr)
 		}
 	} else {
 		// --- Step executed successfully, now update WHAM state ---
-		// Get the run_id generated/updated by the script
-		newActualRunID, err := w.getActualStepRunId(step)
-		if err != nil {
-			// The script ran successfully, but we can't determine its new state.
-			// This is a critical failure that compromises the integrity of the DAG.
-			return fmt.Errorf("step '%s' executed successfully, but failed to determine its new run_id: %w", step.Name, err)
+		// Get the run_id generated/updated by the script, unless the step type reported it.
+		newActualRunID := result.RunID
+		if newActualRunID == "" {
+			newActualRunID, err = w.getActualStepRunId(step)
+			if err != nil {
+				// The script ran successfully, but we can't determine its new state.
+				// This is a critical failure that compromises the integrity of the DAG.
+				return fmt.Errorf("step '%s' executed successfully, but failed to determine its new run_id: %w", step.Name, err)
+			}
 		}
-		w.logger.Debug().Str("step", step.Name).Str("new_actual_run_id", newActualRunID).Msg("New run ID from script execution.")
+		logger.Debug().Str("step", step.Name).Str("new_actual_run_id", newActualRunID).Msg("New run ID from script execution.")
 
 		// If execution reaches this point, the step was executed. The action is "run".
 		// The "skipped" action is handled *before* the execution block based on shouldRunStep.
 		runAction := "run"
 
-		w.saveStepWhamState(step.Name, newActualRunID, runAction, elapsed)
+		// The watermark advances to the value of its output, if the step reported it.
+		watermark := ""
+		if step.WatermarkFromOutput != "" {
+			watermark = result.Outputs[step.WatermarkFromOutput]
+			if watermark == "" {
+				logger.Warn().Str("step", step.Name).Str("output", step.WatermarkFromOutput).Msg("Step did not report its watermark output, keeping the previous watermark.")
+			}
+		}
+
+		w.saveStepWhamState(step.Name, StepState{RunID: newActualRunID, RunAction: runAction, Elapsed: elapsed, Outputs: result.Outputs, Warnings: warnings, Watermark: watermark, InputsHash: inputsHash})
+		w.notifyStepOutcome(step, nil)
 		fmt.Printf("✅ Step '%s' completed successfully.\n", stepName)
-		w.logger.Info().Str("step", step.Name).Msg("Step completed successfully.")
+		logger.Info().Str("step", step.Name).Msg("Step completed successfully.")
+		if err := w.addGeneratedSteps(step, result.GeneratedSteps); err != nil {
+			return fmt.Errorf("step '%s' executed successfully, but its generated steps could not be added: %w", step.Name, err)
+		}
 	}
 
 	return nil
@@ -157,41 +365,427 @@ func (w *WHAM) RunStep(stepName string, force bool) error {
 // sorted steps, calling `RunStep` for each one.
 //
 // The `force` flag is passed down to each `RunStep` call, causing all steps to be
-// executed unconditionally if set to true.
+// executed unconditionally if set to true. With `Parallel` above 1, independent
+// steps are executed concurrently (see runStepsInParallel).
 //
 // If any step fails and is not marked with `can_fail: true`, the entire workflow
-// is halted immediately, and the error from the failing step is returned.
-func (w *WHAM) RunAllSteps(force bool, fromStep, toStep string) error {
-	w.logger.Info().Bool("force", force).Str("from", fromStep).Str("to", toStep).Msg("Starting to run all steps.")
+// is halted immediately, and the error from the failing step is returned, unless
+// `opts.ContinueOnError` treats every step as if it was. With `opts.Staging`, every
+// step runs with the dry-run marker (see dryRunMarked).
+//
+// If the run exceeds its timeout (`opts.Timeout`, or `workflow_timeout` in the
+// settings) or WHAM receives SIGINT or SIGTERM, the run is aborted: the steps in
+// progress are killed and recorded as failed, the steps not started yet are
+// recorded as skipped with the reason "cancelled", and an error wrapping
+// errWorkflowTimeout or errInterrupted is returned.
+//
+// The run holds the run lock of the metadata directory, and fails at once if
+// another process holds it (see acquireRunLock).
+//
+// Every invocation is recorded as a workflow run in the metadata directory,
+// together with its options, configuration digest and resolved execution plan,
+// so it can be investigated and reproduced later with `wham rerun`. Once the run
+// is finished, the `on_success` or `on_failure` handler of the settings is run.
+// Its progress is written to the progress file of the metadata directory as it
+// goes (see ProgressFile).
+//
+// The steps generated by generator steps are executed right after their generator,
+// and kept in the DAG until the next run, which generates them again.
+func (w *WHAM) RunAllSteps(opts RunOptions) error {
+	releaseRunLock, err := w.acquireRunLock("run all")
+	if err != nil {
+		return err
+	}
+	defer releaseRunLock()
+	w.resetGeneratedSteps()
+	run := w.startWorkflowRun(opts)
+	w.activeRun = run
+	defer func() { w.activeRun = nil }()
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = w.config.WhamSettings.WorkflowTimeout
+	}
+	stopRunContext := w.startRunContext(timeout)
+	defer stopRunContext()
+	stopInspection := w.startInspection(run.ID, 0)
+	defer stopInspection()
+	w.startProgressFile()
+	fmt.Printf("🏁 Starting workflow run '%s'.\n", run.ID)
+	w.logger.Info().Str("workflow_run_id", run.ID).Msg("Workflow run started.")
+
+	err = w.runAllSteps(opts)
+	w.commitGeneratedSteps()
+	w.finishWorkflowRun(run, err)
+	w.finishProgressFile(run.Status)
+	w.runWorkflowHandler(run)
+	return err
+}
 
-	// 1. Determine the correct execution order by performing a topological sort.
-	// This also implicitly checks for circular dependencies in the DAG.
-	sortedSteps, err := w.getTopologicalOrder()
+// runAllSteps contains the execution logic of RunAllSteps, without the
+// bookkeeping of the workflow run record.
+func (w *WHAM) runAllSteps(opts RunOptions) error {
+	force, fromStep, toStep := opts.Force, opts.From, opts.To
+	w.logger.Info().Bool("force", force).Str("from", fromStep).Str("to", toStep).Strs("only", opts.Only).Strs("skip", opts.Skip).Int("parallel", opts.Parallel).Bool("continue_on_error", opts.ContinueOnError).Bool("staging", opts.Staging).Msg("Starting to run all steps.")
+	w.continueOnError, w.staging = opts.ContinueOnError, opts.Staging
+	defer func() { w.continueOnError, w.staging = false, false }()
+
+	// 1. Determine the correct execution order by performing a topological sort,
+	// ordered by priority at equal depth. This also implicitly checks for circular
+	// dependencies in the DAG.
+	sortedSteps, err := w.getExecutionOrder()
 	if err != nil {
 		return fmt.Errorf("failed to determine step execution order: %w", err)
 	}
 
-	// 2. Filter the DAG based on --from and --to flags.
-	stepsToRun, err := w.filterDAGForExecution(sortedSteps, fromStep, toStep)
+	// 2. Filter the DAG based on the --from, --to, --only and --skip flags.
+	filteredSteps, err := w.filterDAGForExecution(sortedSteps, fromStep, toStep)
 	if err != nil {
 		return err // An error here means an invalid --from/--to was provided.
 	}
+	filteredSteps, err = w.selectOnlySteps(filteredSteps, opts.Only)
+	if err != nil {
+		return err
+	}
+	stepsToRun, excludedSteps, err := w.excludeSkippedSteps(filteredSteps, opts.Skip, opts.SkipDescendants)
+	if err != nil {
+		return err
+	}
+
+	// Report every broken step now, rather than when it is reached.
+	if err := w.preflightCheck(stepsToRun, force); err != nil {
+		return err
+	}
+	if err := w.checkStateVersions(stepsToRun); err != nil {
+		return err
+	}
 
-	// 3. Execute each step in the filtered and sorted list.
-	for _, step := range stepsToRun {
+	w.planInspection(stepsToRun)
+	w.recordRunPlan(sortedSteps, stepsToRun)
+
+	// 3. Record the steps left out by --from/--to or --only, or excluded by --skip, as
+	// skipped, keeping their run_id, so the summary of this run explains why they did
+	// not run (see recordNotExecuted).
+	if len(filteredSteps) < len(sortedSteps) {
+		selected := make(map[string]bool, len(filteredSteps))
+		for _, step := range filteredSteps {
+			selected[step.Name] = true
+		}
+		reason := ReasonFilteredByFromTo
+		if len(opts.Only) > 0 {
+			reason = ReasonNotInOnly
+		}
+		for _, step := range sortedSteps {
+			if !selected[step.Name] {
+				w.recordNotExecuted(step.Name, reason)
+			}
+		}
+	}
+	for _, step := range excludedSteps {
+		w.recordNotExecuted(step.Name, ReasonExcludedBySkip)
+		fmt.Printf("⏭️ Step '%s' skipped (excluded by --skip).\n", step.Name)
+	}
+
+	// 4. Execute each step in the filtered and sorted list.
+	if opts.Parallel > 1 {
+		if err := w.runStepsInParallel(stepsToRun, force, opts.Parallel); err != nil {
+			return err
+		}
+		w.logger.Info().Msg("All steps finished.")
+		return nil
+	}
+	for i := 0; i < len(stepsToRun); i++ {
+		step := stepsToRun[i]
+		if w.runContext().Err() != nil {
+			w.cancelSteps(stepsToRun[i:], cancelCauseAborted)
+			return context.Cause(w.runContext())
+		}
 		err := w.RunStep(step.Name, force)
+		if err != nil && w.runContext().Err() != nil {
+			// The step was killed because the workflow run was aborted.
+			w.cancelSteps(stepsToRun[i+1:], cancelCauseAborted)
+			return context.Cause(w.runContext())
+		}
 		if err != nil {
 			// If a step returns an error, it means it failed and did not have `can_fail: true`.
 			// Halt the entire workflow immediately.
 			w.logger.Error().Str("step", step.Name).Err(err).Msg("Workflow halted due to a failing step.")
+			w.cancelSteps(stepsToRun[i+1:], fmt.Sprintf("the workflow halted at step '%s'", step.Name))
 			return err
 		}
+		// The steps the step generated, if any, run right after it.
+		if generated := w.takeGeneratedSteps(step.Name); len(generated) > 0 {
+			stepsToRun = slices.Insert(stepsToRun, i+1, generated...)
+			w.planInspection(stepsToRun)
+		}
 	}
 	// If the loop completes, all steps have either succeeded, been skipped, or failed gracefully (with can_fail: true).
 	w.logger.Info().Msg("All steps finished.")
 	return nil
 }
 
+// runStepsInParallel executes the given topologically sorted steps with up to
+// `parallel` of them running at the same time.
+//
+// A step is started as soon as all of its predecessors selected for execution
+// have finished, so independent branches of the DAG progress concurrently while
+// every step still sees the final state of its predecessors. Each step writes its
+// own WHAM state file, so steps finishing at once never overwrite each other.
+//
+// Steps sharing a `concurrency_group` never run at the same time: a ready step
+// waits while another step of its group is running. Likewise, a ready step is not
+// started while another step holding one of its named locks is running, so that
+// it does not take a slot only to wait for the lock.
+//
+// The steps generated by a generator step are scheduled once it has finished, and
+// its successors wait for them too.
+//
+// Once all the steps of a depth of the DAG have finished, a summary of their
+// outcomes is printed, depth after depth (see depthProgress).
+//
+// If a step fails and is not marked with `can_fail: true`, no further step is
+// started; the steps already running are waited for, and the first error is
+// returned, mirroring the serial execution.
+func (w *WHAM) runStepsInParallel(steps []*Step, force bool, parallel int) error {
+	selected := make(map[string]bool, len(steps))
+	for _, step := range steps {
+		selected[step.Name] = true
+	}
+	// pending counts, for each step, the selected predecessors that have not finished yet.
+	pending := make(map[string]int, len(steps))
+	successors := make(map[string][]*Step)
+	var ready []*Step
+	for _, step := range steps {
+		for _, pred := range step.PreviousSteps {
+			if selected[pred] {
+				pending[step.Name]++
+				successors[pred] = append(successors[pred], step)
+			}
+		}
+		if pending[step.Name] == 0 {
+			ready = append(ready, step)
+		}
+	}
+
+	type outcome struct {
+		step    *Step
+		err     error
+		elapsed time.Duration
+	}
+	done := make(chan outcome)
+	progress := w.newDepthProgress(steps)
+	running := 0
+	started := make(map[string]bool, len(steps))
+	finishedSteps := make(map[string]bool, len(steps))
+	// busyGroups holds the concurrency groups of the steps running, and busyLocks
+	// their named locks.
+	busyGroups := make(map[string]bool)
+	busyLocks := make(map[string]bool)
+	var firstErr error
+	var haltedAt string // The step whose failure halts the workflow.
+	for {
+		// Start as many ready steps as allowed, unless the workflow is halting.
+		for firstErr == nil && w.runContext().Err() == nil && running < parallel {
+			next := nextReadyStep(ready, busyGroups, busyLocks)
+			if next < 0 {
+				break
+			}
+			step := ready[next]
+			ready = slices.Delete(ready, next, next+1)
+			running++
+			started[step.Name] = true
+			if step.ConcurrencyGroup != "" {
+				busyGroups[step.ConcurrencyGroup] = true
+			}
+			for _, lock := range step.Locks {
+				busyLocks[lock] = true
+			}
+			progress.start(step)
+			go func() {
+				start := time.Now()
+				err := w.RunStep(step.Name, force)
+				done <- outcome{step: step, err: err, elapsed: time.Since(start)}
+			}()
+		}
+		if running == 0 {
+			break
+		}
+
+		finished := <-done
+		running--
+		delete(busyGroups, finished.step.ConcurrencyGroup)
+		for _, lock := range finished.step.Locks {
+			delete(busyLocks, lock)
+		}
+		if finished.err != nil {
+			// The step failed and did not have `can_fail: true`. Halt the workflow
+			// once the steps already running have finished.
+			w.logger.Error().Str("step", finished.step.Name).Err(finished.err).Msg("Workflow halted due to a failing step.")
+			if firstErr == nil {
+				firstErr, haltedAt = finished.err, finished.step.Name
+			}
+			continue
+		}
+		if generated := w.takeGeneratedSteps(finished.step.Name); len(generated) > 0 {
+			for _, step := range generated {
+				selected[step.Name] = true
+				steps = append(steps, step)
+				for _, pred := range step.PreviousSteps {
+					// The generator and its ancestors have finished: only wait for
+					// the other generated steps.
+					if pred != finished.step.Name && selected[pred] && !finishedSteps[pred] {
+						pending[step.Name]++
+						successors[pred] = append(successors[pred], step)
+					}
+				}
+				for _, succ := range successors[finished.step.Name] {
+					pending[succ.Name]++
+					successors[step.Name] = append(successors[step.Name], succ)
+				}
+				if pending[step.Name] == 0 {
+					ready = append(ready, step)
+				}
+				progress.add(step)
+			}
+			w.planInspection(steps)
+		}
+		finishedSteps[finished.step.Name] = true
+		progress.finish(finished.step, finished.elapsed)
+		for _, succ := range successors[finished.step.Name] {
+			pending[succ.Name]--
+			if pending[succ.Name] == 0 {
+				ready = append(ready, succ)
+			}
+		}
+	}
+
+	if w.runContext().Err() != nil {
+		var notStarted []*Step
+		for _, step := range steps {
+			if !started[step.Name] {
+				notStarted = append(notStarted, step)
+			}
+		}
+		w.cancelSteps(notStarted, cancelCauseAborted)
+		return context.Cause(w.runContext())
+	}
+	if firstErr != nil {
+		var notStarted []*Step
+		for _, step := range steps {
+			if !started[step.Name] {
+				notStarted = append(notStarted, step)
+			}
+		}
+		w.cancelSteps(notStarted, fmt.Sprintf("the workflow halted at step '%s'", haltedAt))
+	}
+	return firstErr
+}
+
+// nextReadyStep returns the index of the ready step to start next: the one with the
+// highest priority whose concurrency group and named locks are not busy. `ready`
+// is in execution order, so ties go to the step that became ready first. Returns
+// -1 if no ready step can be started.
+func nextReadyStep(ready []*Step, busyGroups, busyLocks map[string]bool) int {
+	next := -1
+	for i, step := range ready {
+		if step.ConcurrencyGroup != "" && busyGroups[step.ConcurrencyGroup] {
+			continue
+		}
+		if slices.ContainsFunc(step.Locks, func(lock string) bool { return busyLocks[lock] }) {
+			continue
+		}
+		if next < 0 || step.Priority > ready[next].Priority {
+			next = i
+		}
+	}
+	return next
+}
+
+// recordNotExecuted records a step that the workflow run does not execute, with
+// the reason, in the plan of the run and as skipped in the step's state, keeping
+// its run_id. The state of a step whose last action was "failed" is left as is, so
+// that the step still shows as failed, with its outputs and warnings, until it runs
+// again: `run failed` and --resume find it, and the plan of the run tells why it
+// did not run this time.
+func (w *WHAM) recordNotExecuted(stepName, reason string) {
+	w.recordPlannedReason(stepName, reason)
+	previous := w.getCurrentStepWhamState(stepName)
+	if previous.RunAction == "failed" {
+		return
+	}
+	w.saveStepWhamState(stepName, StepState{RunID: previous.RunID, RunAction: "skipped", Reason: reason})
+}
+
+// cancelCauseAborted is the cause of the steps cancelled because the workflow run
+// was aborted (see cancelSteps).
+const cancelCauseAborted = "the workflow run was aborted"
+
+// cancelSteps records the given steps, which the workflow run did not start, as
+// skipped with the reason "cancelled" (see recordNotExecuted). The cause tells
+// why: the run was aborted, or halted by a failing step.
+func (w *WHAM) cancelSteps(steps []*Step, cause string) {
+	for _, step := range steps {
+		w.recordNotExecuted(step.Name, ReasonCancelled)
+		fmt.Printf("⏹️ Step '%s' cancelled: %s.\n", step.Name, cause)
+		w.logger.Warn().Str("step", step.Name).Str("cause", cause).Msg("Step cancelled.")
+	}
+}
+
+// resumeSteps returns the steps a resumed `run all` executes, in execution order:
+// the steps left unfinished by the previous runs, i.e. whose last action was
+// "failed", that were cancelled (see cancelSteps) or that have never run, and
+// their descendants. The steps of independent branches are thus resumed as well,
+// unlike with --from. It returns none if every step has run without failing.
+func (w *WHAM) resumeSteps() ([]string, error) {
+	sortedSteps, err := w.getExecutionOrder()
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine step execution order: %w", err)
+	}
+	affected := make(map[string]bool)
+	for _, step := range sortedSteps {
+		state := w.getCurrentStepWhamState(step.Name)
+		if state.RunAction != "" && state.RunAction != "failed" && state.Reason != ReasonCancelled {
+			continue
+		}
+		affected[step.Name] = true
+		for _, name := range w.getDescendants(step.Name) {
+			affected[name] = true
+		}
+	}
+	var selected []string
+	for _, step := range sortedSteps {
+		if affected[step.Name] {
+			selected = append(selected, step.Name)
+		}
+	}
+	return selected, nil
+}
+
+// failedStepsToRerun returns the steps whose last action is "failed", and the steps
+// `run failed` executes: those steps and their descendants, in execution order.
+func (w *WHAM) failedStepsToRerun() (failed, selected []string, err error) {
+	sortedSteps, err := w.getExecutionOrder()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to determine step execution order: %w", err)
+	}
+	affected := make(map[string]bool)
+	for _, step := range sortedSteps {
+		if w.getCurrentStepWhamState(step.Name).RunAction != "failed" {
+			continue
+		}
+		failed = append(failed, step.Name)
+		affected[step.Name] = true
+		for _, name := range w.getDescendants(step.Name) {
+			affected[name] = true
+		}
+	}
+	for _, step := range sortedSteps {
+		if affected[step.Name] {
+			selected = append(selected, step.Name)
+		}
+	}
+	return failed, selected, nil
+}
+
 // filterDAGForExecution takes a topologically sorted list of all steps and filters it
 // based on the --from and --to flags.
 func (w *WHAM) filterDAGForExecution(allSteps []*Step, fromStepName, toStepName string) ([]*Step, error) {
@@ -208,25 +802,9 @@ func (w *WHAM) filterDAGForExecution(allSteps []*Step, fromStepName, toStepName
 		if w.findStep(fromStepName) == nil {
 			return nil, fmt.Errorf("step specified in --from not found: '%s'", fromStepName)
 		}
-		descendants := make(map[string]bool)
-		queue := []string{fromStepName}
-		visited := make(map[string]bool)
-		visited[fromStepName] = true
-		descendants[fromStepName] = true
-
-		for len(queue) > 0 {
-			current := queue[0]
-			queue = queue[1:]
-			// Find direct successors of 'current'
-			for _, step := range allSteps {
-				for _, pred := range step.PreviousSteps {
-					if pred == current && !visited[step.Name] {
-						visited[step.Name] = true
-						descendants[step.Name] = true
-						queue = append(queue, step.Name)
-					}
-				}
-			}
+		descendants := map[string]bool{fromStepName: true}
+		for _, name := range w.getDescendants(fromStepName) {
+			descendants[name] = true
 		}
 		runnableSteps = descendants
 	}
@@ -278,3 +856,64 @@ func (w *WHAM) filterDAGForExecution(allSteps []*Step, fromStepName, toStepName
 
 	return finalStepsToRun, nil
 }
+
+// selectOnlySteps keeps the steps named by --only from a topologically sorted list
+// of steps, in the original order. Unlike --from/--to, neither the ancestors nor the
+// descendants of the named steps are selected: the steps run against the current
+// state of their predecessors, whose consistency is still checked unless forced.
+//
+// Returns an error if a named step is not defined in the configuration.
+func (w *WHAM) selectOnlySteps(steps []*Step, only []string) ([]*Step, error) {
+	if len(only) == 0 {
+		return steps, nil
+	}
+	names := make(map[string]bool, len(only))
+	for _, name := range only {
+		if w.findStep(name) == nil {
+			return nil, fmt.Errorf("step specified in --only not found: '%s'", name)
+		}
+		names[name] = true
+	}
+	var selected []*Step
+	for _, step := range steps {
+		if names[step.Name] {
+			selected = append(selected, step)
+		}
+	}
+	return selected, nil
+}
+
+// excludeSkippedSteps removes the steps named by --skip from a topologically
+// sorted list of steps to run, and returns the remaining steps and the excluded
+// ones, both in the original order.
+//
+// With withDescendants, a step whose predecessors are all excluded is excluded
+// as well, so that the exclusive descendants of the skipped steps do not run on
+// their stale state. Steps that also depend on a step that runs are kept.
+//
+// Returns an error if a skipped step is not defined in the configuration.
+func (w *WHAM) excludeSkippedSteps(steps []*Step, skip []string, withDescendants bool) ([]*Step, []*Step, error) {
+	if len(skip) == 0 {
+		return steps, nil, nil
+	}
+	excluded := make(map[string]bool, len(skip))
+	for _, name := range skip {
+		if w.findStep(name) == nil {
+			return nil, nil, fmt.Errorf("step specified in --skip not found: '%s'", name)
+		}
+		excluded[name] = true
+	}
+
+	var kept, excludedSteps []*Step
+	for _, step := range steps {
+		if !excluded[step.Name] && withDescendants && len(step.PreviousSteps) > 0 {
+			excluded[step.Name] = !slices.ContainsFunc(step.PreviousSteps, func(pred string) bool { return !excluded[pred] })
+		}
+		if excluded[step.Name] {
+			excludedSteps = append(excludedSteps, step)
+		} else {
+			kept = append(kept, step)
+		}
+	}
+	return kept, excludedSteps, nil
+}
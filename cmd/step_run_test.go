@@ -1,10 +1,19 @@
 package cmd_test
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -21,7 +30,8 @@ func findAndUnmarshalRunSummary(t *testing.T, outputStr string, target *[]TestSt
 	}
 	jsonOutput := outputStr[jsonStartIndex:]
 
-	err := json.Unmarshal([]byte(jsonOutput), target)
+	// Decode only the array, as the stderr of a failed command follows it.
+	err := json.NewDecoder(strings.NewReader(jsonOutput)).Decode(target)
 	assert.NoError(t, err, "Should be able to unmarshal the JSON summary.")
 }
 
@@ -75,6 +85,35 @@ func TestRunAll_FailRuntimeHalt(t *testing.T) {
 	assert.NotContains(t, outputStr, "All steps completed successfully.", "The final success message should not be present.")
 }
 
+// TestRunAll_ContinueOnError tests that `--continue-on-error` lets the workflow go on
+// past a critical step failure, while still recording the step as failed.
+func TestRunAll_ContinueOnError(t *testing.T) {
+	configPath := "../test/settings/settings_fail_runtime_halt.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "--continue-on-error", "-o", "json")
+	assert.NoError(t, err, "The workflow should not halt on a failure with --continue-on-error.")
+	assert.Contains(t, outputStr, "⚠️ Step 'critical_step_fails' failed but continuing (--continue-on-error)")
+
+	_, summary, found := strings.Cut(outputStr, "Workflow execution finished.")
+	assert.True(t, found, "The workflow should finish.")
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, summary, &states)
+	statesMap := make(map[string]TestStepState)
+	for _, s := range states {
+		statesMap[s.StepName] = s
+	}
+	assert.Equal(t, "failed", statesMap["resilient_step_fails"].RunAction)
+	assert.Equal(t, "failed", statesMap["critical_step_fails"].RunAction, "The failure should still be recorded.")
+
+	// Without the flag, the critical failure halts the workflow again.
+	_, err = runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.Error(t, err)
+	_, err = runWhamCommand(t, "--config", configPath, "run", "start_node", "--continue-on-error")
+	assert.Error(t, err, "--continue-on-error requires the 'all' target.")
+}
+
 // TestForceSingle_InjectsParam tests that forcing a step correctly injects the 'force'
 // parameter via runtime templating.
 func TestForceSingle_InjectsParam(t *testing.T) {
@@ -184,7 +223,7 @@ func TestRunAll_Force(t *testing.T) {
 	}
 }
 
-// TestRunAll_FromToFlags verifies the correct behavior of the --from and --to flags.
+// TestRunAll_FromToFlags verifies the correct behavior of the --from, --to and --only flags.
 func TestRunAll_FromToFlags(t *testing.T) {
 	const configPath = "../test/settings/settings_from_to_flags.yaml"
 
@@ -232,6 +271,31 @@ func TestRunAll_FromToFlags(t *testing.T) {
 			expectError:   true,
 			errorContains: "step specified in --from not found: 'non_existent_step'",
 		},
+		{
+			name:             "run only steps",
+			args:             []string{"run", "all", "--only", "step-d,step-a", "--force"},
+			expectError:      false,
+			expectedToRun:    []string{"step-a", "step-d"},
+			expectedToNotRun: []string{"step-b", "step-c"},
+		},
+		{
+			name:          "fail with only step whose predecessor never ran",
+			args:          []string{"run", "all", "--only", "step-c"},
+			expectError:   true,
+			errorContains: "previous step 'step-b' has no valid WHAM state",
+		},
+		{
+			name:          "fail with only and from",
+			args:          []string{"run", "all", "--only", "step-b", "--from", "step-a"},
+			expectError:   true,
+			errorContains: "--only flag cannot be used with --from, --to or --resume",
+		},
+		{
+			name:          "fail with non-existent only step",
+			args:          []string{"run", "all", "--only", "step-a", "--only", "non_existent_step"},
+			expectError:   true,
+			errorContains: "step specified in --only not found: 'non_existent_step'",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -297,6 +361,32 @@ func TestRunSingle_FailPrecondition(t *testing.T) {
 	assert.NotContains(t, outputStr, "Execution Summary", "The execution summary should not be printed on a failure.")
 }
 
+// TestRunSingle_UnreadableStateHalts verifies that a predecessor's state file that
+// cannot be read is retried and then fails the step, instead of being treated as
+// an empty state.
+func TestRunSingle_UnreadableStateHalts(t *testing.T) {
+	configPath := "../test/settings/settings_ok.yaml"
+	cleanTestStates(t, configPath)                       // Clean before
+	t.Cleanup(func() { cleanTestStates(t, configPath) }) // Clean after
+
+	_, err := runWhamCommand(t, "--config", configPath, "run", "stateful_sh_succeed")
+	assert.NoError(t, err, "The source step should run successfully.")
+
+	// Replace the predecessor's state file with a directory, which cannot be read.
+	statePaths, _ := filepath.Glob("../test/states/metadata/wham_*_stateful_sh_succeed.state")
+	if !assert.Len(t, statePaths, 1, "The source step should have a state file.") {
+		return
+	}
+	assert.NoError(t, os.Remove(statePaths[0]))
+	assert.NoError(t, os.Mkdir(statePaths[0], 0755))
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "stateless_sh_succeed")
+	assert.Error(t, err, "The command should fail when a state file cannot be read.")
+	assert.Contains(t, outputStr, "failed to read WHAM state file", "The error should name the unreadable state file.")
+	assert.Contains(t, outputStr, "after 4 attempts", "The read should have been retried.")
+	assert.NotContains(t, outputStr, "has no valid WHAM state", "The unreadable state should not be mistaken for an empty one.")
+}
+
 // TestRunAll_RetrySuccess verifies that a step correctly retries and eventually succeeds.
 func TestRunAll_RetrySuccess(t *testing.T) {
 	configPath := "../test/settings/settings_retry_success.yaml"
@@ -389,3 +479,1604 @@ func TestWorkDir_FailsOnInvalidPath(t *testing.T) {
 	assert.Contains(t, outputStr, "invalid work_dir './non_existent_dir' for step 'fail_workdir_not_found'", "The error message should indicate an invalid work_dir.")
 	assert.Contains(t, outputStr, "path does not exist or is not a directory", "The error message should be specific about the cause.")
 }
+
+// TestRunAll_SuccessCriteria verifies that a step whose outputs do not meet its
+// success criteria is recorded as failed, or only warned about with the "warn" policy.
+func TestRunAll_SuccessCriteria(t *testing.T) {
+	configPath := "../test/settings/settings_success_criteria.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "-o", "json")
+	assert.NoError(t, err, "The workflow should complete, as the failing step can fail.")
+	assert.Contains(t, outputStr, "Step 'empty_load_warns' did not meet its success criteria", "A warning should be printed for the 'warn' policy.")
+	assert.Contains(t, outputStr, "success criteria not met: 'rows_processed > 0' does not hold", "The failure reason should be printed.")
+
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, outputStr, &states)
+	statesMap := make(map[string]TestStepState)
+	for _, s := range states {
+		statesMap[s.StepName] = s
+	}
+	assert.Equal(t, "run", statesMap["criteria_met"].RunAction)
+	assert.Equal(t, "run", statesMap["empty_load_warns"].RunAction)
+	assert.Equal(t, "failed", statesMap["empty_load_fails"].RunAction)
+}
+
+// TestRunAll_MustStartBy verifies that steps reached after their must_start_by time
+// print an SLA warning and, with the "fail" policy, are failed without being executed.
+func TestRunAll_MustStartBy(t *testing.T) {
+	configPath := "../test/settings/settings_must_start_by.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "-o", "json")
+	assert.NoError(t, err, "The workflow should complete, as the failing step can fail.")
+	assert.Contains(t, outputStr, "Step 'late_warns' is starting", "An SLA warning should be printed for the late step.")
+	assert.NotContains(t, outputStr, "Running step 'late_fails'", "A late step with the 'fail' policy should not be executed.")
+
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, outputStr, &states)
+	statesMap := make(map[string]TestStepState)
+	for _, s := range states {
+		statesMap[s.StepName] = s
+	}
+	assert.Equal(t, "run", statesMap["late_warns"].RunAction)
+	assert.Equal(t, "failed", statesMap["late_fails"].RunAction)
+}
+
+// TestRunAll_HostGuards verifies that a step waits while the host guards do not
+// pass, then starts anyway with a warning once their timeout elapses, while a step
+// with ignore_host_guards starts at once.
+func TestRunAll_HostGuards(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("host guards are only evaluated on Linux")
+	}
+	configPath := "../test/settings/settings_host_guards.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "-o", "json")
+	assert.NoError(t, err, outputStr)
+	assert.Contains(t, outputStr, "Step 'heavy' waiting for the host to be less busy")
+	assert.NotContains(t, outputStr, "Step 'light' waiting")
+
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, outputStr, &states)
+	statesMap := make(map[string]TestStepState)
+	for _, s := range states {
+		statesMap[s.StepName] = s
+	}
+	assert.Equal(t, "run", statesMap["heavy"].RunAction)
+	if assert.Len(t, statesMap["heavy"].Warnings, 1) {
+		assert.Contains(t, statesMap["heavy"].Warnings[0], "started on a busy host")
+	}
+	assert.Equal(t, "run", statesMap["light"].RunAction)
+	assert.Empty(t, statesMap["light"].Warnings)
+}
+
+// TestRunAll_MultipleStateFiles verifies that a stateful step with several state files
+// gets a run_id combining all of them, which is stable across identical executions.
+func TestRunAll_MultipleStateFiles(t *testing.T) {
+	configPath := "../test/settings/settings_state_files.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	sum := sha256.Sum256([]byte("orders.state=o1\ncustomers.state=c1\n"))
+	expectedRunID := hex.EncodeToString(sum[:])[:16]
+
+	for i, expectedAction := range []string{"run", "skipped"} {
+		outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "-o", "json")
+		assert.NoError(t, err)
+		var states []TestStepState
+		findAndUnmarshalRunSummary(t, outputStr, &states)
+		statesMap := make(map[string]TestStepState)
+		for _, s := range states {
+			statesMap[s.StepName] = s
+		}
+		assert.Equal(t, expectedRunID, statesMap["load_datasets"].RunID, "The run_id should combine all state files (run #%d).", i+1)
+		assert.Equal(t, expectedAction, statesMap["build_report"].RunAction, "Unexpected action for the successor (run #%d).", i+1)
+	}
+}
+
+// TestRunAll_CheckSteps verifies that data quality check steps record the observed
+// value and fail or warn when their expectations are not met.
+func TestRunAll_CheckSteps(t *testing.T) {
+	configPath := "../test/settings/settings_check.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "-o", "json")
+	assert.NoError(t, err, "The workflow should complete, as the failing check can fail.")
+	assert.Contains(t, outputStr, "check failed: value 5 is below the minimum of 10", "The failed expectation should be reported.")
+	assert.Contains(t, outputStr, "Check 'check_null_warns' did not pass: value is null", "A warning should be printed for the 'warn' policy.")
+
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, outputStr, &states)
+	statesMap := make(map[string]TestStepState)
+	for _, s := range states {
+		statesMap[s.StepName] = s
+	}
+	assert.Equal(t, "run", statesMap["check_passes"].RunAction)
+	assert.Equal(t, "failed", statesMap["check_below_min"].RunAction)
+	assert.Equal(t, "run", statesMap["check_null_warns"].RunAction)
+
+	// The observed value is recorded as an output of the check.
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "get", "check_passes", "-o", "json")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, `"value": "100"`, "The observed value should be stored in the state.")
+}
+
+// TestRunAll_CheckChangeBaseline verifies that max_change_pct compares against the
+// last successful run of the check, so that a value it rejected does not become the
+// baseline of the next run.
+func TestRunAll_CheckChangeBaseline(t *testing.T) {
+	configPath := "../test/settings/settings_check_change.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	t.Setenv("CHECK_VALUE", "100")
+	_, err := runWhamCommand(t, "--config", configPath, "run", "row_count")
+	assert.NoError(t, err, "The first run has no baseline to compare against.")
+
+	t.Setenv("CHECK_VALUE", "5")
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "row_count")
+	assert.Error(t, err, "A value that changed by more than 50% should fail the check.")
+	assert.Contains(t, outputStr, "value 5 changed by 95.0% from the last successful run's 100")
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "run", "row_count")
+	assert.Error(t, err, "The same value should fail again, as the failed run is not a baseline.")
+	assert.Contains(t, outputStr, "value 5 changed by 95.0% from the last successful run's 100")
+
+	t.Setenv("CHECK_VALUE", "120")
+	_, err = runWhamCommand(t, "--config", configPath, "run", "row_count")
+	assert.NoError(t, err, "A value close to the last successful run's should pass.")
+}
+
+// TestRunAll_FreshnessSteps verifies that freshness steps use the observed watermark
+// as their run_id, so that downstream steps only run when new data arrived, and
+// that a stale source fails or warns according to its policy.
+func TestRunAll_FreshnessSteps(t *testing.T) {
+	configPath := "../test/settings/settings_freshness.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	landingFile := "../test/states/data/landing.csv"
+	assert.NoError(t, os.WriteFile(landingFile, []byte("id\n1\n"), 0644))
+
+	runAll := func() (string, map[string]TestStepState, error) {
+		outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "-o", "json")
+		var states []TestStepState
+		statesMap := make(map[string]TestStepState)
+		if err == nil {
+			findAndUnmarshalRunSummary(t, outputStr, &states)
+			for _, s := range states {
+				statesMap[s.StepName] = s
+			}
+		}
+		return outputStr, statesMap, err
+	}
+
+	outputStr, statesMap, err := runAll()
+	assert.NoError(t, err)
+	assert.Equal(t, "run", statesMap["load"].RunAction, "The first arrival of data should run the downstream step.")
+	assert.Equal(t, "2020-01-01T00:00:00Z", statesMap["orders_table"].RunID, "The printed watermark should become the run_id.")
+	assert.Contains(t, outputStr, "Freshness 'orders_table' did not pass: source is stale", "A stale source should warn with the 'warn' policy.")
+
+	_, statesMap, err = runAll()
+	assert.NoError(t, err)
+	assert.Equal(t, "run", statesMap["landing_file"].RunAction)
+	assert.Equal(t, "no_change", statesMap["load"].Reason, "An unchanged watermark should not run the downstream step.")
+
+	newData := time.Now().Add(-time.Minute)
+	assert.NoError(t, os.Chtimes(landingFile, newData, newData))
+	_, statesMap, err = runAll()
+	assert.NoError(t, err)
+	assert.Equal(t, "run", statesMap["load"].RunAction, "A new watermark should run the downstream step.")
+
+	staleData := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, os.Chtimes(landingFile, staleData, staleData))
+	outputStr, _, err = runAll()
+	assert.Error(t, err, "A stale source should fail with the default policy.")
+	assert.Contains(t, outputStr, "freshness check failed: source is stale")
+}
+
+// TestRunAll_DbtSteps verifies that dbt steps derive their run_id from the invocation
+// ID in run_results.json and surface the failed models in their state.
+func TestRunAll_DbtSteps(t *testing.T) {
+	configPath := "../test/settings/settings_dbt.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.NoError(t, err, "The workflow should complete, as the failing dbt step can fail.")
+	assert.Contains(t, outputStr, "FAKE DBT ARGS: run --select tag:nightly --project-dir", "The dbt arguments should be assembled from the dbt block.")
+	assert.NotContains(t, outputStr, "--not-for-dbt", "Shared args should not be passed to dbt.")
+
+	var state struct {
+		RunID     string            `json:"run_id"`
+		RunAction string            `json:"run_action"`
+		Outputs   map[string]string `json:"outputs"`
+	}
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "get", "dbt_run", "-o", "json")
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &state))
+	assert.Equal(t, "run", state.RunAction)
+	assert.Equal(t, "inv-123", state.RunID, "The run_id should be dbt's invocation ID.")
+	assert.Equal(t, "2", state.Outputs["models_total"])
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "get", "dbt_test_fails", "-o", "json")
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &state))
+	assert.Equal(t, "failed", state.RunAction)
+	assert.Equal(t, "1", state.Outputs["models_failed"])
+	assert.Equal(t, "model.demo.customers", state.Outputs["failed_models"], "The failed models should be recorded in the state.")
+}
+
+// TestRunSingle_InjectsConnection verifies that the env_vars of a step's connection are
+// injected, templated, and overridden by the step's own env_vars.
+func TestRunSingle_InjectsConnection(t *testing.T) {
+	configPath := "../test/settings/settings_connections.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "uses_connection")
+	assert.NoError(t, err, "The command should execute successfully.")
+	assert.Contains(t, outputStr, "VAR1 = warehouse-host", "The connection's env_vars should be injected.")
+	assert.Contains(t, outputStr, "VAR2 = s3cr3t", "The secret should be read from the referenced file.")
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "run", "overrides_connection")
+	assert.NoError(t, err, "The command should execute successfully.")
+	assert.Contains(t, outputStr, "VAR1 = step-specific-host", "The step's env_vars should override the connection's.")
+	assert.Contains(t, outputStr, "VAR2 = s3cr3t", "Non-overridden connection env_vars should still be injected.")
+}
+
+// TestRunAll_SkipReasons verifies that skipped steps record why they did not run.
+func TestRunAll_SkipReasons(t *testing.T) {
+	const configPath = "../test/settings/settings_skip_reasons.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	// step-c is disabled and step-d is outside of --to.
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "--to", "step-b", "-o", "json")
+	assert.NoError(t, err)
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, outputStr, &states)
+	reasons := make(map[string]string)
+	for _, s := range states {
+		reasons[s.StepName] = s.Reason
+	}
+	assert.Equal(t, "", reasons["step-b"], "A step that ran should have no reason.")
+	assert.Equal(t, "filtered_by_from_to", reasons["step-d"])
+
+	// A full run skips the disabled step.
+	outputStr, err = runWhamCommand(t, "--config", configPath, "run", "all", "-o", "json")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "Step 'step-c' skipped (disabled).")
+	assert.Contains(t, outputStr, "Step 'step-e' skipped (its ancestor 'step-c' is disabled).", "The descendants of a disabled step should not fail their precondition checks.")
+	states = nil
+	findAndUnmarshalRunSummary(t, outputStr, &states)
+	for _, s := range states {
+		if s.StepName == "step-c" || s.StepName == "step-e" {
+			assert.Equal(t, "skipped", s.RunAction, s.StepName)
+			assert.Equal(t, "disabled", s.Reason, s.StepName)
+		}
+	}
+
+	// Re-running a step whose predecessors did not change skips it.
+	_, err = runWhamCommand(t, "--config", configPath, "run", "step-d")
+	assert.NoError(t, err)
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "get", "step-d")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "skipped (no_change)", "The table should show the skip reason.")
+}
+
+// TestRunAll_Parallel verifies that --parallel executes independent steps concurrently
+// while still running a step only after all of its predecessors have finished, and
+// summarizes each depth of the DAG once all of its steps have finished.
+func TestRunAll_Parallel(t *testing.T) {
+	const configPath = "../test/settings/settings_parallel.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	start := time.Now()
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "--parallel", "2", "-o", "json")
+	elapsed := time.Since(start)
+	assert.NoError(t, err)
+	assert.Less(t, elapsed, 1900*time.Millisecond, "The two one-second branches should have run concurrently.")
+
+	joinStart := strings.Index(outputStr, "Running step 'join'")
+	assert.Greater(t, joinStart, strings.Index(outputStr, "Step 'branch_a' completed successfully."), "join should start after branch_a.")
+	assert.Greater(t, joinStart, strings.Index(outputStr, "Step 'branch_b' completed successfully."), "join should start after branch_b.")
+
+	// Each depth is summarized once all of its steps have finished.
+	depth0 := strings.Index(outputStr, "📊 Depth 0 finished: 2 run, 0 skipped, 0 failed in ")
+	depth1 := strings.Index(outputStr, "📊 Depth 1 finished: 1 run, 0 skipped, 0 failed in ")
+	assert.Greater(t, depth0, -1, "The summary of depth 0 should be printed.")
+	assert.Greater(t, depth1, joinStart, "The summary of depth 1 should be printed after join ran.")
+	assert.Less(t, depth0, joinStart, "The summary of depth 0 should be printed before join starts.")
+
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, outputStr, &states)
+	for _, s := range states {
+		assert.Equal(t, "run", s.RunAction, "Step '%s' should have run.", s.StepName)
+	}
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "run", "join", "--parallel", "2")
+	assert.Error(t, err)
+	assert.Contains(t, outputStr, "--parallel flag can only be used with the 'all' target")
+}
+
+// TestRunAll_ConcurrencyGroup verifies that steps sharing a concurrency group run
+// one after the other in a parallel run, while the other steps run alongside them.
+func TestRunAll_ConcurrencyGroup(t *testing.T) {
+	const configPath = "../test/settings/settings_concurrency_group.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "--parallel", "3")
+	assert.NoError(t, err)
+
+	// The steps log when they start and end, which tells whether they overlapped.
+	marker := func(event, step string) int {
+		index := strings.Index(outputStr, event+" "+step+"\n")
+		assert.GreaterOrEqual(t, index, 0, "The output should tell when %s started and ended.", step)
+		return index
+	}
+	first, second := "load_orders", "load_customers"
+	if marker("start", second) < marker("start", first) {
+		first, second = second, first
+	}
+	assert.Less(t, marker("end", first), marker("start", second), "The steps of the warehouse group should not overlap.")
+	assert.Less(t, marker("start", "fetch_rates"), marker("end", first), "fetch_rates should run alongside the warehouse steps.")
+	assert.Greater(t, marker("end", "fetch_rates"), marker("start", first), "fetch_rates should run alongside the warehouse steps.")
+}
+
+// TestRunAll_Timeout verifies that a step exceeding its timeout is killed along with
+// the processes it spawned, and recorded as failed with the "timeout" reason.
+func TestRunAll_Timeout(t *testing.T) {
+	const configPath = "../test/settings/settings_timeout.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	start := time.Now()
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "-o", "json")
+	assert.NoError(t, err, "The hung step can fail, so the workflow should succeed.")
+	assert.Less(t, time.Since(start), 10*time.Second, "The hung step should have been killed.")
+	assert.Contains(t, outputStr, "step timed out after 1s")
+
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, outputStr, &states)
+	statesMap := make(map[string]TestStepState)
+	for _, s := range states {
+		statesMap[s.StepName] = s
+	}
+	assert.Equal(t, "failed", statesMap["hangs"].RunAction)
+	assert.Equal(t, "timeout", statesMap["hangs"].Reason)
+	assert.Equal(t, "run", statesMap["after_hang"].RunAction)
+
+	// The background child of the script belongs to its process group, so it must be gone too.
+	data, err := os.ReadFile("../test/states/metadata/hanging_child.pid")
+	assert.NoError(t, err)
+	childPID := strings.TrimSpace(string(data))
+	assert.Eventually(t, func() bool {
+		stat, err := os.ReadFile(filepath.Join("/proc", childPID, "stat"))
+		// A killed child that was not reaped yet is a zombie ("Z").
+		return err != nil || strings.Contains(string(stat), ") Z ")
+	}, 2*time.Second, 50*time.Millisecond, "The script's child process should have been killed.")
+}
+
+// TestRunAll_KillGracePeriod verifies that a step with a kill_grace_period is sent
+// SIGTERM when it times out, and only killed if it is still running after the grace period.
+func TestRunAll_KillGracePeriod(t *testing.T) {
+	const configPath = "../test/settings/settings_kill_grace.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	start := time.Now()
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "-o", "json")
+	assert.NoError(t, err, "Both steps can fail, so the workflow should succeed.")
+	assert.Less(t, time.Since(start), 10*time.Second, "The step ignoring SIGTERM should have been killed.")
+	assert.Contains(t, outputStr, "flushed partial state", "The script should have handled SIGTERM.")
+
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, outputStr, &states)
+	statesMap := make(map[string]TestStepState)
+	for _, s := range states {
+		statesMap[s.StepName] = s
+	}
+	for _, name := range []string{"flushes", "ignores_term"} {
+		assert.Equal(t, "failed", statesMap[name].RunAction, name)
+		assert.Equal(t, "timeout", statesMap[name].Reason, name)
+	}
+}
+
+func TestRunAll_WorkflowTimeout(t *testing.T) {
+	const configPath = "../test/settings/settings_workflow_timeout.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	start := time.Now()
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "-o", "json")
+	assert.Error(t, err, "A workflow exceeding its timeout should fail.")
+	assert.Less(t, time.Since(start), 10*time.Second, "The running step should have been killed.")
+	assert.Contains(t, outputStr, "workflow timed out after 1s")
+
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, outputStr, &states)
+	statesMap := make(map[string]TestStepState)
+	for _, s := range states {
+		statesMap[s.StepName] = s
+	}
+	assert.Equal(t, "failed", statesMap["hangs"].RunAction)
+	assert.Equal(t, "workflow_timeout", statesMap["hangs"].Reason)
+	assert.Equal(t, "skipped", statesMap["after_hang"].RunAction)
+	assert.Equal(t, "cancelled", statesMap["after_hang"].Reason)
+
+	// The --timeout flag overrides the setting.
+	cleanTestStates(t, configPath)
+	outputStr, err = runWhamCommand(t, "--config", configPath, "run", "all", "--timeout", "2s", "-o", "json")
+	assert.Error(t, err)
+	assert.Contains(t, outputStr, "workflow timed out after 2s")
+}
+
+// TestRunAll_Maintenance verifies that a workflow in maintenance mode skips every
+// step, as its dry run predicts, unless forced.
+func TestRunAll_Maintenance(t *testing.T) {
+	const configPath = "../test/settings/settings_maintenance.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	runAll := func(args ...string) map[string]TestStepState {
+		outputStr, err := runWhamCommand(t, append([]string{"--config", configPath, "run", "all", "-o", "json"}, args...)...)
+		assert.NoError(t, err, outputStr)
+		var states []TestStepState
+		findAndUnmarshalRunSummary(t, outputStr, &states)
+		statesMap := make(map[string]TestStepState)
+		for _, s := range states {
+			statesMap[s.StepName] = s
+		}
+		return statesMap
+	}
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "--dry-run", "-o", "json")
+	assert.NoError(t, err, outputStr)
+	assert.Equal(t, 2, strings.Count(outputStr, `"reason": "maintenance"`), "The dry run should predict every step to be skipped.")
+
+	for name, state := range runAll() {
+		assert.Equal(t, "skipped", state.RunAction, name)
+		assert.Equal(t, "maintenance", state.Reason, name)
+	}
+	for name, state := range runAll("--force") {
+		assert.Equal(t, "run", state.RunAction, "Step '%s' should run when forced.", name)
+	}
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "run", "extract")
+	assert.NoError(t, err, outputStr)
+	assert.Contains(t, outputStr, "Step 'extract' skipped (maintenance mode).", "A single step should be skipped as well.")
+}
+
+// TestRunAll_HaltCancelsRemainingSteps verifies that the steps a failing step keeps
+// from running are recorded as skipped with the reason "cancelled", as the dry run
+// predicts, whether the steps run one at a time or in parallel.
+func TestRunAll_HaltCancelsRemainingSteps(t *testing.T) {
+	script, err := filepath.Abs("../test/scripts/bash/stateful.sh")
+	assert.NoError(t, err)
+	for _, parallel := range []string{"1", "2"} {
+		t.Run("Parallel"+parallel, func(t *testing.T) {
+			dir := t.TempDir()
+			configPath := filepath.Join(dir, "wham.yaml")
+			config := "wham_settings:\n  data_dir: data\n  metadata_dir: metadata\nwham_steps:\n" +
+				"- name: extract\n  command: [\"" + script + "\"]\n  env_vars:\n    STATE_FILE: extract.state\n  is_stateful: true\n  state_file: extract.state\n  run_id_var: run_id\n  previous_steps: []\n" +
+				"- name: transform\n  command: [\"/bin/false\"]\n  previous_steps: [extract]\n" +
+				"- name: load\n  command: [\"/bin/true\"]\n  previous_steps: [transform]\n"
+			assert.NoError(t, os.WriteFile(configPath, []byte(config), 0644))
+
+			outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "--parallel", parallel, "-o", "json")
+			assert.Error(t, err, "The failing step should halt the workflow.")
+			assert.Contains(t, outputStr, "Step 'load' cancelled: the workflow halted at step 'transform'.")
+
+			var state TestStepState
+			outputStr, err = runWhamCommand(t, "--config", configPath, "state", "get", "load", "-o", "json")
+			assert.NoError(t, err, outputStr)
+			assert.NoError(t, json.Unmarshal([]byte(outputStr), &state))
+			assert.Equal(t, "skipped", state.RunAction)
+			assert.Equal(t, "cancelled", state.Reason)
+		})
+	}
+}
+
+func TestRunAll_ExitCodes(t *testing.T) {
+	const configPath = "../test/settings/settings_exit_codes.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "-o", "json")
+	assert.NoError(t, err, "Only steps that can fail should have failed.")
+	assert.Contains(t, outputStr, "Step 'partial_success' exited with warning exit code 3.")
+
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, outputStr, &states)
+	statesMap := make(map[string]TestStepState)
+	for _, s := range states {
+		statesMap[s.StepName] = s
+	}
+	assert.Equal(t, "run", statesMap["nothing_to_do"].RunAction, "Exit code 1 is declared as a success.")
+	assert.Equal(t, "run", statesMap["partial_success"].RunAction, "Exit code 3 is declared as a warning.")
+	assert.Equal(t, "failed", statesMap["unexpected_code"].RunAction, "Exit code 2 is not declared.")
+	assert.Equal(t, "failed", statesMap["zero_not_success"].RunAction, "success_exit_codes replaces the default of 0.")
+}
+
+func TestRunAll_DryRun(t *testing.T) {
+	const configPath = "../test/settings/settings_ok.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	type plannedStep struct {
+		StepName string `json:"step_name"`
+		Action   string `json:"action"`
+		Reason   string `json:"reason"`
+	}
+	dryRun := func(args ...string) map[string]plannedStep {
+		t.Helper()
+		outputStr, err := runWhamCommand(t, append([]string{"--config", configPath, "run", "all", "--dry-run", "-o", "json"}, args...)...)
+		assert.NoError(t, err)
+		var plan []plannedStep
+		assert.NoError(t, json.Unmarshal([]byte(outputStr), &plan), "The output should only contain the plan.")
+		planMap := make(map[string]plannedStep)
+		for _, p := range plan {
+			planMap[p.StepName] = p
+		}
+		return planMap
+	}
+
+	plan := dryRun()
+	assert.Len(t, plan, 6)
+	for name, p := range plan {
+		assert.Equal(t, "run", p.Action, "Step '%s' should be predicted to run.", name)
+	}
+	entries, err := os.ReadDir("../test/states/metadata")
+	if err == nil {
+		for _, entry := range entries {
+			assert.False(t, strings.HasPrefix(entry.Name(), "wham_"), "A dry run should not write state, found '%s'.", entry.Name())
+		}
+	}
+
+	// Without the stateful source, its dependents cannot pass their precondition checks.
+	plan = dryRun("--from", "stateless_sh_succeed")
+	assert.Equal(t, "filtered_by_from_to", plan["stateful_sh_succeed"].Reason)
+	assert.Equal(t, "precondition_failed", plan["stateless_sh_succeed"].Reason)
+	assert.Equal(t, "skipped", plan["final_aggregator_step"].Action)
+	assert.Equal(t, "cancelled", plan["final_aggregator_step"].Reason, "The workflow halts before reaching it.")
+}
+
+func TestRunAll_Warnings(t *testing.T) {
+	const configPath = "../test/settings/settings_warnings.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "-o", "json")
+	assert.NoError(t, err)
+
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, outputStr, &states)
+	statesMap := make(map[string]TestStepState)
+	for _, s := range states {
+		statesMap[s.StepName] = s
+	}
+	assert.Equal(t, "failed", statesMap["flaky_source"].RunAction)
+	assert.Equal(t, "run", statesMap["partial_success"].RunAction)
+	assert.Equal(t, []string{"exited with warning exit code 3"}, statesMap["partial_success"].Warnings)
+	assert.Equal(t, "run", statesMap["late_consumer"].RunAction)
+	if assert.Len(t, statesMap["late_consumer"].Warnings, 2) {
+		assert.Contains(t, statesMap["late_consumer"].Warnings[0], "after its must_start_by time (00:00)")
+		assert.Equal(t, "previous step 'flaky_source' failed, its data may be stale", statesMap["late_consumer"].Warnings[1])
+	}
+	assert.Empty(t, statesMap["healthy"].Warnings)
+
+	// The table summary has its own column for warnings.
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "get", "all")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "WARNINGS")
+}
+
+func TestRunAll_Resume(t *testing.T) {
+	const configPath = "../test/settings/settings_resume.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	_, err := runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.Error(t, err, "The workflow should halt at the failing step.")
+
+	t.Setenv("TEST_EXIT_STATUS", "success")
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "--resume", "-o", "json")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "Resuming workflow from step 'transform' (transform, load).")
+
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, outputStr, &states)
+	statesMap := make(map[string]TestStepState)
+	for _, s := range states {
+		statesMap[s.StepName] = s
+	}
+	assert.Equal(t, "not_in_only", statesMap["extract"].Reason, "Steps before the failure should not run again.")
+	assert.Equal(t, "run", statesMap["transform"].RunAction)
+	assert.Equal(t, "run", statesMap["load"].RunAction)
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "run", "all", "--resume")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "Nothing to resume")
+
+	_, err = runWhamCommand(t, "--config", configPath, "run", "all", "--resume", "--from", "load")
+	assert.Error(t, err, "--resume and --from are mutually exclusive.")
+}
+
+// TestRunAll_ResumeBranches verifies that --resume also runs the steps of an
+// independent branch that the failure of another branch kept from running.
+func TestRunAll_ResumeBranches(t *testing.T) {
+	const configPath = "../test/settings/settings_resume_branches.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	_, err := runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.Error(t, err, "The workflow should halt at the failing step.")
+
+	t.Setenv("TEST_EXIT_STATUS", "success")
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "--resume", "-o", "json")
+	assert.NoError(t, err, outputStr)
+	assert.Contains(t, outputStr, "Resuming workflow from step 'transform' (transform, report, load).")
+
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, outputStr, &states)
+	statesMap := make(map[string]TestStepState)
+	for _, s := range states {
+		statesMap[s.StepName] = s
+	}
+	assert.Equal(t, "not_in_only", statesMap["extract"].Reason, "Steps that ran should not run again.")
+	for _, name := range []string{"transform", "report", "load"} {
+		assert.Equal(t, "run", statesMap[name].RunAction, "Step '%s' should be resumed.", name)
+	}
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "run", "all", "--resume")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "Nothing to resume")
+}
+
+// TestRunFailed verifies that `run failed` re-runs only the failed steps and their
+// descendants, and does nothing once no step has failed.
+func TestRunFailed(t *testing.T) {
+	const configPath = "../test/settings/settings_resume.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "failed")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "Nothing to re-run")
+
+	_, err = runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.Error(t, err, "The workflow should halt at the failing step.")
+
+	t.Setenv("TEST_EXIT_STATUS", "success")
+	outputStr, err = runWhamCommand(t, "--config", configPath, "run", "failed", "-o", "json")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "Re-running failed step(s) transform and 1 descendant(s).")
+
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, outputStr, &states)
+	statesMap := make(map[string]TestStepState)
+	for _, s := range states {
+		statesMap[s.StepName] = s
+	}
+	assert.Equal(t, "not_in_only", statesMap["extract"].Reason, "Steps that did not fail should not run again.")
+	assert.Equal(t, "run", statesMap["transform"].RunAction)
+	assert.Equal(t, "run", statesMap["load"].RunAction)
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "run", "failed")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "Nothing to re-run")
+
+	_, err = runWhamCommand(t, "--config", configPath, "run", "failed", "--from", "load")
+	assert.Error(t, err, "--from cannot be used with the 'failed' target.")
+}
+
+// TestRunAll_KeepsFailedState verifies that a run leaving out a failed step keeps
+// its failed state, so that `run failed` still finds it, and records why it did not
+// run in the plan of the run.
+func TestRunAll_KeepsFailedState(t *testing.T) {
+	const configPath = "../test/settings/settings_resume.yaml"
+	const runsDir = "../test/states/metadata/wham_runs"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	_, err := runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.Error(t, err, "The workflow should halt at the failing step.")
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "--only", "extract", "-o", "json")
+	assert.NoError(t, err, outputStr)
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, outputStr, &states)
+	statesMap := make(map[string]TestStepState)
+	for _, s := range states {
+		statesMap[s.StepName] = s
+	}
+	assert.Equal(t, "failed", statesMap["transform"].RunAction, "The failure should be kept.")
+	assert.Equal(t, "skipped", statesMap["load"].RunAction)
+	assert.Equal(t, "not_in_only", statesMap["load"].Reason)
+
+	ids := findWorkflowRunIDs(t, runsDir)
+	var record struct {
+		Plan []struct {
+			Name   string `json:"name"`
+			Reason string `json:"reason"`
+		} `json:"plan"`
+	}
+	data, err := os.ReadFile(filepath.Join(runsDir, ids[len(ids)-1]+".json"))
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(data, &record))
+	reasons := make(map[string]string)
+	for _, p := range record.Plan {
+		reasons[p.Name] = p.Reason
+	}
+	assert.Equal(t, map[string]string{"extract": "", "transform": "not_in_only", "load": "not_in_only"}, reasons)
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "run", "failed")
+	assert.Error(t, err, "The failed step should be re-run, and fail again.")
+	assert.Contains(t, outputStr, "Re-running failed step(s) transform")
+}
+
+// TestRunAll_GlobTemplate verifies that the files matched by the `glob` template
+// function expand into one argument each, and that a step can be skipped while no
+// file matches.
+func TestRunAll_GlobTemplate(t *testing.T) {
+	const configPath = "../test/settings/settings_glob.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	incomingDir := t.TempDir()
+	for _, name := range []string{"b.csv", "a file.csv", "ignored.txt"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(incomingDir, name), nil, 0644))
+	}
+	t.Setenv("TEST_INCOMING_DIR", incomingDir)
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "-o", "json")
+	assert.NoError(t, err, outputStr)
+	assert.Contains(t, outputStr, "FILE="+filepath.Join(incomingDir, "a file.csv")+"\n")
+	assert.Contains(t, outputStr, "FILE="+filepath.Join(incomingDir, "b.csv")+"\n")
+	assert.Contains(t, outputStr, "COUNT=3\n", "The files should be passed after '--', one argument each.")
+	assert.NotContains(t, outputStr, "ignored.txt")
+	assert.NotContains(t, outputStr, "processing json")
+
+	_, summary, _ := strings.Cut(outputStr, "Workflow execution finished.")
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, summary, &states)
+	for _, s := range states {
+		if s.StepName == "process_json" {
+			assert.Equal(t, "when_false", s.Reason, "The step should be skipped while no file matches.")
+		}
+	}
+}
+
+// TestRunAll_Skip verifies that steps excluded with --skip are recorded as skipped,
+// and that --skip-descendants also excludes the steps depending only on them.
+func TestRunAll_Skip(t *testing.T) {
+	const configPath = "../test/settings/settings_skip.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "--skip", "transform", "--skip-descendants", "-o", "json")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "Step 'transform' skipped (excluded by --skip).")
+
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, outputStr, &states)
+	statesMap := make(map[string]TestStepState)
+	for _, s := range states {
+		statesMap[s.StepName] = s
+	}
+	assert.Equal(t, "run", statesMap["extract"].RunAction)
+	assert.Equal(t, "excluded_by_skip", statesMap["transform"].Reason)
+	assert.Equal(t, "excluded_by_skip", statesMap["load"].Reason, "A step depending only on a skipped step should be excluded too.")
+	assert.Equal(t, "run", statesMap["report"].RunAction, "A step not depending on a skipped step should run.")
+
+	// Without --skip-descendants, the dependent step is kept and misses its predecessor's state.
+	outputStr, err = runWhamCommand(t, "--config", configPath, "run", "all", "--skip", "transform")
+	assert.Error(t, err)
+	assert.Contains(t, outputStr, "precondition check failed for step 'load'")
+
+	_, err = runWhamCommand(t, "--config", configPath, "run", "all", "--skip", "missing")
+	assert.Error(t, err, "An unknown step in --skip should be rejected.")
+
+	_, err = runWhamCommand(t, "--config", configPath, "run", "extract", "--skip", "transform")
+	assert.Error(t, err, "--skip should require the 'all' target.")
+}
+
+// TestRunAll_Preflight verifies that `run all` checks all the steps it is about to
+// run before executing any of them, reports all their problems at once, and only
+// warns about those of the steps that can fail.
+func TestRunAll_Preflight(t *testing.T) {
+	const configPath = "../test/settings/settings_preflight.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.Error(t, err)
+	assert.Contains(t, outputStr, "Preflight check found 4 problem(s), no step was run")
+	assert.Contains(t, outputStr, "does_not_exist.sh' for step 'missing_script' not found")
+	assert.Contains(t, outputStr, "invalid work_dir 'does_not_exist' for step 'bad_work_dir'")
+	assert.Contains(t, outputStr, "step 'bad_template': arg '{{ .RunID ': failed to parse parameter template")
+	assert.Contains(t, outputStr, "step 'needs_secret': env_var 'TOKEN': required environment variable 'WHAM_TEST_PREFLIGHT_TOKEN' is not set")
+	assert.NotContains(t, outputStr, "WHAM_TEST_PREFLIGHT_UNSET", "A conditional require_env should not be checked.")
+	assert.Contains(t, outputStr, "Preflight check: step 'optional'", "The problem of a step that can fail should be a warning.")
+	assert.NotContains(t, outputStr, "Step 'first' completed successfully.", "No step should run when the preflight check fails.")
+
+	t.Setenv("WHAM_TEST_PREFLIGHT_TOKEN", "secret")
+	outputStr, err = runWhamCommand(t, "--config", configPath, "run", "all", "--only", "first,needs_secret,optional")
+	assert.NoError(t, err, outputStr)
+	assert.Contains(t, outputStr, "Step 'needs_secret' completed successfully.")
+}
+
+// TestRunAll_When verifies that a step whose `when` condition is false is skipped,
+// unless forced, and that a condition that is not a boolean fails the step.
+func TestRunAll_When(t *testing.T) {
+	const configPath = "../test/settings/settings_when.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "--skip", "not_boolean", "-o", "json")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "Step 'prod_only' skipped (when:")
+
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, outputStr, &states)
+	statesMap := make(map[string]TestStepState)
+	for _, s := range states {
+		statesMap[s.StepName] = s
+	}
+	assert.Equal(t, "when_false", statesMap["prod_only"].Reason)
+	assert.Equal(t, "run", statesMap["always"].RunAction)
+
+	t.Setenv("TEST_DEPLOY_ENV", "prod")
+	outputStr, err = runWhamCommand(t, "--config", configPath, "run", "prod_only")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "Step 'prod_only' completed successfully.", "A true condition should run the step.")
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "run", "not_boolean")
+	assert.Error(t, err)
+	assert.Contains(t, outputStr, "must evaluate to true or false, got 'prod'")
+
+	t.Setenv("TEST_DEPLOY_ENV", "dev")
+	outputStr, err = runWhamCommand(t, "--config", configPath, "run", "prod_only", "--force")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "Step 'prod_only' completed successfully.", "A forced step should ignore its condition.")
+}
+
+// TestRun_Watermark verifies that the watermark of a step advances with the output
+// named by its watermark_from_output, is exposed to its next run as .Watermark, and
+// is kept when the step does not report it.
+func TestRun_Watermark(t *testing.T) {
+	const configPath = "../test/settings/settings_watermark.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	runAndGetWatermark := func(maxLoadedTS, expectedSince string) string {
+		t.Helper()
+		t.Setenv("TEST_MAX_LOADED_TS", maxLoadedTS)
+		outputStr, err := runWhamCommand(t, "--config", configPath, "run", "incremental_load")
+		assert.NoError(t, err)
+		assert.Contains(t, outputStr, "CLI PARAMETERS = since="+expectedSince+"\n", "The previous watermark should be passed to the step.")
+
+		var state TestStepState
+		outputStr, err = runWhamCommand(t, "--config", configPath, "state", "get", "incremental_load", "-o", "json")
+		assert.NoError(t, err)
+		assert.NoError(t, json.Unmarshal([]byte(outputStr), &state))
+		return state.Watermark
+	}
+
+	assert.Equal(t, "2024-01-01T00:00:00Z", runAndGetWatermark("2024-01-01T00:00:00Z", ""))
+	assert.Equal(t, "2024-01-02T00:00:00Z", runAndGetWatermark("2024-01-02T00:00:00Z", "2024-01-01T00:00:00Z"))
+	assert.Equal(t, "2024-01-02T00:00:00Z", runAndGetWatermark("", "2024-01-02T00:00:00Z"), "A run without the output should keep the watermark.")
+}
+
+// TestRunAll_Hooks verifies that before and after hooks run around the command of a
+// step, that after hooks run even if the step failed, that before_retry commands
+// run between failed attempts only, and that hook failures are recorded with their
+// own reasons.
+func TestRunAll_Hooks(t *testing.T) {
+	const configPath = "../test/settings/settings_hooks.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "-o", "json")
+	assert.NoError(t, err, "The workflow should complete, as the failing steps can fail.")
+
+	before := strings.Index(outputStr, "before-marker")
+	command := strings.Index(outputStr, "CLI PARAMETERS = main-marker")
+	after := strings.Index(outputStr, "after-marker")
+	assert.True(t, before >= 0 && before < command && command < after, "The hooks should run around the command.")
+	assert.Contains(t, outputStr, "cleanup-after-failure", "After hooks should run when the command fails.")
+	assert.Contains(t, outputStr, "cleanup-after-before-failure", "After hooks should run when a before hook fails.")
+	assert.NotContains(t, outputStr, "CLI PARAMETERS = never-run-marker", "The command should not run when a before hook fails.")
+	partial := strings.Index(outputStr, "partial-load-marker")
+	repair := strings.Index(outputStr, "repair-marker")
+	assert.True(t, partial >= 0 && partial < repair, "The before_retry commands should run after the failed attempt.")
+	assert.Equal(t, 1, strings.Count(outputStr, "repair-marker"), "The before_retry commands should only run before the retry.")
+
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, outputStr, &states)
+	statesMap := make(map[string]TestStepState)
+	for _, s := range states {
+		statesMap[s.StepName] = s
+	}
+	assert.Equal(t, "run", statesMap["with_hooks"].RunAction)
+	assert.Equal(t, "failed", statesMap["main_fails"].RunAction)
+	assert.Empty(t, statesMap["main_fails"].Reason)
+	assert.Equal(t, "before_hook_failed", statesMap["before_fails"].Reason)
+	assert.Equal(t, "after_hook_failed", statesMap["after_fails"].Reason)
+	assert.Equal(t, "run", statesMap["repaired_on_retry"].RunAction)
+	assert.Equal(t, "failed", statesMap["repair_fails"].RunAction)
+	assert.Equal(t, "before_retry_failed", statesMap["repair_fails"].Reason)
+}
+
+// TestRunAll_WorkflowHandlers verifies that the on_success and on_failure handlers
+// run at the end of a workflow run, with its outcome and execution summary.
+func TestRunAll_WorkflowHandlers(t *testing.T) {
+	const configPath = "../test/settings/settings_handlers.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "on-success-marker succeeded 2 templated-succeeded", "The on_success handler should receive the outcome and the summary.")
+	assert.NotContains(t, outputStr, "on-failure-marker")
+
+	t.Setenv("EXIT_STATUS", "fail")
+	outputStr, err = runWhamCommand(t, "--config", configPath, "run", "all", "--force")
+	assert.Error(t, err, "A handler should not change the outcome of a failed run.")
+	assert.Contains(t, outputStr, "on-failure-marker failed: ", "The on_failure handler should receive the outcome.")
+	assert.Contains(t, outputStr, "first_step", "The on_failure handler should receive the error.")
+	assert.NotContains(t, outputStr, "on-success-marker")
+}
+
+// TestRunAll_Priority verifies that steps of equal depth are executed by decreasing
+// priority, and that a priority never runs a step before its predecessors.
+func TestRunAll_Priority(t *testing.T) {
+	const configPath = "../test/settings/settings_priority.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.NoError(t, err)
+
+	high := strings.Index(outputStr, "CLI PARAMETERS = high-marker")
+	def := strings.Index(outputStr, "CLI PARAMETERS = default-marker")
+	low := strings.Index(outputStr, "CLI PARAMETERS = low-marker")
+	descendant := strings.Index(outputStr, "CLI PARAMETERS = descendant-marker")
+	assert.True(t, high >= 0 && high < def && def < low, "Steps of equal depth should run by decreasing priority.")
+	assert.True(t, low < descendant, "A step should run after its predecessors, whatever its priority.")
+}
+
+// TestRunAll_EnvFiles verifies that the variables of the env files of the settings
+// and of a step are set for its execution, with the documented precedence.
+func TestRunAll_EnvFiles(t *testing.T) {
+	const configPath = "../test/settings/settings_env_files.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "-o", "json")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "ENV = shared-value from-step-file with_env_files from-env-vars")
+	assert.NotContains(t, outputStr, "never-run-marker", "A step whose env file is missing should not run.")
+
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, outputStr, &states)
+	for _, s := range states {
+		if s.StepName == "missing_env_file" {
+			assert.Equal(t, "failed", s.RunAction)
+		}
+	}
+}
+
+func TestRunAll_FailurePatterns(t *testing.T) {
+	const configPath = "../test/settings/settings_failure_patterns.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "-o", "json")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "Running step 'retryable_failure' (attempt 2/2)", "A retryable failure should be retried.")
+	assert.Contains(t, outputStr, "Step 'fatal_failure' failed with a fatal failure (syntax_error), not retrying.")
+	assert.NotContains(t, outputStr, "Running step 'fatal_failure' (attempt 2/3)", "A fatal failure should not be retried.")
+
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, outputStr, &states)
+	classes := map[string]string{}
+	for _, s := range states {
+		assert.Equal(t, "failed", s.RunAction, "Step '%s' should have failed.", s.StepName)
+		classes[s.StepName] = s.FailureClass
+	}
+	assert.Equal(t, map[string]string{
+		"retryable_failure":    "quota_exceeded",
+		"fatal_failure":        "syntax_error",
+		"unclassified_failure": "",
+	}, classes)
+}
+
+func TestRunAll_TTY(t *testing.T) {
+	const configPath = "../test/settings/settings_tty.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "Running with a terminal: true", "The output under the terminal should still be captured.")
+
+	var state struct {
+		Outputs map[string]string `json:"outputs"`
+	}
+	for step, expected := range map[string]string{"with_tty": "true", "without_tty": "false"} {
+		outputStr, err = runWhamCommand(t, "--config", configPath, "state", "get", step, "-o", "json")
+		assert.NoError(t, err)
+		assert.NoError(t, json.Unmarshal([]byte(outputStr), &state))
+		assert.Equal(t, expected, state.Outputs["is_tty"], "Unexpected terminal for step '%s'.", step)
+	}
+}
+
+func TestRunAll_Interrupted(t *testing.T) {
+	const configPath = "../test/settings/settings_interrupt.yaml"
+	const childPIDFile = "../test/states/metadata/hanging_child.pid"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	var stdout strings.Builder
+	run := exec.Command(whamBinaryPath, "--config", configPath, "run", "all", "-o", "json")
+	run.Env = append(os.Environ(), "NO_COLOR=true")
+	run.Stdout = &stdout
+	assert.NoError(t, run.Start())
+	t.Cleanup(func() { run.Process.Kill() })
+
+	// Wait for the hung step to be running, then interrupt WHAM.
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(childPIDFile)
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond, "The hung step should have started.")
+	assert.NoError(t, run.Process.Signal(syscall.SIGTERM))
+	assert.Error(t, run.Wait(), "An interrupted workflow should fail.")
+
+	outputStr := stdout.String()
+	assert.Contains(t, outputStr, "Workflow aborted: interrupted by signal 'terminated'.")
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, outputStr, &states)
+	statesMap := make(map[string]TestStepState)
+	for _, s := range states {
+		statesMap[s.StepName] = s
+	}
+	assert.Equal(t, "failed", statesMap["hangs"].RunAction)
+	assert.Equal(t, "interrupted", statesMap["hangs"].Reason)
+	assert.Equal(t, "skipped", statesMap["after_hang"].RunAction)
+	assert.Equal(t, "cancelled", statesMap["after_hang"].Reason)
+
+	// The script and its background child must not outlive WHAM.
+	data, err := os.ReadFile(childPIDFile)
+	assert.NoError(t, err)
+	childPID := strings.TrimSpace(string(data))
+	assert.Eventually(t, func() bool {
+		stat, err := os.ReadFile(filepath.Join("/proc", childPID, "stat"))
+		return err != nil || strings.Contains(string(stat), ") Z ")
+	}, 2*time.Second, 50*time.Millisecond, "The script's child process should have been killed.")
+}
+
+func TestRunAll_ForwardsSignals(t *testing.T) {
+	const configPath = "../test/settings/settings_signals.yaml"
+	const pidFile = "../test/states/metadata/trap_term.pid"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	run := exec.Command(whamBinaryPath, "--config", configPath, "run", "all")
+	run.Env = append(os.Environ(), "NO_COLOR=true")
+	assert.NoError(t, run.Start())
+	t.Cleanup(func() { run.Process.Kill() })
+
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(pidFile)
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond, "The script should have started.")
+	start := time.Now()
+	assert.NoError(t, run.Process.Signal(syscall.SIGINT))
+	assert.Error(t, run.Wait(), "An interrupted workflow should fail.")
+	assert.Less(t, time.Since(start), 5*time.Second, "WHAM should exit as soon as the script has cleaned up.")
+
+	// The script received the same signal as WHAM, rather than being killed outright.
+	data, err := os.ReadFile("../test/states/metadata/trap_term.marker")
+	assert.NoError(t, err, "The script should have trapped the forwarded signal.")
+	assert.Equal(t, "INT", strings.TrimSpace(string(data)))
+}
+
+func TestRunAll_Watch(t *testing.T) {
+	const configPath = "../test/settings/settings_watch.yaml"
+	const runsLog = "../test/states/metadata/watch_runs.log"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() {
+		os.Remove("../test/states/data/watched.csv")
+		os.Remove("../test/states/data/ignored.txt")
+		cleanTestStates(t, configPath)
+	})
+	countRuns := func() int {
+		data, _ := os.ReadFile(runsLog)
+		return strings.Count(string(data), "run")
+	}
+
+	run := exec.Command(whamBinaryPath, "--config", configPath, "run", "all", "--watch", "../test/states/data/*.csv")
+	run.Env = append(os.Environ(), "NO_COLOR=true")
+	assert.NoError(t, run.Start())
+	t.Cleanup(func() { run.Process.Kill() })
+
+	assert.Eventually(t, func() bool { return countRuns() == 1 }, 5*time.Second, 50*time.Millisecond, "The workflow should run when the watch starts.")
+	time.Sleep(200 * time.Millisecond) // Let the watch start after the run.
+
+	assert.NoError(t, os.WriteFile("../test/states/data/ignored.txt", []byte("x"), 0o644))
+	time.Sleep(time.Second)
+	assert.Equal(t, 1, countRuns(), "A change of a file not matching the pattern should not re-run the workflow.")
+
+	assert.NoError(t, os.WriteFile("../test/states/data/watched.csv", []byte("a,b\n"), 0o644))
+	assert.Eventually(t, func() bool { return countRuns() == 2 }, 5*time.Second, 50*time.Millisecond, "A change of a watched file should re-run the workflow.")
+
+	assert.NoError(t, run.Process.Signal(syscall.SIGINT))
+	assert.NoError(t, run.Wait(), "A signal received between runs should stop the watch gracefully.")
+}
+
+func TestRunAll_LogLevel(t *testing.T) {
+	const configPath = "../test/settings/settings_log_level.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	// Debug messages go to stderr, so capture both streams.
+	run := exec.Command(whamBinaryPath, "--config", configPath, "run", "all")
+	run.Env = append(os.Environ(), "NO_COLOR=true")
+	output, err := run.CombinedOutput()
+	assert.NoError(t, err)
+	outputStr := string(output)
+
+	assert.NotContains(t, outputStr, "CLI PARAMETERS = chatty-marker", "The output of a quiet step should be muted.")
+	assert.Contains(t, outputStr, "Step 'chatty' completed successfully.", "WHAM's own messages about a quiet step are kept.")
+	assert.Contains(t, outputStr, "CLI PARAMETERS = fragile-marker")
+	assert.Contains(t, outputStr, "CLI PARAMETERS = regular-marker")
+	assert.Regexp(t, `DBG Executing command with runtime context\..*step=fragile`, outputStr, "A debug step should show its debug messages.")
+	assert.NotRegexp(t, `DBG .*step=regular`, outputStr, "Other steps should not show debug messages without --debug.")
+}
+
+// TestRunAll_ExpectedOutputs verifies that a step succeeding without producing or
+// updating its expected outputs is recorded as failed, or only warned about with
+// the "warn" policy, while a rewritten output passes even if its mtime was restored.
+func TestRunAll_ExpectedOutputs(t *testing.T) {
+	configPath := "../test/settings/settings_expected_outputs.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "-o", "json")
+	assert.NoError(t, err, "The workflow should complete, as the failing step can fail.")
+	assert.Contains(t, outputStr, "Step 'missing_warns' succeeded without producing its expected outputs: '../states/data/missing.csv' does not exist", "A warning should be printed for the 'warn' policy.")
+	assert.Contains(t, outputStr, "'../states/data/stale.csv' was not updated", "The failure reason should be printed.")
+
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, outputStr, &states)
+	statesMap := make(map[string]TestStepState)
+	for _, s := range states {
+		statesMap[s.StepName] = s
+	}
+	assert.Equal(t, "run", statesMap["produces"].RunAction)
+	assert.Equal(t, "run", statesMap["restores_mtime"].RunAction, "A changed output should pass even with an old mtime.")
+	assert.Equal(t, "run", statesMap["missing_warns"].RunAction)
+	assert.NotEmpty(t, statesMap["missing_warns"].Warnings)
+	assert.Equal(t, "failed", statesMap["stale_fails"].RunAction)
+	assert.Equal(t, "stale_outputs", statesMap["stale_fails"].Reason)
+}
+
+// TestRunAll_GeneratesSteps verifies that the steps printed by a generator step are
+// executed right after it, in dependency order and before its successors, both
+// serially and in parallel, and that an invalid output fails the generator.
+func TestRunAll_GeneratesSteps(t *testing.T) {
+	configPath := "../test/settings/settings_generates_steps.yaml"
+	for name, args := range map[string][]string{"serial": {}, "parallel": {"--parallel", "2"}} {
+		t.Run(name, func(t *testing.T) {
+			cleanTestStates(t, configPath)
+			t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+			outputStr, err := runWhamCommand(t, append([]string{"--config", configPath, "run", "all", "-o", "json"}, args...)...)
+			assert.NoError(t, err, "The workflow should complete, as the invalid generator can fail.")
+			assert.Contains(t, outputStr, "Step 'list_partitions' generated 3 step(s): load_eu, load_us, merge_partitions.")
+			assert.Regexp(t, `order: load_(eu|us) load_(eu|us) merge_partitions \n`, outputStr, "The successor should run after all the generated steps.")
+			assert.Contains(t, outputStr, "failed to parse the steps generated on standard output")
+
+			// The generator's output is a JSON array too: skip it.
+			_, summary, _ := strings.Cut(outputStr, "Workflow execution finished.")
+			var states []TestStepState
+			findAndUnmarshalRunSummary(t, summary, &states)
+			statesMap := make(map[string]TestStepState)
+			for _, s := range states {
+				statesMap[s.StepName] = s
+			}
+			for _, name := range []string{"list_partitions", "load_eu", "load_us", "merge_partitions", "report"} {
+				assert.Equal(t, "run", statesMap[name].RunAction, "Step '%s' should have run.", name)
+			}
+			assert.Equal(t, statesMap["list_partitions"].RunID, statesMap["merge_partitions"].RunID, "Generated steps should inherit the generator's run_id.")
+			assert.Equal(t, "failed", statesMap["bad_generator"].RunAction)
+		})
+	}
+}
+
+// TestRunAll_Locks verifies that steps sharing a named lock never run at the same
+// time, even in parallel runs, and wait for a lock held by another process.
+func TestRunAll_Locks(t *testing.T) {
+	configPath := "../test/settings/settings_locks.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	// Hold one of the locks, as another WHAM process would.
+	locksDir := "../test/states/locks"
+	assert.NoError(t, os.MkdirAll(locksDir, 0755))
+	t.Cleanup(func() { os.RemoveAll(locksDir) })
+	lockFile, err := os.OpenFile(filepath.Join(locksDir, "api_quota.lock"), os.O_RDWR|os.O_CREATE, 0644)
+	assert.NoError(t, err)
+	defer lockFile.Close()
+	assert.NoError(t, syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX))
+	// Release it from another goroutine, which must be done before the file is closed.
+	released := make(chan struct{})
+	go func() {
+		defer close(released)
+		time.Sleep(time.Second)
+		syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+	}()
+	defer func() { <-released }()
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "--parallel", "2")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "Step 'load_customers' waiting for lock 'api_quota'", "The step should wait for the lock held by another process.")
+	for _, step := range []string{"load_orders", "load_customers"} {
+		assert.Regexp(t, "start "+step+"\nend "+step+"\n", outputStr, "Steps sharing a lock should not overlap.")
+	}
+}
+
+// TestRunAll_RunLock verifies that a run fails at once while another process holds
+// the run lock of the metadata directory, naming the holder, and succeeds once the
+// lock is released.
+func TestRunAll_RunLock(t *testing.T) {
+	configPath := "../test/settings/settings_progress_file.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	// Hold the run lock, as another WHAM process would.
+	metadataDir := "../test/states/metadata"
+	assert.NoError(t, os.MkdirAll(metadataDir, 0755))
+	lockFile, err := os.OpenFile(filepath.Join(metadataDir, "wham_run.lock"), os.O_RDWR|os.O_CREATE, 0644)
+	assert.NoError(t, err)
+	defer lockFile.Close()
+	assert.NoError(t, syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX))
+	_, err = lockFile.WriteString("PID 4242, run all, since 2026-03-01T03:00:00Z\n")
+	assert.NoError(t, err)
+
+	for _, target := range []string{"all", "extract"} {
+		outputStr, err := runWhamCommand(t, "--config", configPath, "run", target)
+		assert.Error(t, err, "The run should fail while the lock is held.")
+		assert.Contains(t, outputStr, "another WHAM process is running this workflow (PID 4242, run all, since 2026-03-01T03:00:00Z)")
+		assert.NotContains(t, outputStr, "Running step", "No step should run while the lock is held.")
+	}
+
+	assert.NoError(t, syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN))
+	_, err = runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.NoError(t, err, "The run should succeed once the lock is released.")
+}
+
+// TestRunAll_IdempotencyKey verifies that all the attempts of a step in a workflow
+// run receive the same idempotency key, in the environment and the templates, and
+// that another workflow run gets another key.
+func TestRunAll_IdempotencyKey(t *testing.T) {
+	configPath := "../test/settings/settings_idempotency.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	keyPattern := regexp.MustCompile(`attempt key=([0-9a-f]{32}) arg=([0-9a-f]{32})`)
+	var runKeys []string
+	for range 2 {
+		outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all")
+		assert.NoError(t, err, "The step should succeed on its second attempt.")
+		matches := keyPattern.FindAllStringSubmatch(outputStr, -1)
+		if assert.Len(t, matches, 2, "Both attempts should print their key.") {
+			assert.Equal(t, matches[0][1], matches[0][2], "The template and the environment should get the same key.")
+			assert.Equal(t, matches[0][1], matches[1][1], "The attempts should share the same key.")
+			runKeys = append(runKeys, matches[0][1])
+		}
+	}
+	if len(runKeys) == 2 {
+		assert.NotEqual(t, runKeys[0], runKeys[1], "Each workflow run should get its own key.")
+	}
+}
+
+// TestRunAll_WorkflowRunID verifies that the steps of a workflow run get its ID in
+// VAR_WHAM_RUN_ID and in templates, and that it is recorded in their states.
+func TestRunAll_WorkflowRunID(t *testing.T) {
+	configPath := "../test/settings/settings_workflow_run_id.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "-o", "json")
+	assert.NoError(t, err)
+	match := regexp.MustCompile(`Starting workflow run '([^']+)'`).FindStringSubmatch(outputStr)
+	if !assert.NotNil(t, match, "The workflow run ID should be printed.") {
+		return
+	}
+	runID := match[1]
+	assert.Contains(t, outputStr, fmt.Sprintf("extract env=%s arg=%s\n", runID, runID))
+	assert.Contains(t, outputStr, fmt.Sprintf("load env=%s\n", runID))
+
+	_, summary, _ := strings.Cut(outputStr, "Workflow execution finished.")
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, summary, &states)
+	for _, s := range states {
+		assert.Equal(t, runID, s.WorkflowRunID, "The state of '%s' should record the workflow run ID.", s.StepName)
+	}
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "run", "extract")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "extract env= ", "A step run alone does not belong to a workflow run.")
+}
+
+// TestRunAll_SubWorkflow verifies that a workflow step runs the DAG of another
+// configuration with its own metadata namespace, and records a single aggregate
+// state, whose run_id its successors inherit.
+func TestRunAll_SubWorkflow(t *testing.T) {
+	configPath := "../test/settings/settings_subworkflow.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "-o", "json")
+	assert.NoError(t, err, "The workflow should complete, as the failing steps can fail.")
+	assert.Contains(t, outputStr, "Step 'sub_extract' completed successfully.", "The steps of the sub-workflow should run.")
+
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, outputStr, &states)
+	statesMap := make(map[string]TestStepState)
+	for _, s := range states {
+		statesMap[s.StepName] = s
+	}
+	assert.NotContains(t, statesMap, "sub_extract", "The sub-workflow's steps should not be recorded in the parent's state.")
+	nested := statesMap["nested"]
+	assert.Equal(t, "run", nested.RunAction)
+	assert.NotEmpty(t, nested.RunID, "The aggregate run_id should be derived from the sub-workflow's steps.")
+	assert.Equal(t, map[string]string{"steps_run": "1", "steps_skipped": "0", "steps_failed": "1"}, nested.Outputs)
+	assert.Contains(t, nested.Warnings, "sub-workflow step 'sub_optional' failed")
+	assert.Equal(t, nested.RunID, statesMap["report"].RunID)
+	assert.FileExists(t, "../test/states/metadata/workflows/nested/wham_sub_extract.state", "The sub-workflow's states should be kept in the step's namespace.")
+	assert.Equal(t, "failed", statesMap["recursive"].RunAction, "A workflow including itself should fail.")
+}
+
+// TestRunAll_RunAsUser verifies that a step and its hooks run as the user and group
+// given by run_as_user and run_as_group, and can still report their outputs.
+func TestRunAll_RunAsUser(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("Running steps as another user requires root privileges.")
+	}
+	configPath := "../test/settings/settings_run_as.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "-o", "json")
+	assert.NoError(t, err, "The workflow should complete, as the failing step can fail.")
+	assert.Contains(t, outputStr, "hook uid=65534", "The hooks should run as the step's user.")
+	assert.Contains(t, outputStr, "step uid=65534 gid=65534 user=nobody", "The step should run as its user and group.")
+
+	var states []TestStepState
+	findAndUnmarshalRunSummary(t, outputStr, &states)
+	statesMap := make(map[string]TestStepState)
+	for _, s := range states {
+		statesMap[s.StepName] = s
+	}
+	assert.Equal(t, "run", statesMap["as_nobody"].RunAction, "The step should be able to write its outputs.")
+	assert.Equal(t, "failed", statesMap["unknown_user"].RunAction)
+}
+
+// TestRunAll_Staging verifies that the steps marked with dry_run, or all of them
+// with --staging, get VAR_WHAM_DRY_RUN=1 and record their states as dry runs.
+func TestRunAll_Staging(t *testing.T) {
+	const configPath = "../test/settings/settings_staging.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	runAndGetStates := func(args ...string) (string, map[string]TestStepState) {
+		outputStr, err := runWhamCommand(t, append([]string{"--config", configPath, "run", "all", "--force", "-o", "json"}, args...)...)
+		assert.NoError(t, err)
+		_, summary, _ := strings.Cut(outputStr, "Workflow execution finished.")
+		var states []TestStepState
+		findAndUnmarshalRunSummary(t, summary, &states)
+		statesMap := make(map[string]TestStepState)
+		for _, s := range states {
+			statesMap[s.StepName] = s
+		}
+		return outputStr, statesMap
+	}
+
+	outputStr, states := runAndGetStates()
+	assert.Contains(t, outputStr, "load dry_run=0 \n")
+	assert.Contains(t, outputStr, "canary dry_run=1")
+	assert.False(t, states["load"].DryRun)
+	assert.True(t, states["canary"].DryRun)
+
+	outputStr, states = runAndGetStates("--staging")
+	assert.Contains(t, outputStr, "load dry_run=1 templated-dry-run")
+	assert.Contains(t, outputStr, "canary dry_run=1")
+	assert.True(t, states["load"].DryRun)
+	assert.True(t, states["canary"].DryRun)
+}
+
+// TestRunAll_ProgressFile verifies that `run all` keeps a progress file in the
+// metadata directory up to date: a running step reads itself as the current step,
+// with the finished steps and an ETA, and the file records the final status.
+func TestRunAll_ProgressFile(t *testing.T) {
+	const configPath = "../test/settings/settings_progress_file.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.NoError(t, err, outputStr)
+	assert.Regexp(t, `"current_steps": \[\s*"report"\s*\]`, outputStr, "The running step should be the current step.")
+	assert.Contains(t, outputStr, `"steps_done": 1,`)
+	assert.Contains(t, outputStr, `"steps_total": 2,`)
+	assert.Contains(t, outputStr, `"status": "running"`)
+	assert.Contains(t, outputStr, `"eta": "`, "An ETA should be estimated once a step has finished.")
+
+	data, err := os.ReadFile("../test/states/metadata/wham_progress.json")
+	assert.NoError(t, err)
+	var progress struct {
+		WorkflowRunID string   `json:"workflow_run_id"`
+		Status        string   `json:"status"`
+		CurrentSteps  []string `json:"current_steps"`
+		StepsDone     int      `json:"steps_done"`
+		StepsTotal    int      `json:"steps_total"`
+		ETA           *string  `json:"eta"`
+	}
+	assert.NoError(t, json.Unmarshal(data, &progress))
+	assert.Equal(t, "succeeded", progress.Status)
+	assert.NotEmpty(t, progress.WorkflowRunID)
+	assert.Empty(t, progress.CurrentSteps)
+	assert.Equal(t, 2, progress.StepsDone)
+	assert.Equal(t, 2, progress.StepsTotal)
+	assert.Nil(t, progress.ETA, "A finished run has no ETA.")
+}
+
+// TestRunAll_ScratchDir verifies that a step with a `scratch_dir` gets a private
+// temporary directory in VAR_SCRATCH_DIR and TMPDIR, removed after the step.
+func TestRunAll_ScratchDir(t *testing.T) {
+	const configPath = "../test/settings/settings_scratch_dir.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "uses_scratch")
+	assert.NoError(t, err, outputStr)
+	outputStr, err = runWhamCommand(t, "--config", configPath, "state", "get", "uses_scratch", "-o", "json")
+	assert.NoError(t, err)
+	var state TestStepState
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &state), outputStr)
+
+	scratchDir := state.Outputs["scratch_dir"]
+	assert.NotEmpty(t, scratchDir, "The step should get its scratch directory in VAR_SCRATCH_DIR.")
+	assert.Equal(t, scratchDir, state.Outputs["tmpdir"], "TMPDIR should point at the scratch directory.")
+	_, err = os.Stat(scratchDir)
+	assert.True(t, os.IsNotExist(err), "The scratch directory should be removed after the step.")
+}
+
+// TestRunAll_RunIDFromOutputs verifies that a stateful step with run_id_from_outputs
+// gets a run_id hashed from the files it produced, which changes only with them.
+func TestRunAll_RunIDFromOutputs(t *testing.T) {
+	const configPath = "../test/settings/settings_run_id_from_outputs.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	runAll := func(content string) map[string]TestStepState {
+		t.Setenv("WHAM_TEST_EXPORT_CONTENT", content)
+		outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "-o", "json")
+		assert.NoError(t, err, outputStr)
+		var states []TestStepState
+		findAndUnmarshalRunSummary(t, outputStr, &states)
+		statesMap := make(map[string]TestStepState)
+		for _, s := range states {
+			statesMap[s.StepName] = s
+		}
+		return statesMap
+	}
+
+	first := runAll("id,amount\n1,10\n")
+	assert.NotEmpty(t, first["export"].RunID, "The run_id should be derived from the outputs.")
+	assert.Equal(t, "run", first["report"].RunAction)
+
+	second := runAll("id,amount\n1,10\n")
+	assert.Equal(t, first["export"].RunID, second["export"].RunID, "Unchanged outputs should keep the run_id.")
+	assert.Equal(t, "skipped", second["report"].RunAction, "The successor should be skipped when the outputs did not change.")
+
+	third := runAll("id,amount\n1,10\n2,20\n")
+	assert.NotEqual(t, first["export"].RunID, third["export"].RunID, "Changed outputs should change the run_id.")
+	assert.Equal(t, "run", third["report"].RunAction)
+}
+
+// TestRun_Inputs verifies that a stateless step with inputs is skipped while they
+// are unchanged, and runs again when one of them is modified or added.
+func TestRun_Inputs(t *testing.T) {
+	const configPath = "../test/settings/settings_inputs.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	srcDir := "../test/states/data/src"
+	assert.NoError(t, os.MkdirAll(srcDir, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a"), 0644))
+	runCompile := func() string {
+		_, err := runWhamCommand(t, "--config", configPath, "run", "compile")
+		assert.NoError(t, err)
+		outputStr, err := runWhamCommand(t, "--config", configPath, "state", "get", "compile", "-o", "json")
+		assert.NoError(t, err)
+		var state TestStepState
+		assert.NoError(t, json.Unmarshal([]byte(outputStr), &state), outputStr)
+		return state.RunAction
+	}
+
+	assert.Equal(t, "run", runCompile(), "A step that never ran should run.")
+	assert.Equal(t, "skipped", runCompile(), "A step whose inputs are unchanged should be skipped.")
+	assert.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("changed"), 0644))
+	assert.Equal(t, "run", runCompile(), "A modified input should make the step run.")
+	assert.NoError(t, os.WriteFile(filepath.Join(srcDir, "b.txt"), []byte("b"), 0644))
+	assert.Equal(t, "run", runCompile(), "A new input should make the step run.")
+	assert.Equal(t, "skipped", runCompile())
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "--dry-run")
+	assert.NoError(t, err)
+	assert.Contains(t, outputStr, "no changes in previous steps or inputs since the last run")
+}
+
+// TestRun_LastSuccess verifies that a step gets the date of its last successful
+// execution, from its history, in templates and in VAR_LAST_SUCCESS_DATE, and that
+// its failures since do not count.
+func TestRun_LastSuccess(t *testing.T) {
+	const configPath = "../test/settings/settings_last_success.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	sincePattern := regexp.MustCompile(`since=(\S*) run_id=\S* env=(\S+)`)
+	runLoad := func(exitCode string) []string {
+		t.Setenv("WHAM_TEST_LOAD_EXIT", exitCode)
+		outputStr, _ := runWhamCommand(t, "--config", configPath, "run", "load", "--force")
+		match := sincePattern.FindStringSubmatch(outputStr)
+		if !assert.NotNil(t, match, outputStr) {
+			t.FailNow()
+		}
+		return match[1:]
+	}
+
+	assert.Equal(t, []string{"", "unset"}, runLoad("0"), "A step that never succeeded should have no last success.")
+	afterSuccess := runLoad("1")
+	assert.NotEmpty(t, afterSuccess[0])
+	assert.Equal(t, afterSuccess[0], afterSuccess[1], "The template and the env var should agree.")
+	_, err := time.Parse(time.RFC3339, afterSuccess[0])
+	assert.NoError(t, err, "The last success should render as an RFC 3339 date.")
+	assert.Equal(t, afterSuccess, runLoad("1"), "A failure should not move the last success.")
+}
+
+// TestRunAll_AtomicStateWrites verifies that the WHAM state files are replaced
+// through temporary files that do not outlive the run, and always hold valid JSON.
+func TestRunAll_AtomicStateWrites(t *testing.T) {
+	const configPath = "../test/settings/settings_ok.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	for range 2 {
+		_, err := runWhamCommand(t, "--config", configPath, "run", "all", "--force")
+		assert.NoError(t, err)
+	}
+	stateFiles, err := filepath.Glob("../test/states/metadata/wham_*.state")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, stateFiles)
+	for _, path := range stateFiles {
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.True(t, json.Valid(data), "State file '%s' should hold valid JSON.", path)
+	}
+	leftovers, err := filepath.Glob("../test/states/metadata/.wham_*")
+	assert.NoError(t, err)
+	assert.Empty(t, leftovers, "No temporary state file should be left behind.")
+}
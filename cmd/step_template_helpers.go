@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"maps"
+
+	"dario.cat/mergo"
+)
+
+// applyStepTemplates resolves the `extends` field of every step of the
+// configuration (see applyStepTemplate).
+func (c *Config) applyStepTemplates() error {
+	for name, tmpl := range c.StepTemplates {
+		if tmpl.Name != "" || tmpl.PreviousSteps != nil {
+			return fmt.Errorf("invalid step template '%s': templates cannot define 'name' or 'previous_steps'", name)
+		}
+	}
+	for i := range c.WhamSteps {
+		step := &c.WhamSteps[i]
+		if err := c.applyStepTemplate(step); err != nil {
+			return fmt.Errorf("invalid configuration for step '%s'%s: %w", step.Name, atPosition(c.stepPosition(step.Name)), err)
+		}
+	}
+	return nil
+}
+
+// applyStepTemplate merges into a step the template it extends, from the
+// `step_templates` of the configuration, then the template that one extends, and
+// so on. The fields set by the step take precedence over the template's, and the
+// fields set by a template over those of the template it extends; maps, such as
+// `env_vars`, are merged key by key.
+//
+// As with override files, a field set to its zero value (e.g., `can_fail: false`)
+// does not override the template's.
+func (c *Config) applyStepTemplate(step *Step) error {
+	seen := make(map[string]bool)
+	for name := step.Extends; name != ""; {
+		if seen[name] {
+			return fmt.Errorf("step template '%s' extends itself", name)
+		}
+		seen[name] = true
+		tmpl, ok := c.StepTemplates[name]
+		if !ok {
+			return fmt.Errorf("step template '%s' is not defined", name)
+		}
+		current := name
+		name = tmpl.Extends
+		// The template is shared by several steps: merge a copy of its maps and blocks.
+		tmpl.Extends = ""
+		tmpl.EnvVars = maps.Clone(tmpl.EnvVars)
+		if tmpl.Check != nil {
+			check := *tmpl.Check
+			tmpl.Check = &check
+		}
+		if tmpl.Dbt != nil {
+			dbt := *tmpl.Dbt
+			tmpl.Dbt = &dbt
+		}
+		if tmpl.Freshness != nil {
+			freshness := *tmpl.Freshness
+			tmpl.Freshness = &freshness
+		}
+		if tmpl.ScratchDir != nil {
+			scratchDir := *tmpl.ScratchDir
+			tmpl.ScratchDir = &scratchDir
+		}
+		if err := mergo.Merge(step, tmpl); err != nil {
+			return fmt.Errorf("failed to apply step template '%s': %w", current, err)
+		}
+	}
+	return nil
+}
@@ -14,14 +14,20 @@ type ValidationResult struct {
 }
 
 // GetValidationStatus orchestrates the validation of one or all steps and renders the result.
-func (w *WHAM) GetValidationStatus(target string, outputFormat string) error {
+// With the 'all' target, only the steps matching the selector are validated.
+func (w *WHAM) GetValidationStatus(target string, selector StepSelector, outputFormat string) error {
+	if err := selector.checkTarget(target); err != nil {
+		return err
+	}
 	var results []ValidationResult
 	var stepsToValidate []*Step
 
 	if target == "all" {
-		for i := range w.config.WhamSteps {
-			stepsToValidate = append(stepsToValidate, &w.config.WhamSteps[i])
+		selected, err := w.selectSteps(selector)
+		if err != nil {
+			return err
 		}
+		stepsToValidate = selected
 	} else {
 		step := w.findStep(target)
 		if step == nil {
@@ -45,7 +51,7 @@ func (w *WHAM) GetValidationStatus(target string, outputFormat string) error {
 			return RenderData(os.Stdout, results[0], outputFormat)
 		}
 		return RenderData(os.Stdout, results, outputFormat)
-	case "table":
+	case "table", "wide":
 		return w.renderValidationResultsAsTable(results)
 	default:
 		return fmt.Errorf("unsupported output format: '%s'", outputFormat)
@@ -56,7 +62,19 @@ func (w *WHAM) GetValidationStatus(target string, outputFormat string) error {
 func (w *WHAM) validateSteps(steps []*Step) []ValidationResult {
 	var results []ValidationResult
 	for _, step := range steps {
-		_, err := w.validateStepExecutable(step)
+		var err error
+		if step.Type == StepTypeWorkflow {
+			err = w.validateSubWorkflow(step)
+		} else {
+			_, err = w.validateStepExecutable(step)
+		}
+		if err == nil {
+			// The user and group the step runs as must exist.
+			_, err = resolveRunAs(step)
+		}
+		if err == nil {
+			err = checkStepRequirements(step)
+		}
 		if err != nil {
 			results = append(results, ValidationResult{StepName: step.Name, Valid: false, Reason: err.Error()})
 		} else {
@@ -69,6 +87,7 @@ func (w *WHAM) validateSteps(steps []*Step) []ValidationResult {
 // renderValidationResultsAsTable displays validation results in a table.
 func (w *WHAM) renderValidationResultsAsTable(results []ValidationResult) error {
 	tr := NewTableRenderer(os.Stdout, "NAME", "VALID", "REASON")
+	tr.SetWrap(w.noTruncate)
 	for _, res := range results {
 		tr.AddRow(res.StepName, strconv.FormatBool(res.Valid), res.Reason)
 	}
@@ -2,6 +2,7 @@ package cmd_test
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -80,3 +81,100 @@ func TestValidate_FailNonExistentStep(t *testing.T) {
 	assert.False(t, result.Valid, "The 'valid' field should be false for a non-existent step.")
 	assert.Equal(t, "not found in configuration", result.Reason, "The reason should indicate the step was not found.")
 }
+
+// TestValidate_FailUnknownRunAsUser tests that a step running as a user unknown to
+// the system fails validation.
+func TestValidate_FailUnknownRunAsUser(t *testing.T) {
+	const configPath = "../test/settings/settings_run_as.yaml"
+	cleanTestStates(t, configPath)                       // Clean before
+	t.Cleanup(func() { cleanTestStates(t, configPath) }) // Clean after
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "validate", "unknown_user", "-o", "json")
+
+	assert.NoError(t, err, "The validate command should always exit successfully.")
+
+	var result TestValidationResult
+	err = json.Unmarshal([]byte(outputStr), &result)
+	assert.NoError(t, err, "Should be able to unmarshal the JSON output.")
+
+	assert.False(t, result.Valid, "The 'valid' field should be false.")
+	assert.Contains(t, result.Reason, "unknown user 'wham-no-such-user'", "The reason should name the unknown user.")
+}
+
+// TestValidate_FailRecursiveSubWorkflow tests that a workflow step running its own
+// configuration fails validation.
+func TestValidate_FailRecursiveSubWorkflow(t *testing.T) {
+	const configPath = "../test/settings/settings_subworkflow.yaml"
+	cleanTestStates(t, configPath)                       // Clean before
+	t.Cleanup(func() { cleanTestStates(t, configPath) }) // Clean after
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "validate", "recursive", "-o", "json")
+
+	assert.NoError(t, err, "The validate command should always exit successfully.")
+
+	var result TestValidationResult
+	err = json.Unmarshal([]byte(outputStr), &result)
+	assert.NoError(t, err, "Should be able to unmarshal the JSON output.")
+
+	assert.False(t, result.Valid, "The 'valid' field should be false.")
+	assert.Contains(t, result.Reason, "includes itself", "The reason should explain the recursion.")
+}
+
+// TestValidate_Requires tests that `validate` and `run all` check the binaries the
+// steps require, the latter before executing any step.
+func TestValidate_Requires(t *testing.T) {
+	const configPath = "../test/settings/settings_requires.yaml"
+	cleanTestStates(t, configPath)                       // Clean before
+	t.Cleanup(func() { cleanTestStates(t, configPath) }) // Clean after
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "validate", "all", "-o", "json")
+	assert.NoError(t, err, "The validate command should always exit successfully.")
+	var results []TestValidationResult
+	assert.NoError(t, json.Unmarshal([]byte(outputStr), &results), "Should be able to unmarshal the JSON output.")
+	resultsMap := make(map[string]TestValidationResult)
+	for _, r := range results {
+		resultsMap[r.StepName] = r
+	}
+	assert.True(t, resultsMap["available"].Valid, resultsMap["available"].Reason)
+	assert.False(t, resultsMap["missing"].Valid)
+	assert.Contains(t, resultsMap["missing"].Reason, "required binary 'wham-no-such-binary' not found in PATH")
+	assert.False(t, resultsMap["too_old"].Valid)
+	assert.Contains(t, resultsMap["too_old"].Reason, "999 or later is required")
+
+	// The preflight check halts the workflow before its first step.
+	outputStr, err = runWhamCommand(t, "--config", configPath, "run", "all")
+	assert.Error(t, err)
+	assert.Contains(t, outputStr, "requirements not met")
+	assert.NotContains(t, outputStr, "Running step 'available'", "No step should run when a requirement is not met.")
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "run", "all", "--only", "available")
+	assert.NoError(t, err, outputStr)
+	outputStr, err = runWhamCommand(t, "--config", configPath, "run", "missing")
+	assert.Error(t, err)
+	assert.Contains(t, outputStr, "wham-no-such-binary")
+}
+
+// TestValidate_NoTruncate tests that a reason too wide for the table is truncated by
+// default, and wrapped across lines within the table width with `--no-truncate`.
+func TestValidate_NoTruncate(t *testing.T) {
+	const configPath = "../test/settings/settings_no_truncate.yaml"
+	cleanTestStates(t, configPath)                       // Clean before
+	t.Cleanup(func() { cleanTestStates(t, configPath) }) // Clean after
+	const reason = "required binary 'wham-a-binary-with-a-very-long-name-that-does-not-exist-anywhere-and-whose-validation-reason-does-not-fit-in-the-table' not found in PATH"
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "validate", "long_reason")
+	assert.NoError(t, err, outputStr)
+	assert.Contains(t, outputStr, "...", "The reason should be truncated by default.")
+
+	outputStr, err = runWhamCommand(t, "--config", configPath, "validate", "long_reason", "--no-truncate")
+	assert.NoError(t, err, outputStr)
+	assert.NotContains(t, outputStr, "...")
+	lines := strings.Split(strings.TrimRight(outputStr, "\n"), "\n")
+	assert.Greater(t, len(lines), 2, "The reason should be wrapped across several lines.")
+	for _, line := range lines {
+		assert.LessOrEqual(t, len(strings.TrimRight(line, " ")), 120, "Line %q should fit in the table width.", line)
+	}
+	// Without the whitespace of the layout, the full reason is printed.
+	compact := strings.Join(strings.Fields(outputStr), "")
+	assert.Contains(t, compact, strings.Join(strings.Fields(reason), ""))
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+)
+
+// subWorkflowMetadataDir returns the metadata directory of the sub-workflow of a
+// `workflow` step: a namespace of its own in the parent's metadata directory, so
+// that the states of its steps never clash with the parent's.
+func (w *WHAM) subWorkflowMetadataDir(step *Step) string {
+	return filepath.Join(w.config.WhamSettings.MetadataDir, "workflows", step.Name)
+}
+
+// loadSubWorkflow loads the configuration referenced by a `workflow` step and
+// returns the WHAM engine running it, with its metadata directory redirected to
+// the step's namespace (see subWorkflowMetadataDir).
+func (w *WHAM) loadSubWorkflow(step *Step) (*WHAM, error) {
+	path := w.resolvePath(step.Workflow)
+	// A workflow including itself, directly or not, would never end.
+	chain := slices.Clone(w.workflowChain)
+	for _, configFile := range w.config.ConfigFiles {
+		if absPath, err := filepath.Abs(configFile); err == nil {
+			chain = append(chain, absPath)
+		}
+	}
+	if slices.Contains(chain, path) {
+		return nil, fmt.Errorf("sub-workflow '%s' includes itself", step.Workflow)
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sub-workflow '%s': %w", step.Workflow, err)
+	}
+	config.WhamSettings.MetadataDir = w.subWorkflowMetadataDir(step)
+	// Without a state backend of its own, the sub-workflow keeps its states in the
+	// parent's, in the step's namespace as well.
+	if parent := w.config.WhamSettings.StateBackend; config.WhamSettings.StateBackend == nil && parent != nil {
+		backend := *parent
+		backend.Prefix += "workflows/" + step.Name + "/"
+		backend.Workflow += "/workflows/" + step.Name
+		config.WhamSettings.StateBackend = &backend
+	}
+	sub, err := NewWHAM(config, w.logger.With().Str("workflow", step.Name).Logger())
+	if err != nil {
+		return nil, fmt.Errorf("invalid sub-workflow '%s': %w", step.Workflow, err)
+	}
+	sub.workflowChain = chain
+	return sub, nil
+}
+
+// validateSubWorkflow checks that the configuration referenced by a `workflow` step
+// loads, and that all of its steps are valid, as `step validate` would.
+func (w *WHAM) validateSubWorkflow(step *Step) error {
+	sub, err := w.loadSubWorkflow(step)
+	if err != nil {
+		return err
+	}
+	steps := make([]*Step, len(sub.config.WhamSteps))
+	for i := range sub.config.WhamSteps {
+		steps[i] = &sub.config.WhamSteps[i]
+	}
+	for _, result := range sub.validateSteps(steps) {
+		if !result.Valid {
+			return fmt.Errorf("sub-workflow '%s': step '%s': %s", step.Workflow, result.StepName, result.Reason)
+		}
+	}
+	return nil
+}
+
+// executeSubWorkflow runs the DAG of the configuration referenced by a `workflow`
+// step, as `run all` would, and aggregates the states of its steps into the
+// step's result:
+//   - its run_id is a hash of the run_ids of all the sub-workflow's steps, so that
+//     the steps depending on it run again whenever any of them changed;
+//   - its outputs count the sub-workflow's steps by action (`steps_run`,
+//     `steps_skipped` and `steps_failed`);
+//   - each sub-workflow step that failed with `can_fail: true` is a warning.
+//
+// The sub-workflow is aborted with the parent run, and when the step's `timeout`
+// elapses. It fails if any of its steps halts it.
+func (w *WHAM) executeSubWorkflow(step *Step, force bool) (stepResult, error) {
+	var result stepResult
+	sub, err := w.loadSubWorkflow(step)
+	if err != nil {
+		return result, err
+	}
+	if err := os.MkdirAll(sub.config.WhamSettings.MetadataDir, 0755); err != nil {
+		return result, fmt.Errorf("failed to create metadata directory of sub-workflow '%s': %w", step.Workflow, err)
+	}
+
+	ctx, cancel := context.WithCancel(w.runContext())
+	defer cancel()
+	if step.Timeout > 0 {
+		ctx, cancel = context.WithTimeoutCause(ctx, step.Timeout, errStepTimeout)
+		defer cancel()
+	}
+	sub.runCtx = ctx
+	sub.parentRunID = w.workflowRunID()
+	fmt.Printf("🪆 Step '%s' running sub-workflow '%s'...\n", step.Name, step.Workflow)
+	runErr := sub.runAllSteps(RunOptions{Force: force, ContinueOnError: w.continueOnError, Staging: w.staging})
+	sub.commitGeneratedSteps()
+	if runErr != nil && errors.Is(context.Cause(ctx), errStepTimeout) && w.runContext().Err() == nil {
+		runErr = fmt.Errorf("%w after %s", errStepTimeout, step.Timeout)
+	}
+
+	counts := map[string]int{}
+	hash := sha256.New()
+	for _, subStep := range sub.config.WhamSteps {
+		state := sub.getCurrentStepWhamState(subStep.Name)
+		counts[state.RunAction]++
+		fmt.Fprintf(hash, "%s=%s\n", subStep.Name, state.RunID)
+		if state.RunAction == "failed" && runErr == nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("sub-workflow step '%s' failed", subStep.Name))
+		}
+	}
+	result.RunID = hex.EncodeToString(hash.Sum(nil))[:16]
+	result.Outputs = map[string]string{
+		"steps_run":     strconv.Itoa(counts["run"]),
+		"steps_skipped": strconv.Itoa(counts["skipped"]),
+		"steps_failed":  strconv.Itoa(counts["failed"]),
+	}
+	if runErr != nil {
+		return result, fmt.Errorf("sub-workflow '%s' failed: %w", step.Workflow, runErr)
+	}
+	return result, nil
+}
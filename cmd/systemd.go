@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+)
+
+// Systemd-related concrete command structs
+
+// SystemdCmd handles the 'install-systemd' command.
+type SystemdCmd struct {
+	Schedule string        `help:"Cron expression of the schedule (e.g. '0 3 * * *'), overriding the schedule settings." placeholder:"CRON"`
+	Daemon   bool          `help:"Install a long-lived service running 'wham serve', supervised by the systemd watchdog, instead of a timer."`
+	Watchdog time.Duration `help:"Watchdog interval of the daemon service." default:"1m"`
+	Name     string        `help:"Name of the units." default:"wham"`
+	User     bool          `help:"Install user units (in ~/.config/systemd/user) instead of system units."`
+	Dir      string        `help:"Directory to write the units to, instead of the systemd one." type:"path"`
+	NoStart  bool          `help:"Only write the units, without reloading systemd and enabling them."`
+	Parallel int           `help:"Run up to N independent steps concurrently in each run." default:"1" placeholder:"N"`
+	Timeout  time.Duration `help:"Maximum duration of each run (e.g. 2h), overriding the workflow_timeout setting."`
+}
+
+// Systemd-related command implementations
+
+func (s *SystemdCmd) Run(ctx *Context) error {
+	if s.Name == "" {
+		return fmt.Errorf("--name cannot be empty")
+	}
+	if s.Parallel < 1 {
+		return fmt.Errorf("--parallel must be at least 1")
+	}
+	if s.Timeout < 0 {
+		return fmt.Errorf("--timeout cannot be negative")
+	}
+	if s.Watchdog < time.Second {
+		return fmt.Errorf("--watchdog must be at least 1s")
+	}
+	return ctx.WHAM.InstallSystemd(SystemdOptions{
+		Name:     s.Name,
+		Schedule: s.Schedule,
+		Daemon:   s.Daemon,
+		Watchdog: s.Watchdog,
+		User:     s.User,
+		Dir:      s.Dir,
+		NoStart:  s.NoStart,
+		Parallel: s.Parallel,
+		Timeout:  s.Timeout,
+	})
+}
@@ -0,0 +1,318 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SystemdOptions are the parameters of the units generated by InstallSystemd.
+type SystemdOptions struct {
+	// Name is the name of the units (e.g., "wham" for wham.service and wham.timer).
+	Name string
+	// Schedule is the cron expression of the runs, overriding the schedule settings.
+	Schedule string
+	// Daemon, if true, installs a service running `wham serve` instead of a timer.
+	Daemon bool
+	// Watchdog is the watchdog interval of the daemon service.
+	Watchdog time.Duration
+	// User, if true, installs user units instead of system units.
+	User bool
+	// Dir, if set, is the directory the units are written to.
+	Dir string
+	// NoStart, if true, only writes the units, without enabling them.
+	NoStart bool
+	// Parallel and Timeout are passed to every run.
+	Parallel int
+	Timeout  time.Duration
+}
+
+// unitDir returns the directory the units are installed to.
+func (o *SystemdOptions) unitDir() (string, error) {
+	if o.Dir != "" {
+		return o.Dir, nil
+	}
+	if !o.User {
+		return "/etc/systemd/system", nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate the user configuration directory: %w", err)
+	}
+	return filepath.Join(configDir, "systemd", "user"), nil
+}
+
+// InstallSystemd generates the systemd units running the workflow on its schedule,
+// with the current WHAM binary and configuration files, writes them to the systemd
+// unit directory, then reloads systemd and enables them, unless `opts.NoStart`.
+//
+// By default, a oneshot service runs `run all`, triggered by a timer whose
+// calendar events are translated from the cron schedule. With `opts.Daemon`, a
+// single service of type "notify" runs `wham serve`, which reports its readiness
+// and pings the systemd watchdog (see notifySystemd).
+func (w *WHAM) InstallSystemd(opts SystemdOptions) error {
+	schedule, err := w.resolveSchedule(opts.Schedule)
+	if err != nil {
+		return err
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the WHAM executable: %w", err)
+	}
+	args := []string{executable}
+	for _, path := range w.config.ConfigFiles {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("failed to resolve config path '%s': %w", path, err)
+		}
+		args = append(args, "--config", absPath)
+	}
+	if opts.Daemon {
+		args = append(args, "serve")
+		if opts.Schedule != "" {
+			args = append(args, "--schedule", opts.Schedule)
+		}
+	} else {
+		args = append(args, "run", "all")
+	}
+	if opts.Parallel > 1 {
+		args = append(args, "--parallel", strconv.Itoa(opts.Parallel))
+	}
+	if opts.Timeout > 0 {
+		args = append(args, "--timeout", opts.Timeout.String())
+	}
+
+	units := map[string]string{opts.Name + ".service": w.systemdService(opts, args)}
+	enabledUnit := opts.Name + ".service"
+	if !opts.Daemon {
+		units[opts.Name+".timer"] = systemdTimer(opts, schedule)
+		enabledUnit = opts.Name + ".timer"
+	}
+
+	dir, err := opts.unitDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create unit directory '%s': %w", dir, err)
+	}
+	for _, name := range []string{opts.Name + ".service", opts.Name + ".timer"} {
+		content, ok := units[name]
+		if !ok {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write unit '%s': %w", path, err)
+		}
+		fmt.Printf("📝 Wrote %s\n", path)
+	}
+	if opts.NoStart {
+		_, err := fmt.Printf("✅ Units written. Enable them with: systemctl %senable --now %s\n", userFlag(opts.User), enabledUnit)
+		return err
+	}
+
+	for _, systemctlArgs := range [][]string{{"daemon-reload"}, {"enable", "--now", enabledUnit}} {
+		if opts.User {
+			systemctlArgs = append([]string{"--user"}, systemctlArgs...)
+		}
+		cmd := exec.Command("systemctl", systemctlArgs...)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("'%s' failed: %w", cmd.String(), err)
+		}
+	}
+	_, err = fmt.Printf("✅ %s enabled and started.\n", enabledUnit)
+	return err
+}
+
+// userFlag returns the "--user " flag of systemctl for user units, or "".
+func userFlag(user bool) string {
+	if user {
+		return "--user "
+	}
+	return ""
+}
+
+// systemdService returns the content of the service unit running `args`.
+func (w *WHAM) systemdService(opts SystemdOptions, args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = systemdQuote(arg)
+	}
+	var b strings.Builder
+	b.WriteString("# Generated by `wham install-systemd`.\n[Unit]\n")
+	fmt.Fprintf(&b, "Description=WHAM workflow (%s)\n", systemdEscape(strings.Join(w.config.ConfigFiles, ", ")))
+	b.WriteString("Wants=network-online.target\nAfter=network-online.target\n\n[Service]\n")
+	if opts.Daemon {
+		b.WriteString("Type=notify\nNotifyAccess=main\n")
+		fmt.Fprintf(&b, "WatchdogSec=%d\n", max(int(opts.Watchdog.Seconds()), 1))
+		b.WriteString("Restart=on-failure\nRestartSec=10\n")
+	} else {
+		b.WriteString("Type=oneshot\n")
+	}
+	fmt.Fprintf(&b, "WorkingDirectory=%s\n", systemdEscape(w.config.ConfigDir))
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(quoted, " "))
+	// WHAM forwards SIGTERM to the running scripts, and records them as interrupted.
+	b.WriteString("KillMode=mixed\n")
+	if opts.Daemon {
+		b.WriteString("\n[Install]\n")
+		if opts.User {
+			b.WriteString("WantedBy=default.target\n")
+		} else {
+			b.WriteString("WantedBy=multi-user.target\n")
+		}
+	}
+	return b.String()
+}
+
+// systemdTimer returns the content of the timer unit triggering the service on the schedule.
+func systemdTimer(opts SystemdOptions, schedule *cronSchedule) string {
+	var b strings.Builder
+	b.WriteString("# Generated by `wham install-systemd`.\n[Unit]\n")
+	fmt.Fprintf(&b, "Description=Schedule of the WHAM workflow %s.service\n\n[Timer]\n", opts.Name)
+	if schedule.every > 0 {
+		seconds := int(schedule.every.Seconds())
+		fmt.Fprintf(&b, "OnActiveSec=%ds\nOnUnitActiveSec=%ds\n", seconds, seconds)
+	} else {
+		for _, calendar := range schedule.onCalendar() {
+			fmt.Fprintf(&b, "OnCalendar=%s\n", calendar)
+		}
+	}
+	// A run missed while the machine was off is caught up once it boots.
+	b.WriteString("Persistent=true\n\n[Install]\nWantedBy=timers.target\n")
+	return b.String()
+}
+
+// onCalendar translates the cron schedule into systemd calendar events (see
+// systemd.time(7)), e.g. "Mon,Fri *-*-* 03:00:00 Europe/Paris". As cron matches a
+// day matching either the day-of-month or the day-of-week field when both are
+// restricted, while systemd requires both, such schedules become two events.
+func (s *cronSchedule) onCalendar() []string {
+	days := []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+	month := formatCalendarField(s.month, 1, 12, "%d")
+	dom := formatCalendarField(s.dom, 1, 31, "%d")
+	dow := "*"
+	if s.dow&0x7f != 0x7f {
+		var names []string
+		for d := range 7 {
+			if s.dow&(1<<d) != 0 {
+				names = append(names, days[d])
+			}
+		}
+		dow = strings.Join(names, ",")
+	}
+	timeOfDay := fmt.Sprintf("%s:%s:00", formatCalendarField(s.hour, 0, 23, "%02d"), formatCalendarField(s.minute, 0, 59, "%02d"))
+	zone := ""
+	if s.location != nil && s.location != time.Local {
+		zone = " " + s.location.String()
+	}
+
+	event := func(dow, dom string) string {
+		prefix := ""
+		if dow != "*" {
+			prefix = dow + " "
+		}
+		return fmt.Sprintf("%s*-%s-%s %s%s", prefix, month, dom, timeOfDay, zone)
+	}
+	if !s.domAny && !s.dowAny {
+		return []string{event("*", dom), event(dow, "*")}
+	}
+	return []string{event(dow, dom)}
+}
+
+// formatCalendarField formats the values of a bitset as a systemd calendar field:
+// "*" if all the values from min to max are set, or else their comma-separated list.
+func formatCalendarField(bits uint64, min, max int, format string) string {
+	var values []string
+	for v := min; v <= max; v++ {
+		if bits&(1<<v) != 0 {
+			values = append(values, fmt.Sprintf(format, v))
+		}
+	}
+	if len(values) == max-min+1 {
+		return "*"
+	}
+	return strings.Join(values, ",")
+}
+
+// systemdEscape escapes the specifiers (`%`) of a unit file value.
+func systemdEscape(value string) string {
+	return strings.ReplaceAll(value, "%", "%%")
+}
+
+// systemdQuote quotes an argument of an ExecStart command line, escaping its
+// specifiers (`%`) and variable expansions (`$`).
+func systemdQuote(arg string) string {
+	arg = strings.ReplaceAll(systemdEscape(arg), "$", "$$")
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\;") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+// notifySystemd sends a state notification (e.g., "READY=1") to the systemd
+// service manager, if WHAM runs as a service of type "notify", i.e. if the
+// NOTIFY_SOCKET environment variable is set. It does nothing otherwise.
+func notifySystemd(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:] // An abstract socket.
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("failed to connect to the systemd notification socket: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("failed to notify systemd: %w", err)
+	}
+	return nil
+}
+
+// systemdWatchdogInterval returns the interval of the systemd watchdog of the
+// service, as set by systemd in WATCHDOG_USEC, or 0 if it is not enabled for
+// this process.
+func systemdWatchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// startSystemdWatchdog pings the systemd watchdog at half its interval, if it is
+// enabled, until the returned function is called.
+func (w *WHAM) startSystemdWatchdog() func() {
+	interval := systemdWatchdogInterval()
+	if interval == 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := notifySystemd("WATCHDOG=1"); err != nil {
+					w.logger.Warn().Err(err).Msg("Could not ping the systemd watchdog.")
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,92 @@
+package cmd_test
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestInstallSystemd_Units verifies the units written by `install-systemd`, for a
+// timer translated from the cron schedule and for a daemon service.
+func TestInstallSystemd_Units(t *testing.T) {
+	const configPath = "../test/settings/settings_priority.yaml"
+	absConfigPath, err := filepath.Abs(configPath)
+	assert.NoError(t, err)
+
+	t.Run("timer", func(t *testing.T) {
+		dir := t.TempDir()
+		outputStr, err := runWhamCommand(t, "--config", configPath, "install-systemd", "--schedule", "*/15 6-8 * * mon-fri", "--dir", dir, "--no-start")
+		assert.NoError(t, err)
+		assert.Contains(t, outputStr, "systemctl enable --now wham.timer")
+
+		service, err := os.ReadFile(filepath.Join(dir, "wham.service"))
+		assert.NoError(t, err)
+		assert.Contains(t, string(service), "Type=oneshot")
+		assert.Contains(t, string(service), "--config "+absConfigPath+" run all\n")
+		timer, err := os.ReadFile(filepath.Join(dir, "wham.timer"))
+		assert.NoError(t, err)
+		assert.Contains(t, string(timer), "OnCalendar=Mon,Tue,Wed,Thu,Fri *-*-* 06,07,08:00,15,30,45:00\n")
+	})
+
+	t.Run("day of month or week", func(t *testing.T) {
+		dir := t.TempDir()
+		_, err := runWhamCommand(t, "--config", configPath, "install-systemd", "--schedule", "0 3 1 * sun", "--dir", dir, "--no-start")
+		assert.NoError(t, err)
+		timer, err := os.ReadFile(filepath.Join(dir, "wham.timer"))
+		assert.NoError(t, err)
+		assert.Contains(t, string(timer), "OnCalendar=*-*-1 03:00:00\nOnCalendar=Sun *-*-* 03:00:00\n", "Cron matches either day field.")
+	})
+
+	t.Run("daemon", func(t *testing.T) {
+		dir := t.TempDir()
+		_, err := runWhamCommand(t, "--config", configPath, "install-systemd", "--daemon", "--schedule", "@hourly", "--watchdog", "30s", "--name", "nightly", "--dir", dir, "--no-start")
+		assert.NoError(t, err)
+		service, err := os.ReadFile(filepath.Join(dir, "nightly.service"))
+		assert.NoError(t, err)
+		assert.Contains(t, string(service), "Type=notify")
+		assert.Contains(t, string(service), "WatchdogSec=30")
+		assert.Contains(t, string(service), "serve --schedule @hourly")
+		assert.NoFileExists(t, filepath.Join(dir, "nightly.timer"), "A daemon needs no timer.")
+	})
+}
+
+// TestServe_NotifiesSystemd verifies that `serve` reports its readiness and
+// shutdown to systemd over the socket given in NOTIFY_SOCKET.
+func TestServe_NotifiesSystemd(t *testing.T) {
+	const configPath = "../test/settings/settings_priority.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	socketPath := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	serve := exec.Command(whamBinaryPath, "--config", configPath, "serve", "--schedule", "@every 1s", "--max-runs", "1")
+	serve.Env = append(os.Environ(), "NO_COLOR=true", "NOTIFY_SOCKET="+socketPath)
+	assert.NoError(t, serve.Run())
+
+	var messages []string
+	buf := make([]byte, 4096)
+	for {
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, err := conn.Read(buf)
+		if err != nil {
+			break
+		}
+		messages = append(messages, string(buf[:n]))
+	}
+	if assert.NotEmpty(t, messages) {
+		assert.Equal(t, "READY=1", messages[0])
+		assert.Equal(t, "STOPPING=1", messages[len(messages)-1])
+		assert.Contains(t, strings.Join(messages, "\n"), "STATUS=Running the workflow")
+	}
+}
@@ -1,8 +1,18 @@
 package cmd
 
 import (
+	"bufio"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"os"
 	"runtime"
+	"strconv"
+	"strings"
+
+	"aead.dev/minisign"
 )
 
 // These variables are populated by the Go linker (`ldflags`) at build time.
@@ -10,16 +20,137 @@ var (
 	Version   = "dev" // Default value for development builds
 	Commit    = "none"
 	BuildDate = "unknown"
+	// ReleasePublicKey is the minisign public key signing the checksums files of
+	// the releases, as printed by `minisign -G` (without its comment line). It is
+	// empty in development builds, which cannot be verified.
+	ReleasePublicKey = ""
 )
 
 // VersionCmd holds the command for displaying version information.
-type VersionCmd struct{}
+type VersionCmd struct {
+	Verify    bool   `help:"Verify the checksum of the running binary against a checksums file of a release."`
+	Checksums string `help:"Checksums file used by --verify, in the format of sha256sum." default:"SHA256SUMS" type:"path"`
+	Signature string `help:"Minisign signature of the checksums file used by --verify. Defaults to the checksums file with the '.minisig' suffix." type:"path"`
+}
 
 // Run executes the version command, printing build-time information.
 func (v *VersionCmd) Run() error {
 	fmt.Printf("WHAM! Version: %s\n", Version)
 	fmt.Printf("Commit: %s\n", Commit)
 	fmt.Printf("Build Date: %s\n", BuildDate)
+	fmt.Printf("Platform: %s/%s\n", runtime.GOOS, runtime.GOARCH)
 	fmt.Printf("Go Version: %s\n", runtime.Version())
-	return nil
+	if !v.Verify {
+		return nil
+	}
+	return verifyExecutable(v.Checksums, cmp.Or(v.Signature, v.Checksums+".minisig"))
+}
+
+// releaseArtifactName returns the name of the release binary built for the
+// platform WHAM is running on (see the `release` target of the Makefile).
+func releaseArtifactName() string {
+	return fmt.Sprintf("wham-%s-%s", runtime.GOOS, runtime.GOARCH)
+}
+
+// verifyExecutable checks the provenance of the running binary: the checksums file
+// must be signed by the release key embedded at build time (see ReleasePublicKey),
+// and the SHA-256 checksum of the binary must match the one it lists for the
+// release artifact of the current platform. A file listing a single,
+// unnamed-platform `wham` binary, as published by older releases, is accepted as
+// well.
+//
+// Returns an error if the build has no release key, if the signature is missing
+// or invalid, if the binary cannot be read, if the checksums file has no entry for
+// the platform, or if the checksums differ.
+func verifyExecutable(checksumsPath, signaturePath string) error {
+	keyID, err := verifyChecksumsSignature(checksumsPath, signaturePath)
+	if err != nil {
+		return err
+	}
+	exePath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the running binary: %w", err)
+	}
+	actual, err := fileSHA256(exePath)
+	if err != nil {
+		return err
+	}
+	expected, err := lookupChecksum(checksumsPath, releaseArtifactName(), "wham")
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return fmt.Errorf("checksum mismatch for '%s': expected %s, got %s", exePath, expected, actual)
+	}
+	_, err = fmt.Printf("✅ Verified: checksum %s matches '%s', signed by the release key %s.\n", actual, checksumsPath, keyID)
+	return err
+}
+
+// verifyChecksumsSignature checks the minisign signature of a checksums file
+// against ReleasePublicKey, and returns the ID of the key.
+func verifyChecksumsSignature(checksumsPath, signaturePath string) (string, error) {
+	if ReleasePublicKey == "" {
+		return "", fmt.Errorf("this build of WHAM has no release public key, so its provenance cannot be verified: only the binaries built by `make release` with RELEASE_PUBLIC_KEY can be")
+	}
+	var publicKey minisign.PublicKey
+	if err := publicKey.UnmarshalText([]byte(ReleasePublicKey)); err != nil {
+		return "", fmt.Errorf("invalid release public key: %w", err)
+	}
+	keyID := strings.ToUpper(strconv.FormatUint(publicKey.ID(), 16))
+	checksums, err := os.ReadFile(checksumsPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open checksums file '%s': %w", checksumsPath, err)
+	}
+	signature, err := os.ReadFile(signaturePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open signature file '%s': %w", signaturePath, err)
+	}
+	if !minisign.Verify(publicKey, checksums, signature) {
+		return "", fmt.Errorf("invalid signature: '%s' is not signed by the release key %s with '%s'", checksumsPath, keyID, signaturePath)
+	}
+	return keyID, nil
+}
+
+// fileSHA256 returns the hex-encoded SHA-256 checksum of a file.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open '%s': %w", path, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to read '%s': %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// lookupChecksum returns the checksum listed for the first of the given file names
+// found in a checksums file in the format of sha256sum ("<checksum>  <name>").
+func lookupChecksum(checksumsPath string, names ...string) (string, error) {
+	f, err := os.Open(checksumsPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open checksums file '%s': %w", checksumsPath, err)
+	}
+	defer f.Close()
+
+	checksums := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		// sha256sum marks files read in binary mode with a leading '*'.
+		checksums[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read checksums file '%s': %w", checksumsPath, err)
+	}
+	for _, name := range names {
+		if checksum, ok := checksums[name]; ok {
+			return checksum, nil
+		}
+	}
+	return "", fmt.Errorf("checksums file '%s' has no entry for '%s'", checksumsPath, names[0])
 }
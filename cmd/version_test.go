@@ -0,0 +1,139 @@
+package cmd_test
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"aead.dev/minisign"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestVersion_Verify verifies that `version --verify` accepts a checksums file
+// matching the running binary and signed by its release key, and rejects one that
+// does not match, is not signed by that key, or a binary without a release key.
+func TestVersion_Verify(t *testing.T) {
+	publicKey, privateKey, err := minisign.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate a minisign key: %v", err)
+	}
+	_, otherKey, err := minisign.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate a minisign key: %v", err)
+	}
+	dir := t.TempDir()
+	release := filepath.Join(dir, "wham-release")
+	build := exec.Command("go", "build", "-ldflags", "-X matiq.ai/wham/cmd.ReleasePublicKey="+publicKey.String(), "-o", release, "..")
+	if output, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to build a release of WHAM: %v\n%s", err, output)
+	}
+	data, err := os.ReadFile(release)
+	if err != nil {
+		t.Fatalf("Failed to read the release binary: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	artifact := fmt.Sprintf("wham-%s-%s", runtime.GOOS, runtime.GOARCH)
+	writeChecksums := func(name, content string, key minisign.PrivateKey) string {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		assert.NoError(t, os.WriteFile(path+".minisig", minisign.Sign(key, []byte(content)), 0644))
+		return path
+	}
+	verify := func(binary string, args ...string) (string, error) {
+		cmd := exec.Command(binary, append([]string{"version", "--verify"}, args...)...)
+		cmd.Env = append(os.Environ(), "NO_COLOR=true")
+		output, err := cmd.CombinedOutput()
+		return string(output), err
+	}
+
+	good := fmt.Sprintf("%s  wham-other-arch\n%s  %s\n", hex.EncodeToString(make([]byte, 32)), hex.EncodeToString(sum[:]), artifact)
+	goodPath := writeChecksums("SHA256SUMS", good, privateKey)
+	outputStr, err := verify(release, "--checksums", goodPath)
+	assert.NoError(t, err, "A matching, signed checksum should verify: %s", outputStr)
+	assert.Contains(t, outputStr, fmt.Sprintf("Platform: %s/%s", runtime.GOOS, runtime.GOARCH))
+	assert.Contains(t, outputStr, "Verified")
+
+	bad := fmt.Sprintf("%s  %s\n", hex.EncodeToString(make([]byte, 32)), artifact)
+	badPath := writeChecksums("BAD_SHA256SUMS", bad, privateKey)
+	outputStr, err = verify(release, "--checksums", badPath)
+	assert.Error(t, err, "A different checksum should fail the verification.")
+	assert.Contains(t, outputStr, "checksum mismatch")
+
+	forgedPath := writeChecksums("FORGED_SHA256SUMS", good, otherKey)
+	outputStr, err = verify(release, "--checksums", forgedPath)
+	assert.Error(t, err, "A checksums file signed by another key should fail the verification.")
+	assert.Contains(t, outputStr, "invalid signature")
+
+	outputStr, err = verify(release, "--checksums", goodPath, "--signature", badPath+".minisig")
+	assert.Error(t, err, "The signature of another checksums file should fail the verification.")
+	assert.Contains(t, outputStr, "invalid signature")
+
+	unsignedPath := filepath.Join(dir, "UNSIGNED_SHA256SUMS")
+	assert.NoError(t, os.WriteFile(unsignedPath, []byte(good), 0644))
+	outputStr, err = verify(release, "--checksums", unsignedPath)
+	assert.Error(t, err, "An unsigned checksums file should fail the verification.")
+	assert.Contains(t, outputStr, "failed to open signature file")
+
+	outputStr, err = runWhamCommand(t, "version", "--verify", "--checksums", goodPath)
+	assert.Error(t, err, "A build without a release key should not verify.")
+	assert.Contains(t, outputStr, "no release public key")
+}
+
+// TestVersion_MinVersion verifies that an older release of WHAM refuses a
+// configuration requiring a newer one, and to run a step whose state a newer
+// release wrote, while a development build accepts both.
+func TestVersion_MinVersion(t *testing.T) {
+	dir := t.TempDir()
+	buildRelease := func(version string) string {
+		path := filepath.Join(dir, "wham-"+version)
+		build := exec.Command("go", "build", "-ldflags", "-X matiq.ai/wham/cmd.Version="+version, "-o", path, "..")
+		output, err := build.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Failed to build WHAM %s: %v\n%s", version, err, output)
+		}
+		return path
+	}
+	oldRelease, newRelease := buildRelease("v1.2.0"), buildRelease("v1.3.0-2-gabc1234")
+	truePath, err := exec.LookPath("true")
+	if err != nil {
+		t.Skip("'true' not found in PATH")
+	}
+	configPath := filepath.Join(dir, "wham.yaml")
+	writeConfig := func(minVersion string) {
+		content := "wham_settings:\n  data_dir: data\n  metadata_dir: metadata\n  min_version: \"" + minVersion + "\"\nwham_steps:\n- name: step\n  command: [\"" + truePath + "\"]\n  previous_steps: []\n"
+		assert.NoError(t, os.WriteFile(configPath, []byte(content), 0644))
+	}
+	run := func(binary string) (string, error) {
+		cmd := exec.Command(binary, "--config", configPath, "run", "step")
+		cmd.Env = append(os.Environ(), "NO_COLOR=true")
+		output, err := cmd.CombinedOutput()
+		return string(output), err
+	}
+
+	writeConfig("1.3")
+	outputStr, err := run(oldRelease)
+	assert.Error(t, err, "An older release should refuse the configuration.")
+	assert.Contains(t, outputStr, "requires WHAM 1.3 or later")
+	outputStr, err = run(newRelease)
+	assert.NoError(t, err, outputStr)
+	outputStr, err = run(whamBinaryPath)
+	assert.NoError(t, err, "A development build should accept any min_version: %s", outputStr)
+
+	writeConfig("")
+	outputStr, err = run(newRelease)
+	assert.NoError(t, err, outputStr)
+	outputStr, err = run(oldRelease)
+	assert.Error(t, err, "An older release should refuse to overwrite the state of a newer one.")
+	assert.Contains(t, outputStr, "written by a newer WHAM")
+
+	writeConfig("latest")
+	outputStr, err = run(whamBinaryPath)
+	assert.Error(t, err, "An invalid min_version should be reported.")
+	assert.Contains(t, outputStr, "invalid min_version")
+}
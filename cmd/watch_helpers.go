@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long the watched files must be left unchanged before the
+// workflow is re-run, so that a burst of writes (e.g., an editor saving a file, or
+// a batch of files being copied) triggers a single run.
+const watchDebounce = 500 * time.Millisecond
+
+// newPatternWatcher returns a watcher of the directories that can contain files
+// matching the glob patterns, i.e. the existing directories matching their
+// directory part (e.g., "data/*" for "data/*/input.csv").
+func newPatternWatcher(patterns []string) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	for _, pattern := range patterns {
+		dirs, err := filepath.Glob(filepath.Dir(pattern))
+		if err != nil {
+			watcher.Close()
+			return nil, fmt.Errorf("invalid watch pattern '%s': %w", pattern, err)
+		}
+		watched := 0
+		for _, dir := range dirs {
+			if stat, err := os.Stat(dir); err != nil || !stat.IsDir() {
+				continue
+			}
+			if err := watcher.Add(dir); err != nil {
+				watcher.Close()
+				return nil, fmt.Errorf("failed to watch directory '%s': %w", dir, err)
+			}
+			watched++
+		}
+		if watched == 0 {
+			watcher.Close()
+			return nil, fmt.Errorf("invalid watch pattern '%s': no directory matches '%s'", pattern, filepath.Dir(pattern))
+		}
+	}
+	return watcher, nil
+}
+
+// matchesAnyPattern reports whether a path matches one of the glob patterns.
+func matchesAnyPattern(patterns []string, path string) bool {
+	path = filepath.Clean(path)
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(filepath.Clean(pattern), path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch runs the workflow with the given options, then runs it again every time a
+// file matching one of the glob patterns is created, written, removed or renamed,
+// until WHAM receives SIGINT or SIGTERM. Only the steps affected by the change are
+// executed again, as in any `run all`: the others are skipped if their
+// predecessors did not change.
+//
+// Changes are debounced (see watchDebounce), and changes made during a run trigger
+// another run once it is finished. A failed run is reported and does not stop the
+// watch. After every run, the execution summary is printed in `outputFormat`.
+//
+// SIGINT and SIGTERM stop the watch, as described on startRunContext.
+func (w *WHAM) Watch(patterns []string, opts RunOptions, outputFormat string) error {
+	watcher, err := newPatternWatcher(patterns)
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	w.logger.Info().Strs("patterns", patterns).Msg("Watch started.")
+	for {
+		err := w.RunAllSteps(opts)
+		if err != nil {
+			fmt.Printf("❌ Workflow run failed: %v\n", err)
+			w.logger.Error().Err(err).Msg("Watched workflow run failed.")
+		} else {
+			fmt.Println("\n✅ Workflow execution finished.")
+		}
+		if summaryErr := w.ShowExecutionSummary(outputFormat); summaryErr != nil {
+			return summaryErr
+		}
+		if errors.Is(err, errInterrupted) {
+			return err
+		}
+
+		fmt.Printf("👀 Watching %d pattern(s) for changes...\n", len(patterns))
+		changed, err := w.waitForChange(watcher, patterns, signals)
+		if err != nil || changed == "" {
+			return err
+		}
+		fmt.Printf("🔄 File '%s' changed, re-running the workflow.\n", changed)
+	}
+}
+
+// waitForChange waits for a change of a file matching the patterns, then for the
+// changes to settle, and returns the path of the first file changed. It returns ""
+// if a signal was received meanwhile.
+func (w *WHAM) waitForChange(watcher *fsnotify.Watcher, patterns []string, signals <-chan os.Signal) (string, error) {
+	var changed string
+	var settled <-chan time.Time
+	for {
+		select {
+		case sig := <-signals:
+			fmt.Printf("🛑 Received %s, stopping the watch.\n", sig)
+			w.logger.Info().Str("signal", sig.String()).Msg("Watch stopped by signal.")
+			return "", nil
+		case err := <-watcher.Errors:
+			return "", fmt.Errorf("file watcher failed: %w", err)
+		case event := <-watcher.Events:
+			if event.Op == fsnotify.Chmod || !matchesAnyPattern(patterns, event.Name) {
+				continue
+			}
+			w.logger.Debug().Str("file", event.Name).Str("op", event.Op.String()).Msg("Watched file changed.")
+			if changed == "" {
+				changed = event.Name
+			}
+			settled = time.After(watchDebounce)
+		case <-settled:
+			return changed, nil
+		}
+	}
+}
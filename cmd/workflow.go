@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Workflow-related concrete command structs (verbs)
+
+type RerunWorkflowCmd struct {
+	RunID  string `arg:"" help:"ID of the workflow run to re-execute." name:"workflow-run-id"`
+	Strict bool   `help:"Fail instead of warning if the configuration has changed since the original run."`
+}
+
+// Workflow-related command implementations
+
+func (r *RerunWorkflowCmd) Run(ctx *Context) error {
+	if err := ctx.WHAM.RerunWorkflow(r.RunID, r.Strict); err != nil {
+		return reportAbortedRun(ctx, err)
+	}
+	if _, err := fmt.Println("\n✅ Workflow execution finished."); err != nil {
+		return err
+	}
+	return ctx.WHAM.ShowExecutionSummary(ctx.OutputFormat)
+}
+
+// reportAbortedRun prints the partial execution summary of a workflow run aborted
+// by its timeout or by a signal, so that the steps that were interrupted or
+// cancelled are visible. It returns the run's error unchanged, and prints nothing
+// for other errors.
+func reportAbortedRun(ctx *Context, err error) error {
+	if !errors.Is(err, errWorkflowTimeout) && !errors.Is(err, errInterrupted) {
+		return err
+	}
+	if _, printErr := fmt.Printf("\n🛑 Workflow aborted: %v.\n", err); printErr != nil {
+		return printErr
+	}
+	if summaryErr := ctx.WHAM.ShowExecutionSummary(ctx.OutputFormat); summaryErr != nil {
+		return summaryErr
+	}
+	return err
+}
@@ -0,0 +1,344 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RunOptions holds the parameters of a `run all` invocation. They are persisted
+// with every workflow run record so that a historical run can be reproduced.
+type RunOptions struct {
+	// Force causes all steps to be executed unconditionally.
+	Force bool `json:"force" yaml:"force"`
+	// From is the step at which execution starts (inclusive).
+	From string `json:"from,omitempty" yaml:"from,omitempty"`
+	// To is the step at which execution ends (inclusive).
+	To string `json:"to,omitempty" yaml:"to,omitempty"`
+	// Parallel is the maximum number of steps executed concurrently. Values
+	// below 2 execute the steps one at a time.
+	Parallel int `json:"parallel,omitempty" yaml:"parallel,omitempty"`
+	// Only, if set, are the only steps executed, regardless of --from/--to.
+	Only []string `json:"only,omitempty" yaml:"only,omitempty"`
+	// Skip are the steps excluded from the execution.
+	Skip []string `json:"skip,omitempty" yaml:"skip,omitempty"`
+	// SkipDescendants also excludes the descendants of the skipped steps that depend
+	// only on excluded steps.
+	SkipDescendants bool `json:"skip_descendants,omitempty" yaml:"skip_descendants,omitempty"`
+	// Timeout is the maximum duration of the run. It overrides the `workflow_timeout`
+	// setting when set.
+	Timeout time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// ContinueOnError treats the failure of any step as if it was marked with
+	// `can_fail: true`, so the workflow is not halted.
+	ContinueOnError bool `json:"continue_on_error,omitempty" yaml:"continue_on_error,omitempty"`
+	// Staging runs every step with the dry-run marker (see dryRunMarked).
+	Staging bool `json:"staging,omitempty" yaml:"staging,omitempty"`
+	// RerunOf is the ID of the historical workflow run being reproduced, if any.
+	// It is stored on the run record itself rather than as a parameter.
+	RerunOf string `json:"-" yaml:"-"`
+}
+
+// WorkflowRun is the persisted record of a single `run all` invocation.
+type WorkflowRun struct {
+	// ID is the unique, time-sortable identifier of the workflow run.
+	ID string `json:"id" yaml:"id"`
+	// Status is the outcome of the run ("running", "succeeded" or "failed").
+	Status string `json:"status" yaml:"status"`
+	// StartedAt is the timestamp of when the run started.
+	StartedAt time.Time `json:"started_at" yaml:"started_at"`
+	// FinishedAt is the timestamp of when the run finished. Zero while running.
+	FinishedAt time.Time `json:"finished_at" yaml:"finished_at"`
+	// Elapsed is the total duration of the run.
+	Elapsed time.Duration `json:"elapsed" yaml:"elapsed"`
+	// Options are the parameters the run was started with.
+	Options RunOptions `json:"options" yaml:"options"`
+	// ConfigFiles are the configuration files the run was started with.
+	ConfigFiles []string `json:"config_files" yaml:"config_files"`
+	// ConfigDigest is a hash of the final, merged configuration used by the run.
+	ConfigDigest string `json:"config_digest" yaml:"config_digest"`
+	// RerunOf is the ID of the workflow run this run reproduces, if any.
+	RerunOf string `json:"rerun_of,omitempty" yaml:"rerun_of,omitempty"`
+	// Error is the error that halted the run, if any.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+	// Plan is the execution plan the engine resolved for the run. It is missing if
+	// the run failed before the steps to execute were determined.
+	Plan []PlannedRunStep `json:"plan,omitempty" yaml:"plan,omitempty"`
+}
+
+// PlannedRunStep is a step of the execution plan recorded with a workflow run.
+type PlannedRunStep struct {
+	// Name is the name of the step.
+	Name string `json:"name" yaml:"name"`
+	// PreviousSteps are the step's dependencies at the time of the run.
+	PreviousSteps []string `json:"previous_steps,omitempty" yaml:"previous_steps,omitempty"`
+	// Selected is true if the step was selected for execution, i.e. it was not
+	// left out by --from/--to or --only, or excluded by --skip.
+	Selected bool `json:"selected" yaml:"selected"`
+	// Reason is why the run did not execute the step, if it did not (see the
+	// Reason* constants), e.g. "not_in_only" or "cancelled". It is also recorded for
+	// a failed step, whose state keeps its failure (see recordNotExecuted).
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// newWorkflowRunID generates a unique workflow run ID. The ID starts with a UTC
+// timestamp so that run records sort chronologically by name.
+func newWorkflowRunID() string {
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		// Extremely unlikely; fall back to the nanoseconds of the current time.
+		return time.Now().UTC().Format("20060102T150405.000000000Z")
+	}
+	return time.Now().UTC().Format("20060102T150405.000Z") + "-" + hex.EncodeToString(suffix)
+}
+
+// configDigest computes a stable hash of the final, merged configuration.
+// It is used to detect configuration drift between workflow runs.
+func (w *WHAM) configDigest() (string, error) {
+	data, err := json.Marshal(w.config)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal configuration for digest: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// getWorkflowRunsDir returns the directory where workflow run records are stored.
+func (w *WHAM) getWorkflowRunsDir() string {
+	return filepath.Join(w.config.WhamSettings.MetadataDir, w.config.WhamSettings.MetadataPrefix+"runs")
+}
+
+// startWorkflowRun creates and persists the record of a new workflow run.
+// Failing to persist the record is logged but never halts the workflow.
+func (w *WHAM) startWorkflowRun(opts RunOptions) *WorkflowRun {
+	digest, err := w.configDigest()
+	if err != nil {
+		w.logger.Warn().Err(err).Msg("Could not compute configuration digest for workflow run.")
+	}
+	run := &WorkflowRun{
+		ID:           newWorkflowRunID(),
+		Status:       "running",
+		StartedAt:    time.Now(),
+		Options:      opts,
+		ConfigFiles:  w.config.ConfigFiles,
+		ConfigDigest: digest,
+		RerunOf:      opts.RerunOf,
+	}
+	if err := w.saveWorkflowRun(run); err != nil {
+		w.logger.Warn().Str("workflow_run_id", run.ID).Err(err).Msg("Could not save workflow run record.")
+	}
+	return run
+}
+
+// recordRunPlan records the execution plan of the workflow run in progress: every
+// step of the DAG in the topological order used by the run, and whether it was
+// selected for execution. Failing to persist it is logged but never halts the workflow.
+func (w *WHAM) recordRunPlan(sortedSteps, stepsToRun []*Step) {
+	run := w.activeRun
+	if run == nil {
+		return
+	}
+	selected := make(map[string]bool, len(stepsToRun))
+	for _, step := range stepsToRun {
+		selected[step.Name] = true
+	}
+	run.Plan = make([]PlannedRunStep, len(sortedSteps))
+	for i, step := range sortedSteps {
+		run.Plan[i] = PlannedRunStep{Name: step.Name, PreviousSteps: step.PreviousSteps, Selected: selected[step.Name]}
+	}
+	if err := w.saveWorkflowRun(run); err != nil {
+		w.logger.Warn().Str("workflow_run_id", run.ID).Err(err).Msg("Could not save workflow run record.")
+	}
+}
+
+// recordPlannedReason records, in the plan of the workflow run in progress, why
+// the run did not execute a step. It is saved with the outcome of the run.
+func (w *WHAM) recordPlannedReason(stepName, reason string) {
+	if w.activeRun == nil {
+		return
+	}
+	for i := range w.activeRun.Plan {
+		if w.activeRun.Plan[i].Name == stepName {
+			w.activeRun.Plan[i].Reason = reason
+		}
+	}
+}
+
+// finishWorkflowRun records the final outcome of a workflow run.
+func (w *WHAM) finishWorkflowRun(run *WorkflowRun, runErr error) {
+	run.FinishedAt = time.Now()
+	run.Elapsed = run.FinishedAt.Sub(run.StartedAt)
+	run.Status = "succeeded"
+	if runErr != nil {
+		run.Status = "failed"
+		run.Error = runErr.Error()
+	}
+	if err := w.saveWorkflowRun(run); err != nil {
+		w.logger.Warn().Str("workflow_run_id", run.ID).Err(err).Msg("Could not save workflow run record.")
+	}
+}
+
+// saveWorkflowRun writes a workflow run record to the runs directory as JSON.
+func (w *WHAM) saveWorkflowRun(run *WorkflowRun) error {
+	runsDir := w.getWorkflowRunsDir()
+	if err := os.MkdirAll(runsDir, 0755); err != nil {
+		return fmt.Errorf("failed to create workflow runs directory '%s': %w", runsDir, err)
+	}
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal workflow run '%s': %w", run.ID, err)
+	}
+	path := filepath.Join(runsDir, run.ID+".json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write workflow run file '%s': %w", path, err)
+	}
+	w.logger.Debug().Str("workflow_run_id", run.ID).Str("status", run.Status).Str("path", path).Msg("Workflow run record saved.")
+	return nil
+}
+
+// loadWorkflowRun reads the record of a historical workflow run by its ID.
+func (w *WHAM) loadWorkflowRun(runID string) (*WorkflowRun, error) {
+	// Reject anything that could escape the runs directory.
+	if runID == "" || strings.ContainsAny(runID, `/\`) || strings.HasPrefix(runID, ".") {
+		return nil, fmt.Errorf("invalid workflow run ID '%s'", runID)
+	}
+	path := filepath.Join(w.getWorkflowRunsDir(), runID+".json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("workflow run '%s' not found", runID)
+		}
+		return nil, fmt.Errorf("failed to read workflow run file '%s': %w", path, err)
+	}
+	var run WorkflowRun
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("failed to parse workflow run file '%s': %w", path, err)
+	}
+	return &run, nil
+}
+
+// loadLastFinishedWorkflowRun returns the most recent workflow run that is no
+// longer running, or nil if there is none.
+func (w *WHAM) loadLastFinishedWorkflowRun() (*WorkflowRun, error) {
+	runs, err := w.loadRecentFinishedWorkflowRuns(1)
+	if err != nil || len(runs) == 0 {
+		return nil, err
+	}
+	return runs[0], nil
+}
+
+// loadRecentFinishedWorkflowRuns returns up to `limit` of the most recent workflow
+// runs that are no longer running, most recent first.
+func (w *WHAM) loadRecentFinishedWorkflowRuns(limit int) ([]*WorkflowRun, error) {
+	runsDir := w.getWorkflowRunsDir()
+	entries, err := os.ReadDir(runsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read workflow runs directory '%s': %w", runsDir, err)
+	}
+	var runs []*WorkflowRun
+	// Run IDs start with a timestamp, and os.ReadDir sorts entries by name.
+	for i := len(entries) - 1; i >= 0 && len(runs) < limit; i-- {
+		runID, ok := strings.CutSuffix(entries[i].Name(), ".json")
+		if !ok {
+			continue
+		}
+		run, err := w.loadWorkflowRun(runID)
+		if err != nil {
+			w.logger.Warn().Str("workflow_run_id", runID).Err(err).Msg("Could not load workflow run record.")
+			continue
+		}
+		if run.Status != "running" {
+			runs = append(runs, run)
+		}
+	}
+	return runs, nil
+}
+
+// runWorkflowHandler runs the `on_success` or `on_failure` handler of the settings
+// matching the outcome of a finished workflow run, if any.
+//
+// The handler runs in the config file's directory, with the environment of WHAM
+// and its templated `env_vars`. It also receives the outcome of the run in the
+// VAR_WORKFLOW_RUN_ID, VAR_WORKFLOW_STATUS, VAR_WORKFLOW_ERROR and VAR_WORKFLOW_ELAPSED
+// variables, and the path of a JSON file holding the execution summary (the state
+// of every step, as printed by `state get all -o json`) in VAR_SUMMARY_FILE.
+//
+// The handler runs even if the workflow run was aborted. Its failure is reported
+// but does not change the outcome of the run.
+func (w *WHAM) runWorkflowHandler(run *WorkflowRun) {
+	name, handler := "on_success", w.config.WhamSettings.OnSuccess
+	if run.Status == "failed" {
+		name, handler = "on_failure", w.config.WhamSettings.OnFailure
+	}
+	if handler == nil {
+		return
+	}
+	fmt.Printf("🔔 Running the %s handler of workflow run '%s'.\n", name, run.ID)
+	if err := w.executeWorkflowHandler(handler, run); err != nil {
+		fmt.Printf("⚠️ The %s handler failed: %v\n", name, err)
+		w.logger.Error().Str("workflow_run_id", run.ID).Str("handler", name).Err(err).Msg("Workflow handler failed.")
+		return
+	}
+	w.logger.Info().Str("workflow_run_id", run.ID).Str("handler", name).Msg("Workflow handler finished.")
+}
+
+// executeWorkflowHandler runs a workflow handler for a finished workflow run.
+// See runWorkflowHandler.
+func (w *WHAM) executeWorkflowHandler(handler *WorkflowHandler, run *WorkflowRun) error {
+	summaryFile, err := os.CreateTemp("", "wham_summary_*.json")
+	if err != nil {
+		return fmt.Errorf("failed to create summary file: %w", err)
+	}
+	defer os.Remove(summaryFile.Name())
+	err = RenderData(summaryFile, w.namedStepStates(), "json")
+	if closeErr := summaryFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write summary file '%s': %w", summaryFile.Name(), err)
+	}
+
+	executable, err := w.hookExecutable(handler.Command[0])
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if handler.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, handler.Timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, executable, handler.Command[1:]...)
+	cmd.Dir = w.config.ConfigDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("VAR_DATA_DIR=%s", w.config.WhamSettings.DataDir),
+		fmt.Sprintf("VAR_METADATA_DIR=%s", w.config.WhamSettings.MetadataDir),
+		fmt.Sprintf("VAR_WORKFLOW_RUN_ID=%s", run.ID),
+		fmt.Sprintf("VAR_WORKFLOW_STATUS=%s", run.Status),
+		fmt.Sprintf("VAR_WORKFLOW_ERROR=%s", run.Error),
+		fmt.Sprintf("VAR_WORKFLOW_ELAPSED=%s", run.Elapsed.Round(time.Millisecond)),
+		fmt.Sprintf("VAR_SUMMARY_FILE=%s", summaryFile.Name()),
+	)
+	templateContext := TemplateContext{Config: w.config, StepsMap: w.steps(), Workflow: run}
+	for k, v := range handler.EnvVars {
+		value, err := w.processTemplateString(v, templateContext)
+		if err != nil {
+			return fmt.Errorf("failed to process env var '%s': %w", k, err)
+		}
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, value))
+	}
+	w.logger.Debug().Str("workflow_run_id", run.ID).Str("command", cmd.String()).Msg("Running workflow handler.")
+	return cmd.Run()
+}
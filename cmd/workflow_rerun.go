@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+)
+
+// RerunWorkflow re-executes a historical workflow run with the same options it
+// was originally started with.
+//
+// Before executing, it compares the digest of the current configuration (and the
+// list of configuration files) against the ones recorded for the original run.
+// Any drift is reported as a warning, since the results may not be reproducible.
+// If `strict` is true, drift is treated as an error and nothing is executed.
+//
+// The new execution is recorded as a workflow run of its own, referencing the
+// original run through its `rerun_of` field.
+func (w *WHAM) RerunWorkflow(runID string, strict bool) error {
+	original, err := w.loadWorkflowRun(runID)
+	if err != nil {
+		return err
+	}
+
+	digest, err := w.configDigest()
+	if err != nil {
+		return err
+	}
+	var drift []string
+	if original.ConfigDigest != digest {
+		drift = append(drift, fmt.Sprintf("config digest changed from '%s' to '%s'", original.ConfigDigest, digest))
+	}
+	if !slices.Equal(original.ConfigFiles, w.config.ConfigFiles) {
+		drift = append(drift, fmt.Sprintf("config files changed from %v to %v", original.ConfigFiles, w.config.ConfigFiles))
+	}
+	for _, d := range drift {
+		if strict {
+			return fmt.Errorf("cannot reproduce workflow run '%s': %s", runID, d)
+		}
+		fmt.Printf("⚠️ Configuration drift since workflow run '%s': %s.\n", runID, d)
+		w.logger.Warn().Str("workflow_run_id", runID).Str("drift", d).Msg("Configuration drift detected.")
+	}
+
+	w.logger.Info().Str("workflow_run_id", runID).Interface("options", original.Options).Msg("Re-executing workflow run.")
+	opts := original.Options
+	opts.RerunOf = original.ID
+	return w.RunAllSteps(opts)
+}
@@ -0,0 +1,98 @@
+package cmd_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// findWorkflowRunIDs returns the IDs of the workflow runs recorded in the given runs directory.
+func findWorkflowRunIDs(t *testing.T, runsDir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(runsDir)
+	assert.NoError(t, err, "Should be able to read the workflow runs directory.")
+	var ids []string
+	for _, entry := range entries {
+		ids = append(ids, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	return ids
+}
+
+// TestRerun_ReproducesWorkflowRun verifies that `run all` records a workflow run
+// and that `rerun` re-executes it, recording a new run that references the original.
+func TestRerun_ReproducesWorkflowRun(t *testing.T) {
+	const configPath = "../test/settings/settings_ok.yaml"
+	const runsDir = "../test/states/metadata/wham_runs"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "run", "all", "--to", "stateless_sh_succeed")
+	assert.NoError(t, err, "The initial 'run all' should succeed.")
+
+	ids := findWorkflowRunIDs(t, runsDir)
+	assert.Len(t, ids, 1, "Exactly one workflow run should be recorded.")
+	assert.Contains(t, outputStr, "Starting workflow run '"+ids[0]+"'", "The workflow run ID should be printed.")
+
+	// The run record holds the plan resolved by the engine, including the steps left out by --to.
+	var record struct {
+		Plan []struct {
+			Name     string `json:"name"`
+			Selected bool   `json:"selected"`
+		} `json:"plan"`
+	}
+	data, err := os.ReadFile(filepath.Join(runsDir, ids[0]+".json"))
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(data, &record))
+	if assert.Len(t, record.Plan, 6, "Every step of the DAG should be in the plan.") {
+		assert.Equal(t, "stateful_sh_succeed", record.Plan[0].Name, "The plan should follow the topological order.")
+		selected := 0
+		for _, p := range record.Plan {
+			if p.Selected {
+				selected++
+			}
+		}
+		assert.Equal(t, 2, selected, "Only the steps selected by --to should be marked as selected.")
+	}
+
+	var states []TestStepState
+	outputStr, err = runWhamCommand(t, "--config", configPath, "rerun", ids[0], "-o", "json")
+	assert.NoError(t, err, "The rerun should succeed.")
+	assert.NotContains(t, outputStr, "Configuration drift", "No drift should be reported for an unchanged config.")
+	findAndUnmarshalRunSummary(t, outputStr, &states)
+
+	// The original --to option must be honored: only the two requested steps ran.
+	ran := 0
+	for _, s := range states {
+		if s.RunAction != "" && s.Reason != "filtered_by_from_to" {
+			ran++
+		}
+	}
+	assert.Equal(t, 2, ran, "Only the steps selected by the original run should have been executed.")
+
+	originalID := ids[0]
+	ids = findWorkflowRunIDs(t, runsDir)
+	assert.Len(t, ids, 2, "The rerun should be recorded as a new workflow run.")
+	rerunID := ids[0]
+	if rerunID == originalID {
+		rerunID = ids[1]
+	}
+	data, err = os.ReadFile(filepath.Join(runsDir, rerunID+".json"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"rerun_of": "`+originalID+`"`, "The new run should reference the original run.")
+}
+
+// TestRerun_FailUnknownRun verifies that rerunning a non-existent workflow run fails.
+func TestRerun_FailUnknownRun(t *testing.T) {
+	const configPath = "../test/settings/settings_ok.yaml"
+	cleanTestStates(t, configPath)
+	t.Cleanup(func() { cleanTestStates(t, configPath) })
+
+	outputStr, err := runWhamCommand(t, "--config", configPath, "rerun", "does-not-exist")
+
+	assert.Error(t, err, "The command should fail with an error exit code.")
+	assert.Contains(t, outputStr, "workflow run 'does-not-exist' not found")
+}
@@ -41,18 +41,88 @@ func main() {
 	log.SetFlags(0)
 	log.SetOutput(logger)
 
-	// Load WHAM configuration.
-	config, err := cmd.LoadConfig(cli.Config...)
+	// The 'operator' and 'fleet status' commands load the configurations of the
+	// workflows they manage, rather than the one given on the command line, and
+	// 'state-helper write' is called by scripts, which only know their environment.
+	// 'project list' only reads the projects registry.
+	if ctxKong.Command() == "operator" || ctxKong.Command() == "fleet status" || ctxKong.Command() == "state-helper write" || ctxKong.Command() == "project list" {
+		if err := ctxKong.Run(&cmd.Context{Logger: logger, OutputFormat: cli.Output, NonInteractive: cli.NonInteractive, ProjectsFile: cli.ProjectsFile}); err != nil {
+			logger.Fatal().Err(err).Msg("WHAM command failed.")
+		}
+		return
+	}
+
+	// With --project, the configuration files and the directories are those of the
+	// project in the projects registry. --data-dir and --metadata-dir still win.
+	if cli.Project != "" {
+		if len(cli.Config) > 0 {
+			logger.Fatal().Msg("--project and --config cannot be combined.")
+		}
+		registry, err := cmd.LoadProjectRegistry(cli.ProjectsFile)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to load projects registry.")
+		}
+		project, err := registry.Project(cli.Project)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to select project.")
+		}
+		cli.Config = project.Config
+		if cli.DataDir == "" {
+			cli.DataDir = project.DataDir
+		}
+		if cli.MetadataDir == "" {
+			cli.MetadataDir = project.MetadataDir
+		}
+		logger.Debug().Str("project", cli.Project).Str("registry", registry.Path).Msg("Project selected.")
+	}
+
+	// Load WHAM configuration. --config and WHAM_CONFIG take precedence over the
+	// files discovered in the working directory and the standard locations.
+	if len(cli.Config) == 0 {
+		configPath, err := cmd.DiscoverConfig()
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to locate WHAM configuration.")
+		}
+		cli.Config = []string{configPath}
+	}
+	// With --config-cache, a configuration parsed by a previous invocation is reused.
+	var config *cmd.Config
+	var err error
+	if cli.ConfigCache {
+		var cached bool
+		config, cached, err = cmd.LoadCachedConfig(cli.MetadataDir, cli.Config...)
+		logger.Debug().Bool("hit", cached).Strs("config_paths", cli.Config).Msg("Config cache looked up.")
+	} else {
+		config, err = cmd.LoadConfig(cli.Config...)
+	}
 	if err != nil {
 		logger.Fatal().Err(err).Strs("config_paths", cli.Config).Msg("Failed to load WHAM configuration.")
 	}
 
+	// The directories given on the command line take precedence over the configuration.
+	// Kong has already made them absolute, relative to the working directory.
+	if cli.DataDir != "" {
+		config.WhamSettings.DataDir = cli.DataDir
+	}
+	if cli.MetadataDir != "" {
+		config.WhamSettings.MetadataDir = cli.MetadataDir
+	}
+
 	// Create the WHAM instance.
 	wham, err := cmd.NewWHAM(config, logger)
 	if err != nil {
 		logger.Fatal().Err(err).Msg("Failed to initialize WHAM engine.")
 	}
 
+	// With --ephemeral-state, all state lives in a temporary directory removed at exit.
+	cleanupState := func() {}
+	if cli.EphemeralState {
+		cleanupState, err = wham.UseEphemeralState()
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to set up ephemeral state.")
+		}
+	}
+
 	// Create the data and metadata directories if they do not exist.
 	// This is done after the WHAM instance is created because NewWHAM resolves
 	// the directory paths to be absolute, ensuring they are created in the correct location.
@@ -65,13 +135,17 @@ func main() {
 
 	// Create the context to be passed to the CLI command handlers.
 	cmdCtx := &cmd.Context{
-		WHAM:         wham,
-		Logger:       logger,
-		OutputFormat: cli.Output, // Pass the global output format to the context.
+		WHAM:           wham,
+		Logger:         logger,
+		OutputFormat:   cli.Output, // Pass the global output format to the context.
+		NonInteractive: cli.NonInteractive,
+		ProjectsFile:   cli.ProjectsFile,
 	}
 
 	// Run the selected command.
 	err = ctxKong.Run(cmdCtx)
+	// Clean up before exiting, as a fatal log message exits without running deferred calls.
+	cleanupState()
 	if err != nil {
 		logger.Fatal().Err(err).Msg("WHAM command failed.")
 	}
@@ -0,0 +1,8 @@
+#!/usr/bin/env bash
+
+# Simulates a data quality query (e.g. `psql -tAc "select count(*) ..."`):
+# prints some diagnostics, then the observed value on the last line.
+set -euo pipefail
+
+printf "### RUNNING CHECK QUERY ###\n"
+printf "%s\n" "${CHECK_VALUE-}"
@@ -0,0 +1,38 @@
+#!/usr/bin/env bash
+
+# Fakes a dbt invocation: writes a minimal target/run_results.json in the
+# directory given by --project-dir. Models listed in FAIL_MODELS are reported
+# as errors and make the invocation exit with a non-zero code.
+set -euo pipefail
+
+printf "### FAKE DBT ARGS: %s ###\n" "$*"
+
+PROJECT_DIR="."
+while [[ $# -gt 0 ]]; do
+    if [[ "$1" == "--project-dir" ]]; then
+        PROJECT_DIR="$2"
+        shift
+    fi
+    shift
+done
+
+FAIL_MODELS="${FAIL_MODELS-}"
+INVOCATION_ID="${INVOCATION_ID:-$(date +%s%N)}"
+
+results=""
+exit_code=0
+for model in model.demo.orders model.demo.customers; do
+    status="success"
+    if [[ " ${FAIL_MODELS} " == *" ${model} "* ]]; then
+        status="error"
+        exit_code=1
+    fi
+    results="${results:+${results},}{\"unique_id\": \"${model}\", \"status\": \"${status}\"}"
+done
+
+mkdir -p "${PROJECT_DIR}/target"
+cat << EOF_JSON > "${PROJECT_DIR}/target/run_results.json"
+{"metadata": {"invocation_id": "${INVOCATION_ID}"}, "results": [${results}]}
+EOF_JSON
+
+exit $exit_code
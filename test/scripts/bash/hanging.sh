@@ -0,0 +1,9 @@
+#!/usr/bin/env bash
+
+# Simulates a hung script: spawns a background child, records its PID in the
+# metadata directory and never finishes on its own.
+set -euo pipefail
+
+sleep 30 &
+echo "$!" > "${VAR_METADATA_DIR}/hanging_child.pid"
+sleep 30
@@ -0,0 +1,9 @@
+#!/usr/bin/env bash
+
+# Simulates a script managing several datasets: writes one state file per
+# "<file>=<run_id>" pair of STATE_RUN_IDS into the metadata directory.
+set -euo pipefail
+
+for pair in ${STATE_RUN_IDS-}; do
+    printf "run_id=%s\n" "${pair#*=}" > "${VAR_METADATA_DIR}/${pair%%=*}"
+done
@@ -73,10 +73,17 @@ elif [[ "$EXIT_STATUS" == "random" ]]; then
     exit_code="$((0 + RANDOM % 2))" # <- randomly succeed or fail
 elif [[ "$EXIT_STATUS" == "fail" ]]; then
     exit_code=1 # <- failure completion
+elif [[ "$EXIT_STATUS" =~ ^[0-9]+$ ]]; then
+    exit_code="$EXIT_STATUS" # <- explicit exit code
 fi
 
-# 4 - Stateless: do not write state file
-# EMPTY
+# 4 - Stateless: do not write state file, but report outputs if requested (e.g. OUTPUTS="rows_processed=10 bytes_written=2048")
+if [[ -n "${OUTPUTS-}" && -n "${VAR_OUTPUT_FILE-}" ]]; then
+    printf "${LB}REPORTING OUTPUTS TO '${LG}${VAR_OUTPUT_FILE}${LB}'...${NC}\n"
+    for output in ${OUTPUTS}; do
+        echo "${output}" >> "${VAR_OUTPUT_FILE}"
+    done
+fi
 
 # 5 - Exit after completion
 printf "${LB}### EXITING WITH EXIT CODE ${LG}${exit_code}${LB} ###${NC}\n"
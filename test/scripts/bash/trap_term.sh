@@ -0,0 +1,12 @@
+#!/usr/bin/env bash
+
+# Simulates a long-running script that cleans up when it is terminated: it records
+# the signal it received in the metadata directory before exiting.
+set -euo pipefail
+
+trap 'echo "TERM" > "${VAR_METADATA_DIR}/trap_term.marker"; exit 143' TERM
+trap 'echo "INT" > "${VAR_METADATA_DIR}/trap_term.marker"; exit 130' INT
+
+echo "$$" > "${VAR_METADATA_DIR}/trap_term.pid"
+sleep 30 &
+wait $!
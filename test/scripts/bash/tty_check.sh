@@ -0,0 +1,11 @@
+#!/usr/bin/env bash
+
+# Reports whether the script's standard input and output are terminals.
+set -euo pipefail
+
+is_tty=false
+if [[ -t 0 && -t 1 ]]; then
+    is_tty=true
+fi
+echo "Running with a terminal: ${is_tty}"
+echo "is_tty=${is_tty}" >> "${VAR_OUTPUT_FILE}"